@@ -6,20 +6,18 @@ All rights reserved.
 package main
 
 import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/logquery"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/secretstore"
 	"PAN_ENGINE/utils"
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
 	"encoding/csv"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
 	"io/ioutil"
-	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -29,7 +27,6 @@ import (
 	"time"
 
 	"github.com/go-pdf/fpdf"
-	"github.com/google/uuid"
 	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
@@ -44,31 +41,86 @@ type App struct {
 	// Added fields for report customization
 	maxRows      int
 	reportFormat string
+	// Memory caps for large datasets: the largest response read and how
+	// many rows a report keeps in memory before spilling to disk
+	maxResponseMB int
+	spillRows     int
 	// For caching/tracking API health
 	apiStatus    string
 	lastAPICheck time.Time
+	// Shared API client, rebuilt whenever the URL or key changes
+	client   *panclient.Client
+	clientMu sync.Mutex
+	// Last "show system info" result for the connected device, with the
+	// parsed version and the REST API version selected for it
+	deviceInfo     *panclient.SystemInfo
+	deviceVersion  *panclient.Version
+	restAPIVersion string
+	// Time zone of the device clock, used for log date ranges
+	deviceLocation *time.Location
+	// Cancel functions for running log reports, by report type
+	running   map[string]context.CancelFunc
+	runningMu sync.Mutex
+	// Saved connection profiles and the one currently in use. profilesMu
+	// guards them and keyRotation: changes hold it for writing so the key
+	// rotation watcher can read them in the background.
+	profiles      []ConnectionProfile
+	activeProfile string
+	profilesMu    sync.RWMutex
+	// Where API keys are kept: the OS keyring or the file vault
+	secrets secretstore.Store
+	vault   *secretstore.Vault
+	// How often saved keys should be replaced
+	keyRotation KeyRotationPolicy
+	// Profile that produced each stored report, by report type
+	reportProfiles map[string]string
+	reportMu       sync.Mutex
+	// Imported devices, reached with the credentials of a profile
+	inventory Inventory
+	// Saved report schedules
+	schedules []ScheduledReport
+	// Report types, from the built-in catalog, the user's overrides and
+	// the custom reports defined in the app
+	catalog       *catalog.Catalog
+	catalogMu     sync.RWMutex
+	customReports []catalog.Report
+	// Op commands run from the console
+	opHistory   []opHistoryEntry
+	opHistoryMu sync.Mutex
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{
-		reportData:   make(map[string]interface{}),
-		settingsPath: "settings.json",
-		maxRows:      1000, // Increased from default 100
-		reportFormat: "standard",
-		apiStatus:    "unknown",
+		reportData:     make(map[string]interface{}),
+		running:        make(map[string]context.CancelFunc),
+		reportProfiles: make(map[string]string),
+		settingsPath:   "settings.json",
+		maxRows:        1000, // Increased from default 100
+		reportFormat:   "standard",
+		apiStatus:      "unknown",
+		catalog:        catalog.Default(),
 	}
 }
 
 // Settings structure for persistent storage
 type Settings struct {
-	APIURL        string `json:"api_url"`
-	EncryptedKey  string `json:"encrypted_key"`
-	MaxRows       int    `json:"max_rows"`
-	ReportFormat  string `json:"report_format"`
-	Theme         string `json:"theme"`
-	DateFormat    string `json:"date_format"`
-	DefaultFolder string `json:"default_folder"`
+	// APIURL and EncryptedKey are only read from settings files written
+	// before connection profiles existed
+	APIURL       string `json:"api_url,omitempty"`
+	EncryptedKey string `json:"encrypted_key,omitempty"`
+	// SecretBackend is where API keys are kept: "keyring" or "vault"
+	SecretBackend string              `json:"secret_backend,omitempty"`
+	KeyRotation   KeyRotationPolicy   `json:"key_rotation"`
+	Profiles      []ConnectionProfile `json:"profiles"`
+	ActiveProfile string              `json:"active_profile"`
+	MaxRows       int                 `json:"max_rows"`
+	ReportFormat  string              `json:"report_format"`
+	MaxResponseMB int                 `json:"max_response_mb,omitempty"`
+	SpillRows     int                 `json:"spill_rows,omitempty"`
+	Theme         string              `json:"theme"`
+	DateFormat    string              `json:"date_format"`
+	DefaultFolder string              `json:"default_folder"`
 }
 
 // startup is called when the app starts. The context is saved
@@ -92,6 +144,25 @@ func (a *App) startup(ctx context.Context) {
 	if err := a.loadSettings(); err != nil {
 		utils.InfoLogger.Printf("Could not load settings: %v. Using defaults.", err)
 	}
+	if err := a.loadCustomReports(); err != nil {
+		utils.ErrorLogger.Printf("Could not load custom reports: %v", err)
+	}
+	if err := a.loadCatalog(); err != nil {
+		utils.ErrorLogger.Printf("Could not load report catalog overrides: %v", err)
+	}
+	if err := a.loadOpHistory(); err != nil {
+		utils.ErrorLogger.Printf("Could not load op command history: %v", err)
+	}
+	if err := a.loadInventory(); err != nil {
+		utils.ErrorLogger.Printf("Could not load inventory: %v", err)
+	}
+	if err := a.loadSchedules(); err != nil {
+		utils.ErrorLogger.Printf("Could not load schedules: %v", err)
+	}
+
+	// Remind about keys due for rotation now and while the app runs
+	a.checkKeyRotation()
+	go a.watchKeyRotation(ctx)
 
 	utils.InfoLogger.Println("Application started successfully")
 }
@@ -114,42 +185,61 @@ func (a *App) loadSettings() error {
 	if err := json.Unmarshal(data, &settings); err != nil {
 		return err
 	}
-
-	// Apply the settings
-	a.apiURL = settings.APIURL
-	if settings.EncryptedKey != "" {
-		// Decrypt API key - handled by a separate helper function
-		decryptedKey, err := a.decryptAPIKey(settings.EncryptedKey)
-		if err == nil {
-			a.apiKey = decryptedKey
-		}
-	}
+	a.checkSettingsPermissions()
 
 	if settings.MaxRows > 0 {
 		a.maxRows = settings.MaxRows
 	}
-
 	if settings.ReportFormat != "" {
 		a.reportFormat = settings.ReportFormat
 	}
+	a.maxResponseMB = settings.MaxResponseMB
+	a.spillRows = settings.SpillRows
+	a.profilesMu.Lock()
+	a.keyRotation = settings.KeyRotation
+	a.profilesMu.Unlock()
+
+	// Apply the settings, loading the URL and key of the active profile
+	// from the secret store
+	a.initSecretStore(settings.SecretBackend)
+	a.loadProfiles(settings)
+
+	// Keys written by older releases move into the secret store
+	if a.migrateLegacyKeys() {
+		a.loadProfiles(Settings{Profiles: a.profiles, ActiveProfile: a.activeProfile})
+		if err := a.saveSettings(); err != nil {
+			utils.ErrorLogger.Printf("Failed to save migrated settings: %v", err)
+		}
+	}
+	a.notifyVaultLocked()
 
 	return nil
 }
 
 // saveSettings saves current settings to the settings file
 func (a *App) saveSettings() error {
-	// Encrypt the API key
-	encryptedKey, err := a.encryptAPIKey(a.apiKey)
-	if err != nil {
-		return fmt.Errorf("failed to encrypt API key: %v", err)
+	// Store the URL in the active profile; keys live in the secret store
+	if a.apiURL != "" || a.currentProfile() != nil {
+		a.storeActiveProfile()
 	}
 
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+
 	// Prepare settings struct
+	profiles := a.profiles
+	if profiles == nil {
+		profiles = []ConnectionProfile{}
+	}
 	settings := Settings{
-		APIURL:        a.apiURL,
-		EncryptedKey:  encryptedKey,
+		SecretBackend: a.secretStore().Name(),
+		KeyRotation:   a.keyRotation,
+		Profiles:      profiles,
+		ActiveProfile: a.activeProfile,
 		MaxRows:       a.maxRows,
 		ReportFormat:  a.reportFormat,
+		MaxResponseMB: a.maxResponseMB,
+		SpillRows:     a.spillRows,
 		Theme:         "dark", // Default theme
 		DateFormat:    "YYYY-MM-DD",
 		DefaultFolder: "Reports",
@@ -161,117 +251,75 @@ func (a *App) saveSettings() error {
 		return fmt.Errorf("failed to marshal settings: %v", err)
 	}
 
-	// Write to file
-	if err := ioutil.WriteFile(a.settingsPath, data, 0644); err != nil {
+	// Write to file, readable only by the current user
+	if err := secretstore.WriteFilePrivate(a.settingsPath, data); err != nil {
 		return fmt.Errorf("failed to write settings file: %v", err)
 	}
 
 	return nil
 }
 
-// encryptAPIKey encrypts the API key for secure storage
-func (a *App) encryptAPIKey(key string) (string, error) {
-	if key == "" {
-		return "", nil
-	}
-
-	// Create a unique encryption key based on machine-specific information
-	// In a real implementation, you would use a more secure approach
-	encKey := sha256.Sum256([]byte("PAN_ENGINE_SECRET_KEY"))
-
-	block, err := aes.NewCipher(encKey[:])
-	if err != nil {
-		return "", err
+// SaveAPISettings saves API settings to the active profile and persists them.
+// The key is write-only: an empty key keeps the saved one, use ClearAPIKey
+// to remove it.
+func (a *App) SaveAPISettings(url, key string) (bool, error) {
+	a.apiURL = url
+	a.resetConnection()
+
+	// The key goes to the secret store, the profile only keeps a reference
+	p := a.storeActiveProfile()
+	if key != "" {
+		if err := a.setProfileKey(p, key); err != nil {
+			utils.ErrorLogger.Printf("Failed to save API key: %v", err)
+			return false, err
+		}
+		a.apiKey = key
 	}
+	utils.InfoLogger.Printf("API settings saved: profile=%s, URL=%s", a.activeProfileName(), url)
 
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
+	// Save to persistent storage
+	err := a.saveSettings()
 	if err != nil {
-		return "", err
-	}
-
-	// Create nonce
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return "", err
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
 	}
 
-	// Encrypt
-	ciphertext := gcm.Seal(nonce, nonce, []byte(key), nil)
-
-	// Return base64 encoded string
-	return base64.StdEncoding.EncodeToString(ciphertext), nil
+	return true, nil
 }
 
-// decryptAPIKey decrypts the API key from secure storage
-func (a *App) decryptAPIKey(encryptedKey string) (string, error) {
-	if encryptedKey == "" {
-		return "", nil
-	}
-
-	// Decode base64
-	data, err := base64.StdEncoding.DecodeString(encryptedKey)
-	if err != nil {
-		return "", err
-	}
-
-	// Create encryption key
-	encKey := sha256.Sum256([]byte("PAN_ENGINE_SECRET_KEY"))
-
-	block, err := aes.NewCipher(encKey[:])
-	if err != nil {
-		return "", err
-	}
-
-	// Create GCM
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+// ClearAPIKey removes the active profile's key from the secret store
+func (a *App) ClearAPIKey() (bool, error) {
+	p := a.currentProfile()
+	if p == nil {
+		return false, fmt.Errorf("no profile is active")
 	}
-
-	// Extract nonce
-	if len(data) < gcm.NonceSize() {
-		return "", errors.New("ciphertext too short")
-	}
-
-	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
-
-	// Decrypt
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
-	if err != nil {
-		return "", err
+	if err := a.setProfileKey(p, ""); err != nil {
+		return false, err
 	}
+	a.apiKey = ""
+	a.apiStatus = "unconfigured"
+	a.resetConnection()
 
-	return string(plaintext), nil
-}
-
-// SaveAPISettings saves API settings to the app and persists them
-func (a *App) SaveAPISettings(url, key string) (bool, error) {
-	a.apiURL = url
-	a.apiKey = key
-	utils.InfoLogger.Printf("API settings saved: URL=%s", url)
-
-	// Save to persistent storage
-	err := a.saveSettings()
-	if err != nil {
+	if err := a.saveSettings(); err != nil {
 		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
 		return false, err
 	}
-
-	// Reset API status
-	a.apiStatus = "unknown"
-	a.lastAPICheck = time.Time{}
-
+	utils.InfoLogger.Printf("API key cleared: profile=%s", p.Name)
 	return true, nil
 }
 
-// GetAPISettings returns the current API settings
-func (a *App) GetAPISettings() map[string]string {
-	return map[string]string{
-		"url":    a.apiURL,
-		"key":    a.apiKey,
-		"status": a.apiStatus,
+// GetAPISettings returns the current API settings. The key itself is never
+// returned, only whether one is set, its fingerprint, age and last validation.
+func (a *App) GetAPISettings() map[string]interface{} {
+	settings := map[string]interface{}{
+		"url":     a.apiURL,
+		"status":  a.apiStatus,
+		"profile": a.activeProfileName(),
 	}
+	for k, v := range a.keyStatus(a.currentProfile()) {
+		settings[k] = v
+	}
+	return settings
 }
 
 // SetReportConfig updates report generation configuration
@@ -293,11 +341,43 @@ func (a *App) SetReportConfig(maxRows int, format string) bool {
 	return true
 }
 
+// SetDataLimits sets the largest API response read, in megabytes, and how
+// many rows a report keeps in memory before spilling to disk. Zero restores
+// the default.
+func (a *App) SetDataLimits(maxResponseMB, spillRows int) (bool, error) {
+	if maxResponseMB < 0 || spillRows < 0 {
+		return false, fmt.Errorf("limits cannot be negative")
+	}
+	a.maxResponseMB = maxResponseMB
+	a.spillRows = spillRows
+	a.resetClient()
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save data limits: %v", err)
+		return false, err
+	}
+	return true, nil
+}
+
+// maxResponseSize returns the response size limit in bytes
+func (a *App) maxResponseSize() int64 {
+	if a.maxResponseMB > 0 {
+		return int64(a.maxResponseMB) << 20
+	}
+	return panclient.DefaultMaxResponseSize
+}
+
 // GetReportConfig returns the current report configuration
 func (a *App) GetReportConfig() map[string]interface{} {
+	spillRows := a.spillRows
+	if spillRows <= 0 {
+		spillRows = defaultSpillRows
+	}
 	return map[string]interface{}{
-		"maxRows": a.maxRows,
-		"format":  a.reportFormat,
+		"maxRows":       a.maxRows,
+		"format":        a.reportFormat,
+		"maxResponseMB": a.maxResponseSize() >> 20,
+		"spillRows":     spillRows,
 	}
 }
 
@@ -319,61 +399,190 @@ func (a *App) TestAPIConnection() map[string]interface{} {
 		}
 	}
 
-	// Try to call an API endpoint that should always be available
-	endpoint := "/api/?type=op&cmd=<show><s><info></info></s></show>"
-	_, err := a.callPaloAltoAPI(endpoint)
+	// Read the device version so reports can use the matching REST API
+	client, err := a.apiClient()
+	if err == nil {
+		var info *panclient.SystemInfo
+		info, err = client.SystemInfo(a.requestContext())
+		if err == nil {
+			err = a.setDeviceInfo(info)
+		}
+	}
 
 	a.lastAPICheck = time.Now()
 
 	if err != nil {
-		a.apiStatus = "error"
-		return map[string]interface{}{
-			"status":  "error",
-			"message": fmt.Sprintf("API connection failed: %v", err),
+		a.handleAuthFailure(err)
+		// A rejected key is flagged for re-login instead of a plain error
+		if !panclient.IsKind(err, panclient.KindAuth) {
+			a.apiStatus = "error"
+		}
+		result := apiErrorDetails(err)
+		result["status"] = "error"
+		result["message"] = fmt.Sprintf("API connection failed: %v", err)
+		if client != nil {
+			result["certificate"] = a.certificateDetails(client)
 		}
+		return result
 	}
 
 	a.apiStatus = "connected"
+	a.recordKeyValidation(nil)
 	return map[string]interface{}{
-		"status":  "success",
-		"message": "API connection successful",
+		"status":       "success",
+		"message":      "API connection successful",
+		"hostname":     a.deviceInfo.Hostname,
+		"model":        a.deviceInfo.Model,
+		"sw_version":   a.deviceInfo.SWVersion,
+		"rest_version": a.restVersion(),
+		"certificate":  a.certificateDetails(client),
 	}
 }
 
-// GenerateReport creates a report by calling the Palo Alto API
-func (a *App) GenerateReport(reportType, startDate, endDate string) (map[string]interface{}, error) {
-	utils.InfoLogger.Printf("Generating report: type=%s, start=%s, end=%s", reportType, startDate, endDate)
+// certificateDetails describes the certificate the device presents and how
+// it compares with the active profile's pins, for TestAPIConnection. It is
+// read even when verification fails so the reason can be shown.
+func (a *App) certificateDetails(client *panclient.Client) map[string]interface{} {
+	p := a.currentProfile()
+	details := map[string]interface{}{
+		"insecure_skip_verify": p != nil && p.TLS.InsecureSkipVerify && len(p.TLS.PinnedSHA256) == 0,
+	}
+
+	info, err := client.InspectTLS(a.requestContext())
+	if err != nil {
+		details["error"] = err.Error()
+		return details
+	}
+
+	details["subject"] = info.Subject
+	details["issuer"] = info.Issuer
+	details["dns_names"] = info.DNSNames
+	details["not_before"] = info.NotBefore.Format(time.RFC3339)
+	details["not_after"] = info.NotAfter.Format(time.RFC3339)
+	details["expires_in_days"] = int(time.Until(info.NotAfter).Hours() / 24)
+	details["sha256"] = info.SHA256
+	details["tls_version"] = info.Version
+	details["ca_verified"] = info.Verified
+	details["ca_error"] = info.VerifyError
+
+	// pin_match is only reported when the profile pins a certificate
+	if p != nil && len(p.TLS.PinnedSHA256) > 0 {
+		details["pin_match"] = panclient.MatchPin(info.SHA256, p.TLS.PinnedSHA256)
+	}
+	return details
+}
+
+// GenerateReport creates a report by calling the Palo Alto API. Options carry
+// the REST scope using the PAN-OS parameter names: location, vsys,
+// device-group, template, template-stack and name. Log reports also accept
+// nlogs and query, a filter in PAN-OS log filter syntax. On Panorama, target
+// runs the report on a managed firewall serial, or on every connected
+// firewall when set to "all"; the rows then come in "result" with the
+// status of each firewall in "devices". A target of "tag:<tag>" or
+// "site:<site>" runs the report on an inventory group instead and returns
+// the fleet result.
+func (a *App) GenerateReport(reportType, startDate, endDate string, options map[string]string) (interface{}, error) {
+	if target := strings.TrimSpace(options["target"]); isGroupSelector(target) {
+		return a.generateGroupReport(reportType, target, startDate, endDate, options)
+	}
+
+	utils.InfoLogger.Printf("Generating report: type=%s, profile=%s, start=%s, end=%s", reportType, a.activeProfileName(), startDate, endDate)
 
 	if a.apiURL == "" || a.apiKey == "" {
 		return nil, fmt.Errorf("API URL and Key must be configured first")
 	}
 
 	// Find the endpoint for the given report type
-	endpoint := a.getEndpointForReportType(reportType)
-	if endpoint == "" {
+	report, ok := a.reportCatalog().Get(reportType)
+	if !ok {
 		return nil, fmt.Errorf("unknown report type: %s", reportType)
 	}
+	endpoint := report.EndpointFor(a.restVersion())
 
-	// Add date range parameters if needed
-	if startDate != "" && endDate != "" {
-		if strings.Contains(endpoint, "?") {
-			endpoint += "&"
-		} else {
-			endpoint += "?"
+	if supported, reason := reportSupportedOn(report, a.deviceVersion, a.restAPIVersion); !supported {
+		return nil, fmt.Errorf("report type %s is unsupported: %s", reportType, reason)
+	}
+
+	// Apply the scope to every REST collection
+	if report.Scoped() {
+		scope, err := a.scopeFromOptions(a.withDefaultScope(options))
+		if err != nil {
+			return nil, err
+		}
+		utils.InfoLogger.Printf("Report %s scope: %s", reportType, scope)
+		endpoint = withQuery(endpoint, scope.Query())
+	}
+
+	logType := logTypeForEndpoint(endpoint)
+	if err := checkReportOptions(reportType, logType, startDate, endDate, options); err != nil {
+		return nil, err
+	}
+
+	// Log reports are filtered server-side and limited to a date range
+	query := ""
+	limit := 0
+	if logType != "" {
+		var err error
+		if limit, err = a.logLimit(options); err != nil {
+			return nil, err
+		}
+
+		// Reject malformed filters before they reach the firewall
+		filter, err := logFilter(logType, options)
+		if err != nil {
+			return nil, err
+		}
+
+		// Dates are interpreted in the device's time zone
+		timeRange, err := panclient.TimeRangeQuery(startDate, endDate, a.deviceTimezone())
+		if err != nil {
+			return nil, err
 		}
-		endpoint += fmt.Sprintf("start-time=%s&end-time=%s", startDate, endDate)
+
+		query = logquery.Combine(filter, timeRange)
 	}
 
-	// Call the API
-	data, err := a.callPaloAltoAPI(endpoint)
+	client, err := a.apiClient()
 	if err != nil {
 		return nil, err
 	}
 
-	// Store the data for export later
-	a.reportData[reportType] = data
+	ctx, done := a.startReport(reportType)
+	defer done()
 
-	return data, nil
+	// A target proxies the report through Panorama to managed firewalls
+	var data interface{}
+	var devices []map[string]interface{}
+	if target := strings.TrimSpace(options["target"]); target != "" {
+		var rows *rowSet
+		if rows, devices, err = a.fetchTargetedReport(ctx, client, target, endpoint, report, logType, query, limit); err == nil {
+			data = rows
+		}
+	} else {
+		data, err = a.fetchReport(ctx, client, endpoint, report, logType, query, limit)
+	}
+	if err != nil {
+		if ctx.Err() == context.Canceled {
+			return nil, fmt.Errorf("%s report cancelled", reportType)
+		}
+		a.handleAuthFailure(err)
+		utils.ErrorLogger.Printf("Report %s failed: %v", reportType, err)
+		return nil, operatorError(err)
+	}
+
+	// Store the data for export later, reading it back for the frontend
+	// before a newer run can replace it
+	a.reportMu.Lock()
+	a.storeReportData(reportType, data)
+	a.reportProfiles[reportType] = a.activeProfileName()
+	release := acquireData(data)
+	a.reportMu.Unlock()
+	defer release()
+
+	if devices != nil {
+		return targetedReportView(reportType, data, devices), nil
+	}
+	return reportView(data), nil
 }
 
 // ExportToCSV exports the current report data to a CSV file
@@ -381,7 +590,8 @@ func (a *App) ExportToCSV(reportType string) (string, error) {
 	utils.InfoLogger.Printf("Exporting to CSV: type=%s", reportType)
 
 	// Check if we have data for this report
-	data, ok := a.reportData[reportType]
+	data, release, ok := a.acquireReportData(reportType)
+	defer release()
 	if !ok {
 		return "", fmt.Errorf("no data available for report type: %s", reportType)
 	}
@@ -392,9 +602,11 @@ func (a *App) ExportToCSV(reportType string) (string, error) {
 	filepath := filepath.Join("Reports", filename)
 
 	// Generate CSV
-	if err := a.generateCSV(data, filepath); err != nil {
+	profile := a.reportProfile(reportType)
+	if err := a.generateCSV(data, reportType, profile, filepath); err != nil {
 		return "", err
 	}
+	a.recordExport(filepath, reportType, "csv", profile)
 
 	utils.InfoLogger.Printf("CSV exported successfully: %s", filepath)
 	return filepath, nil
@@ -405,7 +617,8 @@ func (a *App) ExportToPDF(reportType string) (string, error) {
 	utils.InfoLogger.Printf("Exporting to PDF: type=%s", reportType)
 
 	// Check if we have data for this report
-	data, ok := a.reportData[reportType]
+	data, release, ok := a.acquireReportData(reportType)
+	defer release()
 	if !ok {
 		return "", fmt.Errorf("no data available for report type: %s", reportType)
 	}
@@ -416,9 +629,11 @@ func (a *App) ExportToPDF(reportType string) (string, error) {
 	filepath := filepath.Join("Reports", filename)
 
 	// Generate PDF
-	if err := a.generatePDF(data, reportType, filepath); err != nil {
+	profile := a.reportProfile(reportType)
+	if err := a.generatePDF(data, reportType, profile, filepath); err != nil {
 		return "", err
 	}
+	a.recordExport(filepath, reportType, "pdf", profile)
 
 	utils.InfoLogger.Printf("PDF exported successfully: %s", filepath)
 	return filepath, nil
@@ -495,146 +710,194 @@ func (a *App) DeleteReport(path string) error {
 
 // Helper functions
 
-// getEndpointForReportType maps report types to API endpoints
-func (a *App) getEndpointForReportType(reportType string) string {
-	endpoints := map[string]string{
-		// Objects
-		"applications":  "/restapi/v11.0/Objects/Applications",
-		"appGroups":     "/restapi/v11.0/Objects/ApplicationGroups",
-		"appFilters":    "/restapi/v11.0/Objects/ApplicationFilters",
-		"services":      "/restapi/v11.0/Objects/Services",
-		"serviceGroups": "/restapi/v11.0/Objects/ServiceGroups",
-		"tags":          "/restapi/v11.0/Objects/Tags",
-		"hipObjects":    "/restapi/v11.0/Objects/GlobalProtectHIPObjects",
-		"hipProfiles":   "/restapi/v11.0/Objects/GlobalProtectHIPProfiles",
-		"edl":           "/restapi/v11.0/Objects/ExternalDynamicLists",
-		"dataPatterns":  "/restapi/v11.0/Objects/CustomDataPatterns",
-		"spywareSigs":   "/restapi/v11.0/Objects/CustomSpywareSignatures",
-		"vulnSigs":      "/restapi/v11.0/Objects/CustomVulnerabilitySignatures",
-		"urlCategories": "/restapi/v11.0/Objects/CustomURLCategories",
-
-		// Security Profiles
-		"antivirusProfiles":      "/restapi/v11.0/Objects/AntivirusSecurityProfiles",
-		"antispywareProfiles":    "/restapi/v11.0/Objects/AntiSpywareSecurityProfiles",
-		"vulnProtectionProfiles": "/restapi/v11.0/Objects/VulnerabilityProtectionSecurityProfiles",
-		"urlFilteringProfiles":   "/restapi/v11.0/Objects/URLFilteringSecurityProfiles",
-		"fileBlockingProfiles":   "/restapi/v11.0/Objects/FileBlockingSecurityProfiles",
-		"wildfireProfiles":       "/restapi/v11.0/Objects/WildFireAnalysisSecurityProfiles",
-		"dataFilteringProfiles":  "/restapi/v11.0/Objects/DataFilteringSecurityProfiles",
-		"dosProtectionProfiles":  "/restapi/v11.0/Objects/DoSProtectionSecurityProfiles",
-		"securityProfileGroups":  "/restapi/v11.0/Objects/SecurityProfileGroups",
-
-		// Policies
-		"securityRules":         "/restapi/v11.0/Policies/SecurityRules",
-		"natRules":              "/restapi/v11.0/Policies/NATRules",
-		"qosRules":              "/restapi/v11.0/Policies/QoSRules",
-		"pbfRules":              "/restapi/v11.0/Policies/PolicyBasedForwardingRules",
-		"decryptionRules":       "/restapi/v11.0/Policies/DecryptionRules",
-		"packetBrokerRules":     "/restapi/v11.0/Policies/NetworkPacketBrokerRules",
-		"tunnelInspectionRules": "/restapi/v11.0/Policies/TunnelInspectionRules",
-		"appOverrideRules":      "/restapi/v11.0/Policies/ApplicationOverrideRules",
-		"authRules":             "/restapi/v11.0/Policies/AuthenticationRules",
-		"dosRules":              "/restapi/v11.0/Policies/DoSRules",
-		"sdwanRules":            "/restapi/v11.0/Policies/SDWANRules",
-
-		// Network
-		"ethernetInterfaces": "/restapi/v11.0/Network/EthernetInterfaces",
-		"aeInterfaces":       "/restapi/v11.0/Network/AggregateEthernetInterfaces",
-		"vlanInterfaces":     "/restapi/v11.0/Network/VLANInterfaces",
-		"loopbackInterfaces": "/restapi/v11.0/Network/LoopbackInterfaces",
-		"tunnelInterfaces":   "/restapi/v11.0/Network/TunnelIntefaces",
-		"sdwanInterfaces":    "/restapi/v11.0/Network/SDWANInterfaces",
-		"zones":              "/restapi/v11.0/Network/Zones",
-		"vlans":              "/restapi/v11.0/Network/VLANs",
-		"virtualWires":       "/restapi/v11.0/Network/VirtualWires",
-		"virtualRouters":     "/restapi/v11.0/Network/VirtualRouters",
-
-		// GlobalProtect
-		"gpPortals":             "/restapi/v11.0/Network/GlobalProtectPortals",
-		"gpGateways":            "/restapi/v11.0/Network/GlobalProtectGateways",
-		"gpAgentTunnels":        "/restapi/v11.0/Network/GlobalProtectGatewayAgentTunnels",
-		"gpSatelliteTunnels":    "/restapi/v11.0/Network/GlobalProtectGatewaySatelliteTunnels",
-		"gpMdmServers":          "/restapi/v11.0/Network/GlobalProtectGatewayMDMServers",
-		"gpClientlessApps":      "/restapi/v11.0/Network/GlobalProtectClientlessApps",
-		"gpClientlessAppGroups": "/restapi/v11.0/Network/GlobalProtectClientlessAppGroups",
-
-		// Logs
-		"traffic":     "/restapi/v11.0/Objects/TrafficLogs",
-		"threat":      "/restapi/v11.0/Objects/ThreatLogs",
-		"url":         "/restapi/v11.0/Objects/URLFilteringLogs",
-		"data":        "/restapi/v11.0/Objects/DataFilteringLogs",
-		"wildfire":    "/restapi/v11.0/Objects/WildFireLogs",
-		"auth":        "/restapi/v11.0/Objects/AuthenticationLogs",
-		"system":      "/restapi/v11.0/Objects/SystemLogs",
-		"config":      "/restapi/v11.0/Objects/ConfigLogs",
-		"correlation": "/restapi/v11.0/Objects/CorrelationLogs",
-
-		// Legacy XML API endpoints
-		"systemInfo":      "/api/?type=op&cmd=<show><s><info></info></s></show>",
-		"interfaceInfo":   "/api/?type=op&cmd=<show><interface>all</interface></show>",
-		"systemResources": "/api/?type=op&cmd=<show><s><resources></resources></s></show>",
-		"gpUsers":         "/api/?type=op&cmd=<show><global-protect-gateway><current-user></current-user></global-protect-gateway></show>",
-		"activeSessions":  "/api/?type=op&cmd=<show><session><all></all></session></show>",
-		"softwareVersion": "/api/?type=op&cmd=<show><s><software></software></s></show>",
-	}
-
-	return endpoints[reportType]
-}
+// apiClient returns the shared API client, creating it on first use
+func (a *App) apiClient() (*panclient.Client, error) {
+	a.clientMu.Lock()
+	defer a.clientMu.Unlock()
+
+	if a.client != nil {
+		return a.client, nil
+	}
 
-// callPaloAltoAPI makes HTTP request to Palo Alto API
-func (a *App) callPaloAltoAPI(endpoint string) (map[string]interface{}, error) {
-	// Construct full URL
-	fullURL := fmt.Sprintf("%s%s", a.apiURL, endpoint)
-	utils.InfoLogger.Printf("Calling API: %s", fullURL)
+	opts, err := a.clientOptions()
+	if err != nil {
+		return nil, err
+	}
 
-	// Create request
-	req, err := http.NewRequest("GET", fullURL, nil)
+	client, err := panclient.New(a.apiURL, a.apiKey, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("error creating request: %v", err)
+		return nil, err
+	}
+
+	a.client = client
+	return client, nil
+}
+
+// resetClient drops the shared API client so the next call picks up new settings
+func (a *App) resetClient() {
+	a.clientMu.Lock()
+	defer a.clientMu.Unlock()
+
+	if a.client != nil {
+		a.client.Close()
+		a.client = nil
+	}
+}
+
+// requestContext returns the context API calls should run under
+func (a *App) requestContext() context.Context {
+	if a.ctx != nil {
+		return a.ctx
 	}
+	return context.Background()
+}
 
-	// Add headers
-	req.Header.Add("X-PAN-KEY", a.apiKey)
-	req.Header.Add("Content-Type", "application/json")
+// callPaloAltoAPI sends a catalog report's endpoint through the given client.
+// Entries at the report's row path in XML and REST results are decoded as
+// they arrive into a rowSet, which spills to disk when a result is too large
+// to keep in memory, and pass through the report's column mappings.
+func (a *App) callPaloAltoAPI(ctx context.Context, client *panclient.Client, endpoint string, report catalog.Report) (interface{}, error) {
+	// Split the endpoint into its path and query parameters
+	parsed, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %v", endpoint, err)
+	}
 
-	// Make request
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Do(req)
+	var stream *panclient.RowStream
+	if strings.HasPrefix(parsed.Path, "/api") {
+		// Legacy XML API
+		stream, err = client.XMLRowsAt(ctx, parsed.Query(), report.RowPath)
+	} else {
+		// REST API
+		stream, err = client.RESTRowsAt(ctx, parsed.Path, parsed.Query(), report.RowPath)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error making request: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	// Check status code
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("API returned error status: %d", resp.StatusCode)
+	rows := a.newRowSet()
+	if err := rows.addStream(stream, report.MapRow); err != nil {
+		rows.close()
+		return nil, err
 	}
+	utils.InfoLogger.Printf("API response: %d rows", rows.len())
+	return rows, nil
+}
 
-	// Read response
-	body, err := io.ReadAll(resp.Body)
+// fetchReport retrieves one report's data through the given client, running
+// log reports as query jobs and everything else as a single call, and
+// normalizes it into rows
+func (a *App) fetchReport(ctx context.Context, client *panclient.Client, endpoint string, report catalog.Report, logType, query string, limit int) (interface{}, error) {
+	var data interface{}
+	var err error
+	if logType != "" {
+		data, err = a.fetchLogReport(ctx, client, logType, query, limit)
+	} else {
+		data, err = a.callPaloAltoAPI(ctx, client, endpoint, report)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("error reading response: %v", err)
+		return nil, err
 	}
+	return normalizeReportData(data), nil
+}
 
-	// Parse JSON response
-	var result map[string]interface{}
-	if err := json.Unmarshal(body, &result); err != nil {
-		// Try to parse as XML API response (legacy format)
-		if strings.Contains(string(body), "<response") {
-			// Convert XML to JSON for consistent handling (simplified for this example)
-			result = map[string]interface{}{
-				"result": string(body),
-			}
-			return result, nil
-		}
-		return nil, fmt.Errorf("error parsing response: %v", err)
+// startReport returns a context for a running report that CancelReport can
+// stop, and a function to call when the report is done
+func (a *App) startReport(reportType string) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(a.requestContext())
+
+	a.runningMu.Lock()
+	a.running[reportType] = cancel
+	a.runningMu.Unlock()
+
+	return ctx, func() {
+		a.runningMu.Lock()
+		delete(a.running, reportType)
+		a.runningMu.Unlock()
+		cancel()
 	}
+}
+
+// CancelReport stops a running report, including any log query jobs it
+// started. It returns false if no report of that type is running.
+func (a *App) CancelReport(reportType string) bool {
+	a.runningMu.Lock()
+	cancel, ok := a.running[reportType]
+	a.runningMu.Unlock()
 
-	return result, nil
+	if !ok {
+		return false
+	}
+
+	utils.InfoLogger.Printf("Cancelling report: %s", reportType)
+	cancel()
+	return true
+}
+
+// isRESTEndpoint reports whether an endpoint belongs to the REST API
+func isRESTEndpoint(endpoint string) bool {
+	return strings.HasPrefix(endpoint, "/restapi/")
+}
+
+// withQuery adds query parameters to an endpoint path
+func withQuery(endpoint string, params url.Values) string {
+	if len(params) == 0 {
+		return endpoint
+	}
+	if strings.Contains(endpoint, "?") {
+		return endpoint + "&" + params.Encode()
+	}
+	return endpoint + "?" + params.Encode()
+}
+
+// apiErrorDetails describes an API failure for the frontend: what went wrong,
+// how it was classified and whether retrying makes sense
+func apiErrorDetails(err error) map[string]interface{} {
+	details := map[string]interface{}{
+		"error":     err.Error(),
+		"retryable": panclient.IsRetryable(err),
+	}
+	if kind := panclient.Classify(err); kind != panclient.KindUnknown {
+		details["error_kind"] = string(kind)
+		details["hint"] = kind.Hint()
+	}
+	if apiErr, ok := panclient.AsAPIError(err); ok {
+		details["error_code"] = apiErr.Code
+		details["http_status"] = apiErr.HTTPStatus
+	}
+	return details
+}
+
+// operatorError adds guidance and retry advice to an API error for display
+func operatorError(err error) error {
+	var existing *reportError
+	if errors.As(err, &existing) {
+		return err
+	}
+	return &reportError{err: err}
+}
+
+// reportError wraps an API error with operator guidance while keeping the
+// original error available to errors.As
+type reportError struct {
+	err error
+}
+
+func (e *reportError) Error() string {
+	kind := panclient.Classify(e.err)
+	retry := "retrying will not help"
+	if panclient.IsRetryable(e.err) {
+		retry = "retrying may succeed"
+	}
+	return fmt.Sprintf("%v. %s (%s)", e.err, kind.Hint(), retry)
+}
+
+func (e *reportError) Unwrap() error {
+	return e.err
 }
 
 // generateCSV creates a CSV file from report data
-func (a *App) generateCSV(data interface{}, filePath string) error {
+func (a *App) generateCSV(data interface{}, reportType, profile, filePath string) error {
 	// Create directory if it doesn't exist
 	dir := filepath.Dir(filePath)
 	if err := os.MkdirAll(dir, 0755); err != nil {
@@ -671,6 +934,7 @@ func (a *App) generateCSV(data interface{}, filePath string) error {
 		metadataRows := [][]string{
 			{"Generated", time.Now().Format("2006-01-02 15:04:05")},
 			{"Source", "PAN_ENGINE"},
+			{"Profile", profile},
 			{"", ""}, // Empty row for separation
 		}
 
@@ -707,106 +971,104 @@ func (a *App) generateCSV(data interface{}, filePath string) error {
 	case []interface{}:
 		// Handle array data
 		if len(v) == 0 {
-			// Write a header row anyway to show the file isn't empty
-			emptyHeaders := []string{"No Data", "Generated At"}
-			if err := writer.Write(emptyHeaders); err != nil {
-				return err
-			}
-			emptyRow := []string{"No data available", time.Now().Format("2006-01-02 15:04:05")}
-			return writer.Write(emptyRow)
+			return writeEmptyCSV(writer)
 		}
 
-		// For arrays, use the keys from the first item as headers
-		if firstItem, ok := v[0].(map[string]interface{}); ok {
-			// Add metadata header
-			metadataHeaders := []string{"Report Information"}
-			if err := writer.Write(metadataHeaders); err != nil {
-				return err
-			}
+		// Arrays of anything but rows have no table to export
+		if _, ok := v[0].(map[string]interface{}); ok {
+			return a.writeCSVRows(writer, rowSetFromSlice(v), len(v), reportType, profile)
+		}
 
-			// Add metadata rows
-			metadataRows := [][]string{
-				{"Generated", time.Now().Format("2006-01-02 15:04:05")},
-				{"Source", "PAN_ENGINE"},
-				{"Total Items", fmt.Sprintf("%d", len(v))},
-				{"", ""}, // Empty row for separation
-			}
+	case *rowSet:
+		if v.len() == 0 {
+			return writeEmptyCSV(writer)
+		}
+		return a.writeCSVRows(writer, v, v.len(), reportType, profile)
 
-			for _, row := range metadataRows {
-				if err := writer.Write(row); err != nil {
-					return err
-				}
-			}
+	default:
+		return fmt.Errorf("unsupported data type for CSV export")
+	}
 
-			// Get all possible headers from all items
-			headerMap := make(map[string]bool)
-
-			// First scan all items to get all possible headers
-			if a.reportFormat == "complete" {
-				for _, item := range v {
-					if itemMap, ok := item.(map[string]interface{}); ok {
-						for key := range itemMap {
-							headerMap[key] = true
-						}
-					}
-				}
-			} else {
-				// Just use headers from first item for standard format
-				for key := range firstItem {
-					headerMap[key] = true
-				}
-			}
+	return nil
+}
 
-			// Convert to sorted slice
-			var headers []string
-			for key := range headerMap {
-				headers = append(headers, key)
-			}
-			sort.Strings(headers)
+// writeEmptyCSV writes a header row anyway to show the file isn't empty
+func writeEmptyCSV(writer *csv.Writer) error {
+	emptyHeaders := []string{"No Data", "Generated At"}
+	if err := writer.Write(emptyHeaders); err != nil {
+		return err
+	}
+	emptyRow := []string{"No data available", time.Now().Format("2006-01-02 15:04:05")}
+	return writer.Write(emptyRow)
+}
 
-			// Write headers row
-			if err := writer.Write(headers); err != nil {
-				return err
-			}
+// writeCSVRows writes the metadata block and table of a list of rows. Rows
+// are read one at a time, so a report spilled to disk is never loaded whole.
+func (a *App) writeCSVRows(writer *csv.Writer, rows *rowSet, total int, reportType, profile string) error {
+	// Add metadata header
+	metadataHeaders := []string{"Report Information"}
+	if err := writer.Write(metadataHeaders); err != nil {
+		return err
+	}
 
-			// Write each data row
-			rowCount := 0
-			for _, item := range v {
-				// Respect maxRows setting
-				if a.maxRows > 0 && rowCount >= a.maxRows {
-					break
-				}
+	// Add metadata rows
+	metadataRows := [][]string{
+		{"Generated", time.Now().Format("2006-01-02 15:04:05")},
+		{"Source", "PAN_ENGINE"},
+		{"Profile", profile},
+		{"Total Items", fmt.Sprintf("%d", total)},
+		{"", ""}, // Empty row for separation
+	}
 
-				if rowData, ok := item.(map[string]interface{}); ok {
-					var rowValues []string
-					for _, header := range headers {
-						// Check if this item has this header
-						val, exists := rowData[header]
-						if exists {
-							rowValues = append(rowValues, formatValueForCSV(val))
-						} else {
-							rowValues = append(rowValues, "") // Empty for missing value
-						}
-					}
-					if err := writer.Write(rowValues); err != nil {
-						return err
-					}
-					rowCount++
-				}
-			}
+	for _, row := range metadataRows {
+		if err := writer.Write(row); err != nil {
+			return err
+		}
+	}
 
-			// If we truncated the results, add a note
-			if rowCount < len(v) {
-				noteRow := make([]string, len(headers))
-				noteRow[0] = fmt.Sprintf("Note: Output limited to %d of %d rows", rowCount, len(v))
-				writer.Write(noteRow)
-			}
+	// The complete format has a column for every field of every row, the
+	// standard format the report's default columns or those of the first row
+	headers := rows.headers(a.reportFormat == "complete")
+	if report, ok := a.reportCatalog().Get(reportType); ok && a.reportFormat != "complete" {
+		if columns := rows.preferredHeaders(report.DefaultColumns()); len(columns) > 0 {
+			headers = columns
 		}
+	}
 
-	default:
-		return fmt.Errorf("unsupported data type for CSV export")
+	// Write headers row
+	if err := writer.Write(headers); err != nil {
+		return err
+	}
+
+	// Write each data row
+	rowCount := 0
+	err := rows.each(func(rowData map[string]interface{}) error {
+		// Respect maxRows setting
+		if a.maxRows > 0 && rowCount >= a.maxRows {
+			return errEnoughRows
+		}
+
+		rowValues := make([]string, 0, len(headers))
+		for _, header := range headers {
+			// Empty for missing value
+			rowValues = append(rowValues, formatValueForCSV(rowData[header]))
+		}
+		if err := writer.Write(rowValues); err != nil {
+			return err
+		}
+		rowCount++
+		return nil
+	})
+	if err != nil {
+		return err
 	}
 
+	// If we truncated the results, add a note
+	if rowCount < total {
+		noteRow := make([]string, len(headers))
+		noteRow[0] = fmt.Sprintf("Note: Output limited to %d of %d rows", rowCount, total)
+		writer.Write(noteRow)
+	}
 	return nil
 }
 
@@ -832,7 +1094,7 @@ func formatValueForCSV(val interface{}) string {
 }
 
 // generatePDF creates a PDF file from report data
-func (a *App) generatePDF(data interface{}, reportType, filePath string) error {
+func (a *App) generatePDF(data interface{}, reportType, profile, filePath string) error {
 	if data == nil {
 		return fmt.Errorf("no data provided for PDF generation")
 	}
@@ -840,6 +1102,11 @@ func (a *App) generatePDF(data interface{}, reportType, filePath string) error {
 	pdf := fpdf.New("P", "mm", "A4", "")
 	pdf.AddPage()
 
+	// Title with the profile that produced the report
+	pdf.SetFont("Arial", "B", 14)
+	pdf.Cell(0, 10, fmt.Sprintf("%s report - profile %s", reportType, profile))
+	pdf.Ln(12)
+
 	// Set up table dimensions
 	pageWidth, _ := pdf.GetPageSize()
 	colWidth1 := pageWidth * 0.3
@@ -856,12 +1123,45 @@ func (a *App) generatePDF(data interface{}, reportType, filePath string) error {
 	pdf.SetFont("Arial", "", 10)
 	pdf.SetFillColor(255, 255, 255)
 
-	if dataMap, ok := data.(map[string]interface{}); ok {
-		for k, v := range dataMap {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
 			pdf.Cell(colWidth1, 8, fmt.Sprintf("%v", k))
-			pdf.Cell(colWidth2, 8, fmt.Sprintf("%v", v))
+			pdf.Cell(colWidth2, 8, fmt.Sprintf("%v", val))
 			pdf.Ln(-1)
 		}
+	case []interface{}, *rowSet:
+		rows, ok := v.(*rowSet)
+		if !ok {
+			rows = rowSetFromSlice(v.([]interface{}))
+		}
+
+		// One Field/Value block per row, separated by a rule
+		rowCount := 0
+		err := rows.each(func(itemMap map[string]interface{}) error {
+			if a.maxRows > 0 && rowCount >= a.maxRows {
+				return errEnoughRows
+			}
+
+			keys := make([]string, 0, len(itemMap))
+			for k := range itemMap {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+
+			for _, k := range keys {
+				pdf.Cell(colWidth1, 8, k)
+				pdf.Cell(colWidth2, 8, formatValueForCSV(itemMap[k]))
+				pdf.Ln(-1)
+			}
+			pdf.Line(10, pdf.GetY()+1, pageWidth-10, pdf.GetY()+1)
+			pdf.Ln(3)
+			rowCount++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
 	}
 
 	return pdf.OutputFileAndClose(filePath)
@@ -874,8 +1174,10 @@ func (a *App) Greet(name string) string {
 	return greeting
 }
 
-// BatchExportReports exports multiple reports in one operation
-func (a *App) BatchExportReports(reportTypes []string, format string, startDate, endDate string) (map[string]interface{}, error) {
+// BatchExportReports exports multiple reports in one operation. Options are
+// passed to GenerateReport for every report type, so a target of
+// "tag:<tag>" or "site:<site>" exports each report for an inventory group.
+func (a *App) BatchExportReports(reportTypes []string, format string, startDate, endDate string, options map[string]string) (map[string]interface{}, error) {
 	if len(reportTypes) == 0 {
 		return nil, fmt.Errorf("no report types specified")
 	}
@@ -902,22 +1204,18 @@ func (a *App) BatchExportReports(reportTypes []string, format string, startDate,
 			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 
-			// Generate the report
-			reportData, err := a.GenerateReport(rt, startDate, endDate)
+			// Generate the report, which stores its data for export
+			reportData, err := a.GenerateReport(rt, startDate, endDate, options)
 			if err != nil {
 				mu.Lock()
-				results[rt] = map[string]interface{}{
-					"success": false,
-					"error":   err.Error(),
-				}
+				result := apiErrorDetails(err)
+				result["success"] = false
+				results[rt] = result
 				errorCount++
 				mu.Unlock()
 				return
 			}
 
-			// Store the report data for export
-			a.reportData[rt] = reportData
-
 			// Export the report based on format
 			var filePath string
 			var exportErr error
@@ -936,10 +1234,15 @@ func (a *App) BatchExportReports(reportTypes []string, format string, startDate,
 				}
 				errorCount++
 			} else {
-				results[rt] = map[string]interface{}{
+				result := map[string]interface{}{
 					"success": true,
 					"path":    filePath,
 				}
+				// Group runs also report how each device fared
+				if fleet, ok := reportData.(map[string]interface{}); ok && fleet["devices"] != nil {
+					result["devices"] = fleet["devices"]
+				}
+				results[rt] = result
 				successCount++
 			}
 			mu.Unlock()
@@ -955,6 +1258,7 @@ func (a *App) BatchExportReports(reportTypes []string, format string, startDate,
 		"successful": successCount,
 		"failed":     errorCount,
 		"format":     format,
+		"profile":    a.activeProfileName(),
 		"date_range": map[string]string{"start": startDate, "end": endDate},
 		"timestamp":  time.Now().Format(time.RFC3339),
 	}
@@ -963,181 +1267,94 @@ func (a *App) BatchExportReports(reportTypes []string, format string, startDate,
 	return results, nil
 }
 
-// GetSupportedReportTypes returns a list of all supported report types with their details
-func (a *App) GetSupportedReportTypes() []map[string]string {
-	return []map[string]string{
-		// Objects
-		{"type": "applications", "name": "Applications", "category": "Objects", "enabled": "true", "value": "applications", "label": "Applications"},
-		{"type": "appGroups", "name": "Application Groups", "category": "Objects", "enabled": "true", "value": "appGroups", "label": "Application Groups"},
-		{"type": "appFilters", "name": "Application Filters", "category": "Objects", "enabled": "true", "value": "appFilters", "label": "Application Filters"},
-		{"type": "services", "name": "Services", "category": "Objects", "enabled": "true", "value": "services", "label": "Services"},
-		{"type": "serviceGroups", "name": "Service Groups", "category": "Objects", "enabled": "true", "value": "serviceGroups", "label": "Service Groups"},
-		{"type": "tags", "name": "Tags", "category": "Objects", "enabled": "true", "value": "tags", "label": "Tags"},
-		{"type": "hipObjects", "name": "GlobalProtect HIP Objects", "category": "Objects", "enabled": "true", "value": "hipObjects", "label": "GlobalProtect HIP Objects"},
-		{"type": "hipProfiles", "name": "GlobalProtect HIP Profiles", "category": "Objects", "enabled": "true", "value": "hipProfiles", "label": "GlobalProtect HIP Profiles"},
-		{"type": "edl", "name": "External Dynamic Lists", "category": "Objects", "enabled": "true", "value": "edl", "label": "External Dynamic Lists"},
-		{"type": "dataPatterns", "name": "Custom Data Patterns", "category": "Objects", "enabled": "true", "value": "dataPatterns", "label": "Custom Data Patterns"},
-		{"type": "spywareSigs", "name": "Custom Spyware Signatures", "category": "Objects", "enabled": "true", "value": "spywareSigs", "label": "Custom Spyware Signatures"},
-		{"type": "vulnSigs", "name": "Custom Vulnerability Signatures", "category": "Objects", "enabled": "true", "value": "vulnSigs", "label": "Custom Vulnerability Signatures"},
-		{"type": "urlCategories", "name": "Custom URL Categories", "category": "Objects", "enabled": "true", "value": "urlCategories", "label": "Custom URL Categories"},
-
-		// Security Profiles
-		{"type": "antivirusProfiles", "name": "Antivirus Profiles", "category": "Security Profiles", "enabled": "true", "value": "antivirusProfiles", "label": "Antivirus Profiles"},
-		{"type": "antispywareProfiles", "name": "Anti-Spyware Profiles", "category": "Security Profiles", "enabled": "true", "value": "antispywareProfiles", "label": "Anti-Spyware Profiles"},
-		{"type": "vulnProtectionProfiles", "name": "Vulnerability Protection Profiles", "category": "Security Profiles", "enabled": "true", "value": "vulnProtectionProfiles", "label": "Vulnerability Protection Profiles"},
-		{"type": "urlFilteringProfiles", "name": "URL Filtering Profiles", "category": "Security Profiles", "enabled": "true", "value": "urlFilteringProfiles", "label": "URL Filtering Profiles"},
-		{"type": "fileBlockingProfiles", "name": "File Blocking Profiles", "category": "Security Profiles", "enabled": "true", "value": "fileBlockingProfiles", "label": "File Blocking Profiles"},
-		{"type": "wildfireProfiles", "name": "WildFire Analysis Profiles", "category": "Security Profiles", "enabled": "true", "value": "wildfireProfiles", "label": "WildFire Analysis Profiles"},
-		{"type": "dataFilteringProfiles", "name": "Data Filtering Profiles", "category": "Security Profiles", "enabled": "true", "value": "dataFilteringProfiles", "label": "Data Filtering Profiles"},
-		{"type": "dosProtectionProfiles", "name": "DoS Protection Profiles", "category": "Security Profiles", "enabled": "true", "value": "dosProtectionProfiles", "label": "DoS Protection Profiles"},
-		{"type": "securityProfileGroups", "name": "Security Profile Groups", "category": "Security Profiles", "enabled": "true", "value": "securityProfileGroups", "label": "Security Profile Groups"},
-
-		// Policies
-		{"type": "securityRules", "name": "Security Rules", "category": "Policies", "enabled": "true", "value": "securityRules", "label": "Security Rules"},
-		{"type": "natRules", "name": "NAT Rules", "category": "Policies", "enabled": "true", "value": "natRules", "label": "NAT Rules"},
-		{"type": "qosRules", "name": "QoS Rules", "category": "Policies", "enabled": "true", "value": "qosRules", "label": "QoS Rules"},
-		{"type": "pbfRules", "name": "Policy Based Forwarding Rules", "category": "Policies", "enabled": "true", "value": "pbfRules", "label": "Policy Based Forwarding Rules"},
-		{"type": "decryptionRules", "name": "Decryption Rules", "category": "Policies", "enabled": "true", "value": "decryptionRules", "label": "Decryption Rules"},
-		{"type": "packetBrokerRules", "name": "Network Packet Broker Rules", "category": "Policies", "enabled": "true", "value": "packetBrokerRules", "label": "Network Packet Broker Rules"},
-		{"type": "tunnelInspectionRules", "name": "Tunnel Inspection Rules", "category": "Policies", "enabled": "true", "value": "tunnelInspectionRules", "label": "Tunnel Inspection Rules"},
-		{"type": "appOverrideRules", "name": "Application Override Rules", "category": "Policies", "enabled": "true", "value": "appOverrideRules", "label": "Application Override Rules"},
-		{"type": "authRules", "name": "Authentication Rules", "category": "Policies", "enabled": "true", "value": "authRules", "label": "Authentication Rules"},
-		{"type": "dosRules", "name": "DoS Rules", "category": "Policies", "enabled": "true", "value": "dosRules", "label": "DoS Rules"},
-		{"type": "sdwanRules", "name": "SD-WAN Rules", "category": "Policies", "enabled": "true", "value": "sdwanRules", "label": "SD-WAN Rules"},
-
-		// Network
-		{"type": "ethernetInterfaces", "name": "Ethernet Interfaces", "category": "Network", "enabled": "true", "value": "ethernetInterfaces", "label": "Ethernet Interfaces"},
-		{"type": "aeInterfaces", "name": "Aggregate Ethernet Interfaces", "category": "Network", "enabled": "true", "value": "aeInterfaces", "label": "Aggregate Ethernet Interfaces"},
-		{"type": "vlanInterfaces", "name": "VLAN Interfaces", "category": "Network", "enabled": "true", "value": "vlanInterfaces", "label": "VLAN Interfaces"},
-		{"type": "loopbackInterfaces", "name": "Loopback Interfaces", "category": "Network", "enabled": "true", "value": "loopbackInterfaces", "label": "Loopback Interfaces"},
-		{"type": "tunnelInterfaces", "name": "Tunnel Interfaces", "category": "Network", "enabled": "true", "value": "tunnelInterfaces", "label": "Tunnel Interfaces"},
-		{"type": "sdwanInterfaces", "name": "SD-WAN Interfaces", "category": "Network", "enabled": "true", "value": "sdwanInterfaces", "label": "SD-WAN Interfaces"},
-		{"type": "zones", "name": "Zones", "category": "Network", "enabled": "true", "value": "zones", "label": "Zones"},
-		{"type": "vlans", "name": "VLANs", "category": "Network", "enabled": "true", "value": "vlans", "label": "VLANs"},
-		{"type": "virtualWires", "name": "Virtual Wires", "category": "Network", "enabled": "true", "value": "virtualWires", "label": "Virtual Wires"},
-		{"type": "virtualRouters", "name": "Virtual Routers", "category": "Network", "enabled": "true", "value": "virtualRouters", "label": "Virtual Routers"},
-
-		// GlobalProtect
-		{"type": "gpPortals", "name": "GlobalProtect Portals", "category": "GlobalProtect", "enabled": "true", "value": "gpPortals", "label": "GlobalProtect Portals"},
-		{"type": "gpGateways", "name": "GlobalProtect Gateways", "category": "GlobalProtect", "enabled": "true", "value": "gpGateways", "label": "GlobalProtect Gateways"},
-		{"type": "gpAgentTunnels", "name": "GlobalProtect Agent Tunnels", "category": "GlobalProtect", "enabled": "true", "value": "gpAgentTunnels", "label": "GlobalProtect Agent Tunnels"},
-		{"type": "gpSatelliteTunnels", "name": "GlobalProtect Satellite Tunnels", "category": "GlobalProtect", "enabled": "true", "value": "gpSatelliteTunnels", "label": "GlobalProtect Satellite Tunnels"},
-		{"type": "gpMdmServers", "name": "GlobalProtect MDM Servers", "category": "GlobalProtect", "enabled": "true", "value": "gpMdmServers", "label": "GlobalProtect MDM Servers"},
-		{"type": "gpClientlessApps", "name": "GlobalProtect Clientless Apps", "category": "GlobalProtect", "enabled": "true", "value": "gpClientlessApps", "label": "GlobalProtect Clientless Apps"},
-		{"type": "gpClientlessAppGroups", "name": "GlobalProtect Clientless App Groups", "category": "GlobalProtect", "enabled": "true", "value": "gpClientlessAppGroups", "label": "GlobalProtect Clientless App Groups"},
-
-		// Logs
-		{"type": "traffic", "name": "Traffic Logs", "category": "Logs", "enabled": "true", "value": "traffic", "label": "Traffic Logs"},
-		{"type": "threat", "name": "Threat Logs", "category": "Logs", "enabled": "true", "value": "threat", "label": "Threat Logs"},
-		{"type": "url", "name": "URL Filtering Logs", "category": "Logs", "enabled": "true", "value": "url", "label": "URL Filtering Logs"},
-		{"type": "data", "name": "Data Filtering Logs", "category": "Logs", "enabled": "true", "value": "data", "label": "Data Filtering Logs"},
-		{"type": "wildfire", "name": "WildFire Logs", "category": "Logs", "enabled": "true", "value": "wildfire", "label": "WildFire Logs"},
-		{"type": "auth", "name": "Authentication Logs", "category": "Logs", "enabled": "true", "value": "auth", "label": "Authentication Logs"},
-		{"type": "system", "name": "System Logs", "category": "Logs", "enabled": "true", "value": "system", "label": "System Logs"},
-		{"type": "config", "name": "Configuration Logs", "category": "Logs", "enabled": "true", "value": "config", "label": "Configuration Logs"},
-		{"type": "correlation", "name": "Correlation Logs", "category": "Logs", "enabled": "true", "value": "correlation", "label": "Correlation Logs"},
-
-		// System
-		{"type": "systemInfo", "name": "System Information", "category": "System", "enabled": "true", "value": "systemInfo", "label": "System Information"},
-		{"type": "interfaceInfo", "name": "Interface Information", "category": "System", "enabled": "true", "value": "interfaceInfo", "label": "Interface Information"},
-		{"type": "systemResources", "name": "System Resources", "category": "System", "enabled": "true", "value": "systemResources", "label": "System Resources"},
-		{"type": "gpUsers", "name": "GlobalProtect Users", "category": "System", "enabled": "true", "value": "gpUsers", "label": "GlobalProtect Users"},
-		{"type": "activeSessions", "name": "Active Sessions", "category": "System", "enabled": "true", "value": "activeSessions", "label": "Active Sessions"},
-		{"type": "softwareVersion", "name": "Software Version", "category": "System", "enabled": "true", "value": "softwareVersion", "label": "Software Version"},
-	}
-}
-
-// GetReportCategories returns a list of all report categories
-func (a *App) GetReportCategories() []string {
-	return []string{
-		"Objects",
-		"Security Profiles",
-		"Policies",
-		"Network",
-		"GlobalProtect",
-		"Logs",
-		"System",
-	}
-}
-
 // FilterReportData allows filtering report data by search criteria
 func (a *App) FilterReportData(reportType string, filters map[string]string) (map[string]interface{}, error) {
 	// Get the original report data
-	data, ok := a.reportData[reportType]
+	data, release, ok := a.acquireReportData(reportType)
+	defer release()
 	if !ok {
 		return nil, fmt.Errorf("no data available for report type: %s", reportType)
 	}
 
-	// Extract the data array (most reports are array-based)
-	var items []interface{}
-
-	switch v := data.(type) {
-	case map[string]interface{}:
-		// Single object report - just create an array with this item
-		items = []interface{}{v}
-	case []interface{}:
-		// Array report - use as is
-		items = v
-	default:
-		return nil, fmt.Errorf("unsupported data format for filtering")
-	}
-
 	// If no filters provided, return original data
 	if len(filters) == 0 {
+		count := 0
+		if rows, ok := data.(*rowSet); ok {
+			count = rows.len()
+		} else if !eachReportRow(data, func(map[string]interface{}) { count++ }) {
+			return nil, fmt.Errorf("unsupported data format for filtering")
+		}
 		return map[string]interface{}{
-			"result":   data,
-			"count":    len(items),
+			"result":   reportView(data),
+			"count":    count,
 			"filtered": false,
 		}, nil
 	}
 
-	// Apply filters
-	var filtered []interface{}
+	// Apply filters, reading rows one at a time (most reports are
+	// array-based; a single object report is one row). Matches go into a
+	// row set so a large result spills to disk like the report itself.
+	filtered := a.newRowSet()
+	total := 0
+	var addErr error
 
-	for _, item := range items {
-		if itemMap, ok := item.(map[string]interface{}); ok {
-			matches := true
+	ok = eachReportRow(data, func(itemMap map[string]interface{}) {
+		total++
+		if addErr != nil {
+			return
+		}
+		matches := true
 
-			// Check if this item matches all filters
-			for field, value := range filters {
-				if value == "" {
-					continue // Skip empty filters
-				}
+		// Check if this item matches all filters
+		for field, value := range filters {
+			if value == "" {
+				continue // Skip empty filters
+			}
 
-				// Check if field exists
-				fieldValue, exists := itemMap[field]
-				if !exists {
-					matches = false
-					break
-				}
+			// Check if field exists
+			fieldValue, exists := itemMap[field]
+			if !exists {
+				matches = false
+				break
+			}
 
-				// Check if field value contains filter value (case-insensitive)
-				fieldStr := strings.ToLower(fmt.Sprintf("%v", fieldValue))
-				filterStr := strings.ToLower(value)
+			// Check if field value contains filter value (case-insensitive)
+			fieldStr := strings.ToLower(fmt.Sprintf("%v", fieldValue))
+			filterStr := strings.ToLower(value)
 
-				if !strings.Contains(fieldStr, filterStr) {
-					matches = false
-					break
-				}
+			if !strings.Contains(fieldStr, filterStr) {
+				matches = false
+				break
 			}
+		}
 
-			if matches {
-				filtered = append(filtered, item)
-			}
+		if matches {
+			addErr = filtered.add(itemMap, "")
 		}
+	})
+	if !ok {
+		filtered.close()
+		return nil, fmt.Errorf("unsupported data format for filtering")
 	}
-
-	result := map[string]interface{}{
-		"result":   filtered,
-		"count":    len(filtered),
-		"total":    len(items),
-		"filtered": true,
+	if addErr != nil {
+		filtered.close()
+		return nil, addErr
 	}
 
-	// Store filtered results for possible export
-	a.reportData[reportType+"_filtered"] = filtered
+	// Store filtered results for possible export, reading them back for the
+	// frontend before a newer filter can replace them
+	a.reportMu.Lock()
+	a.storeReportData(reportType+"_filtered", filtered)
+	release = acquireData(filtered)
+	a.reportMu.Unlock()
+	defer release()
 
-	return result, nil
+	return map[string]interface{}{
+		"result":   reportView(filtered),
+		"count":    filtered.len(),
+		"total":    total,
+		"filtered": true,
+	}, nil
 }
 
 // SearchAllReports searches for a term across all generated reports
@@ -1151,61 +1368,44 @@ func (a *App) SearchAllReports(searchTerm string) (map[string]interface{}, error
 	// Convert search term to lowercase for case-insensitive matching
 	searchTermLower := strings.ToLower(searchTerm)
 
-	for reportType, data := range a.reportData {
+	reports, release := a.acquireAllReportData()
+	defer release()
+
+	for reportType, data := range reports {
 		// Skip filtered reports (those with _filtered suffix)
 		if strings.HasSuffix(reportType, "_filtered") {
 			continue
 		}
 
-		var matches []interface{}
-		var count int
-
-		switch v := data.(type) {
-		case map[string]interface{}:
-			// Check if this single object contains the search term
-			found := false
-			for _, value := range v {
-				if strings.Contains(strings.ToLower(fmt.Sprintf("%v", value)), searchTermLower) {
-					found = true
-					break
-				}
-			}
-
-			if found {
-				matches = append(matches, v)
-				count = 1
+		// Check each row, reading spilled reports from disk and spilling
+		// a large set of matches the same way
+		matches := a.newRowSet()
+		var addErr error
+		eachReportRow(data, func(itemMap map[string]interface{}) {
+			if addErr != nil {
+				return
 			}
-
-		case []interface{}:
-			// Check each item in the array
-			for _, item := range v {
-				if itemMap, ok := item.(map[string]interface{}); ok {
-					found := false
-
-					// Check all fields in the item
-					for _, value := range itemMap {
-						if strings.Contains(strings.ToLower(fmt.Sprintf("%v", value)), searchTermLower) {
-							found = true
-							break
-						}
-					}
-
-					if found {
-						matches = append(matches, item)
-					}
+			// Check all fields in the item
+			for _, value := range itemMap {
+				if strings.Contains(strings.ToLower(fmt.Sprintf("%v", value)), searchTermLower) {
+					addErr = matches.add(itemMap, "")
+					return
 				}
 			}
-
-			count = len(matches)
+		})
+		if addErr != nil {
+			matches.close()
+			return nil, addErr
 		}
 
 		// Add to results if we found matches
-		if count > 0 {
+		if count := matches.len(); count > 0 {
 			results[reportType] = map[string]interface{}{
-				"matches": matches,
+				"matches": reportView(matches),
 				"count":   count,
 			}
 		}
+		matches.close()
 	}
 
 	// Add summary
@@ -1214,22 +1414,12 @@ func (a *App) SearchAllReports(searchTerm string) (map[string]interface{}, error
 	return map[string]interface{}{
 		"results":              results,
 		"term":                 searchTerm,
-		"reports_searched":     len(a.reportData),
+		"reports_searched":     len(reports),
 		"reports_with_matches": matchCount,
 		"found":                matchCount > 0,
 	}, nil
 }
 
-// ScheduleReport schedules a report to be generated periodically
-func (a *App) ScheduleReport(reportType, schedule string, emailRecipients []string) (string, error) {
-	// This would normally connect to a background service for scheduling
-	// For now, just return a success message with a fake ID
-
-	scheduleID := uuid.New().String()
-
-	return scheduleID, nil
-}
-
 // GetReportHistory returns a summary of recently generated reports with their details
 func (a *App) GetReportHistory() ([]map[string]interface{}, error) {
 	// In a real implementation, this would read from a database of report history
@@ -1240,6 +1430,9 @@ func (a *App) GetReportHistory() ([]map[string]interface{}, error) {
 		return nil, err
 	}
 
+	// Profiles recorded when the files were exported
+	exports := a.loadExportLog()
+
 	// Enhance the report data with more information
 	var reportHistory []map[string]interface{}
 
@@ -1264,6 +1457,10 @@ func (a *App) GetReportHistory() ([]map[string]interface{}, error) {
 			"file_path":   report["path"],
 			"file_size":   report["size"],
 			"created_at":  timestamp,
+			"profile":     "",
+		}
+		if entry, ok := exports[filepath.Base(report["path"])]; ok {
+			historyItem["profile"] = entry.Profile
 		}
 
 		reportHistory = append(reportHistory, historyItem)
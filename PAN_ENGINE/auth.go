@@ -0,0 +1,74 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"fmt"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// EventReauthRequired is emitted when the device rejects the stored API key
+const EventReauthRequired = "api:reauth-required"
+
+// LoginWithCredentials generates an API key with type=keygen and saves it
+// through the encrypted settings path. The password is only used for the
+// keygen request and is never stored.
+func (a *App) LoginWithCredentials(url, username, password string) (bool, error) {
+	if url == "" || username == "" || password == "" {
+		return false, fmt.Errorf("URL, username and password are required")
+	}
+
+	// The key is saved to the active profile, so use its TLS settings
+	opts, err := a.profileClientOptions(a.currentProfile())
+	if err != nil {
+		return false, err
+	}
+	client, err := panclient.New(url, "", opts...)
+	if err != nil {
+		return false, err
+	}
+	defer client.Close()
+
+	key, err := client.Keygen(a.requestContext(), username, password)
+	if err != nil {
+		utils.ErrorLogger.Printf("Login failed for user %s: %v", username, err)
+		return false, operatorError(err)
+	}
+
+	utils.InfoLogger.Printf("API key generated for user %s", username)
+	return a.SaveAPISettings(url, key)
+}
+
+// handleAuthFailure marks the stored key as invalid and asks the frontend
+// to log in again, e.g. after an admin password change revoked the key
+func (a *App) handleAuthFailure(err error) {
+	if !panclient.IsKind(err, panclient.KindAuth) {
+		return
+	}
+
+	utils.ErrorLogger.Printf("API key rejected by device: %v", err)
+	a.apiStatus = "reauth_required"
+	a.lastAPICheck = time.Now()
+	a.recordKeyValidation(err)
+
+	reason := panclient.AuthFailureReason(err)
+	message := "The stored API key was rejected. Log in again to generate a new key."
+	if reason == panclient.AuthKeyExpired {
+		message = "The stored API key has expired. Log in again or rotate the key."
+	}
+
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, EventReauthRequired, map[string]interface{}{
+			"url":     a.apiURL,
+			"reason":  reason,
+			"message": message,
+		})
+	}
+}
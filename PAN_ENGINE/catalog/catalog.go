@@ -0,0 +1,423 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+// Package catalog is the single definition of the report types the engine
+// can run. The built-in catalog is embedded from reports.json; users extend
+// or override it with a file of the same shape. It depends only on the
+// standard library and the opcmd package, not on the app, so the Reporting
+// server can share it.
+package catalog
+
+import (
+	"PAN_ENGINE/opcmd"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+//go:embed reports.json
+var builtin []byte
+
+// API flavors a report can be served by
+const (
+	// FlavorREST reads a /restapi resource
+	FlavorREST = "rest"
+	// FlavorOp runs an operational command
+	FlavorOp = "op"
+	// FlavorConfig reads the running configuration at an XPath
+	FlavorConfig = "config"
+	// FlavorLog runs log query jobs
+	FlavorLog = "log"
+)
+
+// versionPattern matches a PAN-OS release such as "10.1" or "9.1.3"
+var versionPattern = regexp.MustCompile(`^\d+(\.\d+){0,2}$`)
+
+// Config actions: show reads the running configuration, get the candidate
+const (
+	ActionShow = "show"
+	ActionGet  = "get"
+)
+
+// ScopeLocation marks a report whose resource takes a location (vsys,
+// device group, ...) and therefore honours the report scope
+const ScopeLocation = "location"
+
+// Report defines one report type
+type Report struct {
+	// Key identifies the report in bindings, schedules and file names
+	Key         string `json:"key"`
+	Label       string `json:"label"`
+	Category    string `json:"category"`
+	Description string `json:"description,omitempty"`
+	// Flavor is the API serving the report: rest, op, config or log
+	Flavor string `json:"flavor"`
+	// Endpoint is the REST resource below /restapi/<version>/ (for example
+	// "Objects/Addresses"), an op command in XML form or the log-type
+	Endpoint string `json:"endpoint,omitempty"`
+	// XPath is the configuration path of a config report
+	XPath string `json:"xpath,omitempty"`
+	// Action is how a config report reads its XPath: "show" for the
+	// running configuration (the default) or "get" for the candidate
+	Action string `json:"action,omitempty"`
+	// Command is an op command in CLI syntax, such as "show system info",
+	// used when Endpoint holds no XML command
+	Command string `json:"command,omitempty"`
+	// Scope is "location" when the report honours the report scope
+	Scope string `json:"scope,omitempty"`
+	// MinVersion is the first PAN-OS release that serves the report
+	MinVersion string `json:"min_version,omitempty"`
+	// Columns are the default CSV columns, in order; empty uses every
+	// field of the first row
+	Columns []string `json:"columns,omitempty"`
+	// RowPath is the slash separated element of an XML response, or key
+	// path of a REST response, that rows are read from. The default is
+	// "result" for XML and the result's entry list for REST.
+	RowPath string `json:"row_path,omitempty"`
+	// Mappings select and rename the fields of each row, in order; empty
+	// keeps every field
+	Mappings []ColumnMapping `json:"mappings,omitempty"`
+	// Custom marks a report defined in the app rather than the catalog
+	Custom bool `json:"custom,omitempty"`
+	// Disabled removes a built-in report when set in an override file
+	Disabled bool `json:"disabled,omitempty"`
+}
+
+// ColumnMapping exports the row field Field as the column Column
+type ColumnMapping struct {
+	Field string `json:"field"`
+	// Column defaults to the field name
+	Column string `json:"column,omitempty"`
+}
+
+// Name returns the exported column name
+func (m ColumnMapping) Name() string {
+	if m.Column != "" {
+		return m.Column
+	}
+	return plainColumn(m.Field)
+}
+
+// plainColumn returns a column name without attribute markers. REST rows
+// carry attributes such as "@name" as plain columns, so columns written
+// the way the REST API names them still match.
+func plainColumn(name string) string {
+	if !strings.Contains(name, "@") {
+		return name
+	}
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = strings.TrimPrefix(part, "@")
+	}
+	return strings.Join(parts, ".")
+}
+
+// EndpointFor returns the API endpoint of the report, with REST resources
+// placed under the given REST API version (for example "v10.1")
+func (r Report) EndpointFor(restVersion string) string {
+	switch r.Flavor {
+	case FlavorREST:
+		return "/restapi/" + restVersion + "/" + strings.TrimPrefix(r.Endpoint, "/")
+	case FlavorOp:
+		cmd, err := r.OpCommand()
+		if err != nil {
+			return ""
+		}
+		return "/api/?type=op&cmd=" + url.QueryEscape(cmd)
+	case FlavorConfig:
+		action := r.Action
+		if action == "" {
+			action = ActionShow
+		}
+		return "/api/?type=config&action=" + action + "&xpath=" + url.QueryEscape(r.XPath)
+	case FlavorLog:
+		return "/api/?type=log&log-type=" + r.Endpoint
+	}
+	return ""
+}
+
+// OpCommand returns the XML command of an op report
+func (r Report) OpCommand() (string, error) {
+	if r.Endpoint != "" {
+		return r.Endpoint, nil
+	}
+	return opcmd.XML(r.Command)
+}
+
+// LogType returns the log-type a log report queries, or "" for other flavors
+func (r Report) LogType() string {
+	if r.Flavor != FlavorLog {
+		return ""
+	}
+	return r.Endpoint
+}
+
+// Scoped reports whether the report honours the report scope
+func (r Report) Scoped() bool {
+	return r.Scope == ScopeLocation
+}
+
+// MapRow applies the report's column mappings to a row
+func (r Report) MapRow(row map[string]interface{}) map[string]interface{} {
+	if len(r.Mappings) == 0 {
+		return row
+	}
+	out := make(map[string]interface{}, len(r.Mappings))
+	for _, m := range r.Mappings {
+		v, ok := row[m.Field]
+		if !ok {
+			v, ok = row[plainColumn(m.Field)]
+		}
+		if ok {
+			out[m.Name()] = v
+		}
+	}
+	return out
+}
+
+// DefaultColumns returns the columns exported by default: the mapped
+// columns, or else Columns
+func (r Report) DefaultColumns() []string {
+	if len(r.Mappings) == 0 {
+		columns := make([]string, 0, len(r.Columns))
+		for _, column := range r.Columns {
+			columns = append(columns, plainColumn(column))
+		}
+		return columns
+	}
+	columns := make([]string, 0, len(r.Mappings))
+	for _, m := range r.Mappings {
+		columns = append(columns, m.Name())
+	}
+	return columns
+}
+
+// validate checks that a report is complete and consistent
+func (r Report) validate() error {
+	if r.Key == "" {
+		return errors.New("report without a key")
+	}
+	if r.Label == "" || r.Category == "" {
+		return fmt.Errorf("report %s: label and category are required", r.Key)
+	}
+
+	switch r.Flavor {
+	case FlavorREST, FlavorLog:
+		if r.Endpoint == "" {
+			return fmt.Errorf("report %s: endpoint is required for %s reports", r.Key, r.Flavor)
+		}
+	case FlavorOp:
+		if r.Endpoint == "" && r.Command == "" {
+			return fmt.Errorf("report %s: command or endpoint is required for op reports", r.Key)
+		}
+		if _, err := r.OpCommand(); err != nil {
+			return fmt.Errorf("report %s: %v", r.Key, err)
+		}
+	case FlavorConfig:
+		if r.XPath == "" {
+			return fmt.Errorf("report %s: xpath is required for config reports", r.Key)
+		}
+	default:
+		return fmt.Errorf("report %s: invalid flavor %q: must be rest, op, config or log", r.Key, r.Flavor)
+	}
+
+	if r.Action != "" && (r.Flavor != FlavorConfig || (r.Action != ActionShow && r.Action != ActionGet)) {
+		return fmt.Errorf("report %s: invalid action %q: config reports use show or get", r.Key, r.Action)
+	}
+
+	columns := make(map[string]bool, len(r.Mappings))
+	for _, m := range r.Mappings {
+		if m.Field == "" {
+			return fmt.Errorf("report %s: column mapping without a field", r.Key)
+		}
+		if columns[m.Name()] {
+			return fmt.Errorf("report %s: duplicate column %s", r.Key, m.Name())
+		}
+		columns[m.Name()] = true
+	}
+
+	if r.Scope != "" && r.Scope != ScopeLocation {
+		return fmt.Errorf("report %s: invalid scope %q", r.Key, r.Scope)
+	}
+	if r.MinVersion != "" && !versionPattern.MatchString(r.MinVersion) {
+		return fmt.Errorf("report %s: invalid min_version %q", r.Key, r.MinVersion)
+	}
+	if r.Scoped() && r.Flavor != FlavorREST {
+		return fmt.Errorf("report %s: only REST reports can be scoped", r.Key)
+	}
+	if _, err := url.Parse(r.EndpointFor("v0")); err != nil {
+		return fmt.Errorf("report %s: invalid endpoint: %v", r.Key, err)
+	}
+	return nil
+}
+
+// Catalog is an ordered list of report definitions and their categories
+type Catalog struct {
+	// Categories lists the categories in display order
+	Categories []string `json:"categories"`
+	Reports    []Report `json:"reports"`
+}
+
+// Default returns the built-in catalog
+func Default() *Catalog {
+	c, err := Parse(builtin)
+	if err != nil {
+		panic(fmt.Sprintf("built-in report catalog: %v", err))
+	}
+	return c
+}
+
+// Parse decodes and validates a catalog
+func Parse(data []byte) (*Catalog, error) {
+	var c Catalog
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid report catalog: %v", err)
+	}
+	if err := c.validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// OverrideFile is the name of the file holding user additions and overrides
+// to the built-in catalog, in the same format as reports.json
+const OverrideFile = "report_catalog.json"
+
+// Load returns the built-in catalog with the overrides in path applied. A
+// missing override file is not an error.
+func Load(path string) (*Catalog, error) {
+	c := Default()
+	if path == "" {
+		return c, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read report catalog %s: %v", path, err)
+	}
+
+	var overrides Catalog
+	if err := json.Unmarshal(data, &overrides); err != nil {
+		return nil, fmt.Errorf("invalid report catalog %s: %v", path, err)
+	}
+	if err := c.Merge(overrides); err != nil {
+		return nil, fmt.Errorf("report catalog %s: %v", path, err)
+	}
+	return c, nil
+}
+
+// Merge applies overrides: a report with a known key replaces the fields
+// it sets, a disabled one is removed and a new key is added. Categories
+// not yet listed are appended. On error the catalog is left unchanged.
+func (c *Catalog) Merge(overrides Catalog) error {
+	merged := &Catalog{
+		Categories: append([]string(nil), c.Categories...),
+		Reports:    append([]Report(nil), c.Reports...),
+	}
+
+	for _, o := range overrides.Reports {
+		i := merged.index(o.Key)
+		switch {
+		case o.Disabled && i >= 0:
+			merged.Reports = append(merged.Reports[:i], merged.Reports[i+1:]...)
+		case o.Disabled:
+		case i >= 0:
+			merged.Reports[i] = overlay(merged.Reports[i], o)
+		default:
+			merged.Reports = append(merged.Reports, o)
+		}
+	}
+
+	for _, category := range overrides.Categories {
+		merged.addCategory(category)
+	}
+	for _, r := range merged.Reports {
+		merged.addCategory(r.Category)
+	}
+	if err := merged.validate(); err != nil {
+		return err
+	}
+	*c = *merged
+	return nil
+}
+
+// overlay copies the fields set in o over r
+func overlay(r, o Report) Report {
+	set := func(dst *string, v string) {
+		if v != "" {
+			*dst = v
+		}
+	}
+	set(&r.Label, o.Label)
+	set(&r.Category, o.Category)
+	set(&r.Description, o.Description)
+	set(&r.Flavor, o.Flavor)
+	set(&r.Endpoint, o.Endpoint)
+	set(&r.XPath, o.XPath)
+	set(&r.Scope, o.Scope)
+	set(&r.MinVersion, o.MinVersion)
+	set(&r.RowPath, o.RowPath)
+	set(&r.Action, o.Action)
+	set(&r.Command, o.Command)
+	if o.Columns != nil {
+		r.Columns = o.Columns
+	}
+	if o.Mappings != nil {
+		r.Mappings = o.Mappings
+	}
+	return r
+}
+
+func (c *Catalog) addCategory(category string) {
+	if category == "" {
+		return
+	}
+	for _, existing := range c.Categories {
+		if existing == category {
+			return
+		}
+	}
+	c.Categories = append(c.Categories, category)
+}
+
+// Get returns the report with the given key
+func (c *Catalog) Get(key string) (Report, bool) {
+	if i := c.index(key); i >= 0 {
+		return c.Reports[i], true
+	}
+	return Report{}, false
+}
+
+func (c *Catalog) index(key string) int {
+	for i, r := range c.Reports {
+		if r.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// validate checks every report and rejects duplicate keys
+func (c *Catalog) validate() error {
+	seen := make(map[string]bool, len(c.Reports))
+	for _, r := range c.Reports {
+		if err := r.validate(); err != nil {
+			return err
+		}
+		if seen[r.Key] {
+			return fmt.Errorf("duplicate report key %s", r.Key)
+		}
+		seen[r.Key] = true
+	}
+	return nil
+}
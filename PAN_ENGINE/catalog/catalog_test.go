@@ -0,0 +1,303 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package catalog
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// catalogJSON wraps report definitions in a catalog document
+func catalogJSON(reports ...string) []byte {
+	return []byte(`{"categories": ["Objects"], "reports": [` + strings.Join(reports, ",") + `]}`)
+}
+
+const addressesReport = `{"key": "addresses", "label": "Addresses", "category": "Objects", "flavor": "rest", "endpoint": "Objects/Addresses", "scope": "location"}`
+
+func TestBuiltinCatalog(t *testing.T) {
+	c := Default()
+	if len(c.Reports) == 0 {
+		t.Fatal("built-in catalog has no reports")
+	}
+
+	// Every entry validates on its own, not only as part of the catalog
+	var raw Catalog
+	if err := json.Unmarshal(builtin, &raw); err != nil {
+		t.Fatalf("reports.json is invalid: %v", err)
+	}
+	categories := make(map[string]bool)
+	for _, category := range raw.Categories {
+		categories[category] = true
+	}
+	for _, r := range raw.Reports {
+		if err := r.validate(); err != nil {
+			t.Errorf("built-in report %s: %v", r.Key, err)
+		}
+		if !categories[r.Category] {
+			t.Errorf("built-in report %s: category %s is not listed", r.Key, r.Category)
+		}
+		if r.EndpointFor("v11.0") == "" {
+			t.Errorf("built-in report %s has no endpoint", r.Key)
+		}
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    []byte
+		message string
+	}{
+		{"not json", []byte(`{"reports": [`), "invalid report catalog"},
+		{"unknown flavor", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "soap", "endpoint": "x"}`), "invalid flavor"},
+		{"duplicate key", catalogJSON(addressesReport, addressesReport), "duplicate report key"},
+		{"scoped op report", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "op", "command": "show system info", "scope": "location"}`), "only REST reports can be scoped"},
+		{"rest without endpoint", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest"}`), "endpoint is required"},
+		{"log without endpoint", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "log"}`), "endpoint is required"},
+		{"op without command", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "op"}`), "command or endpoint is required"},
+		{"bad op command", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "op", "command": "1234"}`), "must start with a keyword"},
+		{"config without xpath", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "config"}`), "xpath is required"},
+		{"action on rest", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x", "action": "get"}`), "invalid action"},
+		{"missing key", catalogJSON(`{"label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x"}`), "without a key"},
+		{"missing label", catalogJSON(`{"key": "a", "category": "Objects", "flavor": "rest", "endpoint": "x"}`), "label and category are required"},
+		{"unknown scope", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x", "scope": "global"}`), "invalid scope"},
+		{"bad min version", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x", "min_version": "ten"}`), "invalid min_version"},
+		{"mapping without field", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x", "mappings": [{"column": "c"}]}`), "without a field"},
+		{"duplicate column", catalogJSON(`{"key": "a", "label": "A", "category": "Objects", "flavor": "rest", "endpoint": "x", "mappings": [{"field": "@name"}, {"field": "name"}]}`), "duplicate column name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.data)
+			if err == nil {
+				t.Fatal("Parse succeeded, want an error")
+			}
+			if !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("Parse error = %v, want one containing %q", err, tt.message)
+			}
+		})
+	}
+
+	if _, err := Parse(catalogJSON(addressesReport)); err != nil {
+		t.Errorf("Parse of a valid catalog failed: %v", err)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := func() *Catalog {
+		c, err := Parse([]byte(`{"categories": ["Objects", "System"], "reports": [` + addressesReport + `,
+			{"key": "systemInfo", "label": "System Information", "category": "System", "flavor": "op", "command": "show system info", "columns": ["hostname"]}]}`))
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		return c
+	}
+
+	tests := []struct {
+		name       string
+		overrides  Catalog
+		keys       []string
+		categories []string
+		check      func(t *testing.T, c *Catalog)
+	}{
+		{
+			"override a field",
+			Catalog{Reports: []Report{{Key: "addresses", Label: "Address Objects", Columns: []string{"name"}}}},
+			[]string{"addresses", "systemInfo"},
+			[]string{"Objects", "System"},
+			func(t *testing.T, c *Catalog) {
+				r, _ := c.Get("addresses")
+				if r.Label != "Address Objects" || r.Endpoint != "Objects/Addresses" || !r.Scoped() {
+					t.Errorf("overridden report = %+v, want the new label with the other fields kept", r)
+				}
+				if !reflect.DeepEqual(r.Columns, []string{"name"}) {
+					t.Errorf("columns = %v, want [name]", r.Columns)
+				}
+			},
+		},
+		{
+			"disable a report",
+			Catalog{Reports: []Report{{Key: "systemInfo", Disabled: true}, {Key: "nosuchreport", Disabled: true}}},
+			[]string{"addresses"},
+			[]string{"Objects", "System"},
+			nil,
+		},
+		{
+			"add a report",
+			Catalog{Reports: []Report{{Key: "zones", Label: "Zones", Category: "Network", Flavor: FlavorREST, Endpoint: "Network/Zones"}}},
+			[]string{"addresses", "systemInfo", "zones"},
+			[]string{"Objects", "System", "Network"},
+			nil,
+		},
+		{
+			"category order",
+			Catalog{
+				Categories: []string{"Audit", "Objects"},
+				Reports:    []Report{{Key: "zones", Label: "Zones", Category: "Network", Flavor: FlavorREST, Endpoint: "Network/Zones"}},
+			},
+			[]string{"addresses", "systemInfo", "zones"},
+			[]string{"Objects", "System", "Audit", "Network"},
+			nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := base()
+			if err := c.Merge(tt.overrides); err != nil {
+				t.Fatalf("Merge failed: %v", err)
+			}
+			var keys []string
+			for _, r := range c.Reports {
+				keys = append(keys, r.Key)
+			}
+			if !reflect.DeepEqual(keys, tt.keys) {
+				t.Errorf("reports = %v, want %v", keys, tt.keys)
+			}
+			if !reflect.DeepEqual(c.Categories, tt.categories) {
+				t.Errorf("categories = %v, want %v", c.Categories, tt.categories)
+			}
+			if tt.check != nil {
+				tt.check(t, c)
+			}
+		})
+	}
+
+	// An invalid override leaves the catalog as it was
+	c := base()
+	err := c.Merge(Catalog{Reports: []Report{{Key: "addresses", Flavor: FlavorOp}}})
+	if err == nil {
+		t.Fatal("Merge accepted an op report without a command")
+	}
+	if r, _ := c.Get("addresses"); r.Flavor != FlavorREST || len(c.Reports) != 2 {
+		t.Errorf("failed Merge changed the catalog: %+v", c.Reports)
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	c, err := Load(filepath.Join(dir, "missing.json"))
+	if err != nil || len(c.Reports) != len(Default().Reports) {
+		t.Errorf("Load of a missing file = %d reports, %v; want the built-in catalog", len(c.Reports), err)
+	}
+
+	path := filepath.Join(dir, OverrideFile)
+	override := `{"reports": [{"key": "systemInfo", "disabled": true}, {"key": "zones", "label": "Zones", "category": "Network", "flavor": "rest", "endpoint": "Network/Zones"}]}`
+	if err := os.WriteFile(path, []byte(override), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	c, err = Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, ok := c.Get("systemInfo"); ok {
+		t.Error("disabled report still in the catalog")
+	}
+	if _, ok := c.Get("zones"); !ok {
+		t.Error("added report missing from the catalog")
+	}
+
+	if err := os.WriteFile(path, []byte(`{"reports": [{"key": "zones", "flavor": "soap"}]}`), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := Load(path); err == nil {
+		t.Error("Load accepted an invalid override file")
+	}
+}
+
+func TestEndpointFor(t *testing.T) {
+	tests := []struct {
+		name   string
+		report Report
+		want   string
+	}{
+		{"rest", Report{Flavor: FlavorREST, Endpoint: "/Objects/Addresses"}, "/restapi/v10.1/Objects/Addresses"},
+		{"op command", Report{Flavor: FlavorOp, Command: "show system info"}, "/api/?type=op&cmd=%3Cshow%3E%3Csystem%3E%3Cinfo%3E%3C%2Finfo%3E%3C%2Fsystem%3E%3C%2Fshow%3E"},
+		{"op xml", Report{Flavor: FlavorOp, Endpoint: "<show><clock></clock></show>"}, "/api/?type=op&cmd=%3Cshow%3E%3Cclock%3E%3C%2Fclock%3E%3C%2Fshow%3E"},
+		{"invalid op", Report{Flavor: FlavorOp, Command: "1234"}, ""},
+		{"config", Report{Flavor: FlavorConfig, XPath: "/config/shared"}, "/api/?type=config&action=show&xpath=%2Fconfig%2Fshared"},
+		{"candidate config", Report{Flavor: FlavorConfig, XPath: "/config/shared", Action: ActionGet}, "/api/?type=config&action=get&xpath=%2Fconfig%2Fshared"},
+		{"log", Report{Flavor: FlavorLog, Endpoint: "traffic"}, "/api/?type=log&log-type=traffic"},
+		{"unknown", Report{Flavor: "soap"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.report.EndpointFor("v10.1"); got != tt.want {
+				t.Errorf("EndpointFor = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogType(t *testing.T) {
+	tests := []struct {
+		report Report
+		want   string
+	}{
+		{Report{Flavor: FlavorLog, Endpoint: "threat"}, "threat"},
+		{Report{Flavor: FlavorREST, Endpoint: "Objects/Addresses"}, ""},
+		{Report{Flavor: FlavorOp, Endpoint: "<show><clock></clock></show>"}, ""},
+	}
+
+	for _, tt := range tests {
+		if got := tt.report.LogType(); got != tt.want {
+			t.Errorf("LogType of a %s report = %q, want %q", tt.report.Flavor, got, tt.want)
+		}
+	}
+}
+
+func TestMapRow(t *testing.T) {
+	row := map[string]interface{}{"name": "web", "ip-netmask": "10.0.0.1", "location": "vsys"}
+
+	tests := []struct {
+		name     string
+		mappings []ColumnMapping
+		want     map[string]interface{}
+	}{
+		{"no mappings", nil, row},
+		{"select and rename", []ColumnMapping{{Field: "name", Column: "Object"}, {Field: "ip-netmask"}},
+			map[string]interface{}{"Object": "web", "ip-netmask": "10.0.0.1"}},
+		{"attribute field", []ColumnMapping{{Field: "@name"}, {Field: "@location", Column: "Where"}},
+			map[string]interface{}{"name": "web", "Where": "vsys"}},
+		{"missing field", []ColumnMapping{{Field: "fqdn"}, {Field: "name"}},
+			map[string]interface{}{"name": "web"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := Report{Mappings: tt.mappings}
+			if got := r.MapRow(row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("MapRow = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultColumns(t *testing.T) {
+	tests := []struct {
+		name   string
+		report Report
+		want   []string
+	}{
+		{"none", Report{}, []string{}},
+		{"columns", Report{Columns: []string{"@name", "profile-setting.@name", "description"}}, []string{"name", "profile-setting.name", "description"}},
+		{"mappings win", Report{Columns: []string{"a"}, Mappings: []ColumnMapping{{Field: "@name"}, {Field: "x", Column: "Y"}}}, []string{"name", "Y"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.report.DefaultColumns(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DefaultColumns = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
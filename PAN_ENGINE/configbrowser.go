@@ -0,0 +1,163 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	// configBrowserKey is the report data key of the last browsed XPath
+	configBrowserKey = "config_browser"
+
+	// configCompareKey is the report data key of the last comparison
+	configCompareKey = "config_compare"
+
+	// configRoot is where browsing starts
+	configRoot = "/config"
+)
+
+// configXPath checks an XPath given to the config browser, defaulting to
+// the configuration root
+func configXPath(xpath string) (string, error) {
+	xpath = strings.TrimSpace(xpath)
+	if xpath == "" {
+		return configRoot, nil
+	}
+	if !strings.HasPrefix(xpath, configRoot) {
+		return "", fmt.Errorf("config XPath must start with %s", configRoot)
+	}
+	if len(xpath) > len(configRoot) {
+		xpath = strings.TrimRight(xpath, "/")
+	}
+	return xpath, nil
+}
+
+// BrowseConfig reads the configuration at an XPath from the running
+// (action=show) or candidate (action=get) configuration. It returns the
+// child nodes for tree navigation, the decoded element and the rows the
+// exporters use; the rows are kept for ExportToCSV and ExportToPDF under
+// the report type "config_browser".
+func (a *App) BrowseConfig(xpath, source string) (map[string]interface{}, error) {
+	if a.apiURL == "" || a.apiKey == "" {
+		return nil, fmt.Errorf("API URL and Key must be configured first")
+	}
+	xpath, err := configXPath(xpath)
+	if err != nil {
+		return nil, err
+	}
+	source = strings.ToLower(strings.TrimSpace(source))
+	if source == "" {
+		source = panclient.ConfigRunning
+	}
+
+	client, err := a.apiClient()
+	if err != nil {
+		return nil, err
+	}
+
+	utils.InfoLogger.Printf("Browsing %s configuration at %s", source, xpath)
+	resp, element, err := client.ReadConfig(a.requestContext(), source, xpath)
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, operatorError(err)
+	}
+
+	var value interface{}
+	if element != nil {
+		value = element.ToValue()
+	}
+	rows := resp.Rows()
+
+	a.reportMu.Lock()
+	a.storeReportData(configBrowserKey, rows)
+	a.reportProfiles[configBrowserKey] = a.activeProfileName()
+	a.reportMu.Unlock()
+
+	return map[string]interface{}{
+		"xpath":      xpath,
+		"source":     source,
+		"children":   panclient.ConfigChildren(element, xpath),
+		"result":     value,
+		"rows":       rows,
+		"count":      len(rows),
+		"report_key": configBrowserKey,
+	}, nil
+}
+
+// CompareConfig compares the running and candidate configuration at an
+// XPath, listing the uncommitted changes below it. The changes are kept for
+// export under the report type "config_compare".
+func (a *App) CompareConfig(xpath string) (map[string]interface{}, error) {
+	if a.apiURL == "" || a.apiKey == "" {
+		return nil, fmt.Errorf("API URL and Key must be configured first")
+	}
+	xpath, err := configXPath(xpath)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := a.apiClient()
+	if err != nil {
+		return nil, err
+	}
+
+	utils.InfoLogger.Printf("Comparing running and candidate configuration at %s", xpath)
+	ctx := a.requestContext()
+	running, err := readConfigElement(ctx, client, panclient.ConfigRunning, xpath)
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, operatorError(err)
+	}
+	candidate, err := readConfigElement(ctx, client, panclient.ConfigCandidate, xpath)
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, operatorError(err)
+	}
+
+	changes := panclient.DiffConfig(running, candidate)
+	counts := map[string]int{"added": 0, "removed": 0, "changed": 0}
+	rows := make([]interface{}, 0, len(changes))
+	for _, c := range changes {
+		counts[c.Change]++
+		rows = append(rows, map[string]interface{}{
+			"path":      c.Path,
+			"change":    c.Change,
+			"running":   c.Running,
+			"candidate": c.Candidate,
+		})
+	}
+
+	a.reportMu.Lock()
+	a.storeReportData(configCompareKey, rows)
+	a.reportProfiles[configCompareKey] = a.activeProfileName()
+	a.reportMu.Unlock()
+
+	return map[string]interface{}{
+		"xpath":      xpath,
+		"changes":    rows,
+		"added":      counts["added"],
+		"removed":    counts["removed"],
+		"changed":    counts["changed"],
+		"identical":  len(changes) == 0,
+		"report_key": configCompareKey,
+	}, nil
+}
+
+// readConfigElement reads one side of a comparison. A path missing from
+// that configuration compares as empty, so adding or deleting the whole
+// node shows as changes.
+func readConfigElement(ctx context.Context, client *panclient.Client, source, xpath string) (*panclient.Node, error) {
+	_, element, err := client.ReadConfig(ctx, source, xpath)
+	if panclient.IsKind(err, panclient.KindObjectNotPresent) {
+		return nil, nil
+	}
+	return element, err
+}
@@ -0,0 +1,183 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/opcmd"
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// opHistoryFile holds the op commands run from the console
+const opHistoryFile = "op_history.json"
+
+// maxOpHistory caps how many console commands are remembered
+const maxOpHistory = 100
+
+// opHistoryEntry is one op command run from the console
+type opHistoryEntry struct {
+	Command    string    `json:"command"`
+	XML        string    `json:"xml"`
+	Profile    string    `json:"profile"`
+	Status     string    `json:"status"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	RanAt      time.Time `json:"ran_at"`
+}
+
+// opHistoryPath returns the console history next to the settings file
+func (a *App) opHistoryPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), opHistoryFile)
+}
+
+// loadOpHistory reads the console history. A missing file means none.
+func (a *App) loadOpHistory() error {
+	data, err := ioutil.ReadFile(a.opHistoryPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var history []opHistoryEntry
+	if err := json.Unmarshal(data, &history); err != nil {
+		return fmt.Errorf("failed to parse op command history: %v", err)
+	}
+	a.opHistoryMu.Lock()
+	a.opHistory = history
+	a.opHistoryMu.Unlock()
+	return nil
+}
+
+// recordOpCommand adds a command to the console history, dropping the
+// oldest beyond maxOpHistory. Failures are only logged.
+func (a *App) recordOpCommand(entry opHistoryEntry) {
+	a.opHistoryMu.Lock()
+	defer a.opHistoryMu.Unlock()
+
+	a.opHistory = append(a.opHistory, entry)
+	if len(a.opHistory) > maxOpHistory {
+		a.opHistory = a.opHistory[len(a.opHistory)-maxOpHistory:]
+	}
+
+	if err := a.writeOpHistory(); err != nil {
+		utils.ErrorLogger.Printf("Could not save op command history: %v", err)
+	}
+}
+
+// writeOpHistory writes the console history. The caller holds opHistoryMu.
+func (a *App) writeOpHistory() error {
+	history := a.opHistory
+	if history == nil {
+		history = []opHistoryEntry{}
+	}
+
+	data, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal op command history: %v", err)
+	}
+	if err := secretstore.WriteFilePrivate(a.opHistoryPath(), data); err != nil {
+		return fmt.Errorf("failed to write op command history: %v", err)
+	}
+	return nil
+}
+
+// TranslateOpCommand returns the XML an op command in CLI syntax is sent as
+func (a *App) TranslateOpCommand(command string) (string, error) {
+	return opcmd.XML(command)
+}
+
+// ExecuteOpCommand runs an op command on the connected device. The command
+// is given in CLI syntax ("show session id 1234", quoting values with
+// spaces) or as XML. The result is returned as the decoded <result>, the
+// flattened rows the exporters use and the raw response XML, and the
+// command is added to the console history.
+func (a *App) ExecuteOpCommand(command string) (map[string]interface{}, error) {
+	command = strings.TrimSpace(command)
+	if a.apiURL == "" || a.apiKey == "" {
+		return nil, fmt.Errorf("API URL and Key must be configured first")
+	}
+
+	cmd, err := opcmd.XML(command)
+	if err != nil {
+		return nil, err
+	}
+
+	client, err := a.apiClient()
+	if err != nil {
+		return nil, err
+	}
+
+	utils.InfoLogger.Printf("Running op command on %s: %s", a.activeProfileName(), cmd)
+	start := time.Now()
+	resp, err := client.Op(a.requestContext(), cmd)
+	duration := time.Since(start)
+
+	entry := opHistoryEntry{
+		Command:    command,
+		XML:        cmd,
+		Profile:    a.activeProfileName(),
+		Status:     "success",
+		DurationMS: duration.Milliseconds(),
+		RanAt:      start,
+	}
+	if err != nil {
+		entry.Status = "error"
+		entry.Error = err.Error()
+		a.recordOpCommand(entry)
+		a.handleAuthFailure(err)
+		return nil, err
+	}
+	a.recordOpCommand(entry)
+
+	return map[string]interface{}{
+		"command":     command,
+		"xml":         cmd,
+		"status":      resp.Status,
+		"result":      resp.Result,
+		"rows":        resp.Rows(),
+		"output":      string(resp.Raw),
+		"duration_ms": entry.DurationMS,
+	}, nil
+}
+
+// GetOpCommandHistory returns the console history, newest first
+func (a *App) GetOpCommandHistory() []map[string]interface{} {
+	a.opHistoryMu.Lock()
+	defer a.opHistoryMu.Unlock()
+
+	history := make([]map[string]interface{}, 0, len(a.opHistory))
+	for i := len(a.opHistory) - 1; i >= 0; i-- {
+		e := a.opHistory[i]
+		history = append(history, map[string]interface{}{
+			"command":     e.Command,
+			"xml":         e.XML,
+			"profile":     e.Profile,
+			"status":      e.Status,
+			"error":       e.Error,
+			"duration_ms": e.DurationMS,
+			"ran_at":      e.RanAt.Format(time.RFC3339),
+		})
+	}
+	return history
+}
+
+// ClearOpCommandHistory forgets every console command
+func (a *App) ClearOpCommandHistory() error {
+	a.opHistoryMu.Lock()
+	defer a.opHistoryMu.Unlock()
+
+	a.opHistory = nil
+	return a.writeOpHistory()
+}
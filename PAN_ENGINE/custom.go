@@ -0,0 +1,308 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/opcmd"
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// customReportsFile holds the reports users defined in the app
+const customReportsFile = "custom_reports.json"
+
+// customCategory is the catalog category of every custom report
+const customCategory = "Custom"
+
+// restPathPrefix matches the /restapi/<version>/ part of a pasted REST path,
+// which is replaced by the version of the connected device
+var restPathPrefix = regexp.MustCompile(`^/?restapi/v[0-9.]+/`)
+
+// customReportsPath returns the custom reports file next to the settings file
+func (a *App) customReportsPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), customReportsFile)
+}
+
+// loadCustomReports reads the saved custom reports. A missing file means none.
+func (a *App) loadCustomReports() error {
+	data, err := ioutil.ReadFile(a.customReportsPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var reports []catalog.Report
+	if err := json.Unmarshal(data, &reports); err != nil {
+		return fmt.Errorf("failed to parse custom reports: %v", err)
+	}
+	for i := range reports {
+		reports[i].Custom = true
+	}
+	a.customReports = reports
+	return nil
+}
+
+// saveCustomReports writes the custom reports file
+func (a *App) saveCustomReports(reports []catalog.Report) error {
+	if reports == nil {
+		reports = []catalog.Report{}
+	}
+
+	data, err := json.MarshalIndent(reports, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal custom reports: %v", err)
+	}
+	if err := secretstore.WriteFilePrivate(a.customReportsPath(), data); err != nil {
+		return fmt.Errorf("failed to write custom reports file: %v", err)
+	}
+	return nil
+}
+
+// SaveCustomReport defines a report from any API path and adds it to the
+// report types, where it can be generated, batch exported and scheduled
+// like the built-in ones. Settings:
+//   - name: the report label (required)
+//   - source: "rest", "config" or "op"
+//   - path: the REST resource (e.g. "Objects/Addresses"), the config XPath,
+//     or the op command in CLI ("show session id 1234") or XML form
+//   - action: for config reports, "show" for the running configuration
+//     (default) or "get" for the candidate
+//   - row_path: where rows are read from, a slash separated path below the
+//     XML <response> or the REST envelope; empty uses the result entries
+//   - columns: comma separated fields to export, each optionally renamed
+//     as field=Column; empty exports every field
+//   - description and min_version
+//
+// Passing the key of an existing custom report updates it.
+func (a *App) SaveCustomReport(settings map[string]string) (map[string]interface{}, error) {
+	report, err := customReportFromSettings(settings)
+	if err != nil {
+		return nil, err
+	}
+
+	if key := strings.TrimSpace(settings["key"]); key != "" {
+		report.Key = key
+	} else {
+		report.Key = customReportKey(report.Label)
+	}
+	if existing, ok := a.reportCatalog().Get(report.Key); ok && !existing.Custom {
+		return nil, fmt.Errorf("%s is a built-in report type; choose another name", report.Key)
+	}
+
+	reports := append([]catalog.Report(nil), a.customReports...)
+	replaced := false
+	for i, r := range reports {
+		if r.Key == report.Key {
+			reports[i] = report
+			replaced = true
+		}
+	}
+	if !replaced {
+		if settings["key"] != "" {
+			return nil, fmt.Errorf("custom report %s not found", report.Key)
+		}
+		reports = append(reports, report)
+	}
+
+	// Check the definition against the whole catalog before saving it
+	if err := catalog.Default().Merge(catalog.Catalog{Reports: reports}); err != nil {
+		return nil, err
+	}
+	if err := a.saveCustomReports(reports); err != nil {
+		return nil, err
+	}
+	a.customReports = reports
+	if err := a.loadCatalog(); err != nil {
+		utils.ErrorLogger.Printf("Could not load report catalog overrides: %v", err)
+	}
+
+	utils.InfoLogger.Printf("Custom report saved: %s (%s %s)", report.Key, report.Flavor, customReportPath(report))
+	return customReportSummary(report), nil
+}
+
+// ListCustomReports returns the custom report definitions
+func (a *App) ListCustomReports() []map[string]interface{} {
+	reports := make([]map[string]interface{}, 0, len(a.customReports))
+	for _, r := range a.customReports {
+		reports = append(reports, customReportSummary(r))
+	}
+	return reports
+}
+
+// DeleteCustomReport removes a custom report. Reports still used by a
+// schedule are kept.
+func (a *App) DeleteCustomReport(key string) error {
+	for _, s := range a.schedules {
+		if s.ReportType == key {
+			return fmt.Errorf("custom report %s is used by schedule %s; delete the schedule first", key, s.ID)
+		}
+	}
+
+	reports := make([]catalog.Report, 0, len(a.customReports))
+	for _, r := range a.customReports {
+		if r.Key != key {
+			reports = append(reports, r)
+		}
+	}
+	if len(reports) == len(a.customReports) {
+		return fmt.Errorf("custom report %s not found", key)
+	}
+
+	if err := a.saveCustomReports(reports); err != nil {
+		return err
+	}
+	a.customReports = reports
+	if err := a.loadCatalog(); err != nil {
+		utils.ErrorLogger.Printf("Could not load report catalog overrides: %v", err)
+	}
+
+	utils.InfoLogger.Printf("Custom report deleted: %s", key)
+	return nil
+}
+
+// customReportFromSettings builds a catalog entry from SaveCustomReport
+// settings
+func customReportFromSettings(settings map[string]string) (catalog.Report, error) {
+	report := catalog.Report{
+		Label:       strings.TrimSpace(settings["name"]),
+		Category:    customCategory,
+		Description: strings.TrimSpace(settings["description"]),
+		Flavor:      strings.ToLower(strings.TrimSpace(settings["source"])),
+		RowPath:     strings.Trim(strings.TrimSpace(settings["row_path"]), "/"),
+		MinVersion:  strings.TrimSpace(settings["min_version"]),
+		Custom:      true,
+	}
+	if report.Label == "" {
+		return report, fmt.Errorf("custom report name is required")
+	}
+
+	path := strings.TrimSpace(settings["path"])
+	if path == "" {
+		return report, fmt.Errorf("custom report path is required")
+	}
+
+	switch report.Flavor {
+	case catalog.FlavorREST:
+		report.Endpoint = restPathPrefix.ReplaceAllString(path, "")
+		report.Endpoint = strings.TrimPrefix(report.Endpoint, "/")
+		report.Scope = catalog.ScopeLocation
+
+	case catalog.FlavorConfig:
+		if !strings.HasPrefix(path, "/config") {
+			return report, fmt.Errorf("config XPath must start with /config")
+		}
+		report.XPath = path
+		report.Action = strings.ToLower(strings.TrimSpace(settings["action"]))
+		if report.Action == catalog.ActionShow {
+			report.Action = ""
+		}
+
+	case catalog.FlavorOp:
+		if _, err := opcmd.XML(path); err != nil {
+			return report, err
+		}
+		if strings.HasPrefix(path, "<") {
+			report.Endpoint = path
+		} else {
+			report.Command = path
+		}
+
+	default:
+		return report, fmt.Errorf("invalid source %q: must be rest, config or op", settings["source"])
+	}
+
+	mappings, err := parseColumnMappings(settings["columns"])
+	if err != nil {
+		return report, err
+	}
+	report.Mappings = mappings
+	return report, nil
+}
+
+// parseColumnMappings reads "field=Column, other" into column mappings
+func parseColumnMappings(s string) ([]catalog.ColumnMapping, error) {
+	var mappings []catalog.ColumnMapping
+	for _, item := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == '\n' }) {
+		field, column, _ := strings.Cut(item, "=")
+		field, column = strings.TrimSpace(field), strings.TrimSpace(column)
+		if field == "" {
+			if column == "" {
+				continue
+			}
+			return nil, fmt.Errorf("column %q has no field", column)
+		}
+		mappings = append(mappings, catalog.ColumnMapping{Field: field, Column: column})
+	}
+	return mappings, nil
+}
+
+// customReportKey derives a report type key from a custom report name
+func customReportKey(name string) string {
+	var key strings.Builder
+	key.WriteString("custom_")
+	underscore := true
+	for _, r := range strings.ToLower(name) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			key.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			key.WriteRune('_')
+			underscore = true
+		}
+	}
+	return strings.TrimSuffix(key.String(), "_")
+}
+
+// customReportPath returns the path a custom report was defined with
+func customReportPath(r catalog.Report) string {
+	switch {
+	case r.Flavor == catalog.FlavorConfig:
+		return r.XPath
+	case r.Command != "":
+		return r.Command
+	}
+	return r.Endpoint
+}
+
+// customReportSummary describes a custom report in the shape
+// SaveCustomReport accepts
+func customReportSummary(r catalog.Report) map[string]interface{} {
+	columns := make([]string, 0, len(r.Mappings))
+	for _, m := range r.Mappings {
+		if m.Column != "" && m.Column != m.Field {
+			columns = append(columns, m.Field+"="+m.Column)
+		} else {
+			columns = append(columns, m.Field)
+		}
+	}
+
+	action := r.Action
+	if r.Flavor == catalog.FlavorConfig && action == "" {
+		action = catalog.ActionShow
+	}
+
+	return map[string]interface{}{
+		"key":         r.Key,
+		"name":        r.Label,
+		"source":      r.Flavor,
+		"path":        customReportPath(r),
+		"action":      action,
+		"row_path":    r.RowPath,
+		"columns":     strings.Join(columns, ", "),
+		"description": r.Description,
+		"min_version": r.MinVersion,
+	}
+}
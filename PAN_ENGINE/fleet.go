@@ -0,0 +1,412 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/logquery"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// columnDeviceProfile names the profile each row of a fleet report came from
+const columnDeviceProfile = "device_profile"
+
+// columnDeviceSite records the inventory site of each row of a fleet report
+const columnDeviceSite = "device_site"
+
+const (
+	// defaultFleetParallelism is how many devices a fleet run queries at once
+	defaultFleetParallelism = 4
+
+	// maxFleetParallelism caps the "parallelism" option
+	maxFleetParallelism = 16
+)
+
+// fleetDeviceResult is the outcome of a fleet report on one device
+type fleetDeviceResult struct {
+	name     string
+	profile  string
+	site     string
+	hostname string
+	serial   string
+	// data is the fetched report, tagged with tags as it is merged
+	data     interface{}
+	tags     map[string]interface{}
+	rows     int
+	err      error
+	duration time.Duration
+}
+
+// fleetTarget is one device of a fleet run. Profile carries the credentials,
+// TLS settings and default scope, with APIURL set to the device's URL.
+type fleetTarget struct {
+	// Name identifies the device in results: a profile name or inventory hostname
+	Name    string
+	Site    string
+	Profile ConnectionProfile
+}
+
+// resolveFleetTargets expands profile names, inventory hostnames and
+// "tag:"/"site:" group selectors into the devices to run against, in
+// selector order without duplicates. A tag selects both profiles and
+// inventory devices carrying it.
+func (a *App) resolveFleetTargets(selectors []string) ([]fleetTarget, error) {
+	seen := make(map[string]bool)
+	var targets []fleetTarget
+
+	add := func(t fleetTarget) {
+		key := strings.ToLower(t.Profile.APIURL)
+		if !seen[key] {
+			seen[key] = true
+			targets = append(targets, t)
+		}
+	}
+
+	for _, selector := range selectors {
+		selector = strings.TrimSpace(selector)
+		if selector == "" {
+			continue
+		}
+
+		if kind, value, ok := parseGroupSelector(selector); ok {
+			matched := false
+			if kind == groupByTag {
+				for _, p := range a.profiles {
+					if hasTag(p.Tags, value) {
+						add(fleetTarget{Name: p.Name, Profile: p})
+						matched = true
+					}
+				}
+			}
+			for _, d := range a.inventory.Devices {
+				if d.inGroup(kind, value) {
+					t, err := a.inventoryTarget(d)
+					if err != nil {
+						return nil, err
+					}
+					add(t)
+					matched = true
+				}
+			}
+			if !matched {
+				return nil, fmt.Errorf("group %s has no devices", selector)
+			}
+			continue
+		}
+
+		if i := a.findProfile(selector); i >= 0 {
+			add(fleetTarget{Name: a.profiles[i].Name, Profile: a.profiles[i]})
+			continue
+		}
+		if d := a.findInventoryDevice(selector); d != nil {
+			t, err := a.inventoryTarget(*d)
+			if err != nil {
+				return nil, err
+			}
+			add(t)
+			continue
+		}
+		return nil, fmt.Errorf("%s is not a profile, inventory device or group", selector)
+	}
+
+	if len(targets) == 0 {
+		return nil, fmt.Errorf("no devices selected")
+	}
+	return targets, nil
+}
+
+// hasTag reports whether tags contains tag, ignoring case
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// fleetParallelism returns how many devices to query at once. The
+// "parallelism" option overrides the default.
+func fleetParallelism(options map[string]string) (int, error) {
+	value := strings.TrimSpace(options["parallelism"])
+	if value == "" {
+		return defaultFleetParallelism, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid parallelism value %q: must be a positive number", value)
+	}
+	if n > maxFleetParallelism {
+		n = maxFleetParallelism
+	}
+	return n, nil
+}
+
+// RunFleetReport runs one report type against several devices concurrently
+// and merges the rows into one dataset. Targets are profile names, inventory
+// hostnames or "tag:<tag>" and "site:<site>" groups. Every row gets
+// device_profile, device_hostname and device_serial columns, plus
+// device_site for inventory devices. A device that fails is reported in
+// "devices" and does not stop the others. Options are those of
+// GenerateReport, plus parallelism to bound how many devices are queried
+// at once.
+func (a *App) RunFleetReport(reportType string, targets []string, startDate, endDate string, options map[string]string) (map[string]interface{}, error) {
+	utils.InfoLogger.Printf("Running fleet report: type=%s, targets=%v, start=%s, end=%s", reportType, targets, startDate, endDate)
+
+	report, ok := a.reportCatalog().Get(reportType)
+	if !ok {
+		return nil, fmt.Errorf("unknown report type: %s", reportType)
+	}
+	if strings.TrimSpace(options["target"]) != "" {
+		return nil, fmt.Errorf("a Panorama target cannot be combined with a fleet run")
+	}
+
+	devices, err := a.resolveFleetTargets(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	logType := report.LogType()
+	if err := checkReportOptions(reportType, logType, startDate, endDate, options); err != nil {
+		return nil, err
+	}
+
+	// Reject malformed filters once rather than on every device
+	filter, limit := "", 0
+	if logType != "" {
+		if limit, err = a.logLimit(options); err != nil {
+			return nil, err
+		}
+		if filter, err = logFilter(logType, options); err != nil {
+			return nil, err
+		}
+	}
+
+	parallelism, err := fleetParallelism(options)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, done := a.startReport(reportType)
+	defer done()
+
+	// Device rows are merged into one row set as each device finishes, so
+	// the fleet's rows spill to disk rather than being held in memory
+	var (
+		wg sync.WaitGroup
+		mu sync.Mutex
+	)
+	rows := a.newRowSet()
+	results := make([]fleetDeviceResult, len(devices))
+	semaphore := make(chan struct{}, parallelism)
+
+	for i, device := range devices {
+		wg.Add(1)
+		go func(i int, t fleetTarget) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			result := a.runFleetDevice(ctx, t, report, startDate, endDate, filter, limit, options)
+			if result.err == nil {
+				mu.Lock()
+				result.rows, result.err = tagRows(rows, result.data, result.tags)
+				mu.Unlock()
+				result.data = nil
+			}
+			result.duration = time.Since(start)
+			if result.err != nil {
+				utils.ErrorLogger.Printf("Fleet report %s on %s failed: %v", reportType, t.Name, result.err)
+			}
+			results[i] = result
+		}(i, device)
+	}
+	wg.Wait()
+
+	if ctx.Err() == context.Canceled {
+		rows.close()
+		return nil, fmt.Errorf("%s fleet report cancelled", reportType)
+	}
+
+	deviceResults := make([]map[string]interface{}, 0, len(results))
+	var succeeded []string
+
+	for _, r := range results {
+		device := map[string]interface{}{
+			"name":        r.name,
+			"profile":     r.profile,
+			"site":        r.site,
+			"hostname":    r.hostname,
+			"serial":      r.serial,
+			"duration_ms": r.duration.Milliseconds(),
+		}
+		if r.err != nil {
+			for k, v := range apiErrorDetails(r.err) {
+				device[k] = v
+			}
+			device["success"] = false
+		} else {
+			device["success"] = true
+			device["rows"] = r.rows
+			succeeded = append(succeeded, r.name)
+		}
+		deviceResults = append(deviceResults, device)
+	}
+
+	// Store the merged rows for export, labelled with every device that
+	// contributed, reading them back for the frontend before a newer run
+	// can replace them
+	if len(succeeded) > 0 {
+		sort.Strings(succeeded)
+		a.reportMu.Lock()
+		a.storeReportData(reportType, rows)
+		a.reportProfiles[reportType] = "fleet: " + strings.Join(succeeded, ", ")
+		release := acquireData(rows)
+		a.reportMu.Unlock()
+		defer release()
+	} else {
+		defer rows.close()
+	}
+
+	utils.InfoLogger.Printf("Fleet report %s finished: %d of %d devices, %d rows", reportType, len(succeeded), len(results), rows.len())
+
+	return map[string]interface{}{
+		"result":  reportView(rows),
+		"devices": deviceResults,
+		"_summary": map[string]interface{}{
+			"report_type": reportType,
+			"total":       len(results),
+			"successful":  len(succeeded),
+			"failed":      len(results) - len(succeeded),
+			"rows":        rows.len(),
+			"date_range":  map[string]string{"start": startDate, "end": endDate},
+			"timestamp":   time.Now().Format(time.RFC3339),
+		},
+	}, nil
+}
+
+// runFleetDevice runs a report on one device with its own client, so the
+// active connection and what is known about it are left untouched
+func (a *App) runFleetDevice(ctx context.Context, t fleetTarget, report catalog.Report, startDate, endDate, filter string, limit int, options map[string]string) fleetDeviceResult {
+	p := t.Profile
+	result := fleetDeviceResult{name: t.Name, profile: p.Name, site: t.Site}
+
+	fail := func(err error) fleetDeviceResult {
+		result.err = err
+		return result
+	}
+
+	key, err := a.profileKey(&p)
+	if err != nil {
+		return fail(fmt.Errorf("could not read the API key: %v", err))
+	}
+	if p.APIURL == "" || key == "" {
+		return fail(fmt.Errorf("profile %s has no API URL or key", p.Name))
+	}
+
+	opts, err := a.profileClientOptions(&p)
+	if err != nil {
+		return fail(err)
+	}
+	client, err := panclient.New(p.APIURL, key, opts...)
+	if err != nil {
+		return fail(err)
+	}
+	defer client.Close()
+
+	// Each device gets the endpoint and scope matching its own version and type
+	info, err := client.SystemInfo(ctx)
+	if err != nil {
+		return fail(err)
+	}
+	result.hostname = info.Hostname
+	result.serial = info.Serial
+
+	version, err := panclient.ParseVersion(info.SWVersion)
+	if err != nil {
+		return fail(err)
+	}
+	restVersion, _ := panclient.RESTVersionFor(version)
+	if supported, reason := reportSupportedOn(report, &version, restVersion); !supported {
+		return fail(fmt.Errorf("report type %s is unsupported: %s", report.Key, reason))
+	}
+
+	endpoint := report.EndpointFor(restVersion)
+	if report.Scoped() {
+		scope, err := buildScope(profileScope(&p, options), info.IsPanorama())
+		if err != nil {
+			return fail(err)
+		}
+		endpoint = withQuery(endpoint, scope.Query())
+	}
+
+	// Dates are interpreted in each device's own time zone
+	logType := logTypeForEndpoint(endpoint)
+	query := ""
+	if logType != "" {
+		loc, err := client.DeviceLocation(ctx)
+		if err != nil {
+			utils.ErrorLogger.Printf("Could not read the clock of %s, using local time zone: %v", t.Name, err)
+			loc = time.Local
+		}
+		timeRange, err := panclient.TimeRangeQuery(startDate, endDate, loc)
+		if err != nil {
+			return fail(err)
+		}
+		query = logquery.Combine(filter, timeRange)
+	}
+
+	data, err := a.fetchReport(ctx, client, endpoint, report, logType, query, limit)
+	if err != nil {
+		return fail(err)
+	}
+
+	result.data = data
+	result.tags = map[string]interface{}{
+		columnDeviceSerial:   info.Serial,
+		columnDeviceHostname: info.Hostname,
+		columnDeviceProfile:  p.Name,
+	}
+	if t.Site != "" {
+		result.tags[columnDeviceSite] = t.Site
+	}
+	return result
+}
+
+// generateGroupReport runs a GenerateReport call whose target is an
+// inventory group as a fleet run. It only fails when no device succeeded.
+func (a *App) generateGroupReport(reportType, group, startDate, endDate string, options map[string]string) (interface{}, error) {
+	fleetOptions := make(map[string]string, len(options))
+	for k, v := range options {
+		if k != "target" {
+			fleetOptions[k] = v
+		}
+	}
+
+	result, err := a.RunFleetReport(reportType, []string{group}, startDate, endDate, fleetOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	if summary, ok := result["_summary"].(map[string]interface{}); ok && summary["successful"] == 0 {
+		devices, _ := result["devices"].([]map[string]interface{})
+		if len(devices) > 0 {
+			return nil, fmt.Errorf("%s report failed on every device in %s; %s: %v", reportType, group, devices[0]["name"], devices[0]["error"])
+		}
+		return nil, fmt.Errorf("%s report failed on every device in %s", reportType, group)
+	}
+	return result, nil
+}
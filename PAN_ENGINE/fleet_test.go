@@ -0,0 +1,101 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// fakeFirewall answers op commands with the interfaces of a firewall
+func fakeFirewall(t *testing.T, hostname, serial string, interfaces int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		if r.FormValue("cmd") == "<show><system><info></info></system></show>" {
+			fmt.Fprintf(w, `<response status="success"><result><system><hostname>%s</hostname><serial>%s</serial><model>PA-440</model><sw-version>11.1.0</sw-version><family>400</family></system></result></response>`, hostname, serial)
+			return
+		}
+		fmt.Fprint(w, `<response status="success"><result><ifnet>`)
+		for i := 0; i < interfaces; i++ {
+			fmt.Fprintf(w, `<entry><name>ethernet1/%d</name><zone>trust</zone></entry>`, i+1)
+		}
+		fmt.Fprint(w, `</ifnet></result></response>`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestRunFleetReportMergesIntoRowSet(t *testing.T) {
+	a, _ := profileTestApp(t)
+	a.spillRows = 2
+	defer a.shutdown(a.requestContext())
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	targets := map[string]string{
+		"fw1": fakeFirewall(t, "fw1", "0001", 3).URL,
+		"fw2": fakeFirewall(t, "fw2", "0002", 4).URL,
+		"fw3": down.URL,
+	}
+	for name, url := range targets {
+		if _, err := a.CreateProfile(name, url, "key", map[string]string{"max_attempts": "1"}); err != nil {
+			t.Fatalf("CreateProfile(%s) failed: %v", name, err)
+		}
+	}
+
+	result, err := a.RunFleetReport("interfaceInfo", []string{"fw1", "fw2", "fw3"}, "", "", nil)
+	if err != nil {
+		t.Fatalf("RunFleetReport failed: %v", err)
+	}
+
+	summary, ok := result["_summary"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("result has no summary: %v", result)
+	}
+	if summary["successful"] != 2 || summary["failed"] != 1 || summary["rows"] != 7 {
+		t.Errorf("summary = %v, want 2 successful, 1 failed and 7 rows", summary)
+	}
+
+	devices, ok := result["devices"].([]map[string]interface{})
+	if !ok || len(devices) != 3 {
+		t.Fatalf("devices = %v, want three", result["devices"])
+	}
+	for _, d := range devices {
+		if want := d["name"] != "fw3"; d["success"] != want {
+			t.Errorf("device %v: success = %v, want %v", d["name"], d["success"], want)
+		}
+	}
+
+	// The merged rows are kept as a spilled row set, not a slice
+	data, release, ok := a.acquireReportData("interfaceInfo")
+	defer release()
+	rows, isSet := data.(*rowSet)
+	if !ok || !isSet {
+		t.Fatalf("stored report data is %T, want *rowSet", data)
+	}
+	if rows.len() != 7 || !rows.spilled() {
+		t.Errorf("stored %d rows, spilled %v; want 7 spilled rows", rows.len(), rows.spilled())
+	}
+	if view, ok := result["result"].(map[string]interface{}); !ok || view["total_rows"] != 7 {
+		t.Errorf("result = %v, want a preview of 7 rows", result["result"])
+	}
+
+	perDevice := map[interface{}]int{}
+	rows.each(func(row map[string]interface{}) error {
+		perDevice[row[columnDeviceHostname]]++
+		if row[columnDeviceProfile] != row[columnDeviceHostname] {
+			t.Errorf("row of %v tagged with profile %v", row[columnDeviceHostname], row[columnDeviceProfile])
+		}
+		return nil
+	})
+	if perDevice["fw1"] != 3 || perDevice["fw2"] != 4 {
+		t.Errorf("rows per device = %v, want fw1: 3, fw2: 4", perDevice)
+	}
+}
@@ -1,19 +1,55 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function BatchExportReports(arg1:Array<string>,arg2:string,arg3:string,arg4:string):Promise<Record<string, any>>;
+export function BatchExportReports(arg1:Array<string>,arg2:string,arg3:string,arg4:string,arg5:Record<string, string>):Promise<Record<string, any>>;
+
+export function BrowseConfig(arg1:string,arg2:string):Promise<Record<string, any>>;
+
+export function BuildLogQuery(arg1:string,arg2:Array<Record<string, string>>,arg3:string):Promise<string>;
+
+export function CancelReport(arg1:string):Promise<boolean>;
+
+export function ChangeVaultPassphrase(arg1:string,arg2:string):Promise<boolean>;
+
+export function ClearAPIKey():Promise<boolean>;
+
+export function ClearOpCommandHistory():Promise<void>;
+
+export function CloneProfile(arg1:string,arg2:string):Promise<boolean>;
+
+export function CompareConfig(arg1:string):Promise<Record<string, any>>;
+
+export function CreateProfile(arg1:string,arg2:string,arg3:string,arg4:Record<string, string>):Promise<boolean>;
+
+export function DeleteCustomReport(arg1:string):Promise<void>;
+
+export function DeleteProfile(arg1:string):Promise<boolean>;
 
 export function DeleteReport(arg1:string):Promise<void>;
 
+export function DeleteScheduledReport(arg1:string):Promise<boolean>;
+
+export function ExecuteOpCommand(arg1:string):Promise<Record<string, any>>;
+
 export function ExportToCSV(arg1:string):Promise<string>;
 
 export function ExportToPDF(arg1:string):Promise<string>;
 
 export function FilterReportData(arg1:string,arg2:Record<string, string>):Promise<Record<string, any>>;
 
-export function GenerateReport(arg1:string,arg2:string,arg3:string):Promise<Record<string, any>>;
+export function GenerateReport(arg1:string,arg2:string,arg3:string,arg4:Record<string, string>):Promise<any>;
+
+export function GetAPISettings():Promise<Record<string, any>>;
+
+export function GetAvailableScopes():Promise<Record<string, any>>;
 
-export function GetAPISettings():Promise<Record<string, string>>;
+export function GetKeyRotationPolicy():Promise<Record<string, number>>;
+
+export function GetLogQueryFields(arg1:string):Promise<Array<string>>;
+
+export function GetManagedDevices():Promise<Array<Record<string, any>>>;
+
+export function GetOpCommandHistory():Promise<Array<Record<string, any>>>;
 
 export function GetReportCategories():Promise<Array<string>>;
 
@@ -21,20 +57,62 @@ export function GetReportConfig():Promise<Record<string, any>>;
 
 export function GetReportHistory():Promise<Array<Record<string, any>>>;
 
+export function GetSecretStoreStatus():Promise<Record<string, any>>;
+
 export function GetSupportedReportTypes():Promise<Array<Record<string, string>>>;
 
 export function Greet(arg1:string):Promise<string>;
 
+export function ImportInventory(arg1:string,arg2:string,arg3:string):Promise<Record<string, any>>;
+
+export function ListCustomReports():Promise<Array<Record<string, any>>>;
+
+export function ListInventory():Promise<Array<Record<string, any>>>;
+
+export function ListInventoryGroups():Promise<Array<Record<string, any>>>;
+
+export function ListProfiles():Promise<Array<Record<string, any>>>;
+
 export function ListReports():Promise<Array<Record<string, string>>>;
 
+export function ListScheduledReports():Promise<Array<Record<string, any>>>;
+
+export function LockVault():Promise<boolean>;
+
+export function LoginWithCredentials(arg1:string,arg2:string,arg3:string):Promise<boolean>;
+
 export function OpenReport(arg1:string):Promise<void>;
 
+export function RemoveInventoryDevice(arg1:string):Promise<boolean>;
+
+export function RotateAPIKey(arg1:string,arg2:string):Promise<Record<string, any>>;
+
+export function RunFleetReport(arg1:string,arg2:Array<string>,arg3:string,arg4:string,arg5:Record<string, string>):Promise<Record<string, any>>;
+
 export function SaveAPISettings(arg1:string,arg2:string):Promise<boolean>;
 
-export function ScheduleReport(arg1:string,arg2:string,arg3:Array<string>):Promise<string>;
+export function SaveCustomReport(arg1:Record<string, string>):Promise<Record<string, any>>;
+
+export function ScheduleReport(arg1:string,arg2:string,arg3:Array<string>,arg4:string):Promise<string>;
 
 export function SearchAllReports(arg1:string):Promise<Record<string, any>>;
 
+export function SetDataLimits(arg1:number,arg2:number):Promise<boolean>;
+
+export function SetKeyRotationPolicy(arg1:number,arg2:number):Promise<boolean>;
+
 export function SetReportConfig(arg1:number,arg2:string):Promise<boolean>;
 
+export function SetSecretBackend(arg1:string,arg2:string):Promise<boolean>;
+
+export function SwitchProfile(arg1:string):Promise<boolean>;
+
 export function TestAPIConnection():Promise<Record<string, any>>;
+
+export function TranslateOpCommand(arg1:string):Promise<string>;
+
+export function UnlockVault(arg1:string):Promise<boolean>;
+
+export function UpdateProfile(arg1:string,arg2:Record<string, string>):Promise<boolean>;
+
+export function ValidateLogQuery(arg1:string,arg2:string):Promise<string>;
@@ -2,14 +2,66 @@
 // Cynhyrchwyd y ffeil hon yn awtomatig. PEIDIWCH Â MODIWL
 // This file is automatically generated. DO NOT EDIT
 
-export function BatchExportReports(arg1, arg2, arg3, arg4) {
-  return window['go']['main']['App']['BatchExportReports'](arg1, arg2, arg3, arg4);
+export function BatchExportReports(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['BatchExportReports'](arg1, arg2, arg3, arg4, arg5);
+}
+
+export function BrowseConfig(arg1, arg2) {
+  return window['go']['main']['App']['BrowseConfig'](arg1, arg2);
+}
+
+export function BuildLogQuery(arg1, arg2, arg3) {
+  return window['go']['main']['App']['BuildLogQuery'](arg1, arg2, arg3);
+}
+
+export function CancelReport(arg1) {
+  return window['go']['main']['App']['CancelReport'](arg1);
+}
+
+export function ChangeVaultPassphrase(arg1, arg2) {
+  return window['go']['main']['App']['ChangeVaultPassphrase'](arg1, arg2);
+}
+
+export function ClearAPIKey() {
+  return window['go']['main']['App']['ClearAPIKey']();
+}
+
+export function ClearOpCommandHistory() {
+  return window['go']['main']['App']['ClearOpCommandHistory']();
+}
+
+export function CloneProfile(arg1, arg2) {
+  return window['go']['main']['App']['CloneProfile'](arg1, arg2);
+}
+
+export function CompareConfig(arg1) {
+  return window['go']['main']['App']['CompareConfig'](arg1);
+}
+
+export function CreateProfile(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['CreateProfile'](arg1, arg2, arg3, arg4);
+}
+
+export function DeleteCustomReport(arg1) {
+  return window['go']['main']['App']['DeleteCustomReport'](arg1);
+}
+
+export function DeleteProfile(arg1) {
+  return window['go']['main']['App']['DeleteProfile'](arg1);
 }
 
 export function DeleteReport(arg1) {
   return window['go']['main']['App']['DeleteReport'](arg1);
 }
 
+export function DeleteScheduledReport(arg1) {
+  return window['go']['main']['App']['DeleteScheduledReport'](arg1);
+}
+
+export function ExecuteOpCommand(arg1) {
+  return window['go']['main']['App']['ExecuteOpCommand'](arg1);
+}
+
 export function ExportToCSV(arg1) {
   return window['go']['main']['App']['ExportToCSV'](arg1);
 }
@@ -22,14 +74,34 @@ export function FilterReportData(arg1, arg2) {
   return window['go']['main']['App']['FilterReportData'](arg1, arg2);
 }
 
-export function GenerateReport(arg1, arg2, arg3) {
-  return window['go']['main']['App']['GenerateReport'](arg1, arg2, arg3);
+export function GenerateReport(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['GenerateReport'](arg1, arg2, arg3, arg4);
 }
 
 export function GetAPISettings() {
   return window['go']['main']['App']['GetAPISettings']();
 }
 
+export function GetAvailableScopes() {
+  return window['go']['main']['App']['GetAvailableScopes']();
+}
+
+export function GetKeyRotationPolicy() {
+  return window['go']['main']['App']['GetKeyRotationPolicy']();
+}
+
+export function GetLogQueryFields(arg1) {
+  return window['go']['main']['App']['GetLogQueryFields'](arg1);
+}
+
+export function GetManagedDevices() {
+  return window['go']['main']['App']['GetManagedDevices']();
+}
+
+export function GetOpCommandHistory() {
+  return window['go']['main']['App']['GetOpCommandHistory']();
+}
+
 export function GetReportCategories() {
   return window['go']['main']['App']['GetReportCategories']();
 }
@@ -42,6 +114,10 @@ export function GetReportHistory() {
   return window['go']['main']['App']['GetReportHistory']();
 }
 
+export function GetSecretStoreStatus() {
+  return window['go']['main']['App']['GetSecretStoreStatus']();
+}
+
 export function GetSupportedReportTypes() {
   return window['go']['main']['App']['GetSupportedReportTypes']();
 }
@@ -50,30 +126,110 @@ export function Greet(arg1) {
   return window['go']['main']['App']['Greet'](arg1);
 }
 
+export function ImportInventory(arg1, arg2, arg3) {
+  return window['go']['main']['App']['ImportInventory'](arg1, arg2, arg3);
+}
+
+export function ListCustomReports() {
+  return window['go']['main']['App']['ListCustomReports']();
+}
+
+export function ListInventory() {
+  return window['go']['main']['App']['ListInventory']();
+}
+
+export function ListInventoryGroups() {
+  return window['go']['main']['App']['ListInventoryGroups']();
+}
+
+export function ListProfiles() {
+  return window['go']['main']['App']['ListProfiles']();
+}
+
 export function ListReports() {
   return window['go']['main']['App']['ListReports']();
 }
 
+export function ListScheduledReports() {
+  return window['go']['main']['App']['ListScheduledReports']();
+}
+
+export function LockVault() {
+  return window['go']['main']['App']['LockVault']();
+}
+
+export function LoginWithCredentials(arg1, arg2, arg3) {
+  return window['go']['main']['App']['LoginWithCredentials'](arg1, arg2, arg3);
+}
+
 export function OpenReport(arg1) {
   return window['go']['main']['App']['OpenReport'](arg1);
 }
 
+export function RemoveInventoryDevice(arg1) {
+  return window['go']['main']['App']['RemoveInventoryDevice'](arg1);
+}
+
+export function RotateAPIKey(arg1, arg2) {
+  return window['go']['main']['App']['RotateAPIKey'](arg1, arg2);
+}
+
+export function RunFleetReport(arg1, arg2, arg3, arg4, arg5) {
+  return window['go']['main']['App']['RunFleetReport'](arg1, arg2, arg3, arg4, arg5);
+}
+
 export function SaveAPISettings(arg1, arg2) {
   return window['go']['main']['App']['SaveAPISettings'](arg1, arg2);
 }
 
-export function ScheduleReport(arg1, arg2, arg3) {
-  return window['go']['main']['App']['ScheduleReport'](arg1, arg2, arg3);
+export function SaveCustomReport(arg1) {
+  return window['go']['main']['App']['SaveCustomReport'](arg1);
+}
+
+export function ScheduleReport(arg1, arg2, arg3, arg4) {
+  return window['go']['main']['App']['ScheduleReport'](arg1, arg2, arg3, arg4);
 }
 
 export function SearchAllReports(arg1) {
   return window['go']['main']['App']['SearchAllReports'](arg1);
 }
 
+export function SetDataLimits(arg1, arg2) {
+  return window['go']['main']['App']['SetDataLimits'](arg1, arg2);
+}
+
+export function SetKeyRotationPolicy(arg1, arg2) {
+  return window['go']['main']['App']['SetKeyRotationPolicy'](arg1, arg2);
+}
+
 export function SetReportConfig(arg1, arg2) {
   return window['go']['main']['App']['SetReportConfig'](arg1, arg2);
 }
 
+export function SetSecretBackend(arg1, arg2) {
+  return window['go']['main']['App']['SetSecretBackend'](arg1, arg2);
+}
+
+export function SwitchProfile(arg1) {
+  return window['go']['main']['App']['SwitchProfile'](arg1);
+}
+
 export function TestAPIConnection() {
   return window['go']['main']['App']['TestAPIConnection']();
 }
+
+export function TranslateOpCommand(arg1) {
+  return window['go']['main']['App']['TranslateOpCommand'](arg1);
+}
+
+export function UnlockVault(arg1) {
+  return window['go']['main']['App']['UnlockVault'](arg1);
+}
+
+export function UpdateProfile(arg1, arg2) {
+  return window['go']['main']['App']['UpdateProfile'](arg1, arg2);
+}
+
+export function ValidateLogQuery(arg1, arg2) {
+  return window['go']['main']['App']['ValidateLogQuery'](arg1, arg2);
+}
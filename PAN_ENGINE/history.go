@@ -0,0 +1,102 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// exportLogPath records which profile produced each exported file
+var exportLogPath = filepath.Join("Reports", "exports.json")
+
+// exportLogMu serializes updates to the export log
+var exportLogMu sync.Mutex
+
+// exportRecord describes one exported report file
+type exportRecord struct {
+	File       string    `json:"file"`
+	ReportType string    `json:"report_type"`
+	Format     string    `json:"format"`
+	Profile    string    `json:"profile"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// reportProfile returns the profile that produced the stored report data
+func (a *App) reportProfile(reportType string) string {
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+
+	if profile, ok := a.reportProfiles[reportType]; ok {
+		return profile
+	}
+	return a.activeProfileName()
+}
+
+// loadExportLog reads the export log keyed by file name. A missing or
+// unreadable log yields an empty map.
+func (a *App) loadExportLog() map[string]exportRecord {
+	records := make(map[string]exportRecord)
+
+	data, err := ioutil.ReadFile(exportLogPath)
+	if err != nil {
+		return records
+	}
+
+	var list []exportRecord
+	if err := json.Unmarshal(data, &list); err != nil {
+		utils.ErrorLogger.Printf("Could not read export log: %v", err)
+		return records
+	}
+	for _, r := range list {
+		records[r.File] = r
+	}
+	return records
+}
+
+// recordExport adds an exported file to the export log. Failures are only
+// logged since the export itself has already succeeded.
+func (a *App) recordExport(path, reportType, format, profile string) {
+	exportLogMu.Lock()
+	defer exportLogMu.Unlock()
+
+	records := a.loadExportLog()
+	records[filepath.Base(path)] = exportRecord{
+		File:       filepath.Base(path),
+		ReportType: reportType,
+		Format:     format,
+		Profile:    profile,
+		CreatedAt:  time.Now(),
+	}
+
+	// Drop entries for files that were deleted since
+	list := make([]exportRecord, 0, len(records))
+	for name, r := range records {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(exportLogPath), name)); err == nil {
+			list = append(list, r)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].CreatedAt.Before(list[j].CreatedAt)
+	})
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		utils.ErrorLogger.Printf("Could not encode export log: %v", err)
+		return
+	}
+	if err := secretstore.WriteFilePrivate(exportLogPath, data); err != nil {
+		utils.ErrorLogger.Printf("Could not write export log: %v", err)
+	}
+}
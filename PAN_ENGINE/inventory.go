@@ -0,0 +1,411 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// inventoryFile is stored in the same directory as the settings file
+const inventoryFile = "inventory.json"
+
+// Group selector kinds, written as "tag:<tag>" or "site:<site>"
+const (
+	groupByTag  = "tag"
+	groupBySite = "site"
+)
+
+// InventoryDevice is a firewall or Panorama known to the engine. Credentials
+// are never stored here; Profile names the connection profile whose key,
+// TLS settings and default scope are used to reach the device.
+type InventoryDevice struct {
+	Hostname string   `json:"hostname" yaml:"hostname"`
+	URL      string   `json:"url" yaml:"url"`
+	Serial   string   `json:"serial,omitempty" yaml:"serial"`
+	Site     string   `json:"site,omitempty" yaml:"site"`
+	Role     string   `json:"role,omitempty" yaml:"role"`
+	Tags     []string `json:"tags,omitempty" yaml:"-"`
+	Profile  string   `json:"profile" yaml:"profile"`
+}
+
+// Inventory is the persisted device list
+type Inventory struct {
+	Devices   []InventoryDevice `json:"devices"`
+	UpdatedAt time.Time         `json:"updated_at"`
+}
+
+// inGroup reports whether the device belongs to a tag or site group
+func (d InventoryDevice) inGroup(kind, value string) bool {
+	switch kind {
+	case groupByTag:
+		return hasTag(d.Tags, value)
+	case groupBySite:
+		return d.Site != "" && strings.EqualFold(d.Site, value)
+	}
+	return false
+}
+
+// parseGroupSelector splits a "tag:<tag>" or "site:<site>" selector
+func parseGroupSelector(selector string) (kind, value string, ok bool) {
+	i := strings.Index(selector, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	kind = strings.ToLower(strings.TrimSpace(selector[:i]))
+	value = strings.TrimSpace(selector[i+1:])
+	if (kind != groupByTag && kind != groupBySite) || value == "" {
+		return "", "", false
+	}
+	return kind, value, true
+}
+
+// isGroupSelector reports whether a report target names an inventory group
+func isGroupSelector(target string) bool {
+	_, _, ok := parseGroupSelector(target)
+	return ok
+}
+
+// inventoryPath returns the inventory file next to the settings file
+func (a *App) inventoryPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), inventoryFile)
+}
+
+// loadInventory reads the saved inventory. A missing file is an empty inventory.
+func (a *App) loadInventory() error {
+	data, err := ioutil.ReadFile(a.inventoryPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var inventory Inventory
+	if err := json.Unmarshal(data, &inventory); err != nil {
+		return fmt.Errorf("failed to parse inventory: %v", err)
+	}
+	a.inventory = inventory
+	return nil
+}
+
+// saveInventory writes the inventory file
+func (a *App) saveInventory() error {
+	a.inventory.UpdatedAt = time.Now()
+	if a.inventory.Devices == nil {
+		a.inventory.Devices = []InventoryDevice{}
+	}
+
+	data, err := json.MarshalIndent(a.inventory, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal inventory: %v", err)
+	}
+	if err := secretstore.WriteFilePrivate(a.inventoryPath(), data); err != nil {
+		return fmt.Errorf("failed to write inventory file: %v", err)
+	}
+	return nil
+}
+
+// findInventoryDevice returns a device by hostname or serial, or nil
+func (a *App) findInventoryDevice(name string) *InventoryDevice {
+	for i, d := range a.inventory.Devices {
+		if strings.EqualFold(d.Hostname, name) || (d.Serial != "" && strings.EqualFold(d.Serial, name)) {
+			return &a.inventory.Devices[i]
+		}
+	}
+	return nil
+}
+
+// inventoryTarget turns a device into a fleet target using the credentials
+// of the profile it references
+func (a *App) inventoryTarget(d InventoryDevice) (fleetTarget, error) {
+	i := a.findProfile(d.Profile)
+	if i < 0 {
+		return fleetTarget{}, fmt.Errorf("device %s references profile %s, which does not exist", d.Hostname, d.Profile)
+	}
+
+	// Pins identify the profile's own device, not the others sharing it
+	p := a.profiles[i]
+	p.APIURL = d.URL
+	p.TLS.PinnedSHA256 = nil
+	return fleetTarget{Name: d.Hostname, Site: d.Site, Profile: p}, nil
+}
+
+// inventoryColumns are the columns an import file may carry
+var inventoryColumns = []string{"hostname", "url", "serial", "site", "role", "tags", "profile"}
+
+// parseInventoryCSV reads devices from a CSV file with a header row naming
+// the columns. Tags are separated by commas or semicolons.
+func parseInventoryCSV(r io.Reader) ([]InventoryDevice, error) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV header: %v", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+	for _, required := range []string{"hostname", "url"} {
+		if _, ok := columns[required]; !ok {
+			return nil, fmt.Errorf("CSV header is missing the %s column (columns: %s)", required, strings.Join(inventoryColumns, ", "))
+		}
+	}
+
+	var devices []InventoryDevice
+	for line := 2; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+
+		field := func(name string) string {
+			if i, ok := columns[name]; ok && i < len(record) {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		devices = append(devices, InventoryDevice{
+			Hostname: field("hostname"),
+			URL:      field("url"),
+			Serial:   field("serial"),
+			Site:     field("site"),
+			Role:     field("role"),
+			Tags:     splitTags(strings.ReplaceAll(field("tags"), ";", ",")),
+			Profile:  field("profile"),
+		})
+	}
+	return devices, nil
+}
+
+// yamlInventoryDevice accepts tags as a list or a comma separated string
+type yamlInventoryDevice struct {
+	InventoryDevice `yaml:",inline"`
+	Tags            yaml.Node `yaml:"tags"`
+}
+
+// parseInventoryYAML reads devices from a YAML list, or from a "devices"
+// list in a YAML mapping
+func parseInventoryYAML(r io.Reader) ([]InventoryDevice, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []yamlInventoryDevice
+	if err := yaml.Unmarshal(data, &list); err != nil {
+		var doc struct {
+			Devices []yamlInventoryDevice `yaml:"devices"`
+		}
+		if docErr := yaml.Unmarshal(data, &doc); docErr != nil {
+			return nil, fmt.Errorf("failed to parse YAML inventory: %v", err)
+		}
+		list = doc.Devices
+	}
+
+	devices := make([]InventoryDevice, 0, len(list))
+	for _, item := range list {
+		d := item.InventoryDevice
+		switch item.Tags.Kind {
+		case yaml.ScalarNode:
+			d.Tags = splitTags(item.Tags.Value)
+		case yaml.SequenceNode:
+			var tags []string
+			if err := item.Tags.Decode(&tags); err != nil {
+				return nil, fmt.Errorf("device %s: invalid tags: %v", d.Hostname, err)
+			}
+			d.Tags = splitTags(strings.Join(tags, ","))
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+// ImportInventory adds the devices in a CSV or YAML file to the inventory,
+// replacing devices with the same hostname. Format is "csv" or "yaml"; when
+// empty it follows the file extension. Devices without a profile column use
+// defaultProfile. Every device is checked before anything is saved.
+func (a *App) ImportInventory(path, format, defaultProfile string) (map[string]interface{}, error) {
+	utils.InfoLogger.Printf("Importing inventory: %s", path)
+
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open inventory file: %v", err)
+	}
+	defer file.Close()
+
+	var devices []InventoryDevice
+	switch format {
+	case "csv":
+		devices, err = parseInventoryCSV(file)
+	case "yaml", "yml":
+		devices, err = parseInventoryYAML(file)
+	default:
+		return nil, fmt.Errorf("invalid format %q: must be 'csv' or 'yaml'", format)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(devices) == 0 {
+		return nil, fmt.Errorf("inventory file contains no devices")
+	}
+
+	// Validate every device before changing the inventory
+	for i := range devices {
+		d := &devices[i]
+		if d.Profile == "" {
+			d.Profile = strings.TrimSpace(defaultProfile)
+		}
+		if d.Hostname == "" || d.URL == "" {
+			return nil, fmt.Errorf("device %d: hostname and url are required", i+1)
+		}
+		if _, err := panclient.New(d.URL, ""); err != nil {
+			return nil, fmt.Errorf("device %s: %v", d.Hostname, err)
+		}
+		if d.Profile == "" {
+			return nil, fmt.Errorf("device %s: no profile given for its credentials", d.Hostname)
+		}
+		j := a.findProfile(d.Profile)
+		if j < 0 {
+			return nil, fmt.Errorf("device %s: profile %s does not exist", d.Hostname, d.Profile)
+		}
+		d.Profile = a.profiles[j].Name
+	}
+
+	added, updated := 0, 0
+	for _, d := range devices {
+		if existing := a.findInventoryDevice(d.Hostname); existing != nil {
+			*existing = d
+			updated++
+		} else {
+			a.inventory.Devices = append(a.inventory.Devices, d)
+			added++
+		}
+	}
+	sort.Slice(a.inventory.Devices, func(i, j int) bool {
+		return strings.ToLower(a.inventory.Devices[i].Hostname) < strings.ToLower(a.inventory.Devices[j].Hostname)
+	})
+
+	if err := a.saveInventory(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save inventory: %v", err)
+		return nil, err
+	}
+
+	utils.InfoLogger.Printf("Inventory imported: %d added, %d updated", added, updated)
+	return map[string]interface{}{
+		"added":   added,
+		"updated": updated,
+		"total":   len(a.inventory.Devices),
+	}, nil
+}
+
+// ListInventory returns every inventory device
+func (a *App) ListInventory() []map[string]interface{} {
+	devices := make([]map[string]interface{}, 0, len(a.inventory.Devices))
+	for _, d := range a.inventory.Devices {
+		tags := d.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		devices = append(devices, map[string]interface{}{
+			"hostname":       d.Hostname,
+			"url":            d.URL,
+			"serial":         d.Serial,
+			"site":           d.Site,
+			"role":           d.Role,
+			"tags":           tags,
+			"profile":        d.Profile,
+			"profile_exists": a.findProfile(d.Profile) >= 0,
+		})
+	}
+	return devices
+}
+
+// ListInventoryGroups returns the tag and site groups that can be used as a
+// report target, with their selector and device count
+func (a *App) ListInventoryGroups() []map[string]interface{} {
+	counts := make(map[string]int)
+	labels := make(map[string][2]string)
+
+	count := func(kind, value string) {
+		selector := kind + ":" + strings.ToLower(value)
+		if _, ok := labels[selector]; !ok {
+			labels[selector] = [2]string{kind, value}
+		}
+		counts[selector]++
+	}
+
+	for _, d := range a.inventory.Devices {
+		if d.Site != "" {
+			count(groupBySite, d.Site)
+		}
+		for _, tag := range d.Tags {
+			count(groupByTag, tag)
+		}
+	}
+	for _, p := range a.profiles {
+		for _, tag := range p.Tags {
+			count(groupByTag, tag)
+		}
+	}
+
+	groups := make([]map[string]interface{}, 0, len(counts))
+	for selector, n := range counts {
+		label := labels[selector]
+		groups = append(groups, map[string]interface{}{
+			"selector": label[0] + ":" + label[1],
+			"kind":     label[0],
+			"name":     label[1],
+			"devices":  n,
+		})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i]["selector"].(string) < groups[j]["selector"].(string)
+	})
+	return groups
+}
+
+// RemoveInventoryDevice deletes a device from the inventory by hostname
+func (a *App) RemoveInventoryDevice(hostname string) (bool, error) {
+	for i, d := range a.inventory.Devices {
+		if strings.EqualFold(d.Hostname, hostname) {
+			a.inventory.Devices = append(a.inventory.Devices[:i], a.inventory.Devices[i+1:]...)
+			if err := a.saveInventory(); err != nil {
+				utils.ErrorLogger.Printf("Failed to save inventory: %v", err)
+				return false, err
+			}
+			utils.InfoLogger.Printf("Inventory device %s removed", hostname)
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("device %s is not in the inventory", hostname)
+}
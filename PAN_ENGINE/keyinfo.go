@@ -0,0 +1,360 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// EventKeyRotationDue is emitted when saved keys are close to or past
+// their rotation date
+const EventKeyRotationDue = "api:key-rotation-due"
+
+const (
+	// defaultKeyRotationDays is the rotation interval when none is configured
+	defaultKeyRotationDays = 90
+
+	// defaultKeyRotationWarnDays is how early rotation reminders start
+	defaultKeyRotationWarnDays = 14
+
+	// keyRotationCheckInterval is how often a running app checks key ages
+	keyRotationCheckInterval = 12 * time.Hour
+)
+
+// Key states reported to the frontend
+const (
+	keyStateNone    = "none"
+	keyStateOK      = "ok"
+	keyStateDueSoon = "due_soon"
+	keyStateOverdue = "overdue"
+)
+
+// KeyInfo is what the frontend may know about a saved API key. The key
+// itself only ever leaves the secret store to authenticate requests.
+type KeyInfo struct {
+	// Fingerprint is the start of the key's SHA-256, enough to tell keys apart
+	Fingerprint string    `json:"fingerprint,omitempty"`
+	SetAt       time.Time `json:"set_at,omitempty"`
+	// ValidatedAt is when the device last accepted or rejected the key
+	ValidatedAt     time.Time `json:"validated_at,omitempty"`
+	Valid           bool      `json:"valid,omitempty"`
+	ValidationError string    `json:"validation_error,omitempty"`
+	// FailureReason is "expired" or "revoked" once the device rejected the key
+	FailureReason string `json:"failure_reason,omitempty"`
+}
+
+// KeyRotationPolicy is how often saved keys are expected to be replaced
+type KeyRotationPolicy struct {
+	IntervalDays int `json:"interval_days,omitempty"`
+	WarnDays     int `json:"warn_days,omitempty"`
+}
+
+// withDefaults fills in the quarterly default for unset values
+func (r KeyRotationPolicy) withDefaults() KeyRotationPolicy {
+	if r.IntervalDays <= 0 {
+		r.IntervalDays = defaultKeyRotationDays
+	}
+	if r.WarnDays <= 0 {
+		r.WarnDays = defaultKeyRotationWarnDays
+	}
+	return r
+}
+
+// dueAt returns when a key set at setAt should be rotated, or the zero time
+// when its age is unknown
+func (r KeyRotationPolicy) dueAt(setAt time.Time) time.Time {
+	if setAt.IsZero() {
+		return time.Time{}
+	}
+	return setAt.AddDate(0, 0, r.withDefaults().IntervalDays)
+}
+
+// keyState summarizes a key: none, ok, due_soon, overdue, or the reason the
+// device last rejected it
+func (r KeyRotationPolicy) keyState(p *ConnectionProfile, now time.Time) string {
+	if p == nil || !p.hasKey() {
+		return keyStateNone
+	}
+	if !p.Key.ValidatedAt.IsZero() && !p.Key.Valid && p.Key.FailureReason != "" {
+		return p.Key.FailureReason
+	}
+
+	due := r.dueAt(p.Key.SetAt)
+	switch {
+	case due.IsZero():
+		return keyStateOK
+	case !now.Before(due):
+		return keyStateOverdue
+	case !now.Before(due.AddDate(0, 0, -r.withDefaults().WarnDays)):
+		return keyStateDueSoon
+	}
+	return keyStateOK
+}
+
+// keyFingerprint returns a short, non-reversible fingerprint of a key
+func keyFingerprint(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return "SHA256:" + hex.EncodeToString(sum[:4])
+}
+
+// keyStatus describes a profile's key for the frontend
+func (a *App) keyStatus(p *ConnectionProfile) map[string]interface{} {
+	status := map[string]interface{}{
+		"key_set":          p != nil && p.hasKey(),
+		"key_state":        a.keyRotation.keyState(p, time.Now()),
+		"key_fingerprint":  "",
+		"key_set_at":       "",
+		"key_age_days":     -1,
+		"key_rotation_due": "",
+		"key_validated":    "",
+		"key_valid":        false,
+		"key_error":        "",
+	}
+	if p == nil {
+		return status
+	}
+
+	info := p.Key
+	status["key_fingerprint"] = info.Fingerprint
+	if !info.SetAt.IsZero() {
+		status["key_set_at"] = info.SetAt.Format(time.RFC3339)
+		status["key_age_days"] = int(time.Since(info.SetAt).Hours() / 24)
+		status["key_rotation_due"] = a.keyRotation.dueAt(info.SetAt).Format(time.RFC3339)
+	}
+	if !info.ValidatedAt.IsZero() {
+		status["key_validated"] = info.ValidatedAt.Format(time.RFC3339)
+		status["key_valid"] = info.Valid
+		status["key_error"] = info.ValidationError
+	}
+	return status
+}
+
+// noteKeySet records a new key on a profile. Saving the same key again keeps
+// its age and last validation.
+func (p *ConnectionProfile) noteKeySet(key string) {
+	if key == "" {
+		p.Key = KeyInfo{}
+		return
+	}
+
+	fingerprint := keyFingerprint(key)
+	if fingerprint == p.Key.Fingerprint {
+		return
+	}
+	p.Key = KeyInfo{Fingerprint: fingerprint, SetAt: time.Now()}
+}
+
+// recordKeyValidation stores whether the device accepted the active key,
+// and why it did not. Errors that say nothing about the key, such as
+// timeouts, are ignored.
+func (a *App) recordKeyValidation(err error) {
+	p := a.currentProfile()
+	if p == nil || !p.hasKey() {
+		return
+	}
+
+	info := p.Key
+	switch {
+	case err == nil:
+		info.Valid = true
+		info.ValidationError = ""
+		info.FailureReason = ""
+	case panclient.IsKind(err, panclient.KindAuth):
+		info.Valid = false
+		info.ValidationError = err.Error()
+		info.FailureReason = panclient.AuthFailureReason(err)
+	default:
+		return
+	}
+	info.ValidatedAt = time.Now()
+
+	a.profilesMu.Lock()
+	p.Key = info
+	a.profilesMu.Unlock()
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save key validation: %v", err)
+	}
+}
+
+// dueKeys lists the profiles whose keys are due for rotation within the
+// warning window, most urgent first. It runs from the key rotation watcher,
+// so the profiles are read under profilesMu.
+func (a *App) dueKeys(now time.Time) []map[string]interface{} {
+	a.profilesMu.RLock()
+	defer a.profilesMu.RUnlock()
+
+	var due []map[string]interface{}
+	for i := range a.profiles {
+		p := &a.profiles[i]
+		state := a.keyRotation.keyState(p, now)
+		if state != keyStateDueSoon && state != keyStateOverdue {
+			continue
+		}
+
+		dueAt := a.keyRotation.dueAt(p.Key.SetAt)
+		due = append(due, map[string]interface{}{
+			"profile":     p.Name,
+			"state":       state,
+			"fingerprint": p.Key.Fingerprint,
+			"set_at":      p.Key.SetAt.Format(time.RFC3339),
+			"due":         dueAt.Format(time.RFC3339),
+			"days_left":   int(dueAt.Sub(now).Hours() / 24),
+		})
+	}
+
+	sort.Slice(due, func(i, j int) bool {
+		return due[i]["due"].(string) < due[j]["due"].(string)
+	})
+	return due
+}
+
+// checkKeyRotation warns the frontend about keys due for rotation
+func (a *App) checkKeyRotation() {
+	due := a.dueKeys(time.Now())
+	if len(due) == 0 {
+		return
+	}
+
+	for _, d := range due {
+		utils.InfoLogger.Printf("API key of profile %s is %s for rotation (due %s)", d["profile"], d["state"], d["due"])
+	}
+	if a.ctx != nil {
+		runtime.EventsEmit(a.ctx, EventKeyRotationDue, map[string]interface{}{
+			"keys":    due,
+			"message": fmt.Sprintf("%d API key(s) are due for rotation.", len(due)),
+		})
+	}
+}
+
+// watchKeyRotation repeats the rotation check while the app runs
+func (a *App) watchKeyRotation(ctx context.Context) {
+	ticker := time.NewTicker(keyRotationCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			a.checkKeyRotation()
+		}
+	}
+}
+
+// GetKeyRotationPolicy returns the rotation interval and warning window in days
+func (a *App) GetKeyRotationPolicy() map[string]int {
+	policy := a.keyRotation.withDefaults()
+	return map[string]int{
+		"interval_days": policy.IntervalDays,
+		"warn_days":     policy.WarnDays,
+	}
+}
+
+// SetKeyRotationPolicy sets how often keys should be rotated and how many
+// days ahead to warn, then re-checks the saved keys
+func (a *App) SetKeyRotationPolicy(intervalDays, warnDays int) (bool, error) {
+	if intervalDays <= 0 || warnDays <= 0 {
+		return false, fmt.Errorf("rotation interval and warning days must be positive")
+	}
+	if warnDays >= intervalDays {
+		return false, fmt.Errorf("the warning window must be shorter than the rotation interval")
+	}
+
+	a.profilesMu.Lock()
+	a.keyRotation = KeyRotationPolicy{IntervalDays: intervalDays, WarnDays: warnDays}
+	a.profilesMu.Unlock()
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Key rotation policy set: every %d days, warning %d days ahead", intervalDays, warnDays)
+	a.checkKeyRotation()
+	return true, nil
+}
+
+// RotateAPIKey replaces the active profile's key with one generated through
+// keygen, then validates it with TestAPIConnection. The previous key is
+// kept when the new one fails validation. The password is only used for
+// the keygen request and is never stored.
+func (a *App) RotateAPIKey(username, password string) (map[string]interface{}, error) {
+	p := a.currentProfile()
+	if p == nil || a.apiURL == "" {
+		return nil, fmt.Errorf("API URL must be configured first")
+	}
+	if username == "" || password == "" {
+		return nil, fmt.Errorf("username and password are required")
+	}
+
+	opts, err := a.profileClientOptions(p)
+	if err != nil {
+		return nil, err
+	}
+	client, err := panclient.New(a.apiURL, "", opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer client.Close()
+
+	key, err := client.Keygen(a.requestContext(), username, password)
+	if err != nil {
+		utils.ErrorLogger.Printf("Key rotation failed for user %s: %v", username, err)
+		return nil, operatorError(err)
+	}
+
+	previousKey, previousInfo := a.apiKey, p.Key
+	if err := a.setProfileKey(p, key); err != nil {
+		return nil, err
+	}
+	unchanged := p.Key.Fingerprint == previousInfo.Fingerprint
+	a.apiKey = key
+	a.resetConnection()
+
+	result := a.TestAPIConnection()
+	if result["status"] != "success" {
+		// Put the previous key back so a bad rotation does not lock us out
+		if err := a.setProfileKey(p, previousKey); err != nil {
+			utils.ErrorLogger.Printf("Could not restore the previous key of profile %s: %v", p.Name, err)
+		}
+		a.profilesMu.Lock()
+		p.Key = previousInfo
+		a.profilesMu.Unlock()
+		a.apiKey = previousKey
+		a.resetConnection()
+		if err := a.saveSettings(); err != nil {
+			utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		}
+		return result, fmt.Errorf("the new API key failed validation, the previous key was kept: %v", result["message"])
+	}
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return nil, err
+	}
+
+	// PAN-OS hands back the same key until the old one expires or is revoked
+	if unchanged {
+		utils.InfoLogger.Printf("Key rotation for profile %s returned the current key", p.Name)
+		result["message"] = "The device returned the current key. Expire or revoke API keys on the device to issue a new one."
+	} else {
+		utils.InfoLogger.Printf("API key rotated: profile=%s, user=%s, fingerprint=%s", p.Name, username, p.Key.Fingerprint)
+	}
+	result["rotated"] = !unchanged
+	for k, v := range a.keyStatus(p) {
+		result[k] = v
+	}
+	return result, nil
+}
@@ -0,0 +1,123 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ProfileLimits override the request rate, concurrency cap and retries used
+// for a profile's device. Zero values use the client defaults.
+type ProfileLimits struct {
+	RequestsPerSecond float64 `json:"requests_per_second,omitempty"`
+	Burst             int     `json:"burst,omitempty"`
+	MaxConcurrent     int     `json:"max_concurrent,omitempty"`
+	// MaxAttempts includes the first attempt; 1 disables retries
+	MaxAttempts int `json:"max_attempts,omitempty"`
+}
+
+// limitOptions returns the panclient options applying a profile's limits.
+// The rate limit is always set so removing an override restores the defaults.
+func limitOptions(limits ProfileLimits) []panclient.Option {
+	rate, retry := profileLimits(limits)
+	return []panclient.Option{panclient.WithRateLimit(rate), panclient.WithRetry(retry)}
+}
+
+// checkLimits validates a profile's limits without applying them. The rate
+// limit is shared by every client of the device, so building a client just
+// to validate it would change the limit in use.
+func checkLimits(limits ProfileLimits) error {
+	rate, retry := profileLimits(limits)
+	if err := rate.Validate(); err != nil {
+		return err
+	}
+	return retry.Validate()
+}
+
+// profileLimits returns a profile's rate limit and retry policy with the
+// defaults filled in
+func profileLimits(limits ProfileLimits) (panclient.RateLimit, panclient.RetryPolicy) {
+	rate := panclient.DefaultRateLimit
+	if limits.RequestsPerSecond > 0 {
+		rate.RequestsPerSecond = limits.RequestsPerSecond
+	}
+	if limits.Burst > 0 {
+		rate.Burst = limits.Burst
+	}
+	if limits.MaxConcurrent > 0 {
+		rate.MaxConcurrent = limits.MaxConcurrent
+	}
+
+	retry := panclient.DefaultRetryPolicy
+	if limits.MaxAttempts > 0 {
+		retry.MaxAttempts = limits.MaxAttempts
+	}
+	return rate, retry
+}
+
+// applyLimitSettings reads the rate_limit, rate_burst, max_concurrent and
+// max_attempts settings of CreateProfile and UpdateProfile. An empty value
+// restores the default.
+func applyLimitSettings(p *ConnectionProfile, settings map[string]string) error {
+	if v, ok := settings["rate_limit"]; ok {
+		rate := 0.0
+		if v = strings.TrimSpace(v); v != "" {
+			var err error
+			if rate, err = strconv.ParseFloat(v, 64); err != nil || rate <= 0 {
+				return fmt.Errorf("invalid rate_limit value %q: must be a positive number of requests per second", v)
+			}
+		}
+		p.Limits.RequestsPerSecond = rate
+	}
+
+	for key, field := range map[string]*int{
+		"rate_burst":     &p.Limits.Burst,
+		"max_concurrent": &p.Limits.MaxConcurrent,
+		"max_attempts":   &p.Limits.MaxAttempts,
+	} {
+		v, ok := settings[key]
+		if !ok {
+			continue
+		}
+		n := 0
+		if v = strings.TrimSpace(v); v != "" {
+			var err error
+			if n, err = strconv.Atoi(v); err != nil || n <= 0 {
+				return fmt.Errorf("invalid %s value %q: must be a positive number", key, v)
+			}
+		}
+		*field = n
+	}
+	return nil
+}
+
+// limitsSummary describes a profile's limits for the frontend, with the
+// defaults filled in
+func limitsSummary(limits ProfileLimits) map[string]interface{} {
+	rate, retry := panclient.DefaultRateLimit, panclient.DefaultRetryPolicy
+	summary := map[string]interface{}{
+		"rate_limit":     rate.RequestsPerSecond,
+		"rate_burst":     rate.Burst,
+		"max_concurrent": rate.MaxConcurrent,
+		"max_attempts":   retry.MaxAttempts,
+	}
+	if limits.RequestsPerSecond > 0 {
+		summary["rate_limit"] = limits.RequestsPerSecond
+	}
+	if limits.Burst > 0 {
+		summary["rate_burst"] = limits.Burst
+	}
+	if limits.MaxConcurrent > 0 {
+		summary["max_concurrent"] = limits.MaxConcurrent
+	}
+	if limits.MaxAttempts > 0 {
+		summary["max_attempts"] = limits.MaxAttempts
+	}
+	return summary
+}
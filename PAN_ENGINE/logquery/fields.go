@@ -0,0 +1,311 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package logquery
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FieldKind determines which operators and values a field accepts
+type FieldKind int
+
+const (
+	KindString FieldKind = iota
+	KindAddress
+	KindNumber
+	KindTime
+	KindFlag
+)
+
+// commonFields exist in every log type
+var commonFields = map[string]FieldKind{
+	"receive_time":   KindTime,
+	"time_generated": KindTime,
+	"serial":         KindString,
+	"device_name":    KindString,
+	"vsys":           KindString,
+	"seqno":          KindNumber,
+	"subtype":        KindString,
+}
+
+// sessionFields are shared by traffic and the threat family of logs
+var sessionFields = map[string]FieldKind{
+	"addr.src":      KindAddress,
+	"addr.dst":      KindAddress,
+	"addr":          KindAddress,
+	"natsrc":        KindAddress,
+	"natdst":        KindAddress,
+	"zone.src":      KindString,
+	"zone.dst":      KindString,
+	"interface.src": KindString,
+	"interface.dst": KindString,
+	"port.src":      KindNumber,
+	"port.dst":      KindNumber,
+	"natsport":      KindNumber,
+	"natdport":      KindNumber,
+	"user.src":      KindString,
+	"user.dst":      KindString,
+	"app":           KindString,
+	"rule":          KindString,
+	"rule_uuid":     KindString,
+	"proto":         KindString,
+	"action":        KindString,
+	"session_id":    KindNumber,
+	"repeatcnt":     KindNumber,
+	"flags":         KindFlag,
+	"from":          KindString,
+	"to":            KindString,
+}
+
+// threatFields are shared by the threat, url, data and wildfire logs
+var threatFields = map[string]FieldKind{
+	"threatid":  KindString,
+	"severity":  KindString,
+	"direction": KindString,
+	"category":  KindString,
+	"filename":  KindString,
+	"filetype":  KindString,
+	"reportid":  KindNumber,
+}
+
+// logTypeFields lists the fields specific to each PAN-OS log-type
+var logTypeFields = map[string][]map[string]FieldKind{
+	"traffic": {sessionFields, {
+		"bytes":              KindNumber,
+		"bytes_sent":         KindNumber,
+		"bytes_received":     KindNumber,
+		"packets":            KindNumber,
+		"elapsed":            KindNumber,
+		"category":           KindString,
+		"session_end_reason": KindString,
+	}},
+	"threat": {sessionFields, threatFields},
+	"url": {sessionFields, threatFields, {
+		"url":         KindString,
+		"contenttype": KindString,
+		"http_method": KindString,
+		"referer":     KindString,
+		"user_agent":  KindString,
+	}},
+	"data":     {sessionFields, threatFields},
+	"wildfire": {sessionFields, threatFields, {"filedigest": KindString}},
+	"auth": {{
+		"ip":             KindAddress,
+		"user":           KindString,
+		"normalize_user": KindString,
+		"object":         KindString,
+		"authpolicy":     KindString,
+		"authid":         KindString,
+		"vendor":         KindString,
+		"clienttype":     KindString,
+		"event":          KindString,
+		"factorno":       KindNumber,
+	}},
+	"system": {{
+		"eventid":     KindString,
+		"severity":    KindString,
+		"module":      KindString,
+		"object":      KindString,
+		"description": KindString,
+	}},
+	"config": {{
+		"admin":  KindString,
+		"client": KindString,
+		"cmd":    KindString,
+		"result": KindString,
+		"path":   KindString,
+		"host":   KindAddress,
+	}},
+	"corr": {{
+		"severity":    KindString,
+		"category":    KindString,
+		"object":      KindString,
+		"object_id":   KindNumber,
+		"evidence":    KindString,
+		"match_time":  KindTime,
+		"src":         KindAddress,
+		"srcuser":     KindString,
+		"description": KindString,
+	}},
+}
+
+// fieldsFor merges the common and type-specific fields of a log type
+func fieldsFor(logType string) (map[string]FieldKind, bool) {
+	sets, ok := logTypeFields[logType]
+	if !ok {
+		return nil, false
+	}
+
+	fields := make(map[string]FieldKind)
+	for name, kind := range commonFields {
+		fields[name] = kind
+	}
+	for _, set := range sets {
+		for name, kind := range set {
+			fields[name] = kind
+		}
+	}
+	return fields, true
+}
+
+// LogTypes returns the log types the validator knows
+func LogTypes() []string {
+	types := make([]string, 0, len(logTypeFields))
+	for t := range logTypeFields {
+		types = append(types, t)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// Fields returns the sorted field names valid for a log type
+func Fields(logType string) []string {
+	fields, ok := fieldsFor(logType)
+	if !ok {
+		return []string{}
+	}
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ValidationError reports a condition the firewall would reject
+type ValidationError struct {
+	Condition string
+	Msg       string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid log filter %s: %s", e.Condition, e.Msg)
+}
+
+// Validate checks every condition of an expression against the fields and
+// value formats of a log type
+func Validate(logType string, expr Expr) error {
+	fields, ok := fieldsFor(logType)
+	if !ok {
+		return fmt.Errorf("unknown log type %q", logType)
+	}
+	return validateExpr(fields, expr)
+}
+
+// ParseAndValidate parses a raw query, validates it for a log type and
+// returns it in canonical form
+func ParseAndValidate(logType, query string) (string, error) {
+	expr, err := Parse(query)
+	if err != nil {
+		return "", err
+	}
+	if err := Validate(logType, expr); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
+
+func validateExpr(fields map[string]FieldKind, expr Expr) error {
+	switch e := expr.(type) {
+	case *Condition:
+		return validateCondition(fields, e)
+	case *Group:
+		for _, inner := range e.Exprs {
+			if err := validateExpr(fields, inner); err != nil {
+				return err
+			}
+		}
+		return nil
+	case *Negation:
+		return validateExpr(fields, e.Expr)
+	case nil:
+		return fmt.Errorf("empty log filter")
+	}
+	return fmt.Errorf("unsupported expression %T", expr)
+}
+
+func validateCondition(fields map[string]FieldKind, c *Condition) error {
+	fail := func(format string, args ...interface{}) error {
+		return &ValidationError{Condition: c.String(), Msg: fmt.Sprintf(format, args...)}
+	}
+
+	kind, ok := fields[c.Field]
+	if !ok {
+		return fail("unknown field %q for this log type", c.Field)
+	}
+	if !operators[c.Operator] {
+		return fail("unknown operator %q", c.Operator)
+	}
+	if strings.TrimSpace(c.Value) == "" {
+		return fail("value is empty")
+	}
+
+	switch kind {
+	case KindAddress:
+		switch c.Operator {
+		case OpEq, OpNeq, OpIn, OpNotIn:
+		default:
+			return fail("operator %q cannot be used with address field %q", c.Operator, c.Field)
+		}
+		if !validAddress(c.Value, c.Operator == OpIn || c.Operator == OpNotIn) {
+			return fail("%q is not a valid address", c.Value)
+		}
+	case KindNumber:
+		switch c.Operator {
+		case OpEq, OpNeq, OpGeq, OpLeq:
+		default:
+			return fail("operator %q cannot be used with numeric field %q", c.Operator, c.Field)
+		}
+		if _, err := strconv.ParseInt(c.Value, 10, 64); err != nil {
+			return fail("%q is not a number", c.Value)
+		}
+	case KindTime:
+		switch c.Operator {
+		case OpEq, OpNeq, OpGeq, OpLeq, OpIn:
+		default:
+			return fail("operator %q cannot be used with time field %q", c.Operator, c.Field)
+		}
+		if c.Operator != OpIn {
+			if _, err := time.Parse("2006/01/02 15:04:05", c.Value); err != nil {
+				return fail("%q is not a time in YYYY/MM/DD HH:MM:SS form", c.Value)
+			}
+		}
+	case KindFlag:
+		if c.Operator != OpHas {
+			return fail("flag field %q only supports the %q operator", c.Field, OpHas)
+		}
+	default:
+		switch c.Operator {
+		case OpEq, OpNeq, OpContains, OpIn, OpNotIn:
+		default:
+			return fail("operator %q cannot be used with field %q", c.Operator, c.Field)
+		}
+	}
+
+	return nil
+}
+
+// validAddress accepts an IP, and with in/notin also a CIDR or a range
+func validAddress(value string, allowRange bool) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	if !allowRange {
+		return false
+	}
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	if parts := strings.SplitN(value, "-", 2); len(parts) == 2 {
+		return net.ParseIP(parts[0]) != nil && net.ParseIP(parts[1]) != nil
+	}
+	return false
+}
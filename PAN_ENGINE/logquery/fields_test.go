@@ -0,0 +1,107 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package logquery
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseAndValidate(t *testing.T) {
+	tests := []struct {
+		logType string
+		query   string
+		want    string
+	}{
+		{"traffic", `(addr.src in 10.0.0.0/8)`, `(addr.src in 10.0.0.0/8)`},
+		{"traffic", `(addr.src in 10.0.0.1-10.0.0.9)`, `(addr.src in 10.0.0.1-10.0.0.9)`},
+		{"traffic", `(addr.dst eq 2001:db8::1)`, `(addr.dst eq 2001:db8::1)`},
+		{"traffic", `(port.dst geq 1024) and (bytes leq 500)`, `(port.dst geq 1024) and (bytes leq 500)`},
+		{"traffic", `(user.src eq 'acme\bob')`, `(user.src eq acme\bob)`},
+		{"traffic", `(receive_time geq '2024/01/31 23:59:59')`, `(receive_time geq '2024/01/31 23:59:59')`},
+		{"traffic", `(flags has proxy)`, `(flags has proxy)`},
+		{"threat", `(severity eq critical) and not (action eq allow)`, `(severity eq critical) and not (action eq allow)`},
+		{"url", `(url contains example.com)`, `(url contains example.com)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.logType+" "+tt.query, func(t *testing.T) {
+			got, err := ParseAndValidate(tt.logType, tt.query)
+			if err != nil {
+				t.Fatalf("ParseAndValidate failed: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		logType string
+		query   string
+	}{
+		{"unknown field", "traffic", `(nosuchfield eq 1)`},
+		{"threat field on traffic", "traffic", `(threatid eq 1234)`},
+		{"address not an ip", "traffic", `(addr.src eq server1)`},
+		{"cidr needs in", "traffic", `(addr.src eq 10.0.0.0/8)`},
+		{"address contains", "traffic", `(addr.src contains 10.0)`},
+		{"number not numeric", "traffic", `(port.dst eq https)`},
+		{"number contains", "traffic", `(port.dst contains 44)`},
+		{"time format", "traffic", `(receive_time geq 2024-01-31)`},
+		{"flag operator", "traffic", `(flags eq proxy)`},
+		{"string geq", "traffic", `(app geq ssl)`},
+		{"empty value", "traffic", `(app eq '')`},
+		{"unknown operator", "traffic", `(app like ssl)`},
+		{"nested in not", "traffic", `not ((app eq ssl) or (port.dst eq x))`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseAndValidate(tt.logType, tt.query)
+			if err == nil {
+				t.Fatalf("ParseAndValidate(%s, %s) succeeded, want an error", tt.logType, tt.query)
+			}
+		})
+	}
+}
+
+func TestValidateErrorKinds(t *testing.T) {
+	_, err := ParseAndValidate("traffic", `(port.dst eq https)`)
+	var validationErr *ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Errorf("got %v, want a ValidationError", err)
+	}
+
+	_, err = ParseAndValidate("traffic", `(port.dst eq`)
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Errorf("got %v, want a SyntaxError", err)
+	}
+
+	if err := Validate("nosuchlogtype", Eq("app", "ssl")); err == nil {
+		t.Error("Validate accepted an unknown log type")
+	}
+	if err := Validate("traffic", nil); err == nil {
+		t.Error("Validate accepted an empty expression")
+	}
+}
+
+func TestFields(t *testing.T) {
+	for _, logType := range LogTypes() {
+		fields := Fields(logType)
+		if len(fields) == 0 {
+			t.Errorf("log type %s has no fields", logType)
+		}
+		for i := 1; i < len(fields); i++ {
+			if fields[i-1] >= fields[i] {
+				t.Errorf("fields of %s are not sorted: %s before %s", logType, fields[i-1], fields[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package logquery
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// token kinds produced by the lexer
+const (
+	tokLParen = iota
+	tokRParen
+	tokWord
+	tokString
+	tokEOF
+)
+
+type token struct {
+	kind int
+	text string
+	pos  int
+}
+
+// SyntaxError reports where a query could not be parsed
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("invalid log filter at position %d: %s", e.Pos+1, e.Msg)
+}
+
+// lex splits a query into tokens. Quoted strings may use single or double
+// quotes and escape the quote character with a backslash; a doubled
+// backslash is one backslash. Any other backslash is kept as is, so
+// 'acme\bob' needs no escaping.
+func lex(input string) ([]token, error) {
+	var tokens []token
+	runes := []rune(input)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokLParen, text: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokRParen, text: ")", pos: i})
+			i++
+		case r == '!':
+			tokens = append(tokens, token{kind: tokWord, text: "not", pos: i})
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			i++
+			var b strings.Builder
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) && (runes[i+1] == r || runes[i+1] == '\\') {
+					b.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					closed = true
+					i++
+					break
+				}
+				b.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &SyntaxError{Pos: start, Msg: "unterminated quoted value"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: b.String(), pos: start})
+		default:
+			start := i
+			for i < len(runes) && !unicode.IsSpace(runes[i]) && runes[i] != '(' && runes[i] != ')' {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokWord, text: string(runes[start:i]), pos: start})
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+// parser is a recursive descent parser over the token list:
+//
+//	or   := and ("or" and)*
+//	and  := not ("and" not)*
+//	not  := "not" not | term
+//	term := "(" or ")" | field operator value
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// Parse parses a query in PAN-OS log filter syntax
+func Parse(query string) (Expr, error) {
+	if strings.TrimSpace(query) == "" {
+		return nil, &SyntaxError{Pos: 0, Msg: "query is empty"}
+	}
+
+	tokens, err := lex(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokEOF {
+		return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokEOF {
+		p.pos++
+	}
+	return tok
+}
+
+func (p *parser) isKeyword(word string) bool {
+	tok := p.peek()
+	return tok.kind == tokWord && strings.EqualFold(tok.text, word)
+}
+
+func (p *parser) parseOr() (Expr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{left}
+	for p.isKeyword("or") {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, right)
+	}
+	return Or(exprs...), nil
+}
+
+func (p *parser) parseAnd() (Expr, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	exprs := []Expr{left}
+	for p.isKeyword("and") {
+		p.next()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, right)
+	}
+	return And(exprs...), nil
+}
+
+func (p *parser) parseNot() (Expr, error) {
+	if p.isKeyword("not") {
+		p.next()
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return Not(inner), nil
+	}
+	return p.parseTerm()
+}
+
+func (p *parser) parseTerm() (Expr, error) {
+	tok := p.peek()
+
+	switch tok.kind {
+	case tokLParen:
+		p.next()
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &SyntaxError{Pos: closing.pos, Msg: "missing closing parenthesis"}
+		}
+		return inner, nil
+	case tokWord:
+		return p.parseCondition()
+	case tokEOF:
+		return nil, &SyntaxError{Pos: tok.pos, Msg: "unexpected end of query"}
+	}
+
+	return nil, &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+}
+
+func (p *parser) parseCondition() (Expr, error) {
+	field := p.next()
+	if isReserved(field.text) {
+		return nil, &SyntaxError{Pos: field.pos, Msg: fmt.Sprintf("expected a field name, found %q", field.text)}
+	}
+
+	op := p.next()
+	if op.kind != tokWord || !operators[strings.ToLower(op.text)] {
+		return nil, &SyntaxError{Pos: op.pos, Msg: fmt.Sprintf("expected an operator after %q, found %q", field.text, op.text)}
+	}
+
+	value := p.next()
+	if value.kind != tokWord && value.kind != tokString {
+		return nil, &SyntaxError{Pos: value.pos, Msg: fmt.Sprintf("expected a value after %q", op.text)}
+	}
+
+	return Cond(field.text, strings.ToLower(op.text), value.text), nil
+}
+
+func isReserved(word string) bool {
+	switch strings.ToLower(word) {
+	case "and", "or", "not":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package logquery
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLexQuotedValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", `'acme'`, `acme`},
+		{"spaces", `'web server'`, `web server`},
+		{"domain user", `'acme\bob'`, `acme\bob`},
+		{"domain user double quotes", `"acme\bob"`, `acme\bob`},
+		{"escaped quote", `'it\'s'`, `it's`},
+		{"escaped double quote", `"say \"hi\""`, `say "hi"`},
+		{"other quote kept", `"it\'s"`, `it\'s`},
+		{"doubled backslash", `'a\\b'`, `a\b`},
+		{"trailing backslash", `'acme\\'`, `acme\`},
+		{"backslash before letter", `'c:\temp\new'`, `c:\temp\new`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, err := lex(tt.input)
+			if err != nil {
+				t.Fatalf("lex(%s) failed: %v", tt.input, err)
+			}
+			if len(tokens) != 2 || tokens[0].kind != tokString {
+				t.Fatalf("lex(%s) = %+v, want one string token", tt.input, tokens)
+			}
+			if tokens[0].text != tt.want {
+				t.Errorf("lex(%s) = %q, want %q", tt.input, tokens[0].text, tt.want)
+			}
+		})
+	}
+}
+
+func TestLexTokens(t *testing.T) {
+	tokens, err := lex(`!(app eq ssl)`)
+	if err != nil {
+		t.Fatalf("lex failed: %v", err)
+	}
+
+	want := []struct {
+		kind int
+		text string
+	}{
+		{tokWord, "not"},
+		{tokLParen, "("},
+		{tokWord, "app"},
+		{tokWord, "eq"},
+		{tokWord, "ssl"},
+		{tokRParen, ")"},
+		{tokEOF, ""},
+	}
+	if len(tokens) != len(want) {
+		t.Fatalf("got %d tokens, want %d: %+v", len(tokens), len(want), tokens)
+	}
+	for i, w := range want {
+		if tokens[i].kind != w.kind || tokens[i].text != w.text {
+			t.Errorf("token %d = %+v, want %+v", i, tokens[i], w)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`(app eq ssl)`, `(app eq ssl)`},
+		{`app eq ssl`, `(app eq ssl)`},
+		{`(addr.src in 10.0.0.0/8) and (app eq ssl)`, `(addr.src in 10.0.0.0/8) and (app eq ssl)`},
+		{`(a eq 1) AND (b eq 2) or (c eq 3)`, `((a eq 1) and (b eq 2)) or (c eq 3)`},
+		{`(a eq 1) and ((b eq 2) or (c eq 3))`, `(a eq 1) and ((b eq 2) or (c eq 3))`},
+		{`not (app eq ssl)`, `not (app eq ssl)`},
+		{`!(app eq ssl)`, `not (app eq ssl)`},
+		{`not ((a eq 1) or (b eq 2))`, `not ((a eq 1) or (b eq 2))`},
+		{`(rule eq 'Allow Web')`, `(rule eq 'Allow Web')`},
+		{`(user.src eq 'acme\bob')`, `(user.src eq acme\bob)`},
+		{`(user.src eq acme\bob)`, `(user.src eq acme\bob)`},
+		{`(rule eq "it's")`, `(rule eq 'it\'s')`},
+		{`(app EQ ssl)`, `(app eq ssl)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			expr, err := Parse(tt.query)
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", tt.query, err)
+			}
+			if got := expr.String(); got != tt.want {
+				t.Errorf("Parse(%s) = %s, want %s", tt.query, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseValue(t *testing.T) {
+	expr, err := Parse(`(user.src eq 'acme\bob')`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	c, ok := expr.(*Condition)
+	if !ok {
+		t.Fatalf("Parse returned %T, want *Condition", expr)
+	}
+	if c.Field != "user.src" || c.Operator != OpEq || c.Value != `acme\bob` {
+		t.Errorf("Parse = %+v, want user.src eq acme\\bob", c)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		pos   int
+	}{
+		{``, 0},
+		{`   `, 0},
+		{`(app eq ssl`, 11},
+		{`(app eq 'ssl)`, 8},
+		{`(app ssl)`, 5},
+		{`(app eq)`, 7},
+		{`(and eq ssl)`, 1},
+		{`(app eq ssl) extra`, 13},
+		{`(app eq ssl) and`, 16},
+		{`)`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			_, err := Parse(tt.query)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Parse(%s) error = %v, want a SyntaxError", tt.query, err)
+			}
+			if syntaxErr.Pos != tt.pos {
+				t.Errorf("Parse(%s) error at %d, want %d: %v", tt.query, syntaxErr.Pos, tt.pos, err)
+			}
+		})
+	}
+}
+
+// Rendering a parsed query and parsing it again gives the same query
+func TestParseRoundTrip(t *testing.T) {
+	queries := []string{
+		`(user.src eq 'acme\bob')`,
+		`(user.src eq 'acme\\')`,
+		`(rule eq 'it\'s a rule')`,
+		`(rule eq 'back\\\'slash')`,
+		`(rule eq "a \"quoted\" name")`,
+		`(addr.src in 10.0.0.0/8) and not ((app eq ssl) or (app eq web-browsing))`,
+	}
+
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			first, err := Parse(query)
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", query, err)
+			}
+			second, err := Parse(first.String())
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", first.String(), err)
+			}
+			if first.String() != second.String() {
+				t.Errorf("round trip changed %s to %s", first.String(), second.String())
+			}
+		})
+	}
+}
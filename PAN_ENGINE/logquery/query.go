@@ -0,0 +1,186 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+// Package logquery builds, parses and validates queries in the PAN-OS log
+// filter language, e.g. (addr.src in 10.0.0.0/8) and (app eq ssl).
+package logquery
+
+import (
+	"strings"
+)
+
+// Operators supported by the PAN-OS log filter language
+const (
+	OpEq       = "eq"
+	OpNeq      = "neq"
+	OpGeq      = "geq"
+	OpLeq      = "leq"
+	OpIn       = "in"
+	OpNotIn    = "notin"
+	OpContains = "contains"
+	OpHas      = "has"
+)
+
+// operators is the set of valid comparison operators
+var operators = map[string]bool{
+	OpEq: true, OpNeq: true, OpGeq: true, OpLeq: true,
+	OpIn: true, OpNotIn: true, OpContains: true, OpHas: true,
+}
+
+// Expr is a node of a log filter query
+type Expr interface {
+	// String renders the expression in PAN-OS filter syntax
+	String() string
+}
+
+// Condition compares a log field with a value
+type Condition struct {
+	Field    string
+	Operator string
+	Value    string
+}
+
+// Group combines expressions with "and" or "or"
+type Group struct {
+	Op    string
+	Exprs []Expr
+}
+
+// Negation inverts an expression
+type Negation struct {
+	Expr Expr
+}
+
+// Cond returns a condition. Use the helpers such as Eq and In for the
+// common operators.
+func Cond(field, operator, value string) *Condition {
+	return &Condition{Field: field, Operator: operator, Value: value}
+}
+
+// Eq matches a field equal to value
+func Eq(field, value string) *Condition { return Cond(field, OpEq, value) }
+
+// Neq matches a field not equal to value
+func Neq(field, value string) *Condition { return Cond(field, OpNeq, value) }
+
+// Geq matches a field greater than or equal to value
+func Geq(field, value string) *Condition { return Cond(field, OpGeq, value) }
+
+// Leq matches a field less than or equal to value
+func Leq(field, value string) *Condition { return Cond(field, OpLeq, value) }
+
+// In matches an address field inside a subnet or range
+func In(field, value string) *Condition { return Cond(field, OpIn, value) }
+
+// NotIn matches an address field outside a subnet or range
+func NotIn(field, value string) *Condition { return Cond(field, OpNotIn, value) }
+
+// Contains matches a field containing value
+func Contains(field, value string) *Condition { return Cond(field, OpContains, value) }
+
+// And joins expressions so that all must match. Nil expressions are skipped.
+func And(exprs ...Expr) Expr { return group("and", exprs) }
+
+// Or joins expressions so that any may match. Nil expressions are skipped.
+func Or(exprs ...Expr) Expr { return group("or", exprs) }
+
+// Not negates an expression
+func Not(e Expr) Expr { return &Negation{Expr: e} }
+
+func group(op string, exprs []Expr) Expr {
+	var kept []Expr
+	for _, e := range exprs {
+		if e == nil {
+			continue
+		}
+		// Flatten nested groups of the same kind
+		if g, ok := e.(*Group); ok && g.Op == op {
+			kept = append(kept, g.Exprs...)
+			continue
+		}
+		kept = append(kept, e)
+	}
+
+	switch len(kept) {
+	case 0:
+		return nil
+	case 1:
+		return kept[0]
+	}
+	return &Group{Op: op, Exprs: kept}
+}
+
+// String renders the condition, quoting the value when needed
+func (c *Condition) String() string {
+	return "(" + c.Field + " " + c.Operator + " " + quote(c.Value) + ")"
+}
+
+// String renders the group, wrapping nested groups in parentheses
+func (g *Group) String() string {
+	parts := make([]string, 0, len(g.Exprs))
+	for _, e := range g.Exprs {
+		s := e.String()
+		if _, nested := e.(*Group); nested {
+			s = "(" + s + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " "+g.Op+" ")
+}
+
+// String renders the negation
+func (n *Negation) String() string {
+	s := n.Expr.String()
+	if _, isCond := n.Expr.(*Condition); !isCond {
+		s = "(" + s + ")"
+	}
+	return "not " + s
+}
+
+// quote wraps values containing spaces, parentheses or quotes in single
+// quotes. Inside them a quote is escaped with a backslash, and a backslash
+// only where it would otherwise read as an escape: before a quote, another
+// backslash or the closing quote. DOMAIN\user is written as is.
+func quote(value string) string {
+	if value != "" && !strings.ContainsAny(value, " \t()'\"") {
+		return value
+	}
+
+	runes := []rune(value)
+	var b strings.Builder
+	b.WriteByte('\'')
+	for i, r := range runes {
+		switch {
+		case r == '\'':
+			b.WriteString("\\'")
+		case r == '\\' && (i+1 == len(runes) || runes[i+1] == '\'' || runes[i+1] == '\\'):
+			b.WriteString("\\\\")
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteByte('\'')
+	return b.String()
+}
+
+// Combine joins raw query strings with "and", skipping empty ones. Each
+// part is wrapped in parentheses so its own and/or structure is kept.
+func Combine(queries ...string) string {
+	var parts []string
+	for _, q := range queries {
+		q = strings.TrimSpace(q)
+		if q == "" {
+			continue
+		}
+		parts = append(parts, q)
+	}
+	if len(parts) <= 1 {
+		return strings.Join(parts, "")
+	}
+	for i, p := range parts {
+		parts[i] = "(" + p + ")"
+	}
+	return strings.Join(parts, " and ")
+}
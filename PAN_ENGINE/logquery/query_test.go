@@ -0,0 +1,111 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package logquery
+
+import "testing"
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`ssl`, `ssl`},
+		{`10.0.0.0/8`, `10.0.0.0/8`},
+		{``, `''`},
+		{`Allow Web`, `'Allow Web'`},
+		{`a(b)`, `'a(b)'`},
+		{`it's`, `'it\'s'`},
+		{`say "hi"`, `'say "hi"'`},
+		{`acme\bob`, `acme\bob`},
+		{`acme\bob smith`, `'acme\bob smith'`},
+		{`it's acme\`, `'it\'s acme\\'`},
+		{`a\'b`, `'a\\\'b'`},
+		{`a\\b c`, `'a\\\b c'`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			if got := quote(tt.value); got != tt.want {
+				t.Errorf("quote(%q) = %s, want %s", tt.value, got, tt.want)
+			}
+		})
+	}
+}
+
+// A quoted value reads back as the value it was made from
+func TestQuoteRoundTrip(t *testing.T) {
+	values := []string{
+		``, `plain`, `two words`, `it's`, `acme\bob`, `acme\bob smith`,
+		`trailing\ `, `ends with\`, `it's acme\`, `a\'b`, `a\\b c`, `\\\`, `"double"`,
+		`(parens)`, `tab	here`,
+	}
+
+	for _, value := range values {
+		t.Run(value, func(t *testing.T) {
+			expr, err := Parse(Eq("rule", value).String())
+			if err != nil {
+				t.Fatalf("Parse(%s) failed: %v", Eq("rule", value), err)
+			}
+			c, ok := expr.(*Condition)
+			if !ok {
+				t.Fatalf("Parse returned %T, want *Condition", expr)
+			}
+			if c.Value != value {
+				t.Errorf("value %q read back as %q", value, c.Value)
+			}
+		})
+	}
+}
+
+func TestBuilders(t *testing.T) {
+	tests := []struct {
+		name string
+		expr Expr
+		want string
+	}{
+		{"eq", Eq("app", "ssl"), `(app eq ssl)`},
+		{"and", And(In("addr.src", "10.0.0.0/8"), Eq("app", "ssl")), `(addr.src in 10.0.0.0/8) and (app eq ssl)`},
+		{"and skips nil", And(nil, Eq("app", "ssl"), nil), `(app eq ssl)`},
+		{"nested and flattens", And(And(Eq("a", "1"), Eq("b", "2")), Eq("c", "3")), `(a eq 1) and (b eq 2) and (c eq 3)`},
+		{"or inside and", And(Eq("a", "1"), Or(Eq("b", "2"), Eq("c", "3"))), `(a eq 1) and ((b eq 2) or (c eq 3))`},
+		{"not condition", Not(Neq("action", "allow")), `not (action neq allow)`},
+		{"not group", Not(Or(Eq("a", "1"), Eq("b", "2"))), `not ((a eq 1) or (b eq 2))`},
+		{"geq leq", And(Geq("port.dst", "1024"), Leq("port.dst", "2048")), `(port.dst geq 1024) and (port.dst leq 2048)`},
+		{"contains", Contains("url", "example"), `(url contains example)`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.expr.String(); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	if And(nil, nil) != nil {
+		t.Error("And of only nil expressions should be nil")
+	}
+}
+
+func TestCombine(t *testing.T) {
+	tests := []struct {
+		queries []string
+		want    string
+	}{
+		{nil, ``},
+		{[]string{"", "  "}, ``},
+		{[]string{"(app eq ssl)"}, `(app eq ssl)`},
+		{[]string{"(app eq ssl)", ""}, `(app eq ssl)`},
+		{[]string{"(a eq 1) or (b eq 2)", "(receive_time geq '2024/01/01 00:00:00')"},
+			`((a eq 1) or (b eq 2)) and ((receive_time geq '2024/01/01 00:00:00'))`},
+	}
+
+	for _, tt := range tests {
+		if got := Combine(tt.queries...); got != tt.want {
+			t.Errorf("Combine(%q) = %s, want %s", tt.queries, got, tt.want)
+		}
+	}
+}
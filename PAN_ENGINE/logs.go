@@ -0,0 +1,188 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/logquery"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// logTypeForEndpoint returns the log-type of a type=log endpoint, or ""
+func logTypeForEndpoint(endpoint string) string {
+	parsed, err := url.Parse(endpoint)
+	if err != nil || !strings.HasPrefix(parsed.Path, "/api") {
+		return ""
+	}
+	query := parsed.Query()
+	if query.Get("type") != panclient.TypeLog {
+		return ""
+	}
+	return query.Get("log-type")
+}
+
+// logLimit returns how many logs a report should fetch. The "nlogs" option
+// overrides the configured maximum row count.
+func (a *App) logLimit(options map[string]string) (int, error) {
+	if value := strings.TrimSpace(options["nlogs"]); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			return 0, fmt.Errorf("invalid nlogs value %q: must be a positive number", value)
+		}
+		return n, nil
+	}
+	if a.maxRows > 0 {
+		return a.maxRows, nil
+	}
+	return panclient.DefaultLogLimit, nil
+}
+
+// checkReportOptions rejects a date range or filter query on a report type
+// that is not a log report, since only logs are filtered server-side
+func checkReportOptions(reportType, logType, startDate, endDate string, options map[string]string) error {
+	if logType != "" {
+		return nil
+	}
+	if startDate != "" || endDate != "" {
+		return fmt.Errorf("report type %s cannot be filtered by date range; clear the start and end dates", reportType)
+	}
+	if strings.TrimSpace(options["query"]) != "" {
+		return fmt.Errorf("report type %s does not support log filter queries", reportType)
+	}
+	return nil
+}
+
+// logFilter validates the "query" option of a log report and returns it in
+// canonical form, or "" when no filter was given
+func logFilter(logType string, options map[string]string) (string, error) {
+	raw := strings.TrimSpace(options["query"])
+	if raw == "" {
+		return "", nil
+	}
+	return logquery.ParseAndValidate(logType, raw)
+}
+
+// deviceTimezone returns the connected device's time zone, falling back to
+// the local zone when the clock cannot be read
+func (a *App) deviceTimezone() *time.Location {
+	if a.deviceLocation != nil {
+		return a.deviceLocation
+	}
+
+	client, err := a.apiClient()
+	if err == nil {
+		var loc *time.Location
+		if loc, err = client.DeviceLocation(a.requestContext()); err == nil {
+			utils.InfoLogger.Printf("Device time zone: %s", loc)
+			a.deviceLocation = loc
+			return loc
+		}
+	}
+
+	utils.ErrorLogger.Printf("Could not read device clock, using local time zone: %v", err)
+	return time.Local
+}
+
+// fetchLogReport runs log query jobs for a report. Cancelling ctx stops
+// the job on the device. Large pulls spill to disk as they arrive.
+func (a *App) fetchLogReport(ctx context.Context, client *panclient.Client, logType, query string, limit int) (interface{}, error) {
+	utils.InfoLogger.Printf("Fetching %s logs: limit=%d query=%q", logType, limit, query)
+
+	rows := a.newRowSet()
+	err := client.EachLog(ctx, panclient.LogQuery{
+		LogType: logType,
+		Query:   query,
+		Limit:   limit,
+	}, func(row map[string]interface{}) error {
+		return rows.add(row, "")
+	})
+	if err != nil {
+		rows.close()
+		return nil, err
+	}
+
+	utils.InfoLogger.Printf("Fetched %d %s logs", rows.len(), logType)
+	return rows, nil
+}
+
+// logTypeForReport returns the PAN-OS log-type behind a log report type
+func (a *App) logTypeForReport(reportType string) (string, error) {
+	endpoint := a.getEndpointForReportType(reportType)
+	if endpoint == "" {
+		return "", fmt.Errorf("unknown report type: %s", reportType)
+	}
+	logType := logTypeForEndpoint(endpoint)
+	if logType == "" {
+		return "", fmt.Errorf("report type %s is not a log report", reportType)
+	}
+	return logType, nil
+}
+
+// GetLogQueryFields returns the filter fields available for a log report type
+func (a *App) GetLogQueryFields(reportType string) ([]string, error) {
+	logType, err := a.logTypeForReport(reportType)
+	if err != nil {
+		return nil, err
+	}
+	return logquery.Fields(logType), nil
+}
+
+// ValidateLogQuery checks a raw filter for a log report type and returns it
+// in canonical form
+func (a *App) ValidateLogQuery(reportType, query string) (string, error) {
+	logType, err := a.logTypeForReport(reportType)
+	if err != nil {
+		return "", err
+	}
+	return logquery.ParseAndValidate(logType, query)
+}
+
+// BuildLogQuery builds a validated filter from a list of conditions, each
+// with field, operator and value keys and an optional negate of "true".
+// Match is "all" (and) or "any" (or).
+func (a *App) BuildLogQuery(reportType string, conditions []map[string]string, match string) (string, error) {
+	logType, err := a.logTypeForReport(reportType)
+	if err != nil {
+		return "", err
+	}
+
+	var exprs []logquery.Expr
+	for _, c := range conditions {
+		var expr logquery.Expr = logquery.Cond(
+			strings.TrimSpace(c["field"]),
+			strings.ToLower(strings.TrimSpace(c["operator"])),
+			strings.TrimSpace(c["value"]),
+		)
+		if c["negate"] == "true" {
+			expr = logquery.Not(expr)
+		}
+		exprs = append(exprs, expr)
+	}
+	if len(exprs) == 0 {
+		return "", fmt.Errorf("at least one condition is required")
+	}
+
+	var expr logquery.Expr
+	switch match {
+	case "", "all":
+		expr = logquery.And(exprs...)
+	case "any":
+		expr = logquery.Or(exprs...)
+	default:
+		return "", fmt.Errorf("invalid match %q: must be 'all' or 'any'", match)
+	}
+
+	if err := logquery.Validate(logType, expr); err != nil {
+		return "", err
+	}
+	return expr.String(), nil
+}
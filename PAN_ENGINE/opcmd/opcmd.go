@@ -0,0 +1,235 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+// Package opcmd translates PAN-OS operational commands from CLI syntax to
+// the XML the API expects, so commands are never written as XML by hand:
+//
+//	show system info
+//	    <show><system><info></info></system></show>
+//	show session id 1234
+//	    <show><session><id>1234</id></session></show>
+//	test security-policy-match from trust to untrust destination-port 443
+//	    <test><security-policy-match><from>trust</from><to>untrust</to>
+//	    <destination-port>443</destination-port></security-policy-match></test>
+//
+// Words nest as elements until the first argument; from there on the
+// words are argument names, each followed by its value. A quoted word is
+// always a value, as are "yes", "no" and words that cannot be element
+// names such as "1234" or "ethernet1/1". A few argument names always take
+// a value, so "show interface all" reads "all" as the interface. Quote any
+// other value that looks like a keyword.
+//
+// The package only depends on the standard library so the report catalog
+// can use it.
+package opcmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// valueArguments are argument names that always take a value, even one
+// that looks like a keyword
+var valueArguments = map[string]bool{
+	"application": true,
+	"category":    true,
+	"from":        true,
+	"interface":   true,
+	"name":        true,
+	"rule":        true,
+	"source-user": true,
+	"to":          true,
+	"vsys":        true,
+	"zone":        true,
+}
+
+// valueWords are always values, never elements
+var valueWords = map[string]bool{
+	"yes": true,
+	"no":  true,
+}
+
+// token is one word of a command
+type token struct {
+	text string
+	// value is set for quoted words and words that cannot be elements
+	value bool
+}
+
+// XML returns the XML form of an op command. A command already in XML is
+// checked and returned as is.
+func XML(cmd string) (string, error) {
+	cmd = strings.TrimSpace(cmd)
+	if cmd == "" {
+		return "", errors.New("op command is empty")
+	}
+
+	if strings.HasPrefix(cmd, "<") {
+		if err := checkXML(cmd); err != nil {
+			return "", fmt.Errorf("invalid op command XML: %v", err)
+		}
+		return cmd, nil
+	}
+
+	tokens, err := split(cmd)
+	if err != nil {
+		return "", err
+	}
+	if tokens[0].value {
+		return "", fmt.Errorf("op command must start with a keyword, not %q", tokens[0].text)
+	}
+
+	var out strings.Builder
+	var path []string
+	i := 0
+
+	// Nest keywords until the first argument
+	for ; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.value {
+			// A trailing value is the text of the innermost element
+			if i != len(tokens)-1 {
+				return "", fmt.Errorf("unexpected value %q in op command", t.text)
+			}
+			out.WriteString(escape(t.text))
+			i++
+			break
+		}
+		if i+1 < len(tokens) && (tokens[i+1].value || valueArguments[t.text]) {
+			break
+		}
+		out.WriteString("<" + t.text + ">")
+		path = append(path, t.text)
+	}
+
+	// The rest are arguments, each with a value unless the next word is
+	// another argument
+	for i < len(tokens) {
+		name := tokens[i]
+		if name.value {
+			return "", fmt.Errorf("unexpected value %q in op command", name.text)
+		}
+		if i+1 < len(tokens) && (tokens[i+1].value || valueArguments[name.text]) {
+			out.WriteString("<" + name.text + ">" + escape(tokens[i+1].text) + "</" + name.text + ">")
+			i += 2
+			continue
+		}
+		out.WriteString("<" + name.text + "></" + name.text + ">")
+		i++
+	}
+
+	if len(path) == 0 {
+		return "", fmt.Errorf("op command %q has no command keyword", cmd)
+	}
+	for j := len(path) - 1; j >= 0; j-- {
+		out.WriteString("</" + path[j] + ">")
+	}
+	return out.String(), nil
+}
+
+// split breaks a command into words. Single or double quotes group words
+// into one value; a backslash escapes the next character inside double
+// quotes.
+func split(cmd string) ([]token, error) {
+	var tokens []token
+	var word strings.Builder
+	inWord, quoted := false, false
+	var quote rune
+
+	flush := func() {
+		if inWord {
+			text := word.String()
+			tokens = append(tokens, token{text: text, value: quoted || valueWords[text] || !validElementName(text)})
+		}
+		word.Reset()
+		inWord, quoted = false, false
+	}
+
+	runes := []rune(cmd)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			switch {
+			case r == quote:
+				quote = 0
+			case r == '\\' && quote == '"' && i+1 < len(runes):
+				i++
+				word.WriteRune(runes[i])
+			default:
+				word.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inWord, quoted = true, true
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			word.WriteRune(r)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated %c quote in op command", quote)
+	}
+	flush()
+
+	if len(tokens) == 0 {
+		return nil, errors.New("op command is empty")
+	}
+	return tokens, nil
+}
+
+// escape returns s with XML special characters escaped
+func escape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// validElementName reports whether a CLI word can be used as an XML element
+func validElementName(name string) bool {
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '_':
+		case i > 0 && (r >= '0' && r <= '9' || r == '-' || r == '.'):
+		default:
+			return false
+		}
+	}
+	return name != ""
+}
+
+// checkXML verifies that s is a single well-formed element
+func checkXML(s string) error {
+	decoder := xml.NewDecoder(strings.NewReader(s))
+	depth, roots := 0, 0
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		switch tok.(type) {
+		case xml.StartElement:
+			if depth == 0 {
+				roots++
+			}
+			depth++
+		case xml.EndElement:
+			depth--
+		}
+	}
+	if roots != 1 || depth != 0 {
+		return errors.New("expected a single root element")
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package opcmd
+
+import "testing"
+
+func TestXML(t *testing.T) {
+	tests := []struct {
+		cmd  string
+		want string
+	}{
+		{`show system info`, `<show><system><info></info></system></show>`},
+		{`  show   system info `, `<show><system><info></info></system></show>`},
+		{`show session id 1234`, `<show><session><id>1234</id></session></show>`},
+		{`show interface all`, `<show><interface>all</interface></show>`},
+		{`show interface ethernet1/1`, `<show><interface>ethernet1/1</interface></show>`},
+		{`show jobs all`, `<show><jobs><all></all></jobs></show>`},
+		{`show system setting target-vsys`, `<show><system><setting><target-vsys></target-vsys></setting></system></show>`},
+		{`test security-policy-match from trust to untrust destination-port 443`,
+			`<test><security-policy-match><from>trust</from><to>untrust</to><destination-port>443</destination-port></security-policy-match></test>`},
+		{`set system setting target-vsys yes`, `<set><system><setting><target-vsys>yes</target-vsys></setting></system></set>`},
+		{`show routing route type 'static'`, `<show><routing><route><type>static</type></route></routing></show>`},
+		{`show object name "web server"`, `<show><object><name>web server</name></object></show>`},
+		{`show object name "say \"hi\""`, `<show><object><name>say &#34;hi&#34;</name></object></show>`},
+		{`show object name 'a<b>&c'`, `<show><object><name>a&lt;b&gt;&amp;c</name></object></show>`},
+		{`<show><system><info></info></system></show>`, `<show><system><info></info></system></show>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.cmd, func(t *testing.T) {
+			got, err := XML(tt.cmd)
+			if err != nil {
+				t.Fatalf("XML(%s) failed: %v", tt.cmd, err)
+			}
+			if got != tt.want {
+				t.Errorf("XML(%s) = %s, want %s", tt.cmd, got, tt.want)
+			}
+			if err := checkXML(got); err != nil {
+				t.Errorf("XML(%s) is not well formed: %v", tt.cmd, err)
+			}
+		})
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cmd  string
+	}{
+		{"empty", ``},
+		{"blank", `   `},
+		{"starts with a value", `1234 show`},
+		{"starts quoted", `'show' system`},
+		{"value before keyword", `show 1234 info`},
+		{"unterminated quote", `show object name 'web`},
+		{"two values", `show session id 1 2`},
+		{"no keyword", `yes`},
+		{"broken xml", `<show><system></show>`},
+		{"two roots", `<show></show><show></show>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got, err := XML(tt.cmd); err == nil {
+				t.Errorf("XML(%s) = %s, want an error", tt.cmd, got)
+			}
+		})
+	}
+}
+
+func TestValidElementName(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"system", true},
+		{"ip-user-mapping", true},
+		{"target_vsys", true},
+		{"v1.2", true},
+		{"", false},
+		{"1234", false},
+		{"-flag", false},
+		{"ethernet1/1", false},
+		{"10.0.0.1", false},
+		{"a b", false},
+	}
+
+	for _, tt := range tests {
+		if got := validElementName(tt.name); got != tt.want {
+			t.Errorf("validElementName(%q) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,503 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+// Package panclient is a reusable client for the PAN-OS XML and REST APIs.
+// It is shared by the desktop app and any automation that needs to talk to
+// a firewall or Panorama without going through the Wails bindings.
+package panclient
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultTimeout is applied to every request that has no earlier deadline
+	DefaultTimeout = 30 * time.Second
+
+	// DefaultUserAgent identifies the engine in firewall access logs
+	DefaultUserAgent = "PAN_ENGINE/2.0"
+
+	// DefaultMaxResponseSize caps the body of a single response
+	DefaultMaxResponseSize = 512 << 20
+)
+
+// ErrResponseTooLarge is returned when a response body exceeds the limit
+// set with WithMaxResponseSize
+var ErrResponseTooLarge = errors.New("response exceeds the maximum response size")
+
+// Client talks to a single PAN-OS device. It is safe for concurrent use and
+// keeps a pooled transport, so one Client should be reused for all calls to
+// the same device.
+type Client struct {
+	baseURL    *url.URL
+	apiKey     string
+	httpClient *http.Client
+	timeout    time.Duration
+	userAgent  string
+	logger     *log.Logger
+	// target is the managed firewall serial when proxying through Panorama
+	target string
+	// closers are released by Close, e.g. an SSH jump host connection
+	closers []io.Closer
+	// scheduler rate limits requests to the device, shared by all its clients
+	scheduler *scheduler
+	retry     RetryPolicy
+	// maxResponse caps the bytes read from one response body
+	maxResponse int64
+}
+
+// Option configures a Client
+type Option func(*Client) error
+
+// WithTimeout sets the default per-request timeout. A deadline already set
+// on the request context is kept if it is earlier.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		if d <= 0 {
+			return errors.New("timeout must be positive")
+		}
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithMaxResponseSize caps how many bytes are read from one response, so a
+// huge session table or log pull fails instead of exhausting memory
+func WithMaxResponseSize(n int64) Option {
+	return func(c *Client) error {
+		if n <= 0 {
+			return errors.New("maximum response size must be positive")
+		}
+		c.maxResponse = n
+		return nil
+	}
+}
+
+// WithHTTPClient replaces the underlying HTTP client entirely
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) error {
+		if hc == nil {
+			return errors.New("http client cannot be nil")
+		}
+		c.httpClient = hc
+		return nil
+	}
+}
+
+// WithTransport plugs a custom round tripper into the pooled HTTP client
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *Client) error {
+		if rt == nil {
+			return errors.New("transport cannot be nil")
+		}
+		c.httpClient.Transport = rt
+		return nil
+	}
+}
+
+// WithTLSConfig sets the TLS configuration of the pooled transport. It has
+// no effect when a custom round tripper has been plugged in.
+func WithTLSConfig(cfg *tls.Config) Option {
+	return func(c *Client) error {
+		if cfg == nil {
+			return errors.New("tls config cannot be nil")
+		}
+		if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+			t.TLSClientConfig = cfg
+		}
+		return nil
+	}
+}
+
+// WithLogger sets the logger used for request tracing
+func WithLogger(l *log.Logger) Option {
+	return func(c *Client) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// WithUserAgent overrides the User-Agent header
+func WithUserAgent(ua string) Option {
+	return func(c *Client) error {
+		c.userAgent = ua
+		return nil
+	}
+}
+
+// New creates a Client for the device at baseURL (for example
+// "https://fw.example.com"). The API key may be empty when the client is only
+// used to generate one with Keygen.
+func New(baseURL, apiKey string, opts ...Option) (*Client, error) {
+	u, err := url.Parse(strings.TrimRight(strings.TrimSpace(baseURL), "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid API URL: %v", err)
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("invalid API URL %q: scheme must be http or https", baseURL)
+	}
+	if u.Host == "" {
+		return nil, fmt.Errorf("invalid API URL %q: missing host", baseURL)
+	}
+
+	c := &Client{
+		baseURL:    u,
+		apiKey:     apiKey,
+		httpClient: &http.Client{Transport: NewTransport()},
+		timeout:    DefaultTimeout,
+		userAgent:  DefaultUserAgent,
+		scheduler:  schedulerFor(u.Host),
+		retry:      DefaultRetryPolicy,
+
+		maxResponse: DefaultMaxResponseSize,
+	}
+
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// NewTransport returns the pooled transport used by default. It is exported
+// so callers can wrap or tweak it before passing it to WithTransport.
+func NewTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxIdleConnsPerHost:   10,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: 1 * time.Second,
+	}
+}
+
+// BaseURL returns the device URL the client was created with
+func (c *Client) BaseURL() string {
+	return c.baseURL.String()
+}
+
+// APIKey returns the key sent with every request
+func (c *Client) APIKey() string {
+	return c.apiKey
+}
+
+// CloseIdleConnections releases pooled connections
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+// Close releases pooled connections and anything the options opened, such
+// as an SSH jump host connection. The client must not be used afterwards.
+func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
+
+	var first error
+	for _, closer := range c.closers {
+		if err := closer.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.closers = nil
+	return first
+}
+
+// XML API request types
+const (
+	TypeOp     = "op"
+	TypeConfig = "config"
+	TypeLog    = "log"
+	TypeExport = "export"
+	TypeKeygen = "keygen"
+	TypeCommit = "commit"
+)
+
+// XMLResponse is a decoded response from the /api endpoint
+type XMLResponse struct {
+	// Raw is the unparsed response body
+	Raw []byte
+	// Root is the <response> element
+	Root *Node
+	// Status and Code are the attributes of the <response> element
+	Status string
+	Code   string
+	// Result is the <result> element converted with Node.ToValue
+	Result interface{}
+}
+
+// XML sends a request to the legacy /api endpoint. Parameters are sent as a
+// form-encoded POST so that keys, passwords and long commands never end up
+// in URLs or proxy logs. Read-only requests are retried on transient errors.
+func (c *Client) XML(ctx context.Context, params url.Values) (*XMLResponse, error) {
+	if params.Get("type") == "" {
+		return nil, errors.New("XML API request requires a type parameter")
+	}
+	if c.target != "" && params.Get("target") == "" {
+		params = cloneValues(params)
+		params.Set("target", c.target)
+	}
+
+	var resp *XMLResponse
+	err := c.send(ctx, xmlIdempotent(params), func(ctx context.Context) error {
+		var err error
+		resp, err = c.xmlOnce(ctx, params)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// xmlOnce sends one XML API request and decodes the response
+func (c *Client) xmlOnce(ctx context.Context, params url.Values) (*XMLResponse, error) {
+	status, body, err := c.do(ctx, http.MethodPost, "/api/", nil, "application/x-www-form-urlencoded",
+		strings.NewReader(params.Encode()), params.Get("type") != TypeKeygen)
+	if err != nil {
+		return nil, err
+	}
+	return xmlResult(status, body)
+}
+
+// xmlResult decodes an XML API response body, turning error statuses into
+// an APIError
+func xmlResult(status int, body []byte) (*XMLResponse, error) {
+	resp, err := ParseXMLResponse(body)
+	if err != nil {
+		// Not a PAN-OS response at all, e.g. an HTML error page
+		if status != http.StatusOK {
+			return nil, &APIError{Flavor: FlavorXML, HTTPStatus: status, Kind: classifyCode("", status, "")}
+		}
+		return nil, err
+	}
+
+	// Errors are often reported with HTTP 200 and status="error"
+	if resp.Status == "error" || status != http.StatusOK {
+		return nil, xmlError(resp, status)
+	}
+
+	return resp, nil
+}
+
+// Op runs an operational command, given in its XML form
+func (c *Client) Op(ctx context.Context, cmd string) (*XMLResponse, error) {
+	return c.XML(ctx, url.Values{"type": {TypeOp}, "cmd": {cmd}})
+}
+
+// Config runs a configuration action (get, show, set, edit, delete, ...)
+// against an XPath. The element is only sent when non-empty.
+func (c *Client) Config(ctx context.Context, action, xpath, element string) (*XMLResponse, error) {
+	params := url.Values{"type": {TypeConfig}, "action": {action}, "xpath": {xpath}}
+	if element != "" {
+		params.Set("element", element)
+	}
+	return c.XML(ctx, params)
+}
+
+// Log sends a type=log request. Callers supply log-type, nlogs, query etc.
+func (c *Client) Log(ctx context.Context, params url.Values) (*XMLResponse, error) {
+	p := cloneValues(params)
+	p.Set("type", TypeLog)
+	return c.XML(ctx, p)
+}
+
+// Export sends a type=export request for the given category
+func (c *Client) Export(ctx context.Context, category string, params url.Values) (*XMLResponse, error) {
+	p := cloneValues(params)
+	p.Set("type", TypeExport)
+	p.Set("category", category)
+	return c.XML(ctx, p)
+}
+
+// Commit sends a commit request. An empty cmd commits everything.
+func (c *Client) Commit(ctx context.Context, cmd string) (*XMLResponse, error) {
+	if cmd == "" {
+		cmd = "<commit></commit>"
+	}
+	return c.XML(ctx, url.Values{"type": {TypeCommit}, "cmd": {cmd}})
+}
+
+// Keygen exchanges a username and password for an API key. The password
+// is only sent in the request body and is never stored by the client.
+func (c *Client) Keygen(ctx context.Context, username, password string) (string, error) {
+	if username == "" || password == "" {
+		return "", errors.New("username and password are required")
+	}
+
+	resp, err := c.XML(ctx, url.Values{"type": {TypeKeygen}, "user": {username}, "password": {password}})
+	if err != nil {
+		return "", err
+	}
+
+	key := resp.Root.Find("result/key")
+	if key == nil || strings.TrimSpace(key.Text) == "" {
+		return "", errors.New("keygen response did not contain an API key")
+	}
+
+	return strings.TrimSpace(key.Text), nil
+}
+
+// REST sends a request to the /restapi endpoint and decodes the JSON body.
+// A non-nil body is marshalled as JSON. GET requests are retried on
+// transient errors.
+func (c *Client) REST(ctx context.Context, method, path string, query url.Values, body interface{}) (map[string]interface{}, error) {
+	if c.target != "" {
+		return nil, errors.New("REST API requests cannot be proxied through Panorama to a managed firewall")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return nil, fmt.Errorf("error encoding request body: %v", err)
+		}
+	}
+
+	var result map[string]interface{}
+	err := c.send(ctx, restIdempotent(method), func(ctx context.Context) error {
+		var reader io.Reader
+		if data != nil {
+			reader = bytes.NewReader(data)
+		}
+
+		status, raw, err := c.do(ctx, method, path, query, "application/json", reader, true)
+		if err != nil {
+			return err
+		}
+		if status < 200 || status >= 300 {
+			return restError(raw, status)
+		}
+
+		result = nil
+		if err := json.Unmarshal(raw, &result); err != nil {
+			return fmt.Errorf("error parsing response: %v", err)
+		}
+		if result["@status"] == "error" {
+			return restError(raw, status)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// do executes a single request against the device and returns the HTTP
+// status and body. Only transport failures are returned as errors; the
+// caller decides what a non-200 status means for its API flavor.
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader, withKey bool) (int, []byte, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := c.newRequest(ctx, method, path, query, contentType, body, withKey)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return 0, nil, fmt.Errorf("error making request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(c.limitBody(resp.Body))
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("error reading response: %w", err)
+	}
+
+	return resp.StatusCode, data, nil
+}
+
+// newRequest builds a request for a path below the device's base URL
+func (c *Client) newRequest(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader, withKey bool) (*http.Request, error) {
+	u := *c.baseURL
+	u.Path = strings.TrimRight(u.Path, "/") + path
+	if len(query) > 0 {
+		u.RawQuery = query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+
+	if withKey && c.apiKey != "" {
+		req.Header.Set("X-PAN-KEY", c.apiKey)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Accept", "application/json, application/xml")
+	req.Header.Set("User-Agent", c.userAgent)
+
+	if c.logger != nil {
+		c.logger.Printf("Calling API: %s %s", method, u.Path)
+	}
+	return req, nil
+}
+
+// limitBody fails reads past the maximum response size
+func (c *Client) limitBody(body io.Reader) io.Reader {
+	return &limitedReader{r: body, remaining: c.maxResponse}
+}
+
+// limitedReader is io.LimitReader returning ErrResponseTooLarge instead of
+// a silent EOF, so a truncated body is never mistaken for a complete one
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		// Allow a clean EOF exactly at the limit
+		var probe [1]byte
+		if n, err := l.r.Read(probe[:]); n == 0 && err != nil {
+			return 0, err
+		}
+		return 0, ErrResponseTooLarge
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// cloneValues copies url.Values so callers' maps are never mutated
+func cloneValues(v url.Values) url.Values {
+	out := make(url.Values, len(v)+2)
+	for k, vals := range v {
+		out[k] = append([]string(nil), vals...)
+	}
+	return out
+}
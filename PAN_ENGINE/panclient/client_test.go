@@ -0,0 +1,374 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// sentRequest is what a test server saw of one request
+type sentRequest struct {
+	method string
+	path   string
+	query  url.Values
+	form   url.Values
+	body   string
+	key    string
+}
+
+// recordingClient returns a client for a server that records every request
+// and answers with status and body
+func recordingClient(t *testing.T, status int, body string, opts ...Option) (*Client, func() []sentRequest) {
+	t.Helper()
+	var (
+		mu   sync.Mutex
+		sent []sentRequest
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(raw))
+		mu.Lock()
+		sent = append(sent, sentRequest{
+			method: r.Method,
+			path:   r.URL.Path,
+			query:  r.URL.Query(),
+			form:   form,
+			body:   string(raw),
+			key:    r.Header.Get("X-PAN-KEY"),
+		})
+		mu.Unlock()
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, "secret-key", append([]Option{WithRetry(RetryPolicy{MaxAttempts: 1})}, opts...)...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client, func() []sentRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]sentRequest(nil), sent...)
+	}
+}
+
+// onlyRequest returns the single request a test sent
+func onlyRequest(t *testing.T, sent []sentRequest) sentRequest {
+	t.Helper()
+	if len(sent) != 1 {
+		t.Fatalf("sent %d requests, want 1", len(sent))
+	}
+	return sent[0]
+}
+
+const successXML = `<response status="success"><result><hostname>fw1</hostname></result></response>`
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://fw.example.com", true},
+		{" https://fw.example.com/ ", true},
+		{"http://10.0.0.1:8080", true},
+		{"fw.example.com", false},
+		{"ftp://fw.example.com", false},
+		{"https://", false},
+		{"https://fw\x7f.example.com", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			c, err := New(tt.url, "key")
+			if (err == nil) != tt.ok {
+				t.Fatalf("New(%q) error = %v, want ok=%v", tt.url, err, tt.ok)
+			}
+			if c != nil {
+				c.Close()
+			}
+		})
+	}
+}
+
+func TestXML(t *testing.T) {
+	tests := []struct {
+		name     string
+		call     func(c *Client) (*XMLResponse, error)
+		wantForm url.Values
+	}{
+		{"op", func(c *Client) (*XMLResponse, error) {
+			return c.Op(context.Background(), "<show><system><info></info></system></show>")
+		}, url.Values{"type": {"op"}, "cmd": {"<show><system><info></info></system></show>"}}},
+		{"config get", func(c *Client) (*XMLResponse, error) {
+			return c.Config(context.Background(), "get", "/config/shared/address", "")
+		}, url.Values{"type": {"config"}, "action": {"get"}, "xpath": {"/config/shared/address"}}},
+		{"config set", func(c *Client) (*XMLResponse, error) {
+			return c.Config(context.Background(), "set", "/config/shared/address", "<entry name='a'/>")
+		}, url.Values{"type": {"config"}, "action": {"set"}, "xpath": {"/config/shared/address"}, "element": {"<entry name='a'/>"}}},
+		{"log", func(c *Client) (*XMLResponse, error) {
+			return c.Log(context.Background(), url.Values{"log-type": {"traffic"}, "nlogs": {"20"}})
+		}, url.Values{"type": {"log"}, "log-type": {"traffic"}, "nlogs": {"20"}}},
+		{"export", func(c *Client) (*XMLResponse, error) {
+			return c.Export(context.Background(), "configuration", nil)
+		}, url.Values{"type": {"export"}, "category": {"configuration"}}},
+		{"commit", func(c *Client) (*XMLResponse, error) {
+			return c.Commit(context.Background(), "")
+		}, url.Values{"type": {"commit"}, "cmd": {"<commit></commit>"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sent := recordingClient(t, http.StatusOK, successXML)
+
+			resp, err := tt.call(client)
+			if err != nil {
+				t.Fatalf("request failed: %v", err)
+			}
+			if resp.Status != "success" || resp.Root.Find("result/hostname").Text != "fw1" {
+				t.Errorf("response = %+v, want the decoded result", resp)
+			}
+
+			req := onlyRequest(t, sent())
+			if req.method != http.MethodPost || req.path != "/api/" {
+				t.Errorf("sent %s %s, want POST /api/", req.method, req.path)
+			}
+			if len(req.query) != 0 {
+				t.Errorf("parameters leaked into the URL: %v", req.query)
+			}
+			if req.form.Encode() != tt.wantForm.Encode() {
+				t.Errorf("form = %v, want %v", req.form, tt.wantForm)
+			}
+			if req.key != "secret-key" {
+				t.Errorf("X-PAN-KEY = %q, want the API key", req.key)
+			}
+		})
+	}
+}
+
+func TestXMLRequiresType(t *testing.T) {
+	client, sent := recordingClient(t, http.StatusOK, successXML)
+	if _, err := client.XML(context.Background(), url.Values{"cmd": {"<show/>"}}); err == nil {
+		t.Error("XML accepted a request without a type")
+	}
+	if n := len(sent()); n != 0 {
+		t.Errorf("sent %d requests, want none", n)
+	}
+}
+
+func TestXMLErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		kind    ErrorKind
+		code    string
+		message string
+	}{
+		{"error with HTTP 200", http.StatusOK,
+			`<response status="error" code="403"><result><msg>Invalid credentials.</msg></result></response>`,
+			KindAuth, "403", "Invalid credentials."},
+		{"object not present", http.StatusOK,
+			`<response status="error" code="7"><msg><line>Object doesn't exist</line></msg></response>`,
+			KindObjectNotPresent, "7", "Object doesn't exist"},
+		{"XML error with HTTP status", http.StatusServiceUnavailable,
+			`<response status="success"><result/></response>`,
+			KindServer, "", ""},
+		{"HTML error page", http.StatusBadGateway,
+			`<html><body>Bad gateway</body></html>`,
+			KindServer, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := recordingClient(t, tt.status, tt.body)
+
+			_, err := client.Op(context.Background(), "<show><clock></clock></show>")
+			apiErr, ok := AsAPIError(err)
+			if !ok {
+				t.Fatalf("Op returned %v, want an APIError", err)
+			}
+			if apiErr.Flavor != FlavorXML || apiErr.Kind != tt.kind || apiErr.Code != tt.code || apiErr.Message != tt.message {
+				t.Errorf("APIError = %+v, want kind %s, code %q and message %q", apiErr, tt.kind, tt.code, tt.message)
+			}
+			if apiErr.HTTPStatus != tt.status {
+				t.Errorf("HTTPStatus = %d, want %d", apiErr.HTTPStatus, tt.status)
+			}
+		})
+	}
+}
+
+func TestXMLNotXML(t *testing.T) {
+	client, _ := recordingClient(t, http.StatusOK, "not xml at all")
+	_, err := client.Op(context.Background(), "<show><clock></clock></show>")
+	if err == nil {
+		t.Fatal("Op accepted a body that is not XML")
+	}
+	if _, ok := AsAPIError(err); ok {
+		t.Errorf("a malformed body was reported as a device error: %v", err)
+	}
+}
+
+func TestKeygen(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		password string
+		body     string
+		want     string
+		sends    bool
+		apiError bool
+	}{
+		{"success", "admin", "p@ss&word=1", `<response status="success"><result><key> LUFRPT14 </key></result></response>`, "LUFRPT14", true, false},
+		{"bad credentials", "admin", "wrong", `<response status="error" code="403"><result><msg>Invalid Credential</msg></result></response>`, "", true, true},
+		{"no key", "admin", "secret", `<response status="success"><result/></response>`, "", true, false},
+		{"empty key", "admin", "secret", `<response status="success"><result><key>  </key></result></response>`, "", true, false},
+		{"no username", "", "secret", successXML, "", false, false},
+		{"no password", "admin", "", successXML, "", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sent := recordingClient(t, http.StatusOK, tt.body)
+
+			key, err := client.Keygen(context.Background(), tt.username, tt.password)
+			if tt.want != "" {
+				if err != nil || key != tt.want {
+					t.Fatalf("Keygen = %q, %v, want %q", key, err, tt.want)
+				}
+			} else if err == nil {
+				t.Fatalf("Keygen = %q, want an error", key)
+			}
+			if _, ok := AsAPIError(err); ok != tt.apiError {
+				t.Errorf("Keygen error %v is an APIError: %v, want %v", err, ok, tt.apiError)
+			}
+
+			requests := sent()
+			if !tt.sends {
+				if len(requests) != 0 {
+					t.Errorf("sent %d requests, want none", len(requests))
+				}
+				return
+			}
+			req := onlyRequest(t, requests)
+			if req.form.Get("type") != TypeKeygen || req.form.Get("user") != tt.username || req.form.Get("password") != tt.password {
+				t.Errorf("form = %v, want the credentials", req.form)
+			}
+			if len(req.query) != 0 {
+				t.Errorf("credentials leaked into the URL: %v", req.query)
+			}
+			if req.key != "" {
+				t.Errorf("keygen sent X-PAN-KEY %q", req.key)
+			}
+		})
+	}
+}
+
+func TestKeygenNotRetried(t *testing.T) {
+	client, count := countingClient(t, respondStatus(http.StatusServiceUnavailable))
+	if _, err := client.Keygen(context.Background(), "admin", "secret"); err == nil {
+		t.Fatal("Keygen succeeded")
+	}
+	if *count != 1 {
+		t.Errorf("sent %d times, want 1", *count)
+	}
+}
+
+func TestREST(t *testing.T) {
+	client, sent := recordingClient(t, http.StatusOK, `{"@status":"success","result":{"entry":[{"@name":"web"}]}}`)
+
+	query := url.Values{"location": {"vsys"}, "vsys": {"vsys1"}}
+	result, err := client.REST(context.Background(), http.MethodPost, "restapi/v10.2/Objects/Addresses", query,
+		map[string]interface{}{"entry": map[string]string{"@name": "web"}})
+	if err != nil {
+		t.Fatalf("REST failed: %v", err)
+	}
+	if result["@status"] != "success" {
+		t.Errorf("result = %v", result)
+	}
+
+	req := onlyRequest(t, sent())
+	if req.method != http.MethodPost || req.path != "/restapi/v10.2/Objects/Addresses" {
+		t.Errorf("sent %s %s", req.method, req.path)
+	}
+	if req.query.Encode() != query.Encode() {
+		t.Errorf("query = %v, want %v", req.query, query)
+	}
+	if req.body != `{"entry":{"@name":"web"}}` {
+		t.Errorf("body = %s", req.body)
+	}
+	if req.key != "secret-key" {
+		t.Errorf("X-PAN-KEY = %q, want the API key", req.key)
+	}
+}
+
+func TestRESTErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		kind   ErrorKind
+	}{
+		{"error status with HTTP 200", http.StatusOK, `{"@status":"error","@code":"7","message":"Object Not Present"}`, KindObjectNotPresent},
+		{"HTTP 403", http.StatusForbidden, `{"@status":"error","code":16,"message":"Unauthorized"}`, KindAuth},
+		{"plain text", http.StatusNotFound, "Not Found", KindObjectNotPresent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, _ := recordingClient(t, tt.status, tt.body)
+			_, err := client.REST(context.Background(), http.MethodGet, "/restapi/v10.2/Objects/Addresses", nil, nil)
+			apiErr, ok := AsAPIError(err)
+			if !ok {
+				t.Fatalf("REST returned %v, want an APIError", err)
+			}
+			if apiErr.Flavor != FlavorREST || apiErr.Kind != tt.kind {
+				t.Errorf("APIError = %+v, want a REST %s error", apiErr, tt.kind)
+			}
+		})
+	}
+
+	client, _ := recordingClient(t, http.StatusOK, "{not json")
+	if _, err := client.REST(context.Background(), http.MethodGet, "/restapi/v10.2/Objects/Addresses", nil, nil); err == nil ||
+		!strings.Contains(err.Error(), "error parsing response") {
+		t.Errorf("REST with a malformed body returned %v", err)
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	tests := []struct {
+		limit int64
+		ok    bool
+	}{
+		{int64(len(successXML)), true},
+		{int64(len(successXML)) - 1, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.limit), func(t *testing.T) {
+			client, _ := recordingClient(t, http.StatusOK, successXML, WithMaxResponseSize(tt.limit))
+			_, err := client.Op(context.Background(), "<show><clock></clock></show>")
+			if tt.ok && err != nil {
+				t.Errorf("Op failed at the limit: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrResponseTooLarge) {
+				t.Errorf("Op over the limit returned %v, want ErrResponseTooLarge", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,204 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Configuration sources of the XML API
+const (
+	// ConfigRunning is the committed configuration, read with action=show
+	ConfigRunning = "running"
+	// ConfigCandidate includes uncommitted changes, read with action=get
+	ConfigCandidate = "candidate"
+)
+
+// configMetaAttrs are attributes PAN-OS adds to candidate configuration
+// to track changes; they are not part of the configuration itself
+var configMetaAttrs = map[string]bool{
+	"admin":   true,
+	"dirtyId": true,
+	"time":    true,
+}
+
+// ConfigNode is one child of a configuration element, for tree navigation
+type ConfigNode struct {
+	// Name is the element name, or the name attribute of an entry
+	Name string `json:"name"`
+	// XPath selects the node; members and values have none
+	XPath string `json:"xpath,omitempty"`
+	// Kind is "element", "entry", "member" or "value"
+	Kind string `json:"kind"`
+	// Value is the text of a member or value
+	Value       string `json:"value,omitempty"`
+	HasChildren bool   `json:"has_children"`
+}
+
+// ReadConfig reads the configuration at an XPath from the running or the
+// candidate configuration and returns the matched element. A path matching
+// several elements returns the <result> holding them.
+func (c *Client) ReadConfig(ctx context.Context, source, xpath string) (*XMLResponse, *Node, error) {
+	action := "show"
+	switch source {
+	case ConfigRunning, "":
+	case ConfigCandidate:
+		action = "get"
+	default:
+		return nil, nil, fmt.Errorf("invalid configuration source %q: must be running or candidate", source)
+	}
+
+	resp, err := c.Config(ctx, action, xpath, "")
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, configElement(resp), nil
+}
+
+// configElement returns the element a config read matched
+func configElement(resp *XMLResponse) *Node {
+	if resp.Root == nil {
+		return nil
+	}
+	result := resp.Root.Child("result")
+	if result == nil || len(result.Children) != 1 {
+		return result
+	}
+	return result.Children[0]
+}
+
+// ConfigChildren lists the children of the configuration element n found
+// at xpath. Entries are addressed by their name, so their XPath can be
+// read again to navigate the tree.
+func ConfigChildren(n *Node, xpath string) []ConfigNode {
+	if n == nil {
+		return []ConfigNode{}
+	}
+	xpath = strings.TrimRight(xpath, "/")
+
+	children := make([]ConfigNode, 0, len(n.Children))
+	for _, child := range n.Children {
+		node := ConfigNode{Name: child.Name, Kind: "element", HasChildren: len(child.Children) > 0}
+		switch {
+		case child.Name == "entry" && child.Attr("name") != "":
+			node.Name = child.Attr("name")
+			node.Kind = "entry"
+			node.XPath = xpath + "/entry[@name=" + xpathLiteral(node.Name) + "]"
+		case child.Name == "member":
+			node.Kind = "member"
+			node.Value = strings.TrimSpace(child.Text)
+		case len(child.Children) == 0:
+			node.Kind = "value"
+			node.Value = strings.TrimSpace(child.Text)
+			node.XPath = xpath + "/" + child.Name
+		default:
+			node.XPath = xpath + "/" + child.Name
+		}
+		children = append(children, node)
+	}
+	return children
+}
+
+// xpathLiteral quotes a string for an XPath predicate
+func xpathLiteral(s string) string {
+	if !strings.Contains(s, "'") {
+		return "'" + s + "'"
+	}
+	if !strings.Contains(s, `"`) {
+		return `"` + s + `"`
+	}
+	parts := strings.Split(s, "'")
+	return "concat('" + strings.Join(parts, `', "'", '`) + "')"
+}
+
+// ConfigLeaves flattens a configuration element into the values below it,
+// keyed by their path relative to n, such as
+// "entry[@name='web']/ip-netmask". Member lists are joined into one value
+// so reordering shows as a single change. Change tracking attributes of the
+// candidate configuration are left out.
+func ConfigLeaves(n *Node) map[string]string {
+	leaves := make(map[string]string)
+	if n != nil {
+		collectLeaves(leaves, "", n)
+	}
+	return leaves
+}
+
+func collectLeaves(leaves map[string]string, prefix string, n *Node) {
+	join := func(name string) string {
+		if prefix == "" {
+			return name
+		}
+		return prefix + "/" + name
+	}
+
+	for _, attr := range n.Attrs {
+		name := attr.Name.Local
+		if name == "name" || configMetaAttrs[name] {
+			continue
+		}
+		leaves[join("@"+name)] = attr.Value
+	}
+
+	var members []string
+	for _, child := range n.Children {
+		switch {
+		case child.Name == "member":
+			members = append(members, strings.TrimSpace(child.Text))
+		case child.Name == "entry" && child.Attr("name") != "":
+			path := join("entry[@name=" + xpathLiteral(child.Attr("name")) + "]")
+			leaves[path] = ""
+			collectLeaves(leaves, path, child)
+		case len(child.Children) == 0 && len(child.Attrs) == 0:
+			leaves[join(child.Name)] = strings.TrimSpace(child.Text)
+		default:
+			collectLeaves(leaves, join(child.Name), child)
+		}
+	}
+	if members != nil {
+		leaves[join("member")] = strings.Join(members, ", ")
+	}
+}
+
+// ConfigChange is one difference between two configurations
+type ConfigChange struct {
+	Path string `json:"path"`
+	// Change is "added", "removed" or "changed" going from running to
+	// candidate
+	Change    string `json:"change"`
+	Running   string `json:"running"`
+	Candidate string `json:"candidate"`
+}
+
+// DiffConfig compares the leaves of the running and candidate elements,
+// sorted by path
+func DiffConfig(running, candidate *Node) []ConfigChange {
+	before, after := ConfigLeaves(running), ConfigLeaves(candidate)
+
+	var changes []ConfigChange
+	for path, old := range before {
+		current, ok := after[path]
+		switch {
+		case !ok:
+			changes = append(changes, ConfigChange{Path: path, Change: "removed", Running: old})
+		case current != old:
+			changes = append(changes, ConfigChange{Path: path, Change: "changed", Running: old, Candidate: current})
+		}
+	}
+	for path, current := range after {
+		if _, ok := before[path]; !ok {
+			changes = append(changes, ConfigChange{Path: path, Change: "added", Candidate: current})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes
+}
@@ -0,0 +1,120 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// configNode parses a configuration element
+func configNode(t *testing.T, s string) *Node {
+	t.Helper()
+	n, err := DecodeXML(strings.NewReader(s))
+	if err != nil {
+		t.Fatalf("DecodeXML failed: %v", err)
+	}
+	return n
+}
+
+func TestConfigChildren(t *testing.T) {
+	n := configNode(t, `<address>
+		<entry name="web"><ip-netmask>10.0.0.1</ip-netmask></entry>
+		<entry name="it's"><fqdn>example.com</fqdn></entry>
+		<description>servers</description>
+		<tag><member>prod</member></tag>
+		<member>loose</member>
+	</address>`)
+
+	got := ConfigChildren(n, "/config/shared/address/")
+	want := []ConfigNode{
+		{Name: "web", XPath: `/config/shared/address/entry[@name='web']`, Kind: "entry", HasChildren: true},
+		{Name: "it's", XPath: `/config/shared/address/entry[@name="it's"]`, Kind: "entry", HasChildren: true},
+		{Name: "description", XPath: "/config/shared/address/description", Kind: "value", Value: "servers"},
+		{Name: "tag", XPath: "/config/shared/address/tag", Kind: "element", HasChildren: true},
+		{Name: "member", Kind: "member", Value: "loose"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigChildren =\n%+v\nwant\n%+v", got, want)
+	}
+
+	if got := ConfigChildren(nil, "/config"); got == nil || len(got) != 0 {
+		t.Errorf("ConfigChildren(nil) = %v, want an empty list", got)
+	}
+}
+
+func TestXPathLiteral(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{`web`, `'web'`},
+		{`it's`, `"it's"`},
+		{`say "hi"`, `'say "hi"'`},
+		{`it's "x"`, `concat('it', "'", 's "x"')`},
+	}
+
+	for _, tt := range tests {
+		if got := xpathLiteral(tt.value); got != tt.want {
+			t.Errorf("xpathLiteral(%s) = %s, want %s", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestConfigLeaves(t *testing.T) {
+	n := configNode(t, `<address admin="admin" dirtyId="3" time="2024/01/01">
+		<entry name="web" admin="admin" time="2024/01/01"><ip-netmask>10.0.0.1</ip-netmask><tag><member>prod</member><member>dmz</member></tag></entry>
+		<entry name="db" loc="shared"><fqdn>db.example.com</fqdn></entry>
+	</address>`)
+
+	want := map[string]string{
+		"entry[@name='web']":            "",
+		"entry[@name='web']/ip-netmask": "10.0.0.1",
+		"entry[@name='web']/tag/member": "prod, dmz",
+		"entry[@name='db']":             "",
+		"entry[@name='db']/@loc":        "shared",
+		"entry[@name='db']/fqdn":        "db.example.com",
+	}
+	if got := ConfigLeaves(n); !reflect.DeepEqual(got, want) {
+		t.Errorf("ConfigLeaves = %v, want %v", got, want)
+	}
+	if got := ConfigLeaves(nil); len(got) != 0 {
+		t.Errorf("ConfigLeaves(nil) = %v, want none", got)
+	}
+}
+
+func TestDiffConfig(t *testing.T) {
+	running := configNode(t, `<address>
+		<entry name="web"><ip-netmask>10.0.0.1</ip-netmask><tag><member>prod</member><member>dmz</member></tag></entry>
+		<entry name="old"><fqdn>old.example.com</fqdn></entry>
+	</address>`)
+	candidate := configNode(t, `<address admin="admin" dirtyId="5">
+		<entry name="web" admin="admin" dirtyId="5"><ip-netmask>10.0.0.2</ip-netmask><tag><member>dmz</member><member>prod</member></tag></entry>
+		<entry name="new"><fqdn>new.example.com</fqdn></entry>
+	</address>`)
+
+	want := []ConfigChange{
+		{Path: "entry[@name='new']", Change: "added"},
+		{Path: "entry[@name='new']/fqdn", Change: "added", Candidate: "new.example.com"},
+		{Path: "entry[@name='old']", Change: "removed"},
+		{Path: "entry[@name='old']/fqdn", Change: "removed", Running: "old.example.com"},
+		{Path: "entry[@name='web']/ip-netmask", Change: "changed", Running: "10.0.0.1", Candidate: "10.0.0.2"},
+		{Path: "entry[@name='web']/tag/member", Change: "changed", Running: "prod, dmz", Candidate: "dmz, prod"},
+	}
+	if got := DiffConfig(running, candidate); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffConfig =\n%+v\nwant\n%+v", got, want)
+	}
+
+	// Change tracking attributes alone are no change
+	tracked := configNode(t, `<address admin="admin" dirtyId="7" time="2024/01/01">
+		<entry name="web" admin="admin" dirtyId="7"><ip-netmask>10.0.0.1</ip-netmask><tag><member>prod</member><member>dmz</member></tag></entry>
+		<entry name="old" time="2024/01/01"><fqdn>old.example.com</fqdn></entry>
+	</address>`)
+	if got := DiffConfig(running, tracked); len(got) != 0 {
+		t.Errorf("DiffConfig with only change tracking attributes = %v, want none", got)
+	}
+}
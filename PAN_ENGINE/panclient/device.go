@@ -0,0 +1,126 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DeviceXPath is the config root of the local device
+const DeviceXPath = "/config/devices/entry[@name='localhost.localdomain']"
+
+// SystemInfo holds the fields of "show system info" that the engine uses
+type SystemInfo struct {
+	Hostname  string
+	Model     string
+	Serial    string
+	SWVersion string
+	Family    string
+	MultiVsys bool
+	// Fields holds every value returned by the device
+	Fields map[string]string
+}
+
+// IsPanorama reports whether the device is a Panorama
+func (s *SystemInfo) IsPanorama() bool {
+	return strings.EqualFold(s.Model, "Panorama") || strings.EqualFold(s.Family, "pc") ||
+		strings.HasPrefix(strings.ToUpper(s.Model), "M-")
+}
+
+// SystemInfo runs "show system info"
+func (c *Client) SystemInfo(ctx context.Context) (*SystemInfo, error) {
+	resp, err := c.Op(ctx, "<show><system><info></info></system></show>")
+	if err != nil {
+		return nil, err
+	}
+
+	info := &SystemInfo{Fields: make(map[string]string)}
+	if system := resp.Root.Find("result/system"); system != nil {
+		for _, child := range system.Children {
+			info.Fields[child.Name] = strings.TrimSpace(child.Text)
+		}
+	}
+
+	info.Hostname = info.Fields["hostname"]
+	info.Model = info.Fields["model"]
+	info.Serial = info.Fields["serial"]
+	info.SWVersion = info.Fields["sw-version"]
+	info.Family = info.Fields["family"]
+	info.MultiVsys = info.Fields["multi-vsys"] == "on"
+
+	return info, nil
+}
+
+// ListNames returns the name attribute of every entry under a config XPath,
+// without fetching the entries' configuration
+func (c *Client) ListNames(ctx context.Context, xpath string) ([]string, error) {
+	resp, err := c.Config(ctx, "get", strings.TrimRight(xpath, "/")+"/entry/@name", "")
+	if err != nil {
+		if IsKind(err, KindObjectNotPresent) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	names := []string{}
+	if result := resp.Root.Child("result"); result != nil {
+		collectEntryNames(result, &names)
+	}
+	return names, nil
+}
+
+func collectEntryNames(n *Node, out *[]string) {
+	for _, child := range n.Children {
+		if child.Name == "entry" {
+			if name := child.Attr("name"); name != "" {
+				*out = append(*out, name)
+			}
+			continue
+		}
+		collectEntryNames(child, out)
+	}
+}
+
+// deviceClockLayouts are the formats "show clock" has used across releases
+var deviceClockLayouts = []string{
+	"Mon Jan _2 15:04:05 MST 2006",
+	"Mon Jan 2 15:04:05 MST 2006",
+}
+
+// DeviceLocation returns the device's time zone, based on "show clock".
+// The zone abbreviation alone is ambiguous, so the offset is derived by
+// comparing the device's wall clock with the current UTC time.
+func (c *Client) DeviceLocation(ctx context.Context) (*time.Location, error) {
+	resp, err := c.Op(ctx, "<show><clock></clock></show>")
+	if err != nil {
+		return nil, err
+	}
+
+	clock, _ := resp.Result.(string)
+	fields := strings.Fields(clock)
+	if len(fields) < 6 {
+		return nil, fmt.Errorf("unexpected clock output %q", clock)
+	}
+	zone := fields[4]
+
+	// Parse the wall clock as if it were UTC, then compare with real UTC
+	normalized := strings.Join(append(fields[:4:4], "UTC", fields[5]), " ")
+	var wall time.Time
+	for _, layout := range deviceClockLayouts {
+		if wall, err = time.Parse(layout, normalized); err == nil {
+			break
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unexpected clock output %q", clock)
+	}
+
+	offset := wall.Sub(time.Now().UTC()).Round(15 * time.Minute)
+	return time.FixedZone(zone, int(offset.Seconds())), nil
+}
@@ -0,0 +1,162 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSystemInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		system   string
+		want     SystemInfo
+		panorama bool
+	}{
+		{"firewall", `<hostname>fw1</hostname><model>PA-440</model><serial>007951000012345</serial>
+			<sw-version>10.2.4-h2</sw-version><family>400</family><multi-vsys>off</multi-vsys>`,
+			SystemInfo{Hostname: "fw1", Model: "PA-440", Serial: "007951000012345", SWVersion: "10.2.4-h2", Family: "400"}, false},
+		{"multi-vsys firewall", `<hostname>fw2</hostname><model>PA-5220</model><multi-vsys>on</multi-vsys>`,
+			SystemInfo{Hostname: "fw2", Model: "PA-5220", MultiVsys: true}, false},
+		{"Panorama VM", `<hostname>pano</hostname><model>Panorama</model><sw-version>11.0.1-h3</sw-version>`,
+			SystemInfo{Hostname: "pano", Model: "Panorama", SWVersion: "11.0.1-h3"}, true},
+		{"Panorama family", `<hostname>pano</hostname><model>PA-VM</model><family>pc</family>`,
+			SystemInfo{Hostname: "pano", Model: "PA-VM", Family: "pc"}, true},
+		{"M-series appliance", `<hostname>m600</hostname><model>M-600</model>`,
+			SystemInfo{Hostname: "m600", Model: "M-600"}, true},
+		{"empty", ``, SystemInfo{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sent := recordingClient(t, http.StatusOK,
+				`<response status="success"><result><system>`+tt.system+`</system></result></response>`)
+
+			info, err := client.SystemInfo(context.Background())
+			if err != nil {
+				t.Fatalf("SystemInfo failed: %v", err)
+			}
+			if info.Fields == nil || info.Fields["hostname"] != tt.want.Hostname {
+				t.Errorf("Fields = %v", info.Fields)
+			}
+			got := *info
+			got.Fields = nil
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SystemInfo = %+v, want %+v", got, tt.want)
+			}
+			if info.IsPanorama() != tt.panorama {
+				t.Errorf("IsPanorama = %v, want %v", info.IsPanorama(), tt.panorama)
+			}
+			if cmd := onlyRequest(t, sent()).form.Get("cmd"); cmd != "<show><system><info></info></system></show>" {
+				t.Errorf("sent cmd %s", cmd)
+			}
+		})
+	}
+}
+
+func TestListNames(t *testing.T) {
+	tests := []struct {
+		name   string
+		xpath  string
+		body   string
+		status int
+		want   []string
+		ok     bool
+	}{
+		{"vsys", DeviceXPath + "/vsys", `<response status="success"><result total-count="2" count="2">
+			<entry name="vsys1"/><entry name="vsys2"/></result></response>`, http.StatusOK,
+			[]string{"vsys1", "vsys2"}, true},
+		{"nested and trailing slash", "/config/devices/entry/device-group/", `<response status="success"><result>
+			<device-group><entry name="branches"/><entry name="datacenter"/><entry/></device-group></result></response>`, http.StatusOK,
+			[]string{"branches", "datacenter"}, true},
+		{"empty", DeviceXPath + "/vsys", `<response status="success"><result total-count="0" count="0"/></response>`, http.StatusOK,
+			[]string{}, true},
+		{"object not present", DeviceXPath + "/vsys", `<response status="error" code="7"><msg>Object doesn't exist</msg></response>`, http.StatusOK,
+			[]string{}, true},
+		{"auth failure", DeviceXPath + "/vsys", `<response status="error" code="403"><msg>Invalid credentials.</msg></response>`, http.StatusOK,
+			nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sent := recordingClient(t, tt.status, tt.body)
+
+			names, err := client.ListNames(context.Background(), tt.xpath)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ListNames error = %v, want ok=%v", err, tt.ok)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("ListNames = %#v, want %#v", names, tt.want)
+			}
+
+			form := onlyRequest(t, sent()).form
+			wantXPath := tt.xpath
+			if wantXPath[len(wantXPath)-1] == '/' {
+				wantXPath = wantXPath[:len(wantXPath)-1]
+			}
+			if form.Get("action") != "get" || form.Get("xpath") != wantXPath+"/entry/@name" {
+				t.Errorf("sent action=%s xpath=%s", form.Get("action"), form.Get("xpath"))
+			}
+		})
+	}
+}
+
+func TestDeviceLocation(t *testing.T) {
+	tests := []struct {
+		zone   string
+		offset time.Duration
+	}{
+		{"UTC", 0},
+		{"PDT", -7 * time.Hour},
+		{"IST", 5*time.Hour + 30*time.Minute},
+		{"NPT", 5*time.Hour + 45*time.Minute},
+		{"NZDT", 13 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.zone, func(t *testing.T) {
+			// "show clock" pads single digit days with a space
+			wall := time.Now().UTC().Add(tt.offset)
+			clock := wall.Format("Mon Jan _2 15:04:05") + " " + tt.zone + " " + wall.Format("2006")
+			client, _ := recordingClient(t, http.StatusOK,
+				fmt.Sprintf(`<response status="success"><result>%s
+</result></response>`, clock))
+
+			loc, err := client.DeviceLocation(context.Background())
+			if err != nil {
+				t.Fatalf("DeviceLocation(%q) failed: %v", clock, err)
+			}
+			name, offset := time.Now().In(loc).Zone()
+			if name != tt.zone || offset != int(tt.offset.Seconds()) {
+				t.Errorf("zone = %s %+ds, want %s %+ds", name, offset, tt.zone, int(tt.offset.Seconds()))
+			}
+		})
+	}
+}
+
+func TestDeviceLocationErrors(t *testing.T) {
+	tests := []string{
+		``,
+		`<result>not a clock</result>`,
+		`<result>Wed Oct 4 10:12:41 PDT</result>`,
+		`<result>Wed Foo 4 10:12:41 PDT 2023</result>`,
+		`<result><clock>Wed Oct 4 10:12:41 PDT 2023</clock></result>`,
+	}
+
+	for _, result := range tests {
+		t.Run(result, func(t *testing.T) {
+			client, _ := recordingClient(t, http.StatusOK, `<response status="success">`+result+`</response>`)
+			if loc, err := client.DeviceLocation(context.Background()); err == nil {
+				t.Errorf("DeviceLocation = %v, want an error", loc)
+			}
+		})
+	}
+}
@@ -0,0 +1,284 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+	"golang.org/x/net/proxy"
+)
+
+// DialFunc opens a connection to the device, e.g. through a jump host
+type DialFunc func(ctx context.Context, network, addr string) (net.Conn, error)
+
+// WithProxy sends every request through an outbound proxy. http:// and
+// https:// proxies are used with CONNECT, socks5:// and socks5h:// proxies
+// with SOCKS5. Credentials in the URL's user info authenticate to the proxy.
+// It has no effect when a custom round tripper has been plugged in.
+func WithProxy(proxyURL string) Option {
+	return func(c *Client) error {
+		u, err := url.Parse(strings.TrimSpace(proxyURL))
+		if err != nil || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", redactProxyURL(proxyURL))
+		}
+
+		t, ok := c.httpClient.Transport.(*http.Transport)
+		if !ok {
+			return nil
+		}
+
+		switch u.Scheme {
+		case "http", "https":
+			t.Proxy = http.ProxyURL(u)
+		case "socks5", "socks5h":
+			dialer, err := proxy.FromURL(u, &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second})
+			if err != nil {
+				return fmt.Errorf("invalid SOCKS proxy: %v", err)
+			}
+			contextDialer, ok := dialer.(proxy.ContextDialer)
+			if !ok {
+				return errors.New("SOCKS proxy dialer does not support contexts")
+			}
+			t.Proxy = nil
+			t.DialContext = contextDialer.DialContext
+		default:
+			return fmt.Errorf("invalid proxy URL %q: scheme must be http, https, socks5 or socks5h", redactProxyURL(proxyURL))
+		}
+		return nil
+	}
+}
+
+// WithDialer opens every connection with dial instead of a direct TCP
+// connection, bypassing any proxy. It has no effect when a custom round
+// tripper has been plugged in.
+func WithDialer(dial DialFunc) Option {
+	return func(c *Client) error {
+		if dial == nil {
+			return errors.New("dialer cannot be nil")
+		}
+		if t, ok := c.httpClient.Transport.(*http.Transport); ok {
+			t.Proxy = nil
+			t.DialContext = dial
+		}
+		return nil
+	}
+}
+
+// WithSSHJump tunnels every connection through an SSH jump host. The SSH
+// connection is opened on first use and closed by Client.Close.
+func WithSSHJump(cfg SSHJumpConfig) Option {
+	return func(c *Client) error {
+		dialer, err := NewSSHDialer(cfg)
+		if err != nil {
+			return err
+		}
+		c.closers = append(c.closers, dialer)
+		return WithDialer(dialer.DialContext)(c)
+	}
+}
+
+// redactProxyURL hides the password of a proxy URL in messages
+func redactProxyURL(proxyURL string) string {
+	u, err := url.Parse(strings.TrimSpace(proxyURL))
+	if err != nil {
+		return "<invalid URL>"
+	}
+	return u.Redacted()
+}
+
+// SSHJumpConfig describes a bastion used to reach the management network
+type SSHJumpConfig struct {
+	// Address is host or host:port of the jump host; the port defaults to 22
+	Address string
+	User    string
+	// KeyFile is a PEM or OpenSSH private key, decrypted with KeyPassphrase
+	// when it is protected
+	KeyFile       string
+	KeyPassphrase string
+	// The jump host's key is checked against HostKeySHA256, as printed by
+	// ssh-keygen -l ("SHA256:..."), or else KnownHostsFile, which defaults
+	// to ~/.ssh/known_hosts
+	HostKeySHA256  string
+	KnownHostsFile string
+	// Timeout bounds connecting to the jump host; the default is 10 seconds
+	Timeout time.Duration
+}
+
+// SSHDialer opens connections through an SSH jump host, sharing one SSH
+// connection and reconnecting when it drops
+type SSHDialer struct {
+	address string
+	config  *ssh.ClientConfig
+
+	mu     sync.Mutex
+	client *ssh.Client
+}
+
+// NewSSHDialer loads the key and host key settings of a jump host. No
+// connection is made until the first dial.
+func NewSSHDialer(cfg SSHJumpConfig) (*SSHDialer, error) {
+	if cfg.Address == "" || cfg.User == "" || cfg.KeyFile == "" {
+		return nil, errors.New("jump host, user and key file are required")
+	}
+
+	address := cfg.Address
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		address = net.JoinHostPort(address, "22")
+	}
+
+	pem, err := ioutil.ReadFile(cfg.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read SSH key: %v", err)
+	}
+	var signer ssh.Signer
+	if cfg.KeyPassphrase != "" {
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(pem, []byte(cfg.KeyPassphrase))
+	} else {
+		signer, err = ssh.ParsePrivateKey(pem)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SSH key %s: %v", cfg.KeyFile, err)
+	}
+
+	hostKey, err := hostKeyCallback(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := cfg.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	return &SSHDialer{
+		address: address,
+		config: &ssh.ClientConfig{
+			User:            cfg.User,
+			Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+			HostKeyCallback: hostKey,
+			Timeout:         timeout,
+		},
+	}, nil
+}
+
+// hostKeyCallback verifies the jump host against a pinned fingerprint or a
+// known_hosts file. Unknown host keys are always rejected.
+func hostKeyCallback(cfg SSHJumpConfig) (ssh.HostKeyCallback, error) {
+	if pin := strings.TrimSpace(cfg.HostKeySHA256); pin != "" {
+		if !strings.HasPrefix(pin, "SHA256:") {
+			pin = "SHA256:" + pin
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			if got := ssh.FingerprintSHA256(key); got != pin {
+				return fmt.Errorf("jump host key %s does not match the pinned %s", got, pin)
+			}
+			return nil
+		}, nil
+	}
+
+	file := cfg.KnownHostsFile
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, fmt.Errorf("no known_hosts file or host key fingerprint for the jump host: %v", err)
+		}
+		file = filepath.Join(home, ".ssh", "known_hosts")
+	}
+	callback, err := knownhosts.New(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts %s: %v", file, err)
+	}
+	return callback, nil
+}
+
+// DialContext opens a connection to addr from the jump host
+func (d *SSHDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	client, err := d.connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := client.DialContext(ctx, network, addr)
+	if err == nil || ctx.Err() != nil {
+		return conn, err
+	}
+
+	// The SSH connection may have dropped while idle; reconnect once
+	d.drop(client)
+	if client, err = d.connect(ctx); err != nil {
+		return nil, err
+	}
+	return client.DialContext(ctx, network, addr)
+}
+
+// connect returns the shared SSH connection, opening it when needed
+func (d *SSHDialer) connect(ctx context.Context) (*ssh.Client, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client != nil {
+		return d.client, nil
+	}
+
+	conn, err := (&net.Dialer{Timeout: d.config.Timeout, KeepAlive: 30 * time.Second}).DialContext(ctx, "tcp", d.address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach jump host %s: %v", d.address, err)
+	}
+
+	// Bound the SSH handshake by the context as well
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	sshConn, chans, reqs, err := ssh.NewClientConn(conn, d.address, d.config)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("SSH login to jump host %s failed: %v", d.address, err)
+	}
+	conn.SetDeadline(time.Time{})
+
+	d.client = ssh.NewClient(sshConn, chans, reqs)
+	return d.client, nil
+}
+
+// drop forgets a broken SSH connection
+func (d *SSHDialer) drop(client *ssh.Client) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == client {
+		d.client.Close()
+		d.client = nil
+	}
+}
+
+// Close closes the SSH connection and every tunnel through it
+func (d *SSHDialer) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.client == nil {
+		return nil
+	}
+	err := d.client.Close()
+	d.client = nil
+	return err
+}
+
+var _ io.Closer = (*SSHDialer)(nil)
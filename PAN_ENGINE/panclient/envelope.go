@@ -0,0 +1,83 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import "strings"
+
+// EnvelopeRows turns a decoded REST API envelope,
+//
+//	{"@status": "success", "result": {"@total-count": "2", "@count": "2", "entry": [...]}}
+//
+// into the rows RESTRows would stream from it: one per entry, whether entry
+// is a list or a single object. A result without entries becomes one row,
+// unless its counts show it is an empty list.
+func EnvelopeRows(envelope map[string]interface{}) []map[string]interface{} {
+	result, _ := envelope["result"].(map[string]interface{})
+
+	var entries interface{}
+	found := false
+	if result != nil {
+		entries, found = result["entry"]
+	} else if list, ok := envelope["result"].([]interface{}); ok {
+		entries, found = list, true
+	}
+
+	if !found {
+		if row := fallbackRow(envelope, result); row != nil {
+			return []map[string]interface{}{row}
+		}
+		return []map[string]interface{}{}
+	}
+
+	switch v := entries.(type) {
+	case nil:
+		return []map[string]interface{}{}
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(v))
+		for _, entry := range v {
+			rows = append(rows, valueRow(entry))
+		}
+		return rows
+	}
+	return []map[string]interface{}{valueRow(entries)}
+}
+
+// fallbackRow is the single row of a response without an entry list, or nil
+// when its counts show an empty list
+func fallbackRow(envelope, result map[string]interface{}) map[string]interface{} {
+	if _, counted := result["@count"]; counted {
+		return nil
+	}
+	if result != nil {
+		return PromoteAttributes(FlattenRow(result))
+	}
+	return PromoteAttributes(FlattenRow(envelope))
+}
+
+// PromoteAttributes renames the attribute fields of a REST row, such as
+// "@name", "@location" and "@vsys", to plain columns ("name", "location",
+// "vsys"), matching the rows of the XML API where attributes are fields.
+// An attribute is left as is when a field already uses the plain name.
+// Attributes of nested objects are renamed the same way, so
+// "profile-setting.@name" becomes "profile-setting.name".
+func PromoteAttributes(row map[string]interface{}) map[string]interface{} {
+	for key, value := range row {
+		if !strings.Contains(key, "@") {
+			continue
+		}
+		parts := strings.Split(key, ".")
+		for i, part := range parts {
+			parts[i] = strings.TrimPrefix(part, "@")
+		}
+		plain := strings.Join(parts, ".")
+		if _, exists := row[plain]; exists || plain == "" {
+			continue
+		}
+		delete(row, key)
+		row[plain] = value
+	}
+	return row
+}
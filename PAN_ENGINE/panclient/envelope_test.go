@@ -0,0 +1,96 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestPromoteAttributes(t *testing.T) {
+	tests := []struct {
+		name string
+		row  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			"attributes",
+			map[string]interface{}{"@name": "web", "@location": "vsys", "@vsys": "vsys1"},
+			map[string]interface{}{"name": "web", "location": "vsys", "vsys": "vsys1"},
+		},
+		{
+			"nested attribute",
+			map[string]interface{}{"profile-setting.@name": "default"},
+			map[string]interface{}{"profile-setting.name": "default"},
+		},
+		{
+			"plain name taken",
+			map[string]interface{}{"@name": "web", "name": "other"},
+			map[string]interface{}{"@name": "web", "name": "other"},
+		},
+		{
+			"no attributes",
+			map[string]interface{}{"ip-netmask": "10.0.0.1"},
+			map[string]interface{}{"ip-netmask": "10.0.0.1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PromoteAttributes(tt.row); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("PromoteAttributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// EnvelopeRows gives the rows RESTRows streams from the same response
+func TestEnvelopeRowsMatchStream(t *testing.T) {
+	bodies := []string{
+		`{"@status": "success", "result": {"@total-count": "2", "@count": "2", "entry": [{"@name": "web", "ip-netmask": "10.0.0.1"}, {"@name": "db", "fqdn": "db.example.com"}]}}`,
+		`{"@status": "success", "result": {"@count": "1", "entry": {"@name": "web", "tag": {"member": ["a", "b"]}}}}`,
+		`{"@status": "success", "result": [{"@name": "web"}, "plain"]}`,
+		`{"@status": "success", "result": {"@total-count": "0", "@count": "0"}}`,
+		`{"@status": "success", "result": {"@count": "0", "entry": null}}`,
+		`{"@status": "success", "result": {"hostname": "fw1", "@version": "11.1"}}`,
+		`{"@status": "success", "@code": "19"}`,
+	}
+
+	for _, body := range bodies {
+		t.Run(body, func(t *testing.T) {
+			var envelope map[string]interface{}
+			if err := json.Unmarshal([]byte(body), &envelope); err != nil {
+				t.Fatalf("Unmarshal failed: %v", err)
+			}
+			rows := EnvelopeRows(envelope)
+			if rows == nil {
+				t.Error("EnvelopeRows returned nil, want an empty list")
+			}
+
+			client := testClient(t, http.StatusOK, "application/json", body)
+			stream, err := client.RESTRows(context.Background(), "/restapi/v11.0/Objects/Addresses", nil)
+			if err != nil {
+				t.Fatalf("RESTRows failed: %v", err)
+			}
+			streamed, err := readStream(t, stream)
+			if err != nil {
+				t.Fatalf("stream failed: %v", err)
+			}
+
+			if len(rows) != len(streamed) {
+				t.Fatalf("EnvelopeRows gave %d rows, RESTRows %d", len(rows), len(streamed))
+			}
+			for i := range rows {
+				if !reflect.DeepEqual(rows[i], streamed[i].row) {
+					t.Errorf("row %d = %v, streamed %v", i, rows[i], streamed[i].row)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,374 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+)
+
+// ErrorKind classifies an API failure so callers can decide what to tell
+// the operator and whether retrying makes sense
+type ErrorKind string
+
+const (
+	KindUnknown          ErrorKind = "unknown"
+	KindAuth             ErrorKind = "auth"
+	KindObjectNotPresent ErrorKind = "object_not_present"
+	KindInvalidXPath     ErrorKind = "invalid_xpath"
+	KindRateLimited      ErrorKind = "rate_limited"
+	KindUnsupported      ErrorKind = "unsupported"
+	KindInvalidRequest   ErrorKind = "invalid_request"
+	KindServer           ErrorKind = "server"
+	KindNetwork          ErrorKind = "network"
+	KindTLS              ErrorKind = "tls"
+)
+
+// API flavors reported in APIError.Flavor
+const (
+	FlavorXML  = "xml"
+	FlavorREST = "rest"
+)
+
+// APIError is an error reported by the device, from either API flavor
+type APIError struct {
+	Flavor     string
+	HTTPStatus int
+	// Status is the XML status attribute or the REST @status field
+	Status  string
+	Code    string
+	Message string
+	Details []string
+	Kind    ErrorKind
+}
+
+// Error implements the error interface
+func (e *APIError) Error() string {
+	var b strings.Builder
+	b.WriteString("PAN-OS API error")
+	if e.Code != "" {
+		b.WriteString(" " + e.Code)
+	} else if e.HTTPStatus != 0 && e.HTTPStatus != http.StatusOK {
+		fmt.Fprintf(&b, " (HTTP %d)", e.HTTPStatus)
+	}
+	fmt.Fprintf(&b, " [%s]", e.Kind)
+
+	msg := e.Message
+	if msg == "" && e.HTTPStatus != 0 {
+		msg = http.StatusText(e.HTTPStatus)
+	}
+	if msg != "" {
+		b.WriteString(": " + msg)
+	}
+	if len(e.Details) > 0 {
+		b.WriteString(" (" + strings.Join(e.Details, "; ") + ")")
+	}
+	return b.String()
+}
+
+// Retryable reports whether sending the same request again may succeed
+func (e *APIError) Retryable() bool {
+	switch e.Kind {
+	case KindRateLimited, KindServer, KindNetwork:
+		return true
+	}
+	return false
+}
+
+// Hint returns operator guidance for the error kind
+func (e *APIError) Hint() string {
+	return e.Kind.Hint()
+}
+
+// Hint returns operator guidance for the error kind
+func (k ErrorKind) Hint() string {
+	switch k {
+	case KindAuth:
+		return "The API key or credentials were rejected. Check the key or log in again."
+	case KindObjectNotPresent:
+		return "The requested object does not exist on this device or in this scope."
+	case KindInvalidXPath:
+		return "The XPath or resource path is not valid for this device."
+	case KindRateLimited:
+		return "The management plane is throttling requests. Wait and retry."
+	case KindUnsupported:
+		return "This request is not supported by the PAN-OS version on this device."
+	case KindInvalidRequest:
+		return "The device rejected the request as malformed."
+	case KindServer:
+		return "The device reported an internal error. Retrying may succeed."
+	case KindNetwork:
+		return "The device could not be reached. Check the URL and network path, then retry."
+	case KindTLS:
+		return "The device certificate was not trusted or did not match the pinned fingerprint. Check the profile's TLS settings."
+	}
+	return "The device returned an unexpected error."
+}
+
+// AsAPIError extracts an *APIError from err, if there is one
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+// Classify returns the kind of any error returned by the client
+func Classify(err error) ErrorKind {
+	if err == nil {
+		return ""
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.Kind
+	}
+	if isTLSError(err) {
+		return KindTLS
+	}
+	if isNetworkError(err) {
+		return KindNetwork
+	}
+	return KindUnknown
+}
+
+// IsKind reports whether err is an API error of the given kind
+func IsKind(err error, kind ErrorKind) bool {
+	return err != nil && Classify(err) == kind
+}
+
+// Reasons a rejected API key stopped working, from AuthFailureReason
+const (
+	AuthKeyExpired = "expired"
+	AuthKeyRevoked = "revoked"
+)
+
+// AuthFailureReason tells an API key that reached its configured lifetime
+// from one that was revoked, e.g. by an admin password change or a reset of
+// all keys. It returns "" for errors that are not auth failures.
+func AuthFailureReason(err error) string {
+	if !IsKind(err, KindAuth) {
+		return ""
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "expired") {
+		return AuthKeyExpired
+	}
+	return AuthKeyRevoked
+}
+
+// IsRetryable reports whether a failed request may succeed if sent again
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		return apiErr.Retryable()
+	}
+	return !isTLSError(err) && isNetworkError(err)
+}
+
+// isTLSError reports certificate verification and pin failures, and
+// handshakes the device refused. Sending the request again cannot fix them.
+func isTLSError(err error) bool {
+	var (
+		unknownAuthority x509.UnknownAuthorityError
+		hostname         x509.HostnameError
+		invalid          x509.CertificateInvalidError
+		systemRoots      x509.SystemRootsError
+		verification     *tls.CertificateVerificationError
+		recordHeader     tls.RecordHeaderError
+		alert            tls.AlertError
+		pin              *CertificatePinError
+	)
+	return errors.As(err, &unknownAuthority) ||
+		errors.As(err, &hostname) ||
+		errors.As(err, &invalid) ||
+		errors.As(err, &systemRoots) ||
+		errors.As(err, &verification) ||
+		errors.As(err, &recordHeader) ||
+		errors.As(err, &alert) ||
+		errors.As(err, &pin)
+}
+
+// isNetworkError reports timeouts, refused and reset connections, and
+// failures dialing or reading from the device
+func isNetworkError(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNABORTED) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial" || opErr.Op == "read")
+}
+
+// classifyCode maps PAN-OS error codes, HTTP status and message text to a kind.
+// The numeric codes are shared by the XML and REST APIs.
+func classifyCode(code string, httpStatus int, message string) ErrorKind {
+	msg := strings.ToLower(message)
+
+	switch {
+	case httpStatus == http.StatusTooManyRequests,
+		strings.Contains(msg, "too many"),
+		strings.Contains(msg, "rate limit"):
+		return KindRateLimited
+	case strings.Contains(msg, "unsupported api version"),
+		strings.Contains(msg, "invalid api version"),
+		strings.Contains(msg, "not supported"):
+		return KindUnsupported
+	}
+
+	switch code {
+	case "403", "16", "22":
+		return KindAuth
+	case "7":
+		return KindObjectNotPresent
+	case "6":
+		return KindInvalidXPath
+	case "1", "3", "8", "10", "12", "14", "15", "17", "18", "400":
+		if strings.Contains(msg, "xpath") {
+			return KindInvalidXPath
+		}
+		return KindInvalidRequest
+	case "2", "4", "5", "11", "13", "21":
+		return KindServer
+	}
+
+	switch {
+	case httpStatus == http.StatusUnauthorized, httpStatus == http.StatusForbidden,
+		strings.Contains(msg, "invalid credential"),
+		strings.Contains(msg, "invalid key"),
+		strings.Contains(msg, "key") && strings.Contains(msg, "expired"):
+		return KindAuth
+	case httpStatus == http.StatusNotFound,
+		strings.Contains(msg, "not present"):
+		return KindObjectNotPresent
+	case strings.Contains(msg, "xpath"):
+		return KindInvalidXPath
+	case httpStatus >= 500:
+		return KindServer
+	case httpStatus >= 400:
+		return KindInvalidRequest
+	}
+
+	return KindUnknown
+}
+
+// xmlError builds an APIError from a <response status="error"> document
+func xmlError(resp *XMLResponse, httpStatus int) *APIError {
+	var lines []string
+	collectMessages(resp.Root, &lines)
+
+	e := &APIError{
+		Flavor:     FlavorXML,
+		HTTPStatus: httpStatus,
+		Status:     resp.Status,
+		Code:       resp.Code,
+	}
+	if len(lines) > 0 {
+		e.Message = lines[0]
+		e.Details = lines[1:]
+	}
+	e.Kind = classifyCode(e.Code, httpStatus, strings.Join(lines, " "))
+	return e
+}
+
+// collectMessages gathers the text of <msg> and <line> elements in order
+func collectMessages(n *Node, out *[]string) {
+	if n == nil {
+		return
+	}
+	for _, child := range n.Children {
+		if child.Name == "msg" || child.Name == "line" {
+			if text := strings.TrimSpace(child.Text); text != "" {
+				*out = append(*out, text)
+			}
+		}
+		collectMessages(child, out)
+	}
+}
+
+// restError builds an APIError from a REST error body. The body may not
+// be JSON at all when a proxy or the web server itself rejected the request.
+func restError(body []byte, httpStatus int) *APIError {
+	e := &APIError{Flavor: FlavorREST, HTTPStatus: httpStatus}
+
+	var payload map[string]interface{}
+	if err := json.Unmarshal(body, &payload); err == nil {
+		e.Status = stringField(payload, "@status")
+		e.Code = stringField(payload, "@code")
+		if e.Code == "" {
+			e.Code = stringField(payload, "code")
+		}
+		e.Message = stringField(payload, "message")
+		e.Details = restDetails(payload["details"])
+	} else if text := strings.TrimSpace(string(body)); text != "" && len(text) < 200 {
+		e.Message = text
+	}
+
+	e.Kind = classifyCode(e.Code, httpStatus, e.Message+" "+strings.Join(e.Details, " "))
+	return e
+}
+
+// restDetails flattens the details array, which holds either plain strings
+// or CauseInfo objects with a list of causes
+func restDetails(v interface{}) []string {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil
+	}
+
+	var out []string
+	for _, item := range items {
+		switch d := item.(type) {
+		case string:
+			out = append(out, d)
+		case map[string]interface{}:
+			if causes, ok := d["causes"].([]interface{}); ok {
+				for _, c := range causes {
+					if cause, ok := c.(map[string]interface{}); ok {
+						if desc := stringField(cause, "description"); desc != "" {
+							out = append(out, desc)
+						}
+					}
+				}
+			} else if msg := stringField(d, "message"); msg != "" {
+				out = append(out, msg)
+			}
+		}
+	}
+	return out
+}
+
+// stringField returns a JSON field as a string, whether it was sent as a
+// string or a number
+func stringField(m map[string]interface{}, key string) string {
+	switch v := m[key].(type) {
+	case string:
+		return v
+	case float64:
+		return fmt.Sprintf("%d", int64(v))
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
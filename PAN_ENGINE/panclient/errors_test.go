@@ -0,0 +1,135 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"syscall"
+	"testing"
+)
+
+// urlError wraps err the way net/http returns transport failures
+func urlError(err error) error {
+	return &url.Error{Op: "Get", URL: "https://fw.example.com/api/", Err: err}
+}
+
+// timeoutError is a net.Error that timed out
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassifyTransportErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		kind      ErrorKind
+		retryable bool
+	}{
+		{"unknown authority", urlError(x509.UnknownAuthorityError{}), KindTLS, false},
+		{"hostname mismatch", urlError(x509.HostnameError{Host: "fw.example.com"}), KindTLS, false},
+		{"expired certificate", urlError(x509.CertificateInvalidError{Reason: x509.Expired}), KindTLS, false},
+		{"verification", urlError(&tls.CertificateVerificationError{Err: x509.UnknownAuthorityError{}}), KindTLS, false},
+		{"pin mismatch", urlError(&CertificatePinError{Fingerprint: "ab12"}), KindTLS, false},
+		{"no certificate", urlError(&CertificatePinError{}), KindTLS, false},
+		{"plain http", urlError(tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}), KindTLS, false},
+		{"handshake alert", urlError(tls.AlertError(40)), KindTLS, false},
+		{"refused", urlError(&net.OpError{Op: "dial", Net: "tcp", Err: os.NewSyscallError("connect", syscall.ECONNREFUSED)}), KindNetwork, true},
+		{"reset", urlError(&net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}), KindNetwork, true},
+		{"dial failure", urlError(&net.OpError{Op: "dial", Net: "tcp", Err: errors.New("no route to host")}), KindNetwork, true},
+		{"read failure", urlError(&net.OpError{Op: "read", Net: "tcp", Err: errors.New("connection lost")}), KindNetwork, true},
+		{"write failure", urlError(&net.OpError{Op: "write", Net: "tcp", Err: errors.New("broken")}), KindUnknown, false},
+		{"timeout", urlError(timeoutError{}), KindNetwork, true},
+		{"deadline", fmt.Errorf("request: %w", context.DeadlineExceeded), KindNetwork, true},
+		{"cancelled", urlError(context.Canceled), KindUnknown, false},
+		{"other url error", urlError(errors.New("unsupported protocol scheme")), KindUnknown, false},
+		{"plain error", errors.New("boom"), KindUnknown, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Classify(tt.err); got != tt.kind {
+				t.Errorf("Classify = %s, want %s", got, tt.kind)
+			}
+			if got := IsRetryable(tt.err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
+
+func TestClassifyCertificateFailures(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	// The test server's certificate is self-signed
+	_, err := http.Get(server.URL)
+	if err == nil {
+		t.Fatal("request to an untrusted server succeeded")
+	}
+	if kind := Classify(err); kind != KindTLS {
+		t.Errorf("untrusted certificate classified as %s: %v", kind, err)
+	}
+	if IsRetryable(err) {
+		t.Errorf("untrusted certificate is retryable: %v", err)
+	}
+
+	// A trusted certificate that does not match the pin
+	verify, err := VerifyPins([]string{"00" + fmt.Sprintf("%062x", 0)})
+	if err != nil {
+		t.Fatalf("VerifyPins failed: %v", err)
+	}
+	transport := server.Client().Transport.(*http.Transport).Clone()
+	transport.TLSClientConfig.VerifyConnection = verify
+	_, err = (&http.Client{Transport: transport}).Get(server.URL)
+	var pinErr *CertificatePinError
+	if !errors.As(err, &pinErr) {
+		t.Fatalf("pin mismatch returned %v, want a CertificatePinError", err)
+	}
+	if kind := Classify(err); kind != KindTLS {
+		t.Errorf("pin mismatch classified as %s", kind)
+	}
+	if IsRetryable(err) {
+		t.Error("pin mismatch is retryable")
+	}
+}
+
+func TestClassifyAPIErrors(t *testing.T) {
+	tests := []struct {
+		code      string
+		status    int
+		message   string
+		kind      ErrorKind
+		retryable bool
+	}{
+		{"403", http.StatusForbidden, "Invalid credentials.", KindAuth, false},
+		{"7", http.StatusOK, "Object doesn't exist", KindObjectNotPresent, false},
+		{"", http.StatusTooManyRequests, "", KindRateLimited, true},
+		{"", http.StatusInternalServerError, "", KindServer, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%d", tt.code, tt.status), func(t *testing.T) {
+			err := fmt.Errorf("request failed: %w", &APIError{Code: tt.code, HTTPStatus: tt.status, Message: tt.message, Kind: classifyCode(tt.code, tt.status, tt.message)})
+			if got := Classify(err); got != tt.kind {
+				t.Errorf("Classify = %s, want %s", got, tt.kind)
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable = %v, want %v", got, tt.retryable)
+			}
+		})
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxLogsPerJob is the most logs PAN-OS returns from one query job
+	MaxLogsPerJob = 5000
+
+	// DefaultLogLimit is used when a LogQuery does not set Limit
+	DefaultLogLimit = 1000
+
+	defaultPollInterval    = 500 * time.Millisecond
+	defaultMaxPollInterval = 5 * time.Second
+)
+
+// LogQuery describes a log retrieval. Results beyond MaxLogsPerJob are
+// fetched as further jobs using skip.
+type LogQuery struct {
+	// LogType is the PAN-OS log-type, e.g. traffic, threat, url, system
+	LogType string
+	// Query is a filter in PAN-OS log filter syntax
+	Query string
+	// Limit is the total number of logs to return
+	Limit int
+	// Direction is "backward" (newest first, the default) or "forward"
+	Direction string
+	// PollInterval and MaxPollInterval bound the backoff between job polls
+	PollInterval    time.Duration
+	MaxPollInterval time.Duration
+}
+
+// SubmitLogJob enqueues a log query job and returns its job ID
+func (c *Client) SubmitLogJob(ctx context.Context, logType, query string, nlogs, skip int, direction string) (string, error) {
+	params := url.Values{"log-type": {logType}}
+	if query != "" {
+		params.Set("query", query)
+	}
+	if nlogs > 0 {
+		params.Set("nlogs", strconv.Itoa(nlogs))
+	}
+	if skip > 0 {
+		params.Set("skip", strconv.Itoa(skip))
+	}
+	if direction != "" {
+		params.Set("dir", direction)
+	}
+
+	resp, err := c.Log(ctx, params)
+	if err != nil {
+		return "", err
+	}
+
+	job := resp.Root.Find("result/job")
+	if job == nil || strings.TrimSpace(job.Text) == "" {
+		return "", errors.New("log query response did not contain a job ID")
+	}
+
+	return strings.TrimSpace(job.Text), nil
+}
+
+// LogJobResult is the state of a log query job
+type LogJobResult struct {
+	ID       string
+	Status   string
+	Progress string
+	Rows     []interface{}
+}
+
+// Finished reports whether the job has completed
+func (r *LogJobResult) Finished() bool {
+	return r.Status == "FIN"
+}
+
+// GetLogJob fetches the current state of a log query job
+func (c *Client) GetLogJob(ctx context.Context, jobID string) (*LogJobResult, error) {
+	resp, err := c.Log(ctx, url.Values{"action": {"get"}, "job-id": {jobID}})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &LogJobResult{ID: jobID, Rows: []interface{}{}}
+	if status := resp.Root.Find("result/job/status"); status != nil {
+		result.Status = strings.TrimSpace(status.Text)
+	}
+
+	if logs := resp.Root.Find("result/log/logs"); logs != nil {
+		result.Progress = logs.Attr("progress")
+		for _, entry := range logs.Children {
+			if entry.Name != "entry" {
+				continue
+			}
+			if m, ok := entry.ToValue().(map[string]interface{}); ok {
+				result.Rows = append(result.Rows, FlattenRow(m))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// WaitLogJob polls a job with exponential backoff until it finishes. If ctx
+// is cancelled first, the job is stopped on the device.
+func (c *Client) WaitLogJob(ctx context.Context, jobID string, interval, maxInterval time.Duration) (*LogJobResult, error) {
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	if maxInterval < interval {
+		maxInterval = defaultMaxPollInterval
+	}
+
+	for {
+		result, err := c.GetLogJob(ctx, jobID)
+		if err != nil {
+			if ctx.Err() != nil {
+				c.stopLogJob(jobID)
+			}
+			return nil, err
+		}
+		if result.Finished() {
+			return result, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			c.stopLogJob(jobID)
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		interval = interval * 3 / 2
+		if interval > maxInterval {
+			interval = maxInterval
+		}
+	}
+}
+
+// CancelLogJob stops a running log query job on the device
+func (c *Client) CancelLogJob(ctx context.Context, jobID string) error {
+	_, err := c.Log(ctx, url.Values{"action": {"finish"}, "job-id": {jobID}})
+	return err
+}
+
+// stopLogJob cancels a job after the caller's context is gone
+func (c *Client) stopLogJob(jobID string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := c.CancelLogJob(ctx, jobID); err != nil && c.logger != nil {
+		c.logger.Printf("Could not cancel log job %s: %v", jobID, err)
+	}
+}
+
+// FetchLogs runs as many log query jobs as needed to return up to q.Limit
+// logs as flat rows
+func (c *Client) FetchLogs(ctx context.Context, q LogQuery) ([]interface{}, error) {
+	rows := []interface{}{}
+	err := c.EachLog(ctx, q, func(row map[string]interface{}) error {
+		rows = append(rows, row)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// EachLog is FetchLogs for large pulls: rows are handed to fn one job page
+// at a time instead of being collected. An error from fn stops the pull.
+func (c *Client) EachLog(ctx context.Context, q LogQuery, fn func(row map[string]interface{}) error) error {
+	if q.LogType == "" {
+		return errors.New("log type is required")
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultLogLimit
+	}
+
+	for skip := 0; skip < limit; {
+		nlogs := limit - skip
+		if nlogs > MaxLogsPerJob {
+			nlogs = MaxLogsPerJob
+		}
+
+		jobID, err := c.SubmitLogJob(ctx, q.LogType, q.Query, nlogs, skip, q.Direction)
+		if err != nil {
+			return err
+		}
+		if c.logger != nil {
+			c.logger.Printf("Log job %s submitted: type=%s nlogs=%d skip=%d", jobID, q.LogType, nlogs, skip)
+		}
+
+		result, err := c.WaitLogJob(ctx, jobID, q.PollInterval, q.MaxPollInterval)
+		if err != nil {
+			return fmt.Errorf("log job %s: %w", jobID, err)
+		}
+
+		for _, row := range result.Rows {
+			if err := fn(row.(map[string]interface{})); err != nil {
+				return err
+			}
+		}
+
+		// A short page means there is nothing left to skip past
+		if len(result.Rows) < nlogs {
+			break
+		}
+		skip += len(result.Rows)
+	}
+
+	return nil
+}
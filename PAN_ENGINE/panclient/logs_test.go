@@ -0,0 +1,300 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeLogDevice answers log query jobs the way PAN-OS does: a job is
+// submitted, reports ACT for a few polls and then FIN with its page of logs
+type fakeLogDevice struct {
+	mu sync.Mutex
+	// available is how many logs match; pages past it come back short
+	available int
+	// polls is how many times a job reports ACT before finishing; -1 never
+	// finishes
+	polls int
+
+	submits  []url.Values
+	gets     map[string]int
+	finished []string
+}
+
+func (d *fakeLogDevice) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	switch r.PostForm.Get("action") {
+	case "":
+		d.submits = append(d.submits, r.PostForm)
+		fmt.Fprintf(w, `<response status="success" code="19"><result><msg><line>query job enqueued with jobid %d</line></msg><job>%d</job></result></response>`,
+			len(d.submits), len(d.submits))
+
+	case "get":
+		id := r.PostForm.Get("job-id")
+		n, err := strconv.Atoi(id)
+		if err != nil || n < 1 || n > len(d.submits) {
+			fmt.Fprint(w, `<response status="error"><msg><line>Job not found</line></msg></response>`)
+			return
+		}
+		d.gets[id]++
+		if d.polls < 0 || d.gets[id] <= d.polls {
+			fmt.Fprint(w, `<response status="success"><result><job><status>ACT</status></job><log><logs count="0" progress="40"/></log></result></response>`)
+			return
+		}
+
+		submit := d.submits[n-1]
+		nlogs, _ := strconv.Atoi(submit.Get("nlogs"))
+		skip, _ := strconv.Atoi(submit.Get("skip"))
+		count := d.available - skip
+		if count > nlogs {
+			count = nlogs
+		}
+		var entries strings.Builder
+		for i := 0; i < count; i++ {
+			fmt.Fprintf(&entries, `<entry logid="%d"><src>10.0.0.1</src><app>web-browsing</app></entry>`, skip+i)
+		}
+		fmt.Fprintf(w, `<response status="success"><result><job><status>FIN</status></job><log><logs count="%d" progress="100">%s</logs></log></result></response>`,
+			count, entries.String())
+
+	case "finish":
+		d.finished = append(d.finished, r.PostForm.Get("job-id"))
+		fmt.Fprint(w, `<response status="success"><result>Job stopped</result></response>`)
+	}
+}
+
+// logClient returns a client for a fake log device
+func logClient(t *testing.T, device *fakeLogDevice) *Client {
+	t.Helper()
+	device.gets = map[string]int{}
+	server := httptest.NewServer(device)
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, "key", WithRateLimit(fastLimit), WithRetry(fastRetry))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// fastPoll keeps job polling quick in tests
+const fastPoll = time.Millisecond
+
+func TestSubmitLogJob(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		nlogs     int
+		skip      int
+		direction string
+		want      url.Values
+	}{
+		{"minimal", "", 0, 0, "", url.Values{"type": {"log"}, "log-type": {"traffic"}}},
+		{"all parameters", "(addr.src in 10.0.0.1)", 100, 5000, "forward", url.Values{
+			"type": {"log"}, "log-type": {"traffic"}, "query": {"(addr.src in 10.0.0.1)"},
+			"nlogs": {"100"}, "skip": {"5000"}, "dir": {"forward"},
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &fakeLogDevice{}
+			client := logClient(t, device)
+
+			id, err := client.SubmitLogJob(context.Background(), "traffic", tt.query, tt.nlogs, tt.skip, tt.direction)
+			if err != nil {
+				t.Fatalf("SubmitLogJob failed: %v", err)
+			}
+			if id != "1" {
+				t.Errorf("job ID = %q, want 1", id)
+			}
+			if got := device.submits[0].Encode(); got != tt.want.Encode() {
+				t.Errorf("sent %s, want %s", got, tt.want.Encode())
+			}
+		})
+	}
+}
+
+func TestSubmitLogJobWithoutID(t *testing.T) {
+	client := testClient(t, http.StatusOK, "application/xml", `<response status="success"><result><job> </job></result></response>`)
+	if _, err := client.SubmitLogJob(context.Background(), "traffic", "", 10, 0, ""); err == nil {
+		t.Error("SubmitLogJob accepted a response without a job ID")
+	}
+}
+
+func TestWaitLogJob(t *testing.T) {
+	device := &fakeLogDevice{available: 3, polls: 2}
+	client := logClient(t, device)
+
+	id, err := client.SubmitLogJob(context.Background(), "traffic", "", 10, 0, "")
+	if err != nil {
+		t.Fatalf("SubmitLogJob failed: %v", err)
+	}
+	result, err := client.WaitLogJob(context.Background(), id, fastPoll, 2*fastPoll)
+	if err != nil {
+		t.Fatalf("WaitLogJob failed: %v", err)
+	}
+
+	if !result.Finished() || result.Progress != "100" || len(result.Rows) != 3 {
+		t.Fatalf("result = %+v, want a finished job with 3 rows", result)
+	}
+	row := result.Rows[0].(map[string]interface{})
+	if row["logid"] != "0" || row["src"] != "10.0.0.1" {
+		t.Errorf("first row = %v", row)
+	}
+	if polls := device.gets[id]; polls != 3 {
+		t.Errorf("polled %d times, want 3", polls)
+	}
+	if len(device.finished) != 0 {
+		t.Errorf("finished jobs %v, want none", device.finished)
+	}
+}
+
+func TestWaitLogJobCanceled(t *testing.T) {
+	device := &fakeLogDevice{available: 3, polls: -1}
+	client := logClient(t, device)
+
+	id, err := client.SubmitLogJob(context.Background(), "traffic", "", 10, 0, "")
+	if err != nil {
+		t.Fatalf("SubmitLogJob failed: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err := client.WaitLogJob(ctx, id, fastPoll, 2*fastPoll); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("WaitLogJob = %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The job is stopped on the device rather than left running
+	device.mu.Lock()
+	defer device.mu.Unlock()
+	if len(device.finished) != 1 || device.finished[0] != id {
+		t.Errorf("finished jobs %v, want [%s]", device.finished, id)
+	}
+}
+
+func TestCancelLogJob(t *testing.T) {
+	device := &fakeLogDevice{}
+	client := logClient(t, device)
+
+	if err := client.CancelLogJob(context.Background(), "42"); err != nil {
+		t.Fatalf("CancelLogJob failed: %v", err)
+	}
+	if len(device.finished) != 1 || device.finished[0] != "42" {
+		t.Errorf("finished jobs %v, want [42]", device.finished)
+	}
+}
+
+func TestEachLog(t *testing.T) {
+	tests := []struct {
+		name      string
+		available int
+		limit     int
+		// pages are the nlogs and skip of each job submitted
+		pages [][2]int
+		rows  int
+	}{
+		{"default limit", 5000, 0, [][2]int{{DefaultLogLimit, 0}}, DefaultLogLimit},
+		{"one short page", 40, 100, [][2]int{{100, 0}}, 40},
+		{"exact page", 100, 100, [][2]int{{100, 0}}, 100},
+		{"several jobs", 20000, 12000, [][2]int{{5000, 0}, {5000, 5000}, {2000, 10000}}, 12000},
+		{"runs out", 6000, 12000, [][2]int{{5000, 0}, {5000, 5000}}, 6000},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			device := &fakeLogDevice{available: tt.available, polls: 1}
+			client := logClient(t, device)
+
+			rows := 0
+			err := client.EachLog(context.Background(), LogQuery{LogType: "traffic", Limit: tt.limit, PollInterval: fastPoll},
+				func(row map[string]interface{}) error {
+					if row["logid"] != strconv.Itoa(rows) {
+						return fmt.Errorf("row %d has logid %v", rows, row["logid"])
+					}
+					rows++
+					return nil
+				})
+			if err != nil {
+				t.Fatalf("EachLog failed: %v", err)
+			}
+			if rows != tt.rows {
+				t.Errorf("got %d rows, want %d", rows, tt.rows)
+			}
+
+			if len(device.submits) != len(tt.pages) {
+				t.Fatalf("submitted %d jobs, want %d", len(device.submits), len(tt.pages))
+			}
+			for i, page := range tt.pages {
+				nlogs, _ := strconv.Atoi(device.submits[i].Get("nlogs"))
+				skip, _ := strconv.Atoi(device.submits[i].Get("skip"))
+				if nlogs != page[0] || skip != page[1] {
+					t.Errorf("job %d: nlogs=%d skip=%d, want nlogs=%d skip=%d", i+1, nlogs, skip, page[0], page[1])
+				}
+			}
+		})
+	}
+}
+
+func TestEachLogStops(t *testing.T) {
+	device := &fakeLogDevice{available: 20000}
+	client := logClient(t, device)
+
+	stop := errors.New("enough")
+	rows := 0
+	err := client.EachLog(context.Background(), LogQuery{LogType: "traffic", Limit: 12000, PollInterval: fastPoll},
+		func(row map[string]interface{}) error {
+			if rows++; rows == 10 {
+				return stop
+			}
+			return nil
+		})
+	if err != stop {
+		t.Errorf("EachLog = %v, want the callback's error", err)
+	}
+	if len(device.submits) != 1 {
+		t.Errorf("submitted %d jobs after the callback stopped, want 1", len(device.submits))
+	}
+}
+
+func TestEachLogErrors(t *testing.T) {
+	client := logClient(t, &fakeLogDevice{})
+	if err := client.EachLog(context.Background(), LogQuery{}, func(map[string]interface{}) error { return nil }); err == nil {
+		t.Error("EachLog accepted a query without a log type")
+	}
+
+	failing := testClient(t, http.StatusOK, "application/xml",
+		`<response status="error" code="17"><msg><line>Invalid log type</line></msg></response>`)
+	_, err := failing.FetchLogs(context.Background(), LogQuery{LogType: "bogus"})
+	if _, ok := AsAPIError(err); !ok {
+		t.Errorf("FetchLogs = %v, want the device's error", err)
+	}
+}
+
+func TestFetchLogs(t *testing.T) {
+	client := logClient(t, &fakeLogDevice{available: 25})
+
+	rows, err := client.FetchLogs(context.Background(), LogQuery{LogType: "threat", Limit: 50, PollInterval: fastPoll})
+	if err != nil {
+		t.Fatalf("FetchLogs failed: %v", err)
+	}
+	if len(rows) != 25 {
+		t.Errorf("got %d rows, want 25", len(rows))
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"strings"
+)
+
+// ManagedDevice is a firewall connected to Panorama
+type ManagedDevice struct {
+	Serial      string
+	Hostname    string
+	IPAddress   string
+	Model       string
+	SWVersion   string
+	DeviceGroup string
+	Connected   bool
+	// Fields holds every value returned by the device
+	Fields map[string]interface{}
+}
+
+// ConnectedDevices runs "show devices connected" on Panorama
+func (c *Client) ConnectedDevices(ctx context.Context) ([]ManagedDevice, error) {
+	resp, err := c.Op(ctx, "<show><devices><connected></connected></devices></show>")
+	if err != nil {
+		return nil, err
+	}
+
+	devices := []ManagedDevice{}
+	list := resp.Root.Find("result/devices")
+	if list == nil {
+		return devices, nil
+	}
+
+	for _, entry := range list.Children {
+		if entry.Name != "entry" {
+			continue
+		}
+
+		fields, _ := entry.ToValue().(map[string]interface{})
+		device := ManagedDevice{Fields: FlattenRow(fields)}
+		text := func(name string) string {
+			if child := entry.Child(name); child != nil {
+				return strings.TrimSpace(child.Text)
+			}
+			return ""
+		}
+
+		device.Serial = text("serial")
+		if device.Serial == "" {
+			device.Serial = entry.Attr("name")
+		}
+		device.Hostname = text("hostname")
+		device.IPAddress = text("ip-address")
+		device.Model = text("model")
+		device.SWVersion = text("sw-version")
+		device.DeviceGroup = text("device-group")
+		device.Connected = text("connected") != "no"
+
+		devices = append(devices, device)
+	}
+
+	return devices, nil
+}
+
+// WithTarget returns a client that proxies every XML API request through
+// Panorama to the managed firewall with the given serial number. The
+// returned client shares the connection pool of c, which stays responsible
+// for closing it.
+func (c *Client) WithTarget(serial string) *Client {
+	clone := *c
+	clone.target = serial
+	clone.closers = nil
+	return &clone
+}
+
+// Target returns the serial requests are proxied to, or "" for Panorama itself
+func (c *Client) Target() string {
+	return c.target
+}
@@ -0,0 +1,148 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+func TestConnectedDevices(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []ManagedDevice
+	}{
+		{"devices", `<response status="success"><result><devices>
+			<entry name="007951000012345">
+				<serial>007951000012345</serial><hostname>fw-branch1</hostname><ip-address>10.1.0.1</ip-address>
+				<model>PA-440</model><sw-version>10.2.4-h2</sw-version><device-group>branches</device-group><connected>yes</connected>
+			</entry>
+			<entry name="007951000067890">
+				<hostname>fw-branch2</hostname><connected>no</connected>
+			</entry>
+		</devices></result></response>`, []ManagedDevice{
+			{Serial: "007951000012345", Hostname: "fw-branch1", IPAddress: "10.1.0.1", Model: "PA-440", SWVersion: "10.2.4-h2", DeviceGroup: "branches", Connected: true},
+			{Serial: "007951000067890", Hostname: "fw-branch2", Connected: false},
+		}},
+		{"no devices element", `<response status="success"><result/></response>`, []ManagedDevice{}},
+		{"empty list", `<response status="success"><result><devices/></result></response>`, []ManagedDevice{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, sent := recordingClient(t, http.StatusOK, tt.body)
+
+			devices, err := client.ConnectedDevices(context.Background())
+			if err != nil {
+				t.Fatalf("ConnectedDevices failed: %v", err)
+			}
+			if devices == nil || len(devices) != len(tt.want) {
+				t.Fatalf("got %d devices (%v), want %d", len(devices), devices, len(tt.want))
+			}
+			for i, want := range tt.want {
+				got := devices[i]
+				// Every returned field is kept for the report columns
+				if got.Fields["hostname"] != want.Hostname {
+					t.Errorf("device %d Fields = %v", i, got.Fields)
+				}
+				got.Fields = nil
+				if !reflect.DeepEqual(got, want) {
+					t.Errorf("device %d = %+v, want %+v", i, got, want)
+				}
+			}
+
+			if cmd := sent()[0].form.Get("cmd"); cmd != "<show><devices><connected></connected></devices></show>" {
+				t.Errorf("sent cmd %s", cmd)
+			}
+		})
+	}
+}
+
+func TestWithTarget(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		params url.Values
+		want   string
+	}{
+		{"panorama itself", "", url.Values{"type": {"op"}, "cmd": {"<show><clock></clock></show>"}}, ""},
+		{"managed firewall", "007951000012345", url.Values{"type": {"op"}, "cmd": {"<show><clock></clock></show>"}}, "007951000012345"},
+		{"config", "007951000012345", url.Values{"type": {"config"}, "action": {"get"}, "xpath": {"/config"}}, "007951000012345"},
+		{"log", "007951000012345", url.Values{"type": {"log"}, "log-type": {"traffic"}}, "007951000012345"},
+		{"explicit target kept", "007951000012345", url.Values{"type": {"op"}, "cmd": {"<show/>"}, "target": {"007951000099999"}}, "007951000099999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			panorama, sent := recordingClient(t, http.StatusOK, successXML)
+			client := panorama
+			if tt.target != "" {
+				client = panorama.WithTarget(tt.target)
+			}
+			if client.Target() != tt.target {
+				t.Errorf("Target = %q, want %q", client.Target(), tt.target)
+			}
+
+			before := tt.params.Encode()
+			if _, err := client.XML(context.Background(), tt.params); err != nil {
+				t.Fatalf("XML failed: %v", err)
+			}
+			if tt.params.Encode() != before {
+				t.Errorf("XML changed the caller's parameters to %s", tt.params.Encode())
+			}
+
+			req := onlyRequest(t, sent())
+			if got := req.form.Get("target"); got != tt.want {
+				t.Errorf("target = %q, want %q", got, tt.want)
+			}
+			if _, ok := req.query["target"]; ok {
+				t.Error("target was sent in the URL")
+			}
+		})
+	}
+}
+
+func TestWithTargetLeavesPanorama(t *testing.T) {
+	panorama, sent := recordingClient(t, http.StatusOK, successXML)
+	firewall := panorama.WithTarget("007951000012345")
+
+	if _, err := firewall.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+		t.Fatalf("Op through the target failed: %v", err)
+	}
+	if _, err := panorama.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+		t.Fatalf("Op on Panorama failed: %v", err)
+	}
+
+	requests := sent()
+	if len(requests) != 2 || requests[0].form.Get("target") != "007951000012345" || requests[1].form.Get("target") != "" {
+		t.Errorf("targets sent = %v, want the serial then none", requests)
+	}
+	if panorama.Target() != "" {
+		t.Errorf("Panorama client target = %q", panorama.Target())
+	}
+
+	// Closing a target client must leave the shared connection pool alone
+	if err := firewall.Close(); err != nil {
+		t.Errorf("Close failed: %v", err)
+	}
+	if _, err := panorama.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+		t.Errorf("Op on Panorama after closing the target client failed: %v", err)
+	}
+}
+
+func TestWithTargetRejectsREST(t *testing.T) {
+	panorama, sent := recordingClient(t, http.StatusOK, `{"@status":"success"}`)
+	if _, err := panorama.WithTarget("007951000012345").REST(context.Background(), http.MethodGet, "/restapi/v10.2/Objects/Addresses", nil, nil); err == nil {
+		t.Error("REST request through a target succeeded")
+	}
+	if n := len(sent()); n != 0 {
+		t.Errorf("sent %d requests, want none", n)
+	}
+}
@@ -0,0 +1,282 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit bounds the load a device's management plane sees. Every client
+// talking to the same host shares one limit, whatever operation it serves.
+type RateLimit struct {
+	// RequestsPerSecond is the token bucket refill rate
+	RequestsPerSecond float64
+	// Burst is how many requests may be sent at once after an idle period
+	Burst int
+	// MaxConcurrent caps requests in flight to the device
+	MaxConcurrent int
+}
+
+// DefaultRateLimit is applied to devices without a configured limit
+var DefaultRateLimit = RateLimit{RequestsPerSecond: 10, Burst: 20, MaxConcurrent: 4}
+
+// RetryPolicy controls how transient failures are retried. Only idempotent
+// requests are retried: REST reads, config get/show, show commands, log
+// queries and exports.
+type RetryPolicy struct {
+	// MaxAttempts includes the first attempt; 1 disables retries
+	MaxAttempts int
+	// BaseDelay is doubled on every retry, up to MaxDelay, with full jitter
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultRetryPolicy is used unless WithRetry overrides it
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: 500 * time.Millisecond, MaxDelay: 10 * time.Second}
+
+// Validate checks that every field of the limit is positive
+func (l RateLimit) Validate() error {
+	if l.RequestsPerSecond <= 0 || l.Burst <= 0 || l.MaxConcurrent <= 0 {
+		return errors.New("rate limit, burst and concurrency must be positive")
+	}
+	return nil
+}
+
+// Validate checks that the policy makes at least one attempt and that its
+// delays are in order
+func (p RetryPolicy) Validate() error {
+	if p.MaxAttempts <= 0 || p.BaseDelay < 0 || p.MaxDelay < p.BaseDelay {
+		return errors.New("invalid retry policy")
+	}
+	return nil
+}
+
+// WithRateLimit sets the rate limit and concurrency cap for the client's
+// device. Clients for the same host share it, so the last one set applies.
+// Use RateLimit.Validate to check a limit without applying it.
+func WithRateLimit(limit RateLimit) Option {
+	return func(c *Client) error {
+		if err := limit.Validate(); err != nil {
+			return err
+		}
+		c.scheduler.setLimit(limit)
+		return nil
+	}
+}
+
+// WithRetry sets how transient failures of idempotent requests are retried
+func WithRetry(policy RetryPolicy) Option {
+	return func(c *Client) error {
+		if err := policy.Validate(); err != nil {
+			return err
+		}
+		c.retry = policy
+		return nil
+	}
+}
+
+// schedulers holds one scheduler per device host, shared by every client
+var (
+	schedulers   = make(map[string]*scheduler)
+	schedulersMu sync.Mutex
+)
+
+// schedulerFor returns the shared scheduler of a host
+func schedulerFor(host string) *scheduler {
+	schedulersMu.Lock()
+	defer schedulersMu.Unlock()
+
+	key := strings.ToLower(host)
+	s, ok := schedulers[key]
+	if !ok {
+		s = newScheduler(DefaultRateLimit)
+		schedulers[key] = s
+	}
+	return s
+}
+
+// scheduler admits requests to one device through a token bucket and a
+// concurrency cap
+type scheduler struct {
+	mu     sync.Mutex
+	limit  RateLimit
+	tokens float64
+	last   time.Time
+	// slots is replaced when the cap changes; requests release the
+	// channel they acquired from
+	slots chan struct{}
+}
+
+func newScheduler(limit RateLimit) *scheduler {
+	return &scheduler{
+		limit:  limit,
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+		slots:  make(chan struct{}, limit.MaxConcurrent),
+	}
+}
+
+// setLimit changes the limits, keeping the tokens already earned
+func (s *scheduler) setLimit(limit RateLimit) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if limit.MaxConcurrent != s.limit.MaxConcurrent {
+		s.slots = make(chan struct{}, limit.MaxConcurrent)
+	}
+	if s.tokens > float64(limit.Burst) {
+		s.tokens = float64(limit.Burst)
+	}
+	s.limit = limit
+}
+
+// acquire waits for a request slot and a token. The returned function
+// frees the slot once the request is done.
+func (s *scheduler) acquire(ctx context.Context) (func(), error) {
+	s.mu.Lock()
+	slots := s.slots
+	s.mu.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	release := func() { <-slots }
+
+	if err := s.waitToken(ctx); err != nil {
+		release()
+		return nil, err
+	}
+	return release, nil
+}
+
+// waitToken takes one token from the bucket, waiting for a refill if needed
+func (s *scheduler) waitToken(ctx context.Context) error {
+	for {
+		s.mu.Lock()
+		now := time.Now()
+		s.tokens += now.Sub(s.last).Seconds() * s.limit.RequestsPerSecond
+		if s.tokens > float64(s.limit.Burst) {
+			s.tokens = float64(s.limit.Burst)
+		}
+		s.last = now
+
+		if s.tokens >= 1 {
+			s.tokens--
+			s.mu.Unlock()
+			return nil
+		}
+		wait := time.Duration((1 - s.tokens) / s.limit.RequestsPerSecond * float64(time.Second))
+		s.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// backoff returns the delay before retry n (1 for the first retry):
+// exponential with full jitter, so clients hitting a throttled device at
+// the same time do not retry in lockstep
+func (p RetryPolicy) backoff(n int) time.Duration {
+	ceiling := p.BaseDelay << uint(n-1)
+	if ceiling > p.MaxDelay || ceiling <= 0 {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+// send runs one logical request through the device scheduler, retrying
+// transient failures when the request is idempotent
+func (c *Client) send(ctx context.Context, idempotent bool, attempt func(ctx context.Context) error) error {
+	release, err := c.sendHeld(ctx, idempotent, attempt)
+	if release != nil {
+		release()
+	}
+	return err
+}
+
+// sendHeld is send for streamed responses: after a successful attempt the
+// request slot stays held until the caller has read the body and calls the
+// returned release function
+func (c *Client) sendHeld(ctx context.Context, idempotent bool, attempt func(ctx context.Context) error) (func(), error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	attempts := 1
+	if idempotent && c.retry.MaxAttempts > 1 {
+		attempts = c.retry.MaxAttempts
+	}
+
+	for n := 1; ; n++ {
+		release, err := c.scheduler.acquire(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if err = attempt(ctx); err == nil {
+			return release, nil
+		}
+		release()
+
+		if n >= attempts || !IsRetryable(err) || ctx.Err() != nil {
+			return nil, err
+		}
+
+		delay := c.retry.backoff(n)
+		if c.logger != nil {
+			c.logger.Printf("Retrying API request in %v (attempt %d of %d): %v", delay.Round(time.Millisecond), n+1, attempts, err)
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, err
+		}
+	}
+}
+
+// xmlIdempotent reports whether an XML API request only reads state and can
+// safely be sent again
+func xmlIdempotent(params url.Values) bool {
+	switch params.Get("type") {
+	case TypeLog, TypeExport, "report":
+		return true
+	case TypeConfig:
+		switch params.Get("action") {
+		case "get", "show", "complete":
+			return true
+		}
+	case TypeOp:
+		return strings.HasPrefix(strings.TrimSpace(params.Get("cmd")), "<show>")
+	}
+	return false
+}
+
+// restIdempotent reports whether a REST method can safely be sent again
+func restIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,476 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fastRetry retries quickly so tests do not wait on real backoff delays
+var fastRetry = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 4 * time.Millisecond}
+
+// fastLimit keeps the token bucket out of the way of retry tests
+var fastLimit = RateLimit{RequestsPerSecond: 1000, Burst: 100, MaxConcurrent: 4}
+
+// countingClient returns a client for a server that counts the requests it
+// receives and answers them with respond
+func countingClient(t *testing.T, respond func(w http.ResponseWriter, r *http.Request), opts ...Option) (*Client, *int32) {
+	t.Helper()
+	var count int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		respond(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, "key", append([]Option{WithRetry(fastRetry), WithRateLimit(fastLimit)}, opts...)...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client, &count
+}
+
+// respondStatus answers with an HTTP status and an XML error body
+func respondStatus(status int) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(status)
+		fmt.Fprint(w, `<response status="error"><msg>try again</msg></response>`)
+	}
+}
+
+// respondReset drops the connection with a TCP reset instead of answering
+func respondReset(t *testing.T) func(w http.ResponseWriter, r *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Errorf("Hijack failed: %v", err)
+			return
+		}
+		if tcp, ok := conn.(*net.TCPConn); ok {
+			tcp.SetLinger(0)
+		}
+		conn.Close()
+	}
+}
+
+// requests sent by the retry tests, one per kind of call
+var scheduleCalls = []struct {
+	name       string
+	idempotent bool
+	call       func(ctx context.Context, c *Client) error
+}{
+	{"op show", true, func(ctx context.Context, c *Client) error {
+		_, err := c.Op(ctx, "<show><system><info></info></system></show>")
+		return err
+	}},
+	{"config get", true, func(ctx context.Context, c *Client) error {
+		_, err := c.Config(ctx, "get", "/config/devices", "")
+		return err
+	}},
+	{"config show", true, func(ctx context.Context, c *Client) error {
+		_, err := c.Config(ctx, "show", "/config/devices", "")
+		return err
+	}},
+	{"log", true, func(ctx context.Context, c *Client) error {
+		_, err := c.Log(ctx, url.Values{"log-type": {"traffic"}})
+		return err
+	}},
+	{"export", true, func(ctx context.Context, c *Client) error {
+		_, err := c.Export(ctx, "configuration", nil)
+		return err
+	}},
+	{"REST GET", true, func(ctx context.Context, c *Client) error {
+		_, err := c.REST(ctx, http.MethodGet, "/restapi/v10.2/Objects/Addresses", nil, nil)
+		return err
+	}},
+	{"config set", false, func(ctx context.Context, c *Client) error {
+		_, err := c.Config(ctx, "set", "/config/devices", "<entry name='a'/>")
+		return err
+	}},
+	{"config edit", false, func(ctx context.Context, c *Client) error {
+		_, err := c.Config(ctx, "edit", "/config/devices", "<entry name='a'/>")
+		return err
+	}},
+	{"config delete", false, func(ctx context.Context, c *Client) error {
+		_, err := c.Config(ctx, "delete", "/config/devices", "")
+		return err
+	}},
+	{"commit", false, func(ctx context.Context, c *Client) error {
+		_, err := c.Commit(ctx, "")
+		return err
+	}},
+	{"op request", false, func(ctx context.Context, c *Client) error {
+		_, err := c.Op(ctx, "<request><restart><system></system></restart></request>")
+		return err
+	}},
+	{"REST POST", false, func(ctx context.Context, c *Client) error {
+		_, err := c.REST(ctx, http.MethodPost, "/restapi/v10.2/Objects/Addresses", nil, map[string]string{"name": "a"})
+		return err
+	}},
+	{"REST PUT", false, func(ctx context.Context, c *Client) error {
+		_, err := c.REST(ctx, http.MethodPut, "/restapi/v10.2/Objects/Addresses", nil, map[string]string{"name": "a"})
+		return err
+	}},
+	{"REST DELETE", false, func(ctx context.Context, c *Client) error {
+		_, err := c.REST(ctx, http.MethodDelete, "/restapi/v10.2/Objects/Addresses", nil, nil)
+		return err
+	}},
+}
+
+func TestSendRetries(t *testing.T) {
+	failures := []struct {
+		name    string
+		respond func(t *testing.T) func(w http.ResponseWriter, r *http.Request)
+	}{
+		{"429", func(*testing.T) func(w http.ResponseWriter, r *http.Request) {
+			return respondStatus(http.StatusTooManyRequests)
+		}},
+		{"500", func(*testing.T) func(w http.ResponseWriter, r *http.Request) {
+			return respondStatus(http.StatusInternalServerError)
+		}},
+		{"503", func(*testing.T) func(w http.ResponseWriter, r *http.Request) {
+			return respondStatus(http.StatusServiceUnavailable)
+		}},
+		{"connection reset", respondReset},
+	}
+
+	for _, failure := range failures {
+		for _, tc := range scheduleCalls {
+			t.Run(failure.name+"/"+tc.name, func(t *testing.T) {
+				client, count := countingClient(t, failure.respond(t))
+
+				if err := tc.call(context.Background(), client); err == nil {
+					t.Fatal("expected an error")
+				}
+
+				want := int32(1)
+				if tc.idempotent {
+					want = int32(fastRetry.MaxAttempts)
+				}
+				if got := atomic.LoadInt32(count); got != want {
+					t.Errorf("sent %d times, want %d", got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestSendRetrySucceeds(t *testing.T) {
+	var failed int32
+	client, count := countingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&failed, 1) <= 2 {
+			respondStatus(http.StatusServiceUnavailable)(w, r)
+			return
+		}
+		fmt.Fprint(w, `<response status="success"><result>ok</result></response>`)
+	})
+
+	resp, err := client.Op(context.Background(), "<show><clock></clock></show>")
+	if err != nil {
+		t.Fatalf("Op failed: %v", err)
+	}
+	if resp.Result != "ok" {
+		t.Errorf("Result = %v, want ok", resp.Result)
+	}
+	if got := atomic.LoadInt32(count); got != 3 {
+		t.Errorf("sent %d times, want 3", got)
+	}
+}
+
+func TestSendNoRetry(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		policy  RetryPolicy
+		attempt int32
+	}{
+		{"auth failure", http.StatusForbidden, fastRetry, 1},
+		{"bad request", http.StatusBadRequest, fastRetry, 1},
+		{"retries disabled", http.StatusServiceUnavailable, RetryPolicy{MaxAttempts: 1}, 1},
+		{"more attempts", http.StatusServiceUnavailable, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond}, 5},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client, count := countingClient(t, respondStatus(tc.status), WithRetry(tc.policy))
+
+			if _, err := client.Op(context.Background(), "<show><clock></clock></show>"); err == nil {
+				t.Fatal("expected an error")
+			}
+			if got := atomic.LoadInt32(count); got != tc.attempt {
+				t.Errorf("sent %d times, want %d", got, tc.attempt)
+			}
+		})
+	}
+}
+
+func TestSendCanceledDuringBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour}
+	client, count := countingClient(t, respondStatus(http.StatusServiceUnavailable), WithRetry(policy))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	_, err := client.Op(ctx, "<show><clock></clock></show>")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("cancellation took %v", elapsed)
+	}
+	// The backoff itself may be drawn as zero, so at most one retry is sent
+	if got := atomic.LoadInt32(count); got < 1 || got > 2 {
+		t.Errorf("sent %d times, want 1 or 2", got)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RetryPolicy
+		n       int
+		ceiling time.Duration
+	}{
+		{"first retry", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 10 * time.Second}, 1, 100 * time.Millisecond},
+		{"doubled", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: 10 * time.Second}, 3, 400 * time.Millisecond},
+		{"capped", RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}, 5, time.Second},
+		{"overflow", RetryPolicy{BaseDelay: time.Second, MaxDelay: 30 * time.Second}, 70, 30 * time.Second},
+		{"no delay", RetryPolicy{}, 2, 0},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var max time.Duration
+			for i := 0; i < 2000; i++ {
+				d := tc.policy.backoff(tc.n)
+				if d < 0 || d > tc.ceiling {
+					t.Fatalf("backoff(%d) = %v, want within [0, %v]", tc.n, d, tc.ceiling)
+				}
+				if d > max {
+					max = d
+				}
+			}
+			// Full jitter spreads delays over the whole range
+			if max < tc.ceiling/2 {
+				t.Errorf("largest of 2000 delays was %v, want close to %v", max, tc.ceiling)
+			}
+		})
+	}
+}
+
+func TestConcurrencyCap(t *testing.T) {
+	const limit = 2
+	var inFlight, peak int32
+	var mu sync.Mutex
+	client, count := countingClient(t, func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		mu.Lock()
+		if n > peak {
+			peak = n
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `<response status="success"><result/></response>`)
+	}, WithRateLimit(RateLimit{RequestsPerSecond: 1000, Burst: 100, MaxConcurrent: limit}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+				t.Errorf("Op failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(count); got != 10 {
+		t.Errorf("sent %d requests, want 10", got)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if peak > limit {
+		t.Errorf("%d requests in flight, want at most %d", peak, limit)
+	}
+	if peak < limit {
+		t.Errorf("%d requests in flight, want the cap of %d to be used", peak, limit)
+	}
+}
+
+func TestConcurrencyCapSharedByHost(t *testing.T) {
+	var inFlight, peak int32
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		mu.Lock()
+		if n > peak {
+			peak = n
+		}
+		mu.Unlock()
+
+		time.Sleep(20 * time.Millisecond)
+		fmt.Fprint(w, `<response status="success"><result/></response>`)
+	}))
+	defer server.Close()
+
+	// Two clients for the same device share one cap
+	limit := RateLimit{RequestsPerSecond: 1000, Burst: 100, MaxConcurrent: 1}
+	clients := make([]*Client, 2)
+	for i := range clients {
+		c, err := New(server.URL, "key", WithRateLimit(limit))
+		if err != nil {
+			t.Fatalf("New failed: %v", err)
+		}
+		defer c.Close()
+		clients[i] = c
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(c *Client) {
+			defer wg.Done()
+			if _, err := c.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+				t.Errorf("Op failed: %v", err)
+			}
+		}(clients[i%2])
+	}
+	wg.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if peak != 1 {
+		t.Errorf("%d requests in flight, want 1", peak)
+	}
+}
+
+func TestRateLimit(t *testing.T) {
+	s := newScheduler(RateLimit{RequestsPerSecond: 50, Burst: 1, MaxConcurrent: 1})
+
+	start := time.Now()
+	for i := 0; i < 6; i++ {
+		release, err := s.acquire(context.Background())
+		if err != nil {
+			t.Fatalf("acquire failed: %v", err)
+		}
+		release()
+	}
+	// The first token is free; the other five each wait 20ms
+	if elapsed := time.Since(start); elapsed < 80*time.Millisecond {
+		t.Errorf("6 requests at 50/s with a burst of 1 took %v, want at least 100ms", elapsed)
+	}
+}
+
+func TestAcquireCanceled(t *testing.T) {
+	s := newScheduler(RateLimit{RequestsPerSecond: 1000, Burst: 10, MaxConcurrent: 1})
+	release, err := s.acquire(context.Background())
+	if err != nil {
+		t.Fatalf("acquire failed: %v", err)
+	}
+	defer release()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := s.acquire(ctx); err != context.DeadlineExceeded {
+		t.Errorf("acquire with no free slot = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestSetLimit(t *testing.T) {
+	s := newScheduler(RateLimit{RequestsPerSecond: 10, Burst: 20, MaxConcurrent: 4})
+	s.setLimit(RateLimit{RequestsPerSecond: 5, Burst: 2, MaxConcurrent: 1})
+
+	if s.tokens != 2 {
+		t.Errorf("tokens = %v, want them capped at the new burst of 2", s.tokens)
+	}
+	if cap(s.slots) != 1 {
+		t.Errorf("slots = %d, want 1", cap(s.slots))
+	}
+}
+
+func TestLimitOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  Option
+		ok   bool
+	}{
+		{"rate limit", WithRateLimit(RateLimit{RequestsPerSecond: 1, Burst: 1, MaxConcurrent: 1}), true},
+		{"zero rate", WithRateLimit(RateLimit{Burst: 1, MaxConcurrent: 1}), false},
+		{"zero burst", WithRateLimit(RateLimit{RequestsPerSecond: 1, MaxConcurrent: 1}), false},
+		{"zero concurrency", WithRateLimit(RateLimit{RequestsPerSecond: 1, Burst: 1}), false},
+		{"retry", WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Second}), true},
+		{"zero attempts", WithRetry(RetryPolicy{BaseDelay: time.Second, MaxDelay: time.Second}), false},
+		{"negative delay", WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: -time.Second}), false},
+		{"max below base", WithRetry(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Second, MaxDelay: time.Millisecond}), false},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := New("https://limits.example.test", "key", tc.opt)
+			if (err == nil) != tc.ok {
+				t.Errorf("New error = %v, want ok=%v", err, tc.ok)
+			}
+		})
+	}
+}
+
+func TestIdempotent(t *testing.T) {
+	xml := []struct {
+		params url.Values
+		want   bool
+	}{
+		{url.Values{"type": {TypeLog}}, true},
+		{url.Values{"type": {TypeExport}}, true},
+		{url.Values{"type": {"report"}}, true},
+		{url.Values{"type": {TypeConfig}, "action": {"get"}}, true},
+		{url.Values{"type": {TypeConfig}, "action": {"show"}}, true},
+		{url.Values{"type": {TypeConfig}, "action": {"complete"}}, true},
+		{url.Values{"type": {TypeConfig}, "action": {"set"}}, false},
+		{url.Values{"type": {TypeConfig}, "action": {"edit"}}, false},
+		{url.Values{"type": {TypeConfig}, "action": {"delete"}}, false},
+		{url.Values{"type": {TypeOp}, "cmd": {" <show><clock></clock></show>"}}, true},
+		{url.Values{"type": {TypeOp}, "cmd": {"<request><restart/></request>"}}, false},
+		{url.Values{"type": {TypeOp}, "cmd": {"<clear><session><all/></session></clear>"}}, false},
+		{url.Values{"type": {TypeCommit}}, false},
+		{url.Values{"type": {TypeKeygen}}, false},
+	}
+	for _, tc := range xml {
+		if got := xmlIdempotent(tc.params); got != tc.want {
+			t.Errorf("xmlIdempotent(%v) = %v, want %v", tc.params, got, tc.want)
+		}
+	}
+
+	rest := map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodPost:    false,
+		http.MethodPut:     false,
+		http.MethodPatch:   false,
+		http.MethodDelete:  false,
+	}
+	for method, want := range rest {
+		if got := restIdempotent(method); got != want {
+			t.Errorf("restIdempotent(%s) = %v, want %v", method, got, want)
+		}
+	}
+}
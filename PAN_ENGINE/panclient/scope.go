@@ -0,0 +1,121 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Location is the REST API location a collection is read from
+type Location string
+
+const (
+	LocationShared         Location = "shared"
+	LocationVsys           Location = "vsys"
+	LocationDeviceGroup    Location = "device-group"
+	LocationPanoramaPushed Location = "panorama-pushed"
+	LocationTemplate       Location = "template"
+	LocationTemplateStack  Location = "template-stack"
+)
+
+// DefaultVsys is used when a vsys scope does not name one
+const DefaultVsys = "vsys1"
+
+// Scope selects where a REST collection lives. Only the fields relevant to
+// the location are sent; Name optionally narrows the result to one object.
+type Scope struct {
+	Location      Location
+	Vsys          string
+	DeviceGroup   string
+	Template      string
+	TemplateStack string
+	Name          string
+}
+
+// Validate checks that the fields the location needs are present
+func (s Scope) Validate() error {
+	switch s.Location {
+	case LocationShared, LocationVsys, LocationPanoramaPushed:
+		return nil
+	case LocationDeviceGroup:
+		if s.DeviceGroup == "" {
+			return fmt.Errorf("location %q requires a device group", s.Location)
+		}
+	case LocationTemplate:
+		if s.Template == "" {
+			return fmt.Errorf("location %q requires a template", s.Location)
+		}
+	case LocationTemplateStack:
+		if s.TemplateStack == "" {
+			return fmt.Errorf("location %q requires a template stack", s.Location)
+		}
+	case "":
+		return fmt.Errorf("scope location is required")
+	default:
+		return fmt.Errorf("unknown scope location %q", s.Location)
+	}
+	return nil
+}
+
+// Query returns the REST query parameters for the scope
+func (s Scope) Query() url.Values {
+	q := url.Values{}
+	s.Apply(q)
+	return q
+}
+
+// Apply sets the scope's REST query parameters on q
+func (s Scope) Apply(q url.Values) {
+	if s.Location == "" {
+		return
+	}
+	q.Set("location", string(s.Location))
+
+	switch s.Location {
+	case LocationVsys, LocationPanoramaPushed:
+		vsys := s.Vsys
+		if vsys == "" {
+			vsys = DefaultVsys
+		}
+		q.Set("vsys", vsys)
+	case LocationDeviceGroup:
+		q.Set("device-group", s.DeviceGroup)
+	case LocationTemplate:
+		q.Set("template", s.Template)
+		if s.Vsys != "" {
+			q.Set("vsys", s.Vsys)
+		}
+	case LocationTemplateStack:
+		q.Set("template-stack", s.TemplateStack)
+		if s.Vsys != "" {
+			q.Set("vsys", s.Vsys)
+		}
+	}
+
+	if s.Name != "" {
+		q.Set("name", s.Name)
+	}
+}
+
+// String describes the scope for logs and report metadata
+func (s Scope) String() string {
+	switch s.Location {
+	case LocationVsys, LocationPanoramaPushed:
+		vsys := s.Vsys
+		if vsys == "" {
+			vsys = DefaultVsys
+		}
+		return fmt.Sprintf("%s:%s", s.Location, vsys)
+	case LocationDeviceGroup:
+		return fmt.Sprintf("%s:%s", s.Location, s.DeviceGroup)
+	case LocationTemplate:
+		return fmt.Sprintf("%s:%s", s.Location, s.Template)
+	case LocationTemplateStack:
+		return fmt.Sprintf("%s:%s", s.Location, s.TemplateStack)
+	}
+	return string(s.Location)
+}
@@ -0,0 +1,692 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RowStream decodes the entries of a response one row at a time, so a
+// session table or object list never has to fit in memory as a whole.
+// It follows the rules of XMLResponse.Rows: every outermost entry list
+// yields rows, and a response without entry lists yields a single row.
+//
+//	stream, err := client.XMLRows(ctx, params)
+//	if err != nil { ... }
+//	defer stream.Close()
+//	for stream.Next() {
+//		row := stream.Row()
+//	}
+//	if err := stream.Err(); err != nil { ... }
+type RowStream struct {
+	next    func() (map[string]interface{}, string, error)
+	body    io.Closer
+	release func()
+
+	row     map[string]interface{}
+	section string
+	count   int
+	err     error
+	once    sync.Once
+}
+
+// Next advances to the next row. It returns false at the end of the
+// response or on an error, which Err then reports.
+func (s *RowStream) Next() bool {
+	if s.err != nil || s.next == nil {
+		return false
+	}
+	row, section, err := s.next()
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
+		}
+		s.next = nil
+		s.Close()
+		return false
+	}
+	s.row, s.section = row, section
+	s.count++
+	return true
+}
+
+// Row returns the current row
+func (s *RowStream) Row() map[string]interface{} {
+	return s.row
+}
+
+// Section names the entry list the current row came from, e.g. "result"
+// or "gateway.entry". Rows only carries it as a column when a response
+// has more than one list.
+func (s *RowStream) Section() string {
+	return s.section
+}
+
+// Count returns how many rows have been read so far
+func (s *RowStream) Count() int {
+	return s.count
+}
+
+// Err returns the error that ended the stream, if any
+func (s *RowStream) Err() error {
+	return s.err
+}
+
+// Close releases the connection. It is safe to call more than once.
+func (s *RowStream) Close() error {
+	var err error
+	s.once.Do(func() {
+		if s.body != nil {
+			err = s.body.Close()
+		}
+		if s.release != nil {
+			s.release()
+		}
+	})
+	return err
+}
+
+// XMLRows sends a request to the /api endpoint like XML and streams the
+// <entry> elements of its result. Errors reported by the device in the
+// response status are returned before any row is read.
+func (c *Client) XMLRows(ctx context.Context, params url.Values) (*RowStream, error) {
+	return c.XMLRowsAt(ctx, params, DefaultRowPath)
+}
+
+// XMLRowsAt is XMLRows reading the entries below the element at a slash
+// separated path of the <response>, as XMLResponse.RowsAt does
+func (c *Client) XMLRowsAt(ctx context.Context, params url.Values, rowPath string) (*RowStream, error) {
+	if params.Get("type") == "" {
+		return nil, errors.New("XML API request requires a type parameter")
+	}
+	if c.target != "" && params.Get("target") == "" {
+		params = cloneValues(params)
+		params.Set("target", c.target)
+	}
+	body := params.Encode()
+
+	var stream *RowStream
+	release, err := c.sendHeld(ctx, xmlIdempotent(params), func(ctx context.Context) error {
+		resp, err := c.open(ctx, http.MethodPost, "/api/", nil, "application/x-www-form-urlencoded", strings.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return c.readError(resp, func(status int, body []byte) error {
+				_, err := xmlResult(status, body)
+				return err
+			})
+		}
+
+		decoder := newXMLDecoder(c.limitBody(resp.Body))
+		rows, err := startXMLRows(decoder, rowPath)
+		if err != nil {
+			resp.Body.Close()
+			return err
+		}
+		stream = &RowStream{next: rows.next, body: resp.Body}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stream.release = release
+	return stream, nil
+}
+
+// RESTRows sends a GET to the /restapi endpoint like REST and streams the
+// entries under result.entry. An error status ahead of the result, where
+// PAN-OS puts it, is returned before any row is read. One that only follows
+// the entries ends the stream with an error from Err, and the rows already
+// read are then to be discarded.
+func (c *Client) RESTRows(ctx context.Context, path string, query url.Values) (*RowStream, error) {
+	if c.target != "" {
+		return nil, errors.New("REST API requests cannot be proxied through Panorama to a managed firewall")
+	}
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	var stream *RowStream
+	release, err := c.sendHeld(ctx, true, func(ctx context.Context) error {
+		resp, err := c.open(ctx, http.MethodGet, path, query, "", nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return c.readError(resp, func(status int, body []byte) error {
+				return restError(body, status)
+			})
+		}
+
+		decoder := json.NewDecoder(c.limitBody(resp.Body))
+		rows := &jsonRows{decoder: decoder, status: resp.StatusCode, envelope: map[string]interface{}{}}
+		if err := rows.start(); err != nil {
+			resp.Body.Close()
+			return err
+		}
+		stream = &RowStream{next: rows.next, body: resp.Body}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	stream.release = release
+	return stream, nil
+}
+
+// RESTRowsAt is RESTRows for responses whose rows are not the result's
+// entry list. rowPath is a slash separated path of keys from the top of the
+// response, such as "result/entry/0/members"; the value there becomes rows:
+// one per element of a list, or a single row. An empty rowPath streams
+// result.entry. The response is read whole, bounded by the size limit.
+func (c *Client) RESTRowsAt(ctx context.Context, path string, query url.Values, rowPath string) (*RowStream, error) {
+	if strings.Trim(rowPath, "/") == "" {
+		return c.RESTRows(ctx, path, query)
+	}
+
+	result, err := c.REST(ctx, http.MethodGet, path, query, nil)
+	if err != nil {
+		return nil, err
+	}
+	rows := valueRowsAt(result, rowPath)
+	section := rowPath[strings.LastIndex(strings.TrimRight(rowPath, "/"), "/")+1:]
+	return &RowStream{next: func() (map[string]interface{}, string, error) {
+		if len(rows) == 0 {
+			return nil, "", io.EOF
+		}
+		row := rows[0]
+		rows = rows[1:]
+		return row, section, nil
+	}}, nil
+}
+
+// valueRowsAt follows a slash separated path of keys, or list indexes,
+// through decoded JSON and returns the rows of the value found there
+func valueRowsAt(v interface{}, path string) []map[string]interface{} {
+	for _, key := range strings.Split(strings.Trim(path, "/"), "/") {
+		switch current := v.(type) {
+		case map[string]interface{}:
+			v = current[key]
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(current) {
+				return nil
+			}
+			v = current[i]
+		default:
+			return nil
+		}
+	}
+
+	switch current := v.(type) {
+	case nil:
+		return nil
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(current))
+		for _, item := range current {
+			rows = append(rows, valueRow(item))
+		}
+		return rows
+	}
+	return []map[string]interface{}{valueRow(v)}
+}
+
+// open sends a request whose body the caller reads. The client timeout
+// bounds the wait for the response headers only, since reading a large
+// body can legitimately take longer; the request context still applies.
+func (c *Client) open(ctx context.Context, method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	timer := time.AfterFunc(c.timeout, cancel)
+
+	req, err := c.newRequest(ctx, method, path, query, contentType, body, true)
+	if err != nil {
+		timer.Stop()
+		cancel()
+		return nil, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if !timer.Stop() {
+		if err == nil {
+			resp.Body.Close()
+		}
+		cancel()
+		return nil, fmt.Errorf("error making request: %w", context.DeadlineExceeded)
+	}
+	if err != nil {
+		cancel()
+		return nil, fmt.Errorf("error making request: %w", err)
+	}
+
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// readError reads the (small) body of a failed streamed request and decodes
+// it into an error with the given API flavor's rules
+func (c *Client) readError(resp *http.Response, decode func(status int, body []byte) error) error {
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(c.limitBody(resp.Body))
+	if err != nil {
+		return fmt.Errorf("error reading response: %w", err)
+	}
+	return decode(resp.StatusCode, data)
+}
+
+// cancelBody releases the request context once the body is closed
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// xmlRows walks an XML API response, decoding each outermost <entry> below
+// <result> on its own. Everything else is kept as a skeleton tree, which
+// becomes the single row of a response without entries.
+type xmlRows struct {
+	decoder *xml.Decoder
+	root    *Node
+	// path is the element rows are read from, below <response>
+	path []string
+	// stack holds the open elements outside any entry
+	stack []*Node
+	// resultDepth is the index of the row element on the stack, or -1
+	// outside it
+	resultDepth int
+	entries     int
+	fallback    []interface{}
+	done        bool
+}
+
+// startXMLRows reads up to the <response> element and fails early when the
+// device reported an error
+func startXMLRows(decoder *xml.Decoder, rowPath string) (*xmlRows, error) {
+	path := strings.Split(strings.Trim(rowPath, "/"), "/")
+	if path[0] == "" {
+		path = []string{DefaultRowPath}
+	}
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("error parsing XML: no root element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %w", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		root := &Node{Name: start.Name.Local, Attrs: append([]xml.Attr(nil), start.Attr...)}
+		if root.Name != "response" {
+			return nil, fmt.Errorf("unexpected XML root element <%s>", root.Name)
+		}
+		if root.Attr("status") == "error" {
+			full, err := decodeElement(decoder, start)
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("error parsing XML: %w", err)
+			}
+			resp := &XMLResponse{Root: full, Status: "error", Code: full.Attr("code")}
+			return nil, xmlError(resp, http.StatusOK)
+		}
+		return &xmlRows{decoder: decoder, root: root, path: path, stack: []*Node{root}, resultDepth: -1}, nil
+	}
+}
+
+func (x *xmlRows) next() (map[string]interface{}, string, error) {
+	for {
+		if x.done {
+			if len(x.fallback) == 0 {
+				return nil, "", io.EOF
+			}
+			row, _ := x.fallback[0].(map[string]interface{})
+			x.fallback = x.fallback[1:]
+			return row, x.path[len(x.path)-1], nil
+		}
+
+		tok, err := x.decoder.Token()
+		if err == io.EOF || (err == nil && len(x.stack) == 0) {
+			x.finish()
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("error parsing XML: %w", err)
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local == "entry" && x.resultDepth >= 0 {
+				entry, err := decodeElement(x.decoder, t)
+				if err != nil {
+					return nil, "", fmt.Errorf("error parsing XML: %w", err)
+				}
+				x.entries++
+				return entryRow(entry), x.section(), nil
+			}
+
+			node := &Node{Name: t.Name.Local, Attrs: append([]xml.Attr(nil), t.Attr...)}
+			parent := x.stack[len(x.stack)-1]
+			parent.Children = append(parent.Children, node)
+			x.stack = append(x.stack, node)
+			if x.resultDepth < 0 && x.atRowPath() {
+				x.resultDepth = len(x.stack) - 1
+			}
+		case xml.EndElement:
+			x.stack = x.stack[:len(x.stack)-1]
+			if len(x.stack) <= x.resultDepth {
+				x.resultDepth = -1
+			}
+		case xml.CharData:
+			x.stack[len(x.stack)-1].Text += string(t)
+		}
+	}
+}
+
+// atRowPath reports whether the open elements below <response> are the
+// row path
+func (x *xmlRows) atRowPath() bool {
+	if len(x.stack) != len(x.path)+1 {
+		return false
+	}
+	for i, name := range x.path {
+		if x.stack[i+1].Name != name {
+			return false
+		}
+	}
+	return true
+}
+
+// section names the list of the entry being read, as Rows does
+func (x *xmlRows) section() string {
+	var names []string
+	for _, n := range x.stack[x.resultDepth+1:] {
+		names = append(names, n.Name)
+	}
+	if len(names) == 0 {
+		return x.path[len(x.path)-1]
+	}
+	return strings.Join(names, ".")
+}
+
+// finish ends the walk; a result without entries becomes one row
+func (x *xmlRows) finish() {
+	x.done = true
+	if x.entries == 0 {
+		x.fallback = (&XMLResponse{Root: x.root}).RowsAt(strings.Join(x.path, "/"))
+	}
+}
+
+// jsonRows walks a REST API envelope, {"@status": ..., "result": {"entry":
+// [...]}}, decoding one entry at a time. The other fields are kept, and an
+// error status ends the walk as soon as it is read.
+type jsonRows struct {
+	decoder  *json.Decoder
+	status   int
+	envelope map[string]interface{}
+	result   map[string]interface{}
+	// state is where the walk is: the envelope, the result object or the
+	// entry array, which returns to parent when done
+	state     int
+	parent    int
+	sawEntry  bool
+	entries   int
+	fallback  map[string]interface{}
+	finished  bool
+	exhausted bool
+}
+
+const (
+	inEnvelope = iota
+	inResult
+	inEntries
+)
+
+// start consumes the envelope up to the result, so an error status sent
+// ahead of it fails the request before any row is read
+func (j *jsonRows) start() error {
+	tok, err := j.decoder.Token()
+	if err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '{' {
+		return errors.New("error parsing response: expected a JSON object")
+	}
+
+	for j.decoder.More() {
+		tok, err := j.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+		key, _ := tok.(string)
+
+		if key == "@status" {
+			if err := j.readStatus(); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := j.field(key); err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+		if key == "result" {
+			break
+		}
+	}
+	return nil
+}
+
+// readStatus reads the envelope's @status. An error status is returned
+// right away with the rest of the envelope, which carries its code and
+// message.
+func (j *jsonRows) readStatus() error {
+	var status interface{}
+	if err := j.decoder.Decode(&status); err != nil {
+		return fmt.Errorf("error parsing response: %w", err)
+	}
+	j.envelope["@status"] = status
+	if status != "error" {
+		return nil
+	}
+
+	for j.decoder.More() {
+		tok, err := j.decoder.Token()
+		if err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+		key, _ := tok.(string)
+		var v interface{}
+		if err := j.decoder.Decode(&v); err != nil {
+			return fmt.Errorf("error parsing response: %w", err)
+		}
+		j.envelope[key] = v
+	}
+	j.finished = true
+	raw, _ := json.Marshal(j.envelope)
+	return restError(raw, j.status)
+}
+
+func (j *jsonRows) next() (map[string]interface{}, string, error) {
+	for {
+		if j.finished {
+			if j.fallback == nil || j.exhausted {
+				return nil, "", io.EOF
+			}
+			j.exhausted = true
+			return j.fallback, "result", nil
+		}
+
+		switch j.state {
+		case inEntries:
+			if j.decoder.More() {
+				var v interface{}
+				if err := j.decoder.Decode(&v); err != nil {
+					return nil, "", fmt.Errorf("error parsing response: %w", err)
+				}
+				j.entries++
+				return valueRow(v), "result", nil
+			}
+			if _, err := j.decoder.Token(); err != nil {
+				return nil, "", fmt.Errorf("error parsing response: %w", err)
+			}
+			j.state = j.parent
+
+		case inResult, inEnvelope:
+			if !j.decoder.More() {
+				if _, err := j.decoder.Token(); err != nil {
+					return nil, "", fmt.Errorf("error parsing response: %w", err)
+				}
+				if j.state == inResult {
+					j.state = inEnvelope
+					continue
+				}
+				j.finish()
+				continue
+			}
+
+			tok, err := j.decoder.Token()
+			if err != nil {
+				return nil, "", fmt.Errorf("error parsing response: %w", err)
+			}
+			key, _ := tok.(string)
+
+			if j.state == inEnvelope && key == "@status" {
+				if err := j.readStatus(); err != nil {
+					return nil, "", err
+				}
+				continue
+			}
+			row, err := j.field(key)
+			if err != nil {
+				return nil, "", fmt.Errorf("error parsing response: %w", err)
+			}
+			if row != nil {
+				j.entries++
+				return row, "result", nil
+			}
+		}
+	}
+}
+
+// field reads the value of one key of the envelope or result. The result
+// object and entry array are entered rather than decoded; a single entry
+// object is returned as a row.
+func (j *jsonRows) field(key string) (map[string]interface{}, error) {
+	switch {
+	case j.state == inEnvelope && key == "result" && j.result == nil:
+		tok, err := j.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		if d, ok := tok.(json.Delim); ok && d == '{' {
+			j.result = map[string]interface{}{}
+			j.envelope[key] = j.result
+			j.state = inResult
+			return nil, nil
+		}
+		if d, ok := tok.(json.Delim); ok && d == '[' {
+			j.sawEntry = true
+			j.state, j.parent = inEntries, inEnvelope
+			return nil, nil
+		}
+		j.envelope[key] = tok
+		return nil, nil
+
+	case j.state == inResult && key == "entry":
+		j.sawEntry = true
+		tok, err := j.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		d, ok := tok.(json.Delim)
+		if ok && d == '[' {
+			j.state, j.parent = inEntries, inResult
+			return nil, nil
+		}
+		if ok && d == '{' {
+			entry, err := j.object()
+			if err != nil {
+				return nil, err
+			}
+			return valueRow(entry), nil
+		}
+		// A null entry is an empty list
+		if tok == nil {
+			return nil, nil
+		}
+		return valueRow(tok), nil
+	}
+
+	var v interface{}
+	if err := j.decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	if j.state == inResult {
+		j.result[key] = v
+	} else {
+		j.envelope[key] = v
+	}
+	return nil, nil
+}
+
+// object decodes the rest of an object whose opening brace was consumed
+func (j *jsonRows) object() (map[string]interface{}, error) {
+	out := map[string]interface{}{}
+	for j.decoder.More() {
+		tok, err := j.decoder.Token()
+		if err != nil {
+			return nil, err
+		}
+		key, _ := tok.(string)
+		var v interface{}
+		if err := j.decoder.Decode(&v); err != nil {
+			return nil, err
+		}
+		out[key] = v
+	}
+	if _, err := j.decoder.Token(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// finish ends the walk once the envelope is read. A response without any
+// entry list becomes one row of its result, unless its counts show it is
+// an empty list.
+func (j *jsonRows) finish() {
+	j.finished = true
+	if !j.sawEntry {
+		j.fallback = fallbackRow(j.envelope, j.result)
+	}
+}
+
+// valueRow turns one decoded JSON entry into a row, with its attributes
+// as plain columns
+func valueRow(v interface{}) map[string]interface{} {
+	if m, ok := v.(map[string]interface{}); ok {
+		return PromoteAttributes(FlattenRow(m))
+	}
+	return map[string]interface{}{"value": v}
+}
@@ -0,0 +1,292 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+)
+
+// testClient returns a client for a server that answers every request
+// with body, sent with the given HTTP status
+func testClient(t *testing.T, status int, contentType, body string, opts ...Option) *Client {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.WriteHeader(status)
+		fmt.Fprint(w, body)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := New(server.URL, "key", opts...)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+// streamRow is a row read from a stream along with its section
+type streamRow struct {
+	section string
+	row     map[string]interface{}
+}
+
+// readStream reads every row of a stream
+func readStream(t *testing.T, stream *RowStream) ([]streamRow, error) {
+	t.Helper()
+	defer stream.Close()
+
+	var rows []streamRow
+	for stream.Next() {
+		rows = append(rows, streamRow{stream.Section(), stream.Row()})
+	}
+	if stream.Count() != len(rows) {
+		t.Errorf("Count = %d after reading %d rows", stream.Count(), len(rows))
+	}
+	return rows, stream.Err()
+}
+
+func TestXMLRows(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		rowPath string
+		want    []streamRow
+	}{
+		{
+			"entry list",
+			`<response status="success"><result><entry name="a"><zone>trust</zone></entry><entry name="b"><zone>untrust</zone></entry></result></response>`,
+			"",
+			[]streamRow{
+				{"result", map[string]interface{}{"name": "a", "zone": "trust"}},
+				{"result", map[string]interface{}{"name": "b", "zone": "untrust"}},
+			},
+		},
+		{
+			"several lists",
+			`<response status="success"><result><ifnet><entry><name>ethernet1/1</name></entry></ifnet><hw><entry><name>ethernet1/2</name></entry></hw></result></response>`,
+			"",
+			[]streamRow{
+				{"ifnet", map[string]interface{}{"name": "ethernet1/1"}},
+				{"hw", map[string]interface{}{"name": "ethernet1/2"}},
+			},
+		},
+		{
+			"no entries",
+			`<response status="success"><result><system><hostname>fw1</hostname><serial>0001</serial></system></result></response>`,
+			"",
+			[]streamRow{{"result", map[string]interface{}{"hostname": "fw1", "serial": "0001"}}},
+		},
+		{
+			"empty result",
+			`<response status="success"><result></result></response>`,
+			"",
+			nil,
+		},
+		{
+			"row path",
+			`<response status="success"><result><job><id>7</id></job><log><logs count="1"><entry><app>ssl</app></entry></logs></log></result></response>`,
+			"result/log/logs",
+			[]streamRow{{"logs", map[string]interface{}{"app": "ssl"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, http.StatusOK, "application/xml", tt.body)
+			stream, err := client.XMLRowsAt(context.Background(), url.Values{"type": {"op"}}, tt.rowPath)
+			if err != nil {
+				t.Fatalf("XMLRowsAt failed: %v", err)
+			}
+			got, err := readStream(t, stream)
+			if err != nil {
+				t.Fatalf("stream failed: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+
+			// Streaming gives the rows of the whole parsed response
+			resp, err := ParseXMLResponse([]byte(tt.body))
+			if err != nil {
+				t.Fatalf("ParseXMLResponse failed: %v", err)
+			}
+			parsed := resp.RowsAt(tt.rowPath)
+			if len(parsed) != len(got) {
+				t.Errorf("streamed %d rows, parsed %d", len(got), len(parsed))
+			}
+		})
+	}
+}
+
+func TestXMLRowsError(t *testing.T) {
+	client := testClient(t, http.StatusOK, "application/xml",
+		`<response status="error" code="403"><result><msg>Invalid credentials.</msg></result></response>`)
+
+	_, err := client.XMLRows(context.Background(), url.Values{"type": {"op"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.Kind != KindAuth {
+		t.Errorf("XMLRows error = %v, want an auth APIError", err)
+	}
+
+	if _, err := client.XMLRows(context.Background(), url.Values{}); err == nil {
+		t.Error("XMLRows accepted a request without a type")
+	}
+}
+
+func TestRESTRows(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []map[string]interface{}
+	}{
+		{
+			"entry list",
+			`{"@status": "success", "result": {"@total-count": "2", "@count": "2", "entry": [
+				{"@name": "web", "@location": "vsys", "ip-netmask": "10.0.0.1"},
+				{"@name": "db", "@location": "vsys", "ip-netmask": "10.0.0.2"}]}}`,
+			[]map[string]interface{}{
+				{"name": "web", "location": "vsys", "ip-netmask": "10.0.0.1"},
+				{"name": "db", "location": "vsys", "ip-netmask": "10.0.0.2"},
+			},
+		},
+		{
+			"single entry",
+			`{"@status": "success", "result": {"@count": "1", "entry": {"@name": "web", "tag": {"member": ["a", "b"]}}}}`,
+			[]map[string]interface{}{{"name": "web", "tag": "a, b"}},
+		},
+		{
+			"result list",
+			`{"@status": "success", "result": [{"@name": "web"}]}`,
+			[]map[string]interface{}{{"name": "web"}},
+		},
+		{
+			"empty list",
+			`{"@status": "success", "result": {"@total-count": "0", "@count": "0"}}`,
+			nil,
+		},
+		{
+			"no entries",
+			`{"@status": "success", "result": {"hostname": "fw1"}}`,
+			[]map[string]interface{}{{"hostname": "fw1"}},
+		},
+		{
+			"status after result",
+			`{"result": {"entry": [{"@name": "web"}]}, "@status": "success"}`,
+			[]map[string]interface{}{{"name": "web"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := testClient(t, http.StatusOK, "application/json", tt.body)
+			stream, err := client.RESTRows(context.Background(), "/restapi/v11.0/Objects/Addresses", nil)
+			if err != nil {
+				t.Fatalf("RESTRows failed: %v", err)
+			}
+			rows, err := readStream(t, stream)
+			if err != nil {
+				t.Fatalf("stream failed: %v", err)
+			}
+
+			var got []map[string]interface{}
+			for _, r := range rows {
+				if r.section != "result" {
+					t.Errorf("section = %s, want result", r.section)
+				}
+				got = append(got, r.row)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rows = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRESTRowsErrors(t *testing.T) {
+	// An error status ahead of the result is returned before any row is
+	// read, with the code and message that follow it
+	for _, body := range []string{
+		`{"@status": "error", "@code": "7", "message": "Object doesn't exist", "result": {"entry": [{"@name": "web"}]}}`,
+		`{"@code": "7", "@status": "error", "result": {"entry": [{"@name": "web"}]}, "message": "Object doesn't exist"}`,
+	} {
+		client := testClient(t, http.StatusOK, "application/json", body)
+		stream, err := client.RESTRows(context.Background(), "/restapi/v11.0/Objects/Addresses", nil)
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.Code != "7" || apiErr.Message != "Object doesn't exist" {
+			t.Errorf("RESTRows(%s) = %v, %v, want the device's error", body, stream, err)
+		}
+	}
+
+	// One sent after the entries ends the stream with an error
+	client := testClient(t, http.StatusOK, "application/json",
+		`{"result": {"entry": [{"@name": "web"}]}, "@status": "error", "@code": "7", "message": "Object doesn't exist"}`)
+	stream, err := client.RESTRows(context.Background(), "/restapi/v11.0/Objects/Addresses", nil)
+	if err != nil {
+		t.Fatalf("RESTRows failed: %v", err)
+	}
+	var apiErr *APIError
+	if _, err := readStream(t, stream); !errors.As(err, &apiErr) || apiErr.Code != "7" {
+		t.Errorf("stream error = %v, want the device's error", err)
+	}
+
+	// An HTTP error is returned before any row is read
+	client = testClient(t, http.StatusForbidden, "application/json",
+		`{"@status": "error", "@code": "403", "message": "Invalid credentials."}`)
+	_, err = client.RESTRows(context.Background(), "/restapi/v11.0/Objects/Addresses", nil)
+	if !errors.As(err, &apiErr) || apiErr.Kind != KindAuth {
+		t.Errorf("RESTRows error = %v, want an auth APIError", err)
+	}
+}
+
+func TestRESTRowsAt(t *testing.T) {
+	client := testClient(t, http.StatusOK, "application/json",
+		`{"@status": "success", "result": {"entry": [{"@name": "group", "members": [{"@name": "a"}, {"@name": "b"}]}]}}`)
+
+	stream, err := client.RESTRowsAt(context.Background(), "/restapi/v11.0/Objects/AddressGroups", nil, "result/entry/0/members")
+	if err != nil {
+		t.Fatalf("RESTRowsAt failed: %v", err)
+	}
+	got, err := readStream(t, stream)
+	if err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	want := []streamRow{
+		{"members", map[string]interface{}{"name": "a"}},
+		{"members", map[string]interface{}{"name": "b"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rows = %v, want %v", got, want)
+	}
+}
+
+func TestStreamResponseSizeLimit(t *testing.T) {
+	body := `<response status="success"><result>`
+	for i := 0; i < 100; i++ {
+		body += fmt.Sprintf(`<entry><name>object-%d</name></entry>`, i)
+	}
+	body += `</result></response>`
+
+	client := testClient(t, http.StatusOK, "application/xml", body, WithMaxResponseSize(512))
+	stream, err := client.XMLRows(context.Background(), url.Values{"type": {"op"}})
+	if err != nil {
+		t.Fatalf("XMLRows failed: %v", err)
+	}
+	rows, err := readStream(t, stream)
+	if err == nil {
+		t.Fatalf("read %d rows of an oversized response without an error", len(rows))
+	}
+	if len(rows) == 0 || len(rows) >= 100 {
+		t.Errorf("read %d rows before the limit, want some but not all", len(rows))
+	}
+}
@@ -0,0 +1,79 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogTimeLayout is the timestamp format used in log filter queries
+const LogTimeLayout = "2006/01/02 15:04:05"
+
+// dateOnlyLayouts are inputs that name a whole day
+var dateOnlyLayouts = []string{"2006-01-02", "2006/01/02"}
+
+// dateTimeLayouts are inputs with a time of day but no zone
+var dateTimeLayouts = []string{"2006-01-02 15:04:05", "2006/01/02 15:04:05", "2006-01-02T15:04:05", "2006-01-02T15:04"}
+
+// ParseRangeBound parses a date range bound in the device's time zone.
+// A bare date covers the whole day, so an end bound resolves to 23:59:59.
+// Times with an explicit zone (RFC 3339) are converted to the device zone.
+func ParseRangeBound(value string, end bool, loc *time.Location) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if loc == nil {
+		loc = time.Local
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t.In(loc), nil
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	for _, layout := range dateOnlyLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			// Days are not always 24 hours long where daylight saving
+			// time changes, so the last second is set on the wall clock
+			if end {
+				t = time.Date(t.Year(), t.Month(), t.Day(), 23, 59, 59, 0, loc)
+			}
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD or YYYY-MM-DD HH:MM:SS", value)
+}
+
+// TimeRangeQuery builds a receive_time filter clause. Either bound may be
+// empty; both empty returns "".
+func TimeRangeQuery(startDate, endDate string, loc *time.Location) (string, error) {
+	var clauses []string
+	var start, end time.Time
+	var err error
+
+	if startDate != "" {
+		if start, err = ParseRangeBound(startDate, false, loc); err != nil {
+			return "", err
+		}
+		clauses = append(clauses, fmt.Sprintf("(receive_time geq '%s')", start.Format(LogTimeLayout)))
+	}
+	if endDate != "" {
+		if end, err = ParseRangeBound(endDate, true, loc); err != nil {
+			return "", err
+		}
+		clauses = append(clauses, fmt.Sprintf("(receive_time leq '%s')", end.Format(LogTimeLayout)))
+	}
+
+	if startDate != "" && endDate != "" && end.Before(start) {
+		return "", fmt.Errorf("end date %s is before start date %s", endDate, startDate)
+	}
+
+	return strings.Join(clauses, " and "), nil
+}
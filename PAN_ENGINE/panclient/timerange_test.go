@@ -0,0 +1,85 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+)
+
+func TestParseRangeBound(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Fatalf("LoadLocation failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		value string
+		end   bool
+		loc   *time.Location
+		want  string
+	}{
+		{"start of day", "2024-06-01", false, time.UTC, "2024/06/01 00:00:00"},
+		{"end of day", "2024-06-01", true, time.UTC, "2024/06/01 23:59:59"},
+		{"slashes", "2024/06/01", true, time.UTC, "2024/06/01 23:59:59"},
+		{"time of day", "2024-06-01 12:30:00", true, time.UTC, "2024/06/01 12:30:00"},
+		{"minutes only", "2024-06-01T12:30", false, time.UTC, "2024/06/01 12:30:00"},
+		{"explicit zone", "2024-06-01T12:00:00Z", false, newYork, "2024/06/01 08:00:00"},
+		{"spring forward end", "2024-03-10", true, newYork, "2024/03/10 23:59:59"},
+		{"spring forward start", "2024-03-10", false, newYork, "2024/03/10 00:00:00"},
+		{"fall back end", "2024-11-03", true, newYork, "2024/11/03 23:59:59"},
+		{"fall back start", "2024-11-03", false, newYork, "2024/11/03 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRangeBound(tt.value, tt.end, tt.loc)
+			if err != nil {
+				t.Fatalf("ParseRangeBound(%s) failed: %v", tt.value, err)
+			}
+			if got.Location() != tt.loc {
+				t.Errorf("ParseRangeBound(%s) in %s, want %s", tt.value, got.Location(), tt.loc)
+			}
+			if s := got.Format(LogTimeLayout); s != tt.want {
+				t.Errorf("ParseRangeBound(%s) = %s, want %s", tt.value, s, tt.want)
+			}
+		})
+	}
+
+	if _, err := ParseRangeBound("06/01/2024", false, time.UTC); err == nil {
+		t.Error("ParseRangeBound accepted 06/01/2024")
+	}
+}
+
+func TestTimeRangeQuery(t *testing.T) {
+	tests := []struct {
+		start   string
+		end     string
+		want    string
+		wantErr bool
+	}{
+		{"", "", "", false},
+		{"2024-06-01", "", "(receive_time geq '2024/06/01 00:00:00')", false},
+		{"", "2024-06-01", "(receive_time leq '2024/06/01 23:59:59')", false},
+		{"2024-06-01", "2024-06-01", "(receive_time geq '2024/06/01 00:00:00') and (receive_time leq '2024/06/01 23:59:59')", false},
+		{"2024-06-02", "2024-06-01", "", true},
+		{"yesterday", "", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.start+"_"+tt.end, func(t *testing.T) {
+			got, err := TimeRangeQuery(tt.start, tt.end, time.UTC)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("TimeRangeQuery(%q, %q) error = %v, want error %v", tt.start, tt.end, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("TimeRangeQuery(%q, %q) = %s, want %s", tt.start, tt.end, got, tt.want)
+			}
+		})
+	}
+}
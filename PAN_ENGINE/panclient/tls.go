@@ -0,0 +1,211 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TLSInfo describes the certificate a device presented
+type TLSInfo struct {
+	Subject   string
+	Issuer    string
+	DNSNames  []string
+	NotBefore time.Time
+	NotAfter  time.Time
+	// SHA256 is the fingerprint of the leaf certificate, as used for pinning
+	SHA256 string
+	// Version is the negotiated protocol, e.g. "TLS 1.3"
+	Version string
+	// Verified reports whether the chain is trusted by the client's CA pool
+	Verified    bool
+	VerifyError string
+}
+
+// CertificateFingerprint returns the SHA-256 of a certificate's DER encoding
+// in lower case hex, the form certificate pins are compared in
+func CertificateFingerprint(cert *x509.Certificate) string {
+	sum := sha256.Sum256(cert.Raw)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizePin accepts a SHA-256 fingerprint as printed by browsers or
+// openssl ("AB:CD:...", optionally prefixed with "sha256:" or "SHA256=")
+// and returns it in the form of CertificateFingerprint
+func NormalizePin(pin string) (string, error) {
+	p := strings.ToLower(strings.TrimSpace(pin))
+	for _, prefix := range []string{"sha256:", "sha256=", "sha256 fingerprint="} {
+		p = strings.TrimPrefix(p, prefix)
+	}
+	p = strings.NewReplacer(":", "", " ", "", "-", "").Replace(p)
+
+	if len(p) != sha256.Size*2 {
+		return "", fmt.Errorf("invalid certificate pin %q: expected a SHA-256 fingerprint", pin)
+	}
+	if _, err := hex.DecodeString(p); err != nil {
+		return "", fmt.Errorf("invalid certificate pin %q: %v", pin, err)
+	}
+	return p, nil
+}
+
+// MatchPin reports whether a fingerprint is one of the pins
+func MatchPin(fingerprint string, pins []string) bool {
+	for _, pin := range pins {
+		if p, err := NormalizePin(pin); err == nil && p == fingerprint {
+			return true
+		}
+	}
+	return false
+}
+
+// CertificatePinError rejects a device whose certificate matches none of
+// the pinned fingerprints
+type CertificatePinError struct {
+	// Fingerprint is that of the presented certificate, empty when the
+	// device presented none
+	Fingerprint string
+}
+
+func (e *CertificatePinError) Error() string {
+	if e.Fingerprint == "" {
+		return "device presented no certificate"
+	}
+	return fmt.Sprintf("certificate fingerprint %s does not match any pinned fingerprint", e.Fingerprint)
+}
+
+// VerifyPins returns a tls.Config.VerifyConnection callback that accepts a
+// connection only when the leaf certificate matches one of the pins
+func VerifyPins(pins []string) (func(tls.ConnectionState) error, error) {
+	if len(pins) == 0 {
+		return nil, errors.New("at least one certificate pin is required")
+	}
+	normalized := make([]string, 0, len(pins))
+	for _, pin := range pins {
+		p, err := NormalizePin(pin)
+		if err != nil {
+			return nil, err
+		}
+		normalized = append(normalized, p)
+	}
+
+	return func(cs tls.ConnectionState) error {
+		if len(cs.PeerCertificates) == 0 {
+			return &CertificatePinError{}
+		}
+		fingerprint := CertificateFingerprint(cs.PeerCertificates[0])
+		if !MatchPin(fingerprint, normalized) {
+			return &CertificatePinError{Fingerprint: fingerprint}
+		}
+		return nil
+	}, nil
+}
+
+// ParseTLSVersion parses a minimum TLS version such as "1.2" or "TLS1.3"
+func ParseTLSVersion(version string) (uint16, error) {
+	v := strings.TrimPrefix(strings.ToLower(strings.ReplaceAll(version, " ", "")), "tls")
+	switch v {
+	case "1.0":
+		return tls.VersionTLS10, nil
+	case "1.1":
+		return tls.VersionTLS11, nil
+	case "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	}
+	return 0, fmt.Errorf("invalid TLS version %q: must be 1.0, 1.1, 1.2 or 1.3", version)
+}
+
+// InspectTLS connects to the device and describes the certificate it
+// presents. The certificate is read even when it would not be trusted, so
+// callers can show why a connection fails; Verified tells whether the
+// client's own CA pool accepts it. Proxy settings of the transport apply.
+func (c *Client) InspectTLS(ctx context.Context) (*TLSInfo, error) {
+	if c.baseURL.Scheme != "https" {
+		return nil, errors.New("the API URL does not use HTTPS")
+	}
+	base, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		return nil, errors.New("TLS inspection needs the default transport")
+	}
+
+	// Accept any certificate for this one request, then verify it here
+	transport := base.Clone()
+	trusted := transport.TLSClientConfig
+	if trusted == nil {
+		trusted = &tls.Config{}
+	}
+	probe := trusted.Clone()
+	probe.InsecureSkipVerify = true
+	probe.VerifyConnection = nil
+	probe.VerifyPeerCertificate = nil
+	transport.TLSClientConfig = probe
+	defer transport.CloseIdleConnections()
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, c.baseURL.String()+"/", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	hc := &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return nil, errors.New("device presented no certificate")
+	}
+	leaf := resp.TLS.PeerCertificates[0]
+
+	info := &TLSInfo{
+		Subject:   leaf.Subject.String(),
+		Issuer:    leaf.Issuer.String(),
+		DNSNames:  leaf.DNSNames,
+		NotBefore: leaf.NotBefore,
+		NotAfter:  leaf.NotAfter,
+		SHA256:    CertificateFingerprint(leaf),
+		Version:   tls.VersionName(resp.TLS.Version),
+	}
+
+	intermediates := x509.NewCertPool()
+	for _, cert := range resp.TLS.PeerCertificates[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, verifyErr := leaf.Verify(x509.VerifyOptions{
+		DNSName:       c.baseURL.Hostname(),
+		Roots:         trusted.RootCAs,
+		Intermediates: intermediates,
+	})
+	info.Verified = verifyErr == nil
+	if verifyErr != nil {
+		info.VerifyError = verifyErr.Error()
+	}
+
+	return info, nil
+}
@@ -0,0 +1,329 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// tlsDevice starts an HTTPS test server answering every request with a
+// successful XML response, and counts the requests that reach it
+func tlsDevice(t *testing.T, configure func(*tls.Config)) (*httptest.Server, *int32) {
+	t.Helper()
+	var count int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&count, 1)
+		fmt.Fprint(w, successXML)
+	}))
+	server.TLS = &tls.Config{}
+	if configure != nil {
+		configure(server.TLS)
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+	return server, &count
+}
+
+// deviceFingerprint returns the pin of a test server's certificate
+func deviceFingerprint(server *httptest.Server) string {
+	return CertificateFingerprint(server.Certificate())
+}
+
+// colonPin formats a fingerprint the way browsers print it
+func colonPin(fingerprint string) string {
+	var parts []string
+	for i := 0; i < len(fingerprint); i += 2 {
+		parts = append(parts, strings.ToUpper(fingerprint[i:i+2]))
+	}
+	return strings.Join(parts, ":")
+}
+
+func TestNormalizePin(t *testing.T) {
+	const hexPin = "9f86d081884c7d659a2feaa0c55ad015a3bf4f1b2b0b822cd15d6c15b0f00a08"
+	tests := []struct {
+		pin string
+		ok  bool
+	}{
+		{hexPin, true},
+		{strings.ToUpper(hexPin), true},
+		{colonPin(hexPin), true},
+		{"sha256:" + hexPin, true},
+		{"SHA256=" + colonPin(hexPin), true},
+		{" SHA256 Fingerprint=" + colonPin(hexPin) + " ", true},
+		{hexPin[:62], false},
+		{hexPin + "00", false},
+		{strings.Replace(hexPin, "9f", "zz", 1), false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pin, func(t *testing.T) {
+			got, err := NormalizePin(tt.pin)
+			if (err == nil) != tt.ok {
+				t.Fatalf("NormalizePin error = %v, want ok=%v", err, tt.ok)
+			}
+			if tt.ok && got != hexPin {
+				t.Errorf("NormalizePin = %s, want %s", got, hexPin)
+			}
+		})
+	}
+}
+
+func TestVerifyPinsRejectsBadPins(t *testing.T) {
+	for _, pins := range [][]string{nil, {}, {"not-a-pin"}} {
+		if _, err := VerifyPins(pins); err == nil {
+			t.Errorf("VerifyPins(%q) succeeded", pins)
+		}
+	}
+
+	verify, err := VerifyPins([]string{strings.Repeat("ab", 32)})
+	if err != nil {
+		t.Fatalf("VerifyPins failed: %v", err)
+	}
+	var pinErr *CertificatePinError
+	if err := verify(tls.ConnectionState{}); !errors.As(err, &pinErr) || pinErr.Fingerprint != "" {
+		t.Errorf("verify without certificates = %v, want a CertificatePinError", err)
+	}
+}
+
+func TestCertificatePinning(t *testing.T) {
+	server, _ := tlsDevice(t, nil)
+	fingerprint := deviceFingerprint(server)
+
+	tests := []struct {
+		name string
+		pins []string
+		ok   bool
+	}{
+		{"matching pin", []string{fingerprint}, true},
+		{"browser format", []string{"SHA256:" + colonPin(fingerprint)}, true},
+		{"one of several", []string{strings.Repeat("00", 32), fingerprint}, true},
+		{"mismatch", []string{strings.Repeat("00", 32)}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verify, err := VerifyPins(tt.pins)
+			if err != nil {
+				t.Fatalf("VerifyPins failed: %v", err)
+			}
+			// A pin stands in for the CA chain, which the test certificate lacks
+			client, err := New(server.URL, "key", WithRetry(fastRetry),
+				WithTLSConfig(&tls.Config{InsecureSkipVerify: true, VerifyConnection: verify}))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer client.Close()
+
+			_, err = client.Op(context.Background(), "<show><clock></clock></show>")
+			if tt.ok {
+				if err != nil {
+					t.Errorf("Op with a matching pin failed: %v", err)
+				}
+				return
+			}
+
+			var pinErr *CertificatePinError
+			if !errors.As(err, &pinErr) {
+				t.Fatalf("Op = %v, want a CertificatePinError", err)
+			}
+			if pinErr.Fingerprint != fingerprint {
+				t.Errorf("error fingerprint = %s, want %s", pinErr.Fingerprint, fingerprint)
+			}
+			if kind := Classify(err); kind != KindTLS {
+				t.Errorf("pin mismatch classified as %s, want %s", kind, KindTLS)
+			}
+		})
+	}
+}
+
+func TestPinMismatchNotRetried(t *testing.T) {
+	server, count := tlsDevice(t, nil)
+	verify, err := VerifyPins([]string{strings.Repeat("00", 32)})
+	if err != nil {
+		t.Fatalf("VerifyPins failed: %v", err)
+	}
+	client, err := New(server.URL, "key", WithRetry(fastRetry),
+		WithTLSConfig(&tls.Config{InsecureSkipVerify: true, VerifyConnection: verify}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer client.Close()
+
+	if _, err := client.Op(context.Background(), "<show><clock></clock></show>"); err == nil {
+		t.Fatal("Op succeeded despite the pin mismatch")
+	}
+	if n := atomic.LoadInt32(count); n != 0 {
+		t.Errorf("%d requests reached the device, want none", n)
+	}
+}
+
+func TestUntrustedCertificate(t *testing.T) {
+	server, _ := tlsDevice(t, nil)
+	client, err := New(server.URL, "key", WithRetry(fastRetry))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer client.Close()
+
+	_, err = client.Op(context.Background(), "<show><clock></clock></show>")
+	if kind := Classify(err); kind != KindTLS {
+		t.Errorf("untrusted certificate error %v classified as %s, want %s", err, kind, KindTLS)
+	}
+}
+
+func TestMinimumTLSVersion(t *testing.T) {
+	// The device only speaks TLS 1.2
+	server, _ := tlsDevice(t, func(cfg *tls.Config) { cfg.MaxVersion = tls.VersionTLS12 })
+
+	tests := []struct {
+		minimum string
+		ok      bool
+	}{
+		{"1.2", true},
+		{"TLS1.3", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.minimum, func(t *testing.T) {
+			version, err := ParseTLSVersion(tt.minimum)
+			if err != nil {
+				t.Fatalf("ParseTLSVersion failed: %v", err)
+			}
+			client, err := New(server.URL, "key", WithRetry(fastRetry),
+				WithTLSConfig(&tls.Config{InsecureSkipVerify: true, MinVersion: version}))
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer client.Close()
+
+			_, err = client.Op(context.Background(), "<show><clock></clock></show>")
+			if (err == nil) != tt.ok {
+				t.Errorf("Op with minimum TLS %s = %v, want ok=%v", tt.minimum, err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestParseTLSVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  uint16
+		ok    bool
+	}{
+		{"1.0", tls.VersionTLS10, true},
+		{"1.1", tls.VersionTLS11, true},
+		{"1.2", tls.VersionTLS12, true},
+		{"1.3", tls.VersionTLS13, true},
+		{"TLS1.2", tls.VersionTLS12, true},
+		{"tls 1.3", tls.VersionTLS13, true},
+		{"TLS 1.3", tls.VersionTLS13, true},
+		{"", 0, false},
+		{"1.4", 0, false},
+		{"SSL3.0", 0, false},
+		{"12", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseTLSVersion(tt.input)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseTLSVersion(%q) error = %v, want ok=%v", tt.input, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("ParseTLSVersion(%q) = %x, want %x", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInspectTLS(t *testing.T) {
+	server, _ := tlsDevice(t, nil)
+	fingerprint := deviceFingerprint(server)
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	mismatch, err := VerifyPins([]string{strings.Repeat("00", 32)})
+	if err != nil {
+		t.Fatalf("VerifyPins failed: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		cfg      *tls.Config
+		verified bool
+	}{
+		{"system roots", nil, false},
+		{"trusted CA", &tls.Config{RootCAs: roots}, true},
+		// The certificate is still shown when the pin would reject it
+		{"pin mismatch", &tls.Config{InsecureSkipVerify: true, VerifyConnection: mismatch}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := []Option{}
+			if tt.cfg != nil {
+				opts = append(opts, WithTLSConfig(tt.cfg))
+			}
+			client, err := New(server.URL, "key", opts...)
+			if err != nil {
+				t.Fatalf("New failed: %v", err)
+			}
+			defer client.Close()
+
+			info, err := client.InspectTLS(context.Background())
+			if err != nil {
+				t.Fatalf("InspectTLS failed: %v", err)
+			}
+			if info.SHA256 != fingerprint {
+				t.Errorf("SHA256 = %s, want %s", info.SHA256, fingerprint)
+			}
+			if info.Version != "TLS 1.3" {
+				t.Errorf("Version = %q, want TLS 1.3", info.Version)
+			}
+			if info.Verified != tt.verified {
+				t.Errorf("Verified = %v (%s), want %v", info.Verified, info.VerifyError, tt.verified)
+			}
+			if !tt.verified && info.VerifyError == "" {
+				t.Error("an unverified certificate has no VerifyError")
+			}
+			if info.NotAfter.IsZero() || len(info.DNSNames) == 0 {
+				t.Errorf("certificate details missing: %+v", info)
+			}
+		})
+	}
+}
+
+func TestInspectTLSRequiresHTTPS(t *testing.T) {
+	client := testClient(t, http.StatusOK, "application/xml", successXML)
+	if _, err := client.InspectTLS(context.Background()); err == nil {
+		t.Error("InspectTLS succeeded on a plain HTTP URL")
+	}
+
+	server, _ := tlsDevice(t, nil)
+	custom, err := New(server.URL, "key", WithTransport(roundTripperFunc(http.DefaultTransport.RoundTrip)))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer custom.Close()
+	if _, err := custom.InspectTLS(context.Background()); err == nil {
+		t.Error("InspectTLS succeeded with a custom round tripper")
+	}
+}
+
+// roundTripperFunc adapts a function to http.RoundTripper
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
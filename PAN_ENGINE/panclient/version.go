@@ -0,0 +1,116 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a PAN-OS software version such as 10.2.4-h2
+type Version struct {
+	Major int
+	Minor int
+	Patch int
+	// Raw is the version string as reported by the device
+	Raw string
+}
+
+// ParseVersion parses a sw-version string. Hotfix and build suffixes such
+// as "-h2" or "-c50" are kept in Raw but ignored for comparison.
+func ParseVersion(s string) (Version, error) {
+	raw := strings.TrimSpace(s)
+	core := raw
+	if i := strings.IndexAny(core, "-_ "); i >= 0 {
+		core = core[:i]
+	}
+
+	parts := strings.Split(core, ".")
+	if len(parts) < 2 {
+		return Version{}, fmt.Errorf("invalid PAN-OS version %q", s)
+	}
+
+	nums := make([]int, 3)
+	for i := 0; i < len(parts) && i < 3; i++ {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return Version{}, fmt.Errorf("invalid PAN-OS version %q", s)
+		}
+		nums[i] = n
+	}
+
+	return Version{Major: nums[0], Minor: nums[1], Patch: nums[2], Raw: raw}, nil
+}
+
+// MustParseVersion is ParseVersion for constant version strings
+func MustParseVersion(s string) Version {
+	v, err := ParseVersion(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Compare returns -1, 0 or 1 when v is older, equal or newer than other
+func (v Version) Compare(other Version) int {
+	switch {
+	case v.Major != other.Major:
+		return sign(v.Major - other.Major)
+	case v.Minor != other.Minor:
+		return sign(v.Minor - other.Minor)
+	case v.Patch != other.Patch:
+		return sign(v.Patch - other.Patch)
+	}
+	return 0
+}
+
+// AtLeast reports whether v is the same as or newer than other
+func (v Version) AtLeast(other Version) bool {
+	return v.Compare(other) >= 0
+}
+
+// String returns the major.minor.patch form
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// RESTAPIVersions lists the REST API versions the engine knows, oldest first.
+// A device serves the REST API version matching its own major.minor release
+// and every earlier one.
+var RESTAPIVersions = []string{"v9.0", "v9.1", "v10.0", "v10.1", "v10.2", "v11.0", "v11.1", "v11.2"}
+
+// DefaultRESTVersion is used until the device version is known
+const DefaultRESTVersion = "v11.0"
+
+// RESTVersionFor returns the highest known REST API version that a device
+// running sw can serve
+func RESTVersionFor(sw Version) (string, error) {
+	best := ""
+	for _, candidate := range RESTAPIVersions {
+		v, err := ParseVersion(strings.TrimPrefix(candidate, "v"))
+		if err != nil {
+			continue
+		}
+		if sw.AtLeast(v) {
+			best = candidate
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("PAN-OS %s does not support the REST API (9.0 or later required)", sw.Raw)
+	}
+	return best, nil
+}
@@ -0,0 +1,117 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import "testing"
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input string
+		want  Version
+		ok    bool
+	}{
+		{"10.1", Version{Major: 10, Minor: 1, Raw: "10.1"}, true},
+		{"10.2.4", Version{Major: 10, Minor: 2, Patch: 4, Raw: "10.2.4"}, true},
+		{"11.0.1-h3", Version{Major: 11, Minor: 0, Patch: 1, Raw: "11.0.1-h3"}, true},
+		{"9.1.16-c50", Version{Major: 9, Minor: 1, Patch: 16, Raw: "9.1.16-c50"}, true},
+		{" 10.2.9_h1 \n", Version{Major: 10, Minor: 2, Patch: 9, Raw: "10.2.9_h1"}, true},
+		{"11.1.2.5", Version{Major: 11, Minor: 1, Patch: 2, Raw: "11.1.2.5"}, true},
+		{"", Version{}, false},
+		{"garbage", Version{}, false},
+		{"10", Version{}, false},
+		{"10.x", Version{}, false},
+		{"10.", Version{}, false},
+		{"v10.1", Version{}, false},
+		{"-h3", Version{}, false},
+		{"10.1.x-h3", Version{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if (err == nil) != tt.ok {
+				t.Fatalf("ParseVersion(%q) error = %v, want ok=%v", tt.input, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("ParseVersion(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRESTVersionFor(t *testing.T) {
+	tests := []struct {
+		sw   string
+		want string
+		ok   bool
+	}{
+		{"10.1", "v10.1", true},
+		{"10.1.0", "v10.1", true},
+		{"10.0.99", "v10.0", true},
+		{"11.0.1-h3", "v11.0", true},
+		{"9.0.0", "v9.0", true},
+		{"11.2.4-h1", "v11.2", true},
+		// Releases newer than the engine knows use the newest known version
+		{"12.1.0", "v11.2", true},
+		{"8.1.25", "", false},
+		{"0.0", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.sw, func(t *testing.T) {
+			got, err := RESTVersionFor(MustParseVersion(tt.sw))
+			if (err == nil) != tt.ok {
+				t.Fatalf("RESTVersionFor(%s) error = %v, want ok=%v", tt.sw, err, tt.ok)
+			}
+			if got != tt.want {
+				t.Errorf("RESTVersionFor(%s) = %q, want %q", tt.sw, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"10.1", "10.1.0", 0},
+		{"10.1.0-h3", "10.1.0", 0},
+		{"10.1.1", "10.1.0", 1},
+		{"10.1.9", "10.2.0", -1},
+		{"11.0", "10.2.9", 1},
+		{"9.1.16", "10.0.0", -1},
+		{"10.10.0", "10.9.0", 1},
+	}
+
+	for _, tt := range tests {
+		a, b := MustParseVersion(tt.a), MustParseVersion(tt.b)
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := b.Compare(a); got != -tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+		if got := a.AtLeast(b); got != (tt.want >= 0) {
+			t.Errorf("%s.AtLeast(%s) = %v, want %v", tt.a, tt.b, got, tt.want >= 0)
+		}
+	}
+}
+
+func TestMustParseVersionPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("MustParseVersion did not panic on an invalid version")
+		}
+	}()
+	MustParseVersion("garbage")
+}
+
+func TestVersionString(t *testing.T) {
+	if got := MustParseVersion("11.0.1-h3").String(); got != "11.0.1" {
+		t.Errorf("String = %q, want 11.0.1", got)
+	}
+}
@@ -0,0 +1,361 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package panclient
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Node is a decoded XML element
+type Node struct {
+	Name     string
+	Attrs    []xml.Attr
+	Text     string
+	Children []*Node
+}
+
+// Attr returns the value of the named attribute, or "" if it is not set
+func (n *Node) Attr(name string) string {
+	for _, attr := range n.Attrs {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// Child returns the first direct child with the given name
+func (n *Node) Child(name string) *Node {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	return nil
+}
+
+// Find follows a slash separated path of element names from n
+func (n *Node) Find(path string) *Node {
+	current := n
+	for _, part := range strings.Split(strings.Trim(path, "/"), "/") {
+		if part == "" {
+			continue
+		}
+		if current = current.Child(part); current == nil {
+			return nil
+		}
+	}
+	return current
+}
+
+// DecodeXML parses an XML document into a Node tree
+func DecodeXML(r io.Reader) (*Node, error) {
+	decoder := newXMLDecoder(r)
+
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return nil, fmt.Errorf("error parsing XML: no root element")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %v", err)
+		}
+		if start, ok := tok.(xml.StartElement); ok {
+			root, err := decodeElement(decoder, start)
+			// An unterminated document still yields what was read
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return nil, fmt.Errorf("error parsing XML: %v", err)
+			}
+			return root, nil
+		}
+	}
+}
+
+// newXMLDecoder returns a decoder tolerant of the loose XML some PAN-OS
+// commands produce
+func newXMLDecoder(r io.Reader) *xml.Decoder {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	return decoder
+}
+
+// decodeElement reads the element opened by start, and everything inside
+// it, into a Node. It returns io.ErrUnexpectedEOF, with the partial node,
+// when the input ends first.
+func decodeElement(decoder *xml.Decoder, start xml.StartElement) (*Node, error) {
+	root := &Node{Name: start.Name.Local, Attrs: append([]xml.Attr(nil), start.Attr...)}
+	stack := []*Node{root}
+
+	for len(stack) > 0 {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			return root, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			node := &Node{Name: t.Name.Local, Attrs: append([]xml.Attr(nil), t.Attr...)}
+			parent := stack[len(stack)-1]
+			parent.Children = append(parent.Children, node)
+			stack = append(stack, node)
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		case xml.CharData:
+			stack[len(stack)-1].Text += string(t)
+		}
+	}
+
+	return root, nil
+}
+
+// listElements are always decoded as arrays, even with a single child,
+// so a one-entry list has the same shape as a hundred-entry list.
+var listElements = map[string]bool{
+	"entry":  true,
+	"member": true,
+}
+
+// ToValue converts the node into plain Go values:
+//   - elements with only text become strings
+//   - attributes such as name= become fields of the element's map
+//   - repeated children and <entry>/<member> lists become arrays
+func (n *Node) ToValue() interface{} {
+	text := strings.TrimSpace(n.Text)
+
+	if len(n.Children) == 0 && len(n.Attrs) == 0 {
+		return text
+	}
+
+	result := make(map[string]interface{}, len(n.Attrs)+len(n.Children))
+
+	// Group children by name, keeping first-seen order
+	var names []string
+	grouped := make(map[string][]interface{})
+	for _, child := range n.Children {
+		if _, seen := grouped[child.Name]; !seen {
+			names = append(names, child.Name)
+		}
+		grouped[child.Name] = append(grouped[child.Name], child.ToValue())
+	}
+
+	for _, name := range names {
+		values := grouped[name]
+		if len(values) == 1 && !listElements[name] {
+			result[name] = values[0]
+		} else {
+			result[name] = values
+		}
+	}
+
+	// Attributes become fields, unless a child element already uses the name
+	for _, attr := range n.Attrs {
+		key := attr.Name.Local
+		if _, exists := result[key]; exists {
+			key = "@" + key
+		}
+		result[key] = attr.Value
+	}
+
+	if text != "" {
+		if len(result) == 0 {
+			return text
+		}
+		result["#text"] = text
+	}
+
+	return result
+}
+
+// ParseXMLResponse decodes a <response> document from the /api endpoint
+func ParseXMLResponse(body []byte) (*XMLResponse, error) {
+	root, err := DecodeXML(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if root.Name != "response" {
+		return nil, fmt.Errorf("unexpected XML root element <%s>", root.Name)
+	}
+
+	resp := &XMLResponse{
+		Raw:    body,
+		Root:   root,
+		Status: root.Attr("status"),
+		Code:   root.Attr("code"),
+	}
+
+	if result := root.Child("result"); result != nil {
+		resp.Result = result.ToValue()
+	}
+
+	return resp, nil
+}
+
+// DefaultRowPath is the element of a <response> rows are read from
+const DefaultRowPath = "result"
+
+// Rows returns the result as a list of flat rows suitable for tabular export.
+// Every <entry> list in the result becomes a set of rows; when there is more
+// than one list, a "section" column records which list each row came from.
+// A result without entry lists becomes a single row.
+func (r *XMLResponse) Rows() []interface{} {
+	return r.RowsAt(DefaultRowPath)
+}
+
+// RowsAt is Rows for the element at a slash separated path below
+// <response>, for responses whose rows sit deeper than <result>
+func (r *XMLResponse) RowsAt(path string) []interface{} {
+	if r.Root == nil {
+		return []interface{}{}
+	}
+	if strings.Trim(path, "/") == "" {
+		path = DefaultRowPath
+	}
+	result := r.Root.Find(path)
+	if result == nil {
+		return []interface{}{}
+	}
+
+	lists := findEntryLists(result, "")
+	if len(lists) == 0 {
+		switch v := result.ToValue().(type) {
+		case map[string]interface{}:
+			// Unwrap a single wrapper element such as <system>
+			if len(v) == 1 {
+				for _, inner := range v {
+					if innerMap, ok := inner.(map[string]interface{}); ok {
+						v = innerMap
+					}
+				}
+			}
+			return []interface{}{FlattenRow(v)}
+		case string:
+			if v == "" {
+				return []interface{}{}
+			}
+			return []interface{}{map[string]interface{}{"output": v}}
+		}
+		return []interface{}{}
+	}
+
+	var rows []interface{}
+	for _, list := range lists {
+		for _, entry := range list.entries {
+			row := entryRow(entry)
+			if len(lists) > 1 {
+				row["section"] = list.section
+			}
+			rows = append(rows, row)
+		}
+	}
+
+	return rows
+}
+
+// entryRow flattens one <entry> into a row
+func entryRow(entry *Node) map[string]interface{} {
+	switch v := entry.ToValue().(type) {
+	case map[string]interface{}:
+		return FlattenRow(v)
+	case string:
+		return map[string]interface{}{"value": v}
+	}
+	return map[string]interface{}{}
+}
+
+// entryList is a run of <entry> elements found under one parent
+type entryList struct {
+	section string
+	entries []*Node
+}
+
+// findEntryLists collects the outermost <entry> lists below n
+func findEntryLists(n *Node, path string) []entryList {
+	var entries []*Node
+	var lists []entryList
+
+	for _, child := range n.Children {
+		if child.Name == "entry" {
+			entries = append(entries, child)
+		}
+	}
+	if len(entries) > 0 {
+		section := path
+		if section == "" {
+			section = n.Name
+		}
+		return []entryList{{section: section, entries: entries}}
+	}
+
+	for _, child := range n.Children {
+		childPath := child.Name
+		if path != "" {
+			childPath = path + "." + child.Name
+		}
+		lists = append(lists, findEntryLists(child, childPath)...)
+	}
+
+	return lists
+}
+
+// FlattenRow turns nested maps into dotted column names and joins
+// lists of plain values, so every cell in an exported table is a scalar.
+func FlattenRow(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	flattenInto(out, "", m)
+	return out
+}
+
+func flattenInto(out map[string]interface{}, prefix string, m map[string]interface{}) {
+	for key, value := range m {
+		name := key
+		if prefix != "" {
+			name = prefix + "." + key
+		}
+
+		switch v := value.(type) {
+		case map[string]interface{}:
+			// A single member/entry wrapper collapses into its parent column
+			if members, ok := v["member"].([]interface{}); ok && len(v) == 1 {
+				out[name] = joinScalars(members)
+				continue
+			}
+			flattenInto(out, name, v)
+		case []interface{}:
+			if allScalars(v) {
+				out[name] = joinScalars(v)
+			} else {
+				out[name] = v
+			}
+		default:
+			out[name] = v
+		}
+	}
+}
+
+func allScalars(values []interface{}) bool {
+	for _, v := range values {
+		switch v.(type) {
+		case map[string]interface{}, []interface{}:
+			return false
+		}
+	}
+	return true
+}
+
+func joinScalars(values []interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		parts = append(parts, fmt.Sprintf("%v", v))
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,243 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TargetAll runs a report on every connected managed firewall
+const TargetAll = "all"
+
+// Device identity columns added to every row of a proxied report
+const (
+	columnDeviceSerial   = "device_serial"
+	columnDeviceHostname = "device_hostname"
+)
+
+// maxPanoramaTargets caps how many managed firewalls are queried at once
+const maxPanoramaTargets = 4
+
+// requirePanorama fails unless the connected device is a Panorama
+func (a *App) requirePanorama() error {
+	if a.deviceInfo == nil {
+		client, err := a.apiClient()
+		if err != nil {
+			return err
+		}
+		info, err := client.SystemInfo(a.requestContext())
+		if err != nil {
+			a.handleAuthFailure(err)
+			return operatorError(err)
+		}
+		if err := a.setDeviceInfo(info); err != nil {
+			return err
+		}
+	}
+
+	if !a.deviceInfo.IsPanorama() {
+		return fmt.Errorf("the connected device (%s) is not a Panorama", a.deviceInfo.Model)
+	}
+	return nil
+}
+
+// GetManagedDevices lists the firewalls connected to Panorama
+func (a *App) GetManagedDevices() ([]map[string]interface{}, error) {
+	if err := a.requirePanorama(); err != nil {
+		return nil, err
+	}
+
+	client, err := a.apiClient()
+	if err != nil {
+		return nil, err
+	}
+
+	devices, err := client.ConnectedDevices(a.requestContext())
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, operatorError(err)
+	}
+
+	result := make([]map[string]interface{}, 0, len(devices))
+	for _, d := range devices {
+		result = append(result, map[string]interface{}{
+			"serial":       d.Serial,
+			"hostname":     d.Hostname,
+			"ip_address":   d.IPAddress,
+			"model":        d.Model,
+			"sw_version":   d.SWVersion,
+			"device_group": d.DeviceGroup,
+			"connected":    d.Connected,
+		})
+	}
+
+	return result, nil
+}
+
+// fetchTargetedReport runs a report on one managed firewall, or on every
+// connected one for TargetAll, and tags each row with the device identity.
+// A firewall that fails does not sink the whole run: the status of every
+// firewall is returned alongside the rows, in the form RunFleetReport
+// reports devices. It only fails when no firewall succeeded.
+func (a *App) fetchTargetedReport(ctx context.Context, client *panclient.Client, target, endpoint string, report catalog.Report, logType, query string, limit int) (*rowSet, []map[string]interface{}, error) {
+	if isRESTEndpoint(endpoint) {
+		return nil, nil, fmt.Errorf("REST reports cannot be proxied through Panorama; connect to the firewall directly")
+	}
+	if err := a.requirePanorama(); err != nil {
+		return nil, nil, err
+	}
+
+	devices, err := client.ConnectedDevices(ctx)
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, nil, err
+	}
+
+	// Pick the devices to query
+	var targets []panclient.ManagedDevice
+	for _, d := range devices {
+		if !d.Connected {
+			continue
+		}
+		if target == TargetAll || d.Serial == target {
+			targets = append(targets, d)
+		}
+	}
+	if len(targets) == 0 {
+		if target == TargetAll {
+			return nil, nil, fmt.Errorf("no managed firewalls are connected to Panorama")
+		}
+		return nil, nil, fmt.Errorf("managed firewall %s is not connected to Panorama", target)
+	}
+
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		lastErr   error
+		succeeded int
+	)
+	rows := a.newRowSet()
+	statuses := make([]map[string]interface{}, len(targets))
+	semaphore := make(chan struct{}, maxPanoramaTargets)
+
+	for i, device := range targets {
+		wg.Add(1)
+		go func(i int, d panclient.ManagedDevice) {
+			defer wg.Done()
+
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			start := time.Now()
+			data, err := a.fetchReport(ctx, client.WithTarget(d.Serial), endpoint, report, logType, query, limit)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			count := 0
+			if err == nil {
+				count, err = tagRows(rows, data, map[string]interface{}{
+					columnDeviceSerial:   d.Serial,
+					columnDeviceHostname: d.Hostname,
+				})
+			}
+
+			status := map[string]interface{}{
+				"serial":      d.Serial,
+				"hostname":    d.Hostname,
+				"duration_ms": time.Since(start).Milliseconds(),
+			}
+			if err != nil {
+				utils.ErrorLogger.Printf("Report on %s (%s) failed: %v", d.Hostname, d.Serial, err)
+				for k, v := range apiErrorDetails(err) {
+					status[k] = v
+				}
+				status["success"] = false
+				lastErr = err
+			} else {
+				status["success"] = true
+				status["rows"] = count
+				succeeded++
+			}
+			statuses[i] = status
+		}(i, device)
+	}
+	wg.Wait()
+
+	if succeeded == 0 {
+		rows.close()
+		return nil, nil, lastErr
+	}
+	return rows, statuses, nil
+}
+
+// targetedReportView is what GenerateReport returns for a Panorama target:
+// the rows as reportView gives them, with how each firewall fared in the
+// shape of a fleet result
+func targetedReportView(reportType string, data interface{}, devices []map[string]interface{}) map[string]interface{} {
+	succeeded := 0
+	for _, d := range devices {
+		if d["success"] == true {
+			succeeded++
+		}
+	}
+	rows := 0
+	if set, ok := data.(*rowSet); ok {
+		rows = set.len()
+	}
+
+	return map[string]interface{}{
+		"result":  reportView(data),
+		"devices": devices,
+		"_summary": map[string]interface{}{
+			"report_type": reportType,
+			"total":       len(devices),
+			"successful":  succeeded,
+			"failed":      len(devices) - succeeded,
+			"rows":        rows,
+			"timestamp":   time.Now().Format(time.RFC3339),
+		},
+	}
+}
+
+// tagRows copies the rows of fetched report data into dst, adding the tag
+// columns to each, and returns how many rows were copied. Rows are streamed,
+// so a spilled report is never loaded whole, and a fetched row set is closed
+// once copied. The caller serializes writes to dst.
+func tagRows(dst *rowSet, data interface{}, tags map[string]interface{}) (int, error) {
+	count := 0
+	tag := func(row map[string]interface{}) error {
+		out := make(map[string]interface{}, len(row)+len(tags))
+		for k, v := range row {
+			out[k] = v
+		}
+		for k, v := range tags {
+			out[k] = v
+		}
+		count++
+		return dst.add(out, "")
+	}
+
+	if rows, ok := data.(*rowSet); ok {
+		defer rows.close()
+		err := rows.each(tag)
+		return count, err
+	}
+
+	var err error
+	eachReportRow(data, func(row map[string]interface{}) {
+		if err == nil {
+			err = tag(row)
+		}
+	})
+	return count, err
+}
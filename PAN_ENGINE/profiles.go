@@ -0,0 +1,643 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultProfileName holds the connection saved before profiles existed
+const DefaultProfileName = "default"
+
+// ConnectionProfile is a named device connection such as lab, prod or a
+// tenant firewall
+type ConnectionProfile struct {
+	Name   string `json:"name"`
+	APIURL string `json:"api_url"`
+	// KeyRef is the ID of the API key in the secret store
+	KeyRef string `json:"key_ref,omitempty"`
+	// EncryptedKey is only read from settings files written before the
+	// secret store existed, and is cleared once the key is migrated
+	EncryptedKey string `json:"encrypted_key,omitempty"`
+	// Key describes the saved key without revealing it
+	Key          KeyInfo           `json:"key_info"`
+	TLS          ProfileTLS        `json:"tls"`
+	Proxy        ProfileProxy      `json:"proxy"`
+	Limits       ProfileLimits     `json:"limits"`
+	DefaultScope map[string]string `json:"default_scope,omitempty"`
+	Tags         []string          `json:"tags,omitempty"`
+	CreatedAt    time.Time         `json:"created_at"`
+}
+
+// ProfileTLS holds the TLS settings used to reach a profile's device
+type ProfileTLS struct {
+	// CABundle is a PEM file of CAs trusted in addition to the system pool
+	CABundle string `json:"ca_bundle,omitempty"`
+	// PinnedSHA256 are SHA-256 fingerprints of the device certificate. A
+	// matching certificate is trusted without a CA bundle, so self-signed
+	// management certificates can be verified; with a CA bundle both apply.
+	PinnedSHA256 []string `json:"pinned_sha256,omitempty"`
+	// ClientCert and ClientKey are PEM files for mutual TLS
+	ClientCert string `json:"client_cert,omitempty"`
+	ClientKey  string `json:"client_key,omitempty"`
+	// MinVersion is the lowest TLS version accepted, e.g. "1.2"
+	MinVersion string `json:"min_version,omitempty"`
+	// InsecureSkipVerify turns off certificate verification altogether
+	InsecureSkipVerify bool `json:"insecure_skip_verify,omitempty"`
+}
+
+// scopeOptionKeys are the GenerateReport options a profile can default
+var scopeOptionKeys = []string{"location", "vsys", "device-group", "template", "template-stack"}
+
+// findProfile returns the index of a profile by name, or -1
+func (a *App) findProfile(name string) int {
+	for i, p := range a.profiles {
+		if strings.EqualFold(p.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// currentProfile returns the active profile, or nil when none is configured
+func (a *App) currentProfile() *ConnectionProfile {
+	if i := a.findProfile(a.activeProfile); i >= 0 {
+		return &a.profiles[i]
+	}
+	return nil
+}
+
+// activeProfileName returns the name recorded with reports and exports
+func (a *App) activeProfileName() string {
+	if p := a.currentProfile(); p != nil {
+		return p.Name
+	}
+	return DefaultProfileName
+}
+
+// loadProfiles applies the profiles from a settings file, turning the
+// single URL and key of older settings files into the default profile
+func (a *App) loadProfiles(settings Settings) {
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+
+	a.profiles = settings.Profiles
+	a.activeProfile = settings.ActiveProfile
+
+	if len(a.profiles) == 0 && settings.APIURL != "" {
+		utils.InfoLogger.Printf("Migrating saved API settings to the %q profile", DefaultProfileName)
+		a.profiles = []ConnectionProfile{{
+			Name:         DefaultProfileName,
+			APIURL:       settings.APIURL,
+			EncryptedKey: settings.EncryptedKey,
+			CreatedAt:    time.Now(),
+		}}
+		a.activeProfile = DefaultProfileName
+	}
+
+	p := a.currentProfile()
+	if p == nil {
+		if len(a.profiles) == 0 {
+			return
+		}
+		p = &a.profiles[0]
+		a.activeProfile = p.Name
+	}
+
+	a.apiURL = p.APIURL
+	a.apiKey = ""
+	// A locked vault is reported to the frontend once the settings are loaded
+	if key, err := a.profileKey(p); err == nil {
+		a.apiKey = key
+		// Keys saved before fingerprints were recorded
+		if key != "" && p.Key.Fingerprint == "" {
+			p.Key.Fingerprint = keyFingerprint(key)
+		}
+	} else if !errors.Is(err, secretstore.ErrLocked) {
+		utils.ErrorLogger.Printf("Could not read the key of profile %s: %v", p.Name, err)
+	}
+}
+
+// storeActiveProfile writes the current URL into the active profile,
+// creating the default profile on first save, and returns the profile
+func (a *App) storeActiveProfile() *ConnectionProfile {
+	a.profilesMu.Lock()
+	defer a.profilesMu.Unlock()
+
+	p := a.currentProfile()
+	if p == nil {
+		name := a.activeProfile
+		if name == "" {
+			name = DefaultProfileName
+		}
+		a.profiles = append(a.profiles, ConnectionProfile{Name: name, CreatedAt: time.Now()})
+		a.activeProfile = name
+		p = &a.profiles[len(a.profiles)-1]
+	}
+
+	p.APIURL = a.apiURL
+	return p
+}
+
+// resetConnection forgets the client and everything learned about the
+// device, so the next call connects with the current settings
+func (a *App) resetConnection() {
+	a.resetClient()
+	a.deviceInfo = nil
+	a.deviceVersion = nil
+	a.restAPIVersion = ""
+	a.deviceLocation = nil
+	a.apiStatus = "unknown"
+	a.lastAPICheck = time.Time{}
+}
+
+// clientOptions returns the panclient options for the active profile
+func (a *App) clientOptions() ([]panclient.Option, error) {
+	return a.profileClientOptions(a.currentProfile())
+}
+
+// profileClientOptions returns the panclient options for a profile, which
+// may be nil for a connection saved outside any profile
+func (a *App) profileClientOptions(p *ConnectionProfile) ([]panclient.Option, error) {
+	opts, err := a.pendingClientOptions(p, nil)
+	if err != nil || p == nil {
+		return opts, err
+	}
+	return append(opts, limitOptions(p.Limits)...), nil
+}
+
+// pendingClientOptions returns the connection options of a profile, with the
+// proxy secrets in pending used ahead of the stored ones. The profile's
+// limits are left out: they apply to every client of the device.
+func (a *App) pendingClientOptions(p *ConnectionProfile, pending map[string]string) ([]panclient.Option, error) {
+	opts := []panclient.Option{
+		panclient.WithLogger(utils.InfoLogger),
+		panclient.WithMaxResponseSize(a.maxResponseSize()),
+	}
+	if p == nil {
+		return opts, nil
+	}
+
+	cfg, err := profileTLSConfig(p.TLS)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+	if cfg != nil {
+		opts = append(opts, panclient.WithTLSConfig(cfg))
+	}
+	if p.TLS.InsecureSkipVerify && len(p.TLS.PinnedSHA256) == 0 {
+		utils.ErrorLogger.Printf("WARNING: TLS certificate verification is DISABLED for profile %s (%s). "+
+			"Any server can impersonate this device; pin its certificate or add a CA bundle instead.", p.Name, p.APIURL)
+	}
+
+	proxyOpts, err := a.profileProxyOptions(p, pending)
+	if err != nil {
+		return nil, fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+	return append(opts, proxyOpts...), nil
+}
+
+// checkProfile builds a client from a profile's settings without connecting,
+// so a bad URL or bad certificate, key or proxy settings are rejected when
+// saved. The proxy secrets in settings are checked before they are stored,
+// and the limits are checked without touching the ones in use for the device.
+func (a *App) checkProfile(p *ConnectionProfile, settings map[string]string) error {
+	if err := checkLimits(p.Limits); err != nil {
+		return fmt.Errorf("profile %s: %v", p.Name, err)
+	}
+	opts, err := a.pendingClientOptions(p, settings)
+	if err != nil {
+		return err
+	}
+	client, err := panclient.New(p.APIURL, "", opts...)
+	if err != nil {
+		return err
+	}
+	return client.Close()
+}
+
+// profileTLSConfig builds the TLS configuration for a profile, or nil to use
+// the system defaults
+func profileTLSConfig(settings ProfileTLS) (*tls.Config, error) {
+	if settings.CABundle == "" && len(settings.PinnedSHA256) == 0 && settings.ClientCert == "" &&
+		settings.MinVersion == "" && !settings.InsecureSkipVerify {
+		return nil, nil
+	}
+
+	cfg := &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+
+	if settings.CABundle != "" {
+		pem, err := ioutil.ReadFile(settings.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %v", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("CA bundle %s contains no PEM certificates", settings.CABundle)
+		}
+		cfg.RootCAs = pool
+	}
+
+	// A pin stands in for the CA chain unless a CA bundle was given too
+	if len(settings.PinnedSHA256) > 0 {
+		verify, err := panclient.VerifyPins(settings.PinnedSHA256)
+		if err != nil {
+			return nil, err
+		}
+		cfg.VerifyConnection = verify
+		if settings.CABundle == "" {
+			cfg.InsecureSkipVerify = true
+		}
+	}
+
+	if settings.ClientCert != "" || settings.ClientKey != "" {
+		if settings.ClientCert == "" || settings.ClientKey == "" {
+			return nil, fmt.Errorf("client certificate and key must be set together")
+		}
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.MinVersion != "" {
+		version, err := panclient.ParseTLSVersion(settings.MinVersion)
+		if err != nil {
+			return nil, err
+		}
+		cfg.MinVersion = version
+	}
+
+	return cfg, nil
+}
+
+// applyProfileSettings copies TLS, scope and tag settings from a binding's
+// settings map onto a profile. Only keys present in the map are changed.
+func applyProfileSettings(p *ConnectionProfile, settings map[string]string) {
+	if v, ok := settings["ca_bundle"]; ok {
+		p.TLS.CABundle = strings.TrimSpace(v)
+	}
+	if v, ok := settings["pinned_sha256"]; ok {
+		p.TLS.PinnedSHA256 = nil
+		for _, pin := range strings.Split(v, ",") {
+			if pin = strings.TrimSpace(pin); pin != "" {
+				p.TLS.PinnedSHA256 = append(p.TLS.PinnedSHA256, pin)
+			}
+		}
+	}
+	if v, ok := settings["client_cert"]; ok {
+		p.TLS.ClientCert = strings.TrimSpace(v)
+	}
+	if v, ok := settings["client_key"]; ok {
+		p.TLS.ClientKey = strings.TrimSpace(v)
+	}
+	if v, ok := settings["min_tls_version"]; ok {
+		p.TLS.MinVersion = strings.TrimSpace(v)
+	}
+	if v, ok := settings["insecure_skip_verify"]; ok {
+		p.TLS.InsecureSkipVerify = v == "true"
+	}
+	if v, ok := settings["tags"]; ok {
+		p.Tags = splitTags(v)
+	}
+	applyProxySettings(p, settings)
+
+	for _, key := range scopeOptionKeys {
+		v, ok := settings[key]
+		if !ok {
+			continue
+		}
+		if p.DefaultScope == nil {
+			p.DefaultScope = make(map[string]string)
+		}
+		if v = strings.TrimSpace(v); v == "" {
+			delete(p.DefaultScope, key)
+		} else {
+			p.DefaultScope[key] = v
+		}
+	}
+}
+
+// splitTags parses a comma separated tag list, dropping blanks and duplicates
+func splitTags(value string) []string {
+	seen := make(map[string]bool)
+	var tags []string
+	for _, tag := range strings.Split(value, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[strings.ToLower(tag)] {
+			continue
+		}
+		seen[strings.ToLower(tag)] = true
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// withDefaultScope fills in the active profile's default scope for any
+// scope option the caller left empty
+func (a *App) withDefaultScope(options map[string]string) map[string]string {
+	return profileScope(a.currentProfile(), options)
+}
+
+// profileScope fills in a profile's default scope for any scope option the
+// caller left empty
+func profileScope(p *ConnectionProfile, options map[string]string) map[string]string {
+	if p == nil || len(p.DefaultScope) == 0 || strings.TrimSpace(options["location"]) != "" {
+		return options
+	}
+
+	merged := make(map[string]string, len(options)+len(p.DefaultScope))
+	for k, v := range options {
+		merged[k] = v
+	}
+	for k, v := range p.DefaultScope {
+		if strings.TrimSpace(merged[k]) == "" {
+			merged[k] = v
+		}
+	}
+	return merged
+}
+
+// profileSummary describes a profile for the frontend without its key
+func (a *App) profileSummary(p ConnectionProfile) map[string]interface{} {
+	scope := make(map[string]string, len(p.DefaultScope))
+	for k, v := range p.DefaultScope {
+		scope[k] = v
+	}
+	tags := p.Tags
+	if tags == nil {
+		tags = []string{}
+	}
+	pins := p.TLS.PinnedSHA256
+	if pins == nil {
+		pins = []string{}
+	}
+
+	summary := map[string]interface{}{
+		"name":                 p.Name,
+		"url":                  p.APIURL,
+		"ca_bundle":            p.TLS.CABundle,
+		"pinned_sha256":        pins,
+		"client_cert":          p.TLS.ClientCert,
+		"client_key":           p.TLS.ClientKey,
+		"min_tls_version":      p.TLS.MinVersion,
+		"insecure_skip_verify": p.TLS.InsecureSkipVerify,
+		"default_scope":        scope,
+		"tags":                 tags,
+		"created_at":           p.CreatedAt.Format(time.RFC3339),
+		"active":               strings.EqualFold(p.Name, a.activeProfile),
+	}
+	for k, v := range a.keyStatus(&p) {
+		summary[k] = v
+	}
+	for k, v := range proxySummary(p) {
+		summary[k] = v
+	}
+	for k, v := range limitsSummary(p.Limits) {
+		summary[k] = v
+	}
+	return summary
+}
+
+// ListProfiles returns every saved connection profile. Keys are never returned.
+func (a *App) ListProfiles() []map[string]interface{} {
+	profiles := make([]map[string]interface{}, 0, len(a.profiles))
+	for _, p := range a.profiles {
+		profiles = append(profiles, a.profileSummary(p))
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i]["name"].(string) < profiles[j]["name"].(string)
+	})
+	return profiles
+}
+
+// CreateProfile saves a new connection profile. Settings may carry
+// ca_bundle, pinned_sha256 (comma separated fingerprints), client_cert,
+// client_key, min_tls_version, insecure_skip_verify ("true"), tags (comma
+// separated), the default scope options location, vsys, device-group,
+// template and template-stack, and either a proxy (proxy_url,
+// proxy_username, proxy_password) or an SSH jump host (jump_host,
+// jump_user, jump_key_file, jump_key_passphrase, jump_host_key_sha256,
+// jump_known_hosts). Request limits for the device are set with
+// rate_limit (requests per second), rate_burst, max_concurrent and
+// max_attempts. The first profile created becomes the active one.
+func (a *App) CreateProfile(name, url, key string, settings map[string]string) (bool, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || strings.TrimSpace(url) == "" {
+		return false, fmt.Errorf("profile name and URL are required")
+	}
+	if a.findProfile(name) >= 0 {
+		return false, fmt.Errorf("profile %s already exists", name)
+	}
+
+	profile := ConnectionProfile{
+		Name:      name,
+		APIURL:    strings.TrimSpace(url),
+		CreatedAt: time.Now(),
+	}
+	applyProfileSettings(&profile, settings)
+	if err := applyLimitSettings(&profile, settings); err != nil {
+		return false, err
+	}
+
+	// Secrets are only stored once the settings are known to be usable
+	if err := a.checkProfile(&profile, settings); err != nil {
+		return false, err
+	}
+	if err := a.applyProxySecrets(&profile, settings); err != nil {
+		a.deleteProfileSecrets(profile)
+		return false, err
+	}
+	if err := a.setProfileKey(&profile, key); err != nil {
+		a.deleteProfileSecrets(profile)
+		return false, err
+	}
+
+	a.profilesMu.Lock()
+	a.profiles = append(a.profiles, profile)
+	if a.currentProfile() == nil {
+		a.activeProfile = profile.Name
+		a.apiURL = profile.APIURL
+		a.apiKey = key
+		a.resetConnection()
+	}
+	a.profilesMu.Unlock()
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Profile %s created: URL=%s", profile.Name, profile.APIURL)
+	return true, nil
+}
+
+// UpdateProfile changes the TLS, proxy, limit, scope and tag settings of a
+// profile.
+// Settings take the keys of CreateProfile; keys not present are unchanged.
+func (a *App) UpdateProfile(name string, settings map[string]string) (bool, error) {
+	i := a.findProfile(name)
+	if i < 0 {
+		return false, fmt.Errorf("profile %s does not exist", name)
+	}
+
+	updated := a.profiles[i]
+	updated.TLS.PinnedSHA256 = append([]string(nil), updated.TLS.PinnedSHA256...)
+	scope := make(map[string]string, len(updated.DefaultScope))
+	for k, v := range updated.DefaultScope {
+		scope[k] = v
+	}
+	updated.DefaultScope = scope
+	applyProfileSettings(&updated, settings)
+	if err := applyLimitSettings(&updated, settings); err != nil {
+		return false, err
+	}
+
+	// Secrets are only stored once the settings are known to be usable
+	if err := a.checkProfile(&updated, settings); err != nil {
+		return false, err
+	}
+	if err := a.applyProxySecrets(&updated, settings); err != nil {
+		return false, err
+	}
+	a.profilesMu.Lock()
+	a.profiles[i] = updated
+	a.profilesMu.Unlock()
+
+	// The shared client has to pick up the new TLS settings
+	if strings.EqualFold(updated.Name, a.activeProfile) {
+		a.resetConnection()
+	}
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Profile %s updated", updated.Name)
+	return true, nil
+}
+
+// SwitchProfile makes a saved profile the active connection
+func (a *App) SwitchProfile(name string) (bool, error) {
+	i := a.findProfile(name)
+	if i < 0 {
+		return false, fmt.Errorf("profile %s does not exist", name)
+	}
+	if _, err := profileTLSConfig(a.profiles[i].TLS); err != nil {
+		return false, fmt.Errorf("profile %s: %v", a.profiles[i].Name, err)
+	}
+
+	a.loadProfiles(Settings{Profiles: a.profiles, ActiveProfile: a.profiles[i].Name})
+	a.resetConnection()
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Switched to profile %s: URL=%s", a.activeProfile, a.apiURL)
+	return true, nil
+}
+
+// CloneProfile copies a profile, key included, under a new name
+func (a *App) CloneProfile(source, name string) (bool, error) {
+	i := a.findProfile(source)
+	if i < 0 {
+		return false, fmt.Errorf("profile %s does not exist", source)
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return false, fmt.Errorf("profile name is required")
+	}
+	if a.findProfile(name) >= 0 {
+		return false, fmt.Errorf("profile %s already exists", name)
+	}
+
+	// The clone gets its own copy of the key so either can be rotated alone
+	key, err := a.profileKey(&a.profiles[i])
+	if err != nil {
+		return false, err
+	}
+
+	clone := a.profiles[i]
+	clone.Name = name
+	clone.CreatedAt = time.Now()
+	clone.KeyRef = ""
+	clone.EncryptedKey = ""
+	if err := a.setProfileKey(&clone, key); err != nil {
+		return false, err
+	}
+	if err := a.copyProfileSecrets(&clone); err != nil {
+		return false, err
+	}
+	clone.Tags = append([]string(nil), clone.Tags...)
+	clone.DefaultScope = make(map[string]string, len(a.profiles[i].DefaultScope))
+	for k, v := range a.profiles[i].DefaultScope {
+		clone.DefaultScope[k] = v
+	}
+
+	a.profilesMu.Lock()
+	a.profiles = append(a.profiles, clone)
+	a.profilesMu.Unlock()
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Profile %s cloned to %s", source, name)
+	return true, nil
+}
+
+// DeleteProfile removes a saved profile. Deleting the active profile
+// switches to the next remaining one, or clears the connection.
+func (a *App) DeleteProfile(name string) (bool, error) {
+	i := a.findProfile(name)
+	if i < 0 {
+		return false, fmt.Errorf("profile %s does not exist", name)
+	}
+
+	wasActive := strings.EqualFold(a.profiles[i].Name, a.activeProfile)
+	a.deleteProfileSecrets(a.profiles[i])
+	a.profilesMu.Lock()
+	a.profiles = append(a.profiles[:i], a.profiles[i+1:]...)
+	if wasActive {
+		a.activeProfile = ""
+	}
+	a.profilesMu.Unlock()
+
+	if wasActive {
+		a.apiURL = ""
+		a.apiKey = ""
+		if len(a.profiles) > 0 {
+			a.loadProfiles(Settings{Profiles: a.profiles})
+		}
+		a.resetConnection()
+	}
+
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	utils.InfoLogger.Printf("Profile %s deleted", name)
+	return true, nil
+}
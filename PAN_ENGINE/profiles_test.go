@@ -0,0 +1,271 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/secretstore"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// memoryStore is a secret store kept in memory
+type memoryStore struct {
+	mu      sync.Mutex
+	secrets map[string]string
+}
+
+func (m *memoryStore) Name() string { return "memory" }
+
+func (m *memoryStore) Get(id string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	secret, ok := m.secrets[id]
+	if !ok {
+		return "", secretstore.ErrNotFound
+	}
+	return secret, nil
+}
+
+func (m *memoryStore) Set(id, secret string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.secrets[id] = secret
+	return nil
+}
+
+func (m *memoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.secrets, id)
+	return nil
+}
+
+// profileTestApp returns an app saving its settings in a temporary
+// directory and its secrets in memory
+func profileTestApp(t *testing.T) (*App, *memoryStore) {
+	t.Helper()
+	store := &memoryStore{secrets: map[string]string{}}
+	a := NewApp()
+	a.settingsPath = filepath.Join(t.TempDir(), "settings.json")
+	a.secrets = store
+	return a, store
+}
+
+// writeJumpKey writes an SSH private key encrypted with passphrase
+func writeJumpKey(t *testing.T, passphrase string) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	block, err := ssh.MarshalPrivateKeyWithPassphrase(key, "", []byte(passphrase))
+	if err != nil {
+		t.Fatalf("MarshalPrivateKeyWithPassphrase failed: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(path, pem.EncodeToMemory(block), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func jumpSettings(keyFile, passphrase string) map[string]string {
+	return map[string]string{
+		"jump_host":            "bastion.example.com",
+		"jump_user":            "admin",
+		"jump_key_file":        keyFile,
+		"jump_key_passphrase":  passphrase,
+		"jump_host_key_sha256": "SHA256:AAAA",
+	}
+}
+
+func TestCreateProfileChecksBeforeStoringSecrets(t *testing.T) {
+	keyFile := writeJumpKey(t, "correct")
+
+	tests := []struct {
+		name     string
+		settings map[string]string
+	}{
+		{"wrong passphrase", jumpSettings(keyFile, "wrong")},
+		{"missing key file", jumpSettings(filepath.Join(t.TempDir(), "missing"), "correct")},
+		{"proxy and jump host", map[string]string{
+			"proxy_url": "http://proxy.example.com:3128", "proxy_username": "user", "proxy_password": "secret",
+			"jump_host": "bastion.example.com",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, store := profileTestApp(t)
+			if _, err := a.CreateProfile("fw1", "https://fw1.example.com", "key", tt.settings); err == nil {
+				t.Fatal("CreateProfile succeeded, want an error")
+			}
+			if len(store.secrets) != 0 {
+				t.Errorf("rejected profile left %d secrets in the store", len(store.secrets))
+			}
+			if len(a.profiles) != 0 {
+				t.Errorf("rejected profile was added")
+			}
+		})
+	}
+}
+
+func TestCreateProfileUsesGivenPassphrase(t *testing.T) {
+	a, store := profileTestApp(t)
+	keyFile := writeJumpKey(t, "correct")
+
+	if _, err := a.CreateProfile("fw1", "https://fw1.example.com", "key", jumpSettings(keyFile, "correct")); err != nil {
+		t.Fatalf("CreateProfile failed: %v", err)
+	}
+	ref := a.profiles[0].Proxy.JumpKeyPassphraseRef
+	if got := store.secrets[ref]; got != "correct" {
+		t.Errorf("stored passphrase %q, want correct", got)
+	}
+}
+
+func TestUpdateProfileKeepsSecretsOnError(t *testing.T) {
+	a, store := profileTestApp(t)
+	keyFile := writeJumpKey(t, "correct")
+
+	if _, err := a.CreateProfile("fw1", "https://fw1.example.com", "key", jumpSettings(keyFile, "correct")); err != nil {
+		t.Fatalf("CreateProfile failed: %v", err)
+	}
+	ref := a.profiles[0].Proxy.JumpKeyPassphraseRef
+
+	if _, err := a.UpdateProfile("fw1", map[string]string{"jump_key_passphrase": "wrong"}); err == nil {
+		t.Fatal("UpdateProfile accepted a wrong passphrase")
+	}
+	if got := store.secrets[ref]; got != "correct" {
+		t.Errorf("rejected update changed the stored passphrase to %q", got)
+	}
+
+	// The stored passphrase still unlocks the key when none is given
+	if _, err := a.UpdateProfile("fw1", map[string]string{"jump_user": "operator"}); err != nil {
+		t.Errorf("UpdateProfile failed: %v", err)
+	}
+}
+
+func TestCheckProfileLeavesDeviceLimits(t *testing.T) {
+	// Requests wait for each other, so a cap of one shows as a peak of one
+	var inFlight, peak int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		defer atomic.AddInt32(&inFlight, -1)
+		for deadline := time.Now().Add(500 * time.Millisecond); atomic.LoadInt32(&inFlight) < 2 && time.Now().Before(deadline); {
+			time.Sleep(5 * time.Millisecond)
+		}
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		fmt.Fprint(w, `<response status="success"><result/></response>`)
+	}))
+	defer server.Close()
+
+	client, err := panclient.New(server.URL, "key",
+		panclient.WithRateLimit(panclient.RateLimit{RequestsPerSecond: 100, Burst: 10, MaxConcurrent: 2}))
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	defer client.Close()
+
+	a, _ := profileTestApp(t)
+	p := &ConnectionProfile{Name: "fw1", APIURL: server.URL, Limits: ProfileLimits{MaxConcurrent: 1}}
+	if err := a.checkProfile(p, nil); err != nil {
+		t.Fatalf("checkProfile failed: %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.Op(context.Background(), "<show><clock></clock></show>"); err != nil {
+				t.Errorf("Op failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(&peak); got != 2 {
+		t.Errorf("%d requests in flight after checkProfile, want the device's cap of 2", got)
+	}
+}
+
+func TestKeyRotationCheckWhileProfilesChange(t *testing.T) {
+	a, _ := profileTestApp(t)
+
+	// The watcher checks keys in the background while the bindings run
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				a.checkKeyRotation()
+			}
+		}
+	}()
+
+	for i := 0; i < 20; i++ {
+		name := fmt.Sprintf("fw%d", i)
+		if _, err := a.CreateProfile(name, "https://"+name+".example.com", "key-"+name, nil); err != nil {
+			t.Fatalf("CreateProfile failed: %v", err)
+		}
+		if _, err := a.UpdateProfile(name, map[string]string{"rate_limit": "5"}); err != nil {
+			t.Fatalf("UpdateProfile failed: %v", err)
+		}
+		if _, err := a.SwitchProfile(name); err != nil {
+			t.Fatalf("SwitchProfile failed: %v", err)
+		}
+		if _, err := a.SetKeyRotationPolicy(90, 14); err != nil {
+			t.Fatalf("SetKeyRotationPolicy failed: %v", err)
+		}
+		if i%2 == 1 {
+			if _, err := a.DeleteProfile(name); err != nil {
+				t.Fatalf("DeleteProfile failed: %v", err)
+			}
+		}
+	}
+	close(done)
+	wg.Wait()
+
+	if len(a.profiles) != 10 {
+		t.Errorf("%d profiles left, want 10", len(a.profiles))
+	}
+}
+
+func TestCreateProfileRejectsBadURL(t *testing.T) {
+	for _, url := range []string{"fw1.example.com", "ftp://fw1.example.com", "https://"} {
+		a, store := profileTestApp(t)
+		if _, err := a.CreateProfile("fw1", url, "key", nil); err == nil {
+			t.Errorf("CreateProfile accepted %q", url)
+		}
+		if len(a.profiles) != 0 || len(store.secrets) != 0 {
+			t.Errorf("rejected URL %q left a profile or secrets behind", url)
+		}
+	}
+}
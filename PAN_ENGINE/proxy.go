@@ -0,0 +1,154 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ProfileProxy routes a profile's API traffic through an outbound proxy or
+// an SSH jump host, for management interfaces only reachable that way
+type ProfileProxy struct {
+	// URL is an http://, https:// (CONNECT), socks5:// or socks5h:// proxy
+	URL      string `json:"url,omitempty"`
+	Username string `json:"username,omitempty"`
+	// PasswordRef is the ID of the proxy password in the secret store
+	PasswordRef string `json:"password_ref,omitempty"`
+
+	// JumpHost is host[:port] of an SSH bastion, logged into as JumpUser
+	// with the private key in JumpKeyFile
+	JumpHost    string `json:"jump_host,omitempty"`
+	JumpUser    string `json:"jump_user,omitempty"`
+	JumpKeyFile string `json:"jump_key_file,omitempty"`
+	// JumpKeyPassphraseRef is the ID of the key passphrase in the secret store
+	JumpKeyPassphraseRef string `json:"jump_key_passphrase_ref,omitempty"`
+	// The bastion's host key is checked against JumpHostKeySHA256, or else
+	// the JumpKnownHosts file (~/.ssh/known_hosts by default)
+	JumpHostKeySHA256 string `json:"jump_host_key_sha256,omitempty"`
+	JumpKnownHosts    string `json:"jump_known_hosts,omitempty"`
+}
+
+// proxySettingKeys map the plain proxy settings of CreateProfile and
+// UpdateProfile to their profile fields
+var proxySettingKeys = map[string]func(p *ProfileProxy) *string{
+	"proxy_url":            func(p *ProfileProxy) *string { return &p.URL },
+	"proxy_username":       func(p *ProfileProxy) *string { return &p.Username },
+	"jump_host":            func(p *ProfileProxy) *string { return &p.JumpHost },
+	"jump_user":            func(p *ProfileProxy) *string { return &p.JumpUser },
+	"jump_key_file":        func(p *ProfileProxy) *string { return &p.JumpKeyFile },
+	"jump_host_key_sha256": func(p *ProfileProxy) *string { return &p.JumpHostKeySHA256 },
+	"jump_known_hosts":     func(p *ProfileProxy) *string { return &p.JumpKnownHosts },
+}
+
+// applyProxySettings copies the plain proxy settings onto a profile. Only
+// keys present in the map are changed.
+func applyProxySettings(p *ConnectionProfile, settings map[string]string) {
+	for key, field := range proxySettingKeys {
+		if v, ok := settings[key]; ok {
+			*field(&p.Proxy) = strings.TrimSpace(v)
+		}
+	}
+}
+
+// applyProxySecrets stores the proxy password and jump key passphrase in the
+// secret store. Like API keys they are write-only: an empty value keeps the
+// saved one, and they are removed when the proxy or jump host is.
+func (a *App) applyProxySecrets(p *ConnectionProfile, settings map[string]string) error {
+	proxy := &p.Proxy
+
+	if v := settings["proxy_password"]; v != "" {
+		if err := a.storeSecret(&proxy.PasswordRef, v); err != nil {
+			return fmt.Errorf("failed to store proxy password: %v", err)
+		}
+	}
+	if proxy.URL == "" || proxy.Username == "" {
+		if err := a.storeSecret(&proxy.PasswordRef, ""); err != nil {
+			return err
+		}
+	}
+
+	if v := settings["jump_key_passphrase"]; v != "" {
+		if err := a.storeSecret(&proxy.JumpKeyPassphraseRef, v); err != nil {
+			return fmt.Errorf("failed to store jump host key passphrase: %v", err)
+		}
+	}
+	if proxy.JumpHost == "" {
+		if err := a.storeSecret(&proxy.JumpKeyPassphraseRef, ""); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// proxySecret returns a secret given with a profile's settings but not yet
+// stored, or else the one saved under ref
+func (a *App) proxySecret(ref, pending string) (string, error) {
+	if pending != "" {
+		return pending, nil
+	}
+	return a.readSecret(ref)
+}
+
+// profileProxyOptions returns the panclient options routing a profile's
+// traffic through its proxy or jump host. Secrets in pending (proxy_password,
+// jump_key_passphrase) are used ahead of the stored ones.
+func (a *App) profileProxyOptions(p *ConnectionProfile, pending map[string]string) ([]panclient.Option, error) {
+	proxy := p.Proxy
+
+	switch {
+	case proxy.URL != "" && proxy.JumpHost != "":
+		return nil, fmt.Errorf("use either a proxy or a jump host, not both")
+
+	case proxy.URL != "":
+		u, err := url.Parse(proxy.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		if proxy.Username != "" {
+			password, err := a.proxySecret(proxy.PasswordRef, pending["proxy_password"])
+			if err != nil {
+				return nil, fmt.Errorf("could not read the proxy password: %v", err)
+			}
+			u.User = url.UserPassword(proxy.Username, password)
+		}
+		return []panclient.Option{panclient.WithProxy(u.String())}, nil
+
+	case proxy.JumpHost != "":
+		passphrase, err := a.proxySecret(proxy.JumpKeyPassphraseRef, pending["jump_key_passphrase"])
+		if err != nil {
+			return nil, fmt.Errorf("could not read the jump host key passphrase: %v", err)
+		}
+		return []panclient.Option{panclient.WithSSHJump(panclient.SSHJumpConfig{
+			Address:        proxy.JumpHost,
+			User:           proxy.JumpUser,
+			KeyFile:        proxy.JumpKeyFile,
+			KeyPassphrase:  passphrase,
+			HostKeySHA256:  proxy.JumpHostKeySHA256,
+			KnownHostsFile: proxy.JumpKnownHosts,
+		})}, nil
+	}
+
+	return nil, nil
+}
+
+// proxySummary describes a profile's proxy settings for the frontend,
+// without its secrets
+func proxySummary(p ConnectionProfile) map[string]interface{} {
+	return map[string]interface{}{
+		"proxy_url":               p.Proxy.URL,
+		"proxy_username":          p.Proxy.Username,
+		"proxy_password_set":      p.Proxy.PasswordRef != "",
+		"jump_host":               p.Proxy.JumpHost,
+		"jump_user":               p.Proxy.JumpUser,
+		"jump_key_file":           p.Proxy.JumpKeyFile,
+		"jump_key_passphrase_set": p.Proxy.JumpKeyPassphraseRef != "",
+		"jump_host_key_sha256":    p.Proxy.JumpHostKeySHA256,
+		"jump_known_hosts":        p.Proxy.JumpKnownHosts,
+	}
+}
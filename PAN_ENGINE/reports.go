@@ -0,0 +1,100 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/utils"
+	"path/filepath"
+)
+
+// catalogPath returns the report catalog overrides next to the settings file
+func (a *App) catalogPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), catalog.OverrideFile)
+}
+
+// loadCatalog builds the report catalog from the built-in reports, the
+// user's overrides and the saved custom reports. On an invalid override
+// file the built-in reports are used.
+func (a *App) loadCatalog() error {
+	c, err := catalog.Load(a.catalogPath())
+	if err != nil {
+		c = catalog.Default()
+	}
+	if mergeErr := c.Merge(catalog.Catalog{Reports: a.customReports}); mergeErr != nil {
+		utils.ErrorLogger.Printf("Could not add custom reports: %v", mergeErr)
+	}
+
+	a.catalogMu.Lock()
+	a.catalog = c
+	a.catalogMu.Unlock()
+
+	utils.InfoLogger.Printf("Loaded %d report types", len(c.Reports))
+	return err
+}
+
+// reportCatalog returns the current report catalog. It is replaced rather
+// than changed, so callers may keep reading it.
+func (a *App) reportCatalog() *catalog.Catalog {
+	a.catalogMu.RLock()
+	defer a.catalogMu.RUnlock()
+	return a.catalog
+}
+
+// getEndpointForReportType maps report types to API endpoints, using the
+// REST API version selected for the connected device
+func (a *App) getEndpointForReportType(reportType string) string {
+	return a.endpointForReportType(reportType, a.restVersion())
+}
+
+// endpointForReportType maps report types to API endpoints for a REST API
+// version. Unknown report types have no endpoint.
+func (a *App) endpointForReportType(reportType, version string) string {
+	report, ok := a.reportCatalog().Get(reportType)
+	if !ok {
+		return ""
+	}
+	return report.EndpointFor(version)
+}
+
+// GetSupportedReportTypes returns a list of all supported report types with their details.
+// Report types the connected PAN-OS version lacks are returned with enabled set to "false".
+func (a *App) GetSupportedReportTypes() []map[string]string {
+	reports := a.reportCatalog().Reports
+	reportTypes := make([]map[string]string, 0, len(reports))
+	for _, report := range reports {
+		rt := map[string]string{
+			"type":     report.Key,
+			"name":     report.Label,
+			"category": report.Category,
+			"enabled":  "true",
+			"value":    report.Key,
+			"label":    report.Label,
+			"flavor":   report.Flavor,
+		}
+		if report.Description != "" {
+			rt["description"] = report.Description
+		}
+		if report.Custom {
+			rt["custom"] = "true"
+		}
+		if report.MinVersion != "" {
+			rt["min_version"] = report.MinVersion
+		}
+		if supported, reason := reportSupportedOn(report, a.deviceVersion, a.restAPIVersion); !supported {
+			rt["enabled"] = "false"
+			rt["disabled_reason"] = reason
+		}
+		reportTypes = append(reportTypes, rt)
+	}
+
+	return reportTypes
+}
+
+// GetReportCategories returns a list of all report categories
+func (a *App) GetReportCategories() []string {
+	return append([]string(nil), a.reportCatalog().Categories...)
+}
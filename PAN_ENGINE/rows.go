@@ -0,0 +1,451 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+const (
+	// defaultSpillRows is how many rows a report keeps in memory before the
+	// rest go to a temporary file
+	defaultSpillRows = 50000
+
+	// previewRows is how many rows of a spilled report the frontend gets
+	previewRows = 1000
+)
+
+// errEnoughRows stops rowSet.each early without reporting a failure
+var errEnoughRows = errors.New("enough rows")
+
+// rowSet holds the rows of a report. The first rows are kept in memory; once
+// there are more than the spill threshold the rest are written to a
+// temporary file as JSON lines, so reports of millions of rows are exported
+// without holding them all at once.
+type rowSet struct {
+	// limit is the number of rows kept in memory
+	limit int
+	rows  []sectionRow
+	count int
+
+	// mu guards the spill file, which is appended to and read back, and
+	// its readers: close waits for the last reader to release the set
+	mu      sync.Mutex
+	file    *os.File
+	writer  *bufio.Writer
+	readers int
+	closing bool
+
+	// columns is every column seen, firstColumns those of the first row
+	columns      map[string]bool
+	firstColumns []string
+	sections     map[string]bool
+}
+
+// sectionRow is a row and the entry list it came from
+type sectionRow struct {
+	Section string                 `json:"section,omitempty"`
+	Row     map[string]interface{} `json:"row"`
+}
+
+// newRowSet creates an empty row set spilling after the configured number
+// of rows
+func (a *App) newRowSet() *rowSet {
+	limit := a.spillRows
+	if limit <= 0 {
+		limit = defaultSpillRows
+	}
+	return &rowSet{limit: limit, columns: map[string]bool{}, sections: map[string]bool{}}
+}
+
+// rowSetFromSlice wraps rows already in memory, skipping anything that is
+// not a row
+func rowSetFromSlice(items []interface{}) *rowSet {
+	rows := &rowSet{limit: len(items), columns: map[string]bool{}, sections: map[string]bool{}}
+	for _, item := range items {
+		if row, ok := item.(map[string]interface{}); ok {
+			rows.add(row, "")
+		}
+	}
+	return rows
+}
+
+// add appends a row from the named entry list
+func (s *rowSet) add(row map[string]interface{}, section string) error {
+	if s.count == 0 {
+		for k := range row {
+			s.firstColumns = append(s.firstColumns, k)
+		}
+	}
+	for k := range row {
+		s.columns[k] = true
+	}
+	if section != "" {
+		s.sections[section] = true
+	}
+	s.count++
+
+	if len(s.rows) < s.limit {
+		s.rows = append(s.rows, sectionRow{Section: section, Row: row})
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		f, err := os.CreateTemp("", "pan_engine-rows-*.jsonl")
+		if err != nil {
+			return fmt.Errorf("failed to create spill file: %v", err)
+		}
+		s.file = f
+		s.writer = bufio.NewWriter(f)
+		utils.InfoLogger.Printf("Report exceeds %d rows, spilling to %s", s.limit, f.Name())
+	}
+	line, err := json.Marshal(sectionRow{Section: section, Row: row})
+	if err != nil {
+		return fmt.Errorf("failed to spill row: %v", err)
+	}
+	line = append(line, '\n')
+	if _, err := s.writer.Write(line); err != nil {
+		return fmt.Errorf("failed to spill row: %v", err)
+	}
+	return nil
+}
+
+// addStream reads every row of a stream through mapRow, closing it
+func (s *rowSet) addStream(stream *panclient.RowStream, mapRow func(map[string]interface{}) map[string]interface{}) error {
+	defer stream.Close()
+	for stream.Next() {
+		if err := s.add(mapRow(stream.Row()), stream.Section()); err != nil {
+			return err
+		}
+	}
+	return stream.Err()
+}
+
+// len returns the number of rows
+func (s *rowSet) len() int {
+	return s.count
+}
+
+// spilled reports whether some rows are on disk
+func (s *rowSet) spilled() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file != nil
+}
+
+// multiSection reports whether rows came from more than one entry list, in
+// which case each row carries a "section" column as XMLResponse.Rows does
+func (s *rowSet) multiSection() bool {
+	return len(s.sections) > 1
+}
+
+// headers returns the sorted columns for a table: those of every row when
+// complete is set, otherwise those of the first row
+func (s *rowSet) headers(complete bool) []string {
+	var headers []string
+	if complete {
+		for k := range s.columns {
+			headers = append(headers, k)
+		}
+	} else {
+		headers = append(headers, s.firstColumns...)
+	}
+	if s.multiSection() && !s.columns["section"] {
+		headers = append(headers, "section")
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// preferredHeaders returns the given default columns that appear in the
+// rows, in order, followed by the device identity and section columns. It
+// returns nil when the rows have none of the defaults.
+func (s *rowSet) preferredHeaders(defaults []string) []string {
+	var headers []string
+	seen := map[string]bool{}
+	add := func(column string) {
+		if s.columns[column] && !seen[column] {
+			headers = append(headers, column)
+			seen[column] = true
+		}
+	}
+
+	for _, column := range defaults {
+		add(column)
+	}
+	if len(headers) == 0 {
+		return nil
+	}
+
+	for _, column := range []string{columnDeviceProfile, columnDeviceHostname, columnDeviceSerial, columnDeviceSite} {
+		add(column)
+	}
+	if s.multiSection() && !seen["section"] {
+		headers = append(headers, "section")
+	}
+	return headers
+}
+
+// each calls fn for every row in order. Returning errEnoughRows from fn
+// stops early without an error.
+func (s *rowSet) each(fn func(row map[string]interface{}) error) error {
+	for _, r := range s.rows {
+		if err := fn(s.output(r)); err != nil {
+			if err == errEnoughRows {
+				return nil
+			}
+			return err
+		}
+	}
+
+	s.mu.Lock()
+	if s.file == nil {
+		s.mu.Unlock()
+		return nil
+	}
+	err := s.writer.Flush()
+	name := s.file.Name()
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("failed to write spill file: %v", err)
+	}
+
+	f, err := os.Open(name)
+	if err != nil {
+		return fmt.Errorf("failed to read spill file: %v", err)
+	}
+	defer f.Close()
+
+	decoder := json.NewDecoder(bufio.NewReader(f))
+	for {
+		var r sectionRow
+		if err := decoder.Decode(&r); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read spill file: %v", err)
+		}
+		if err := fn(s.output(r)); err != nil {
+			if err == errEnoughRows {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// output returns a stored row as exported, with its section when needed
+func (s *rowSet) output(r sectionRow) map[string]interface{} {
+	if !s.multiSection() {
+		return r.Row
+	}
+	row := make(map[string]interface{}, len(r.Row)+1)
+	for k, v := range r.Row {
+		row[k] = v
+	}
+	row["section"] = r.Section
+	return row
+}
+
+// slice returns up to n rows, or every row when n is 0
+func (s *rowSet) slice(n int) []interface{} {
+	out := []interface{}{}
+	s.each(func(row map[string]interface{}) error {
+		if n > 0 && len(out) >= n {
+			return errEnoughRows
+		}
+		out = append(out, row)
+		return nil
+	})
+	return out
+}
+
+// acquire marks the set as being read, so close keeps the spill file until
+// the matching release
+func (s *rowSet) acquire() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers++
+}
+
+// release ends a read started by acquire, removing the spill file if the
+// set was closed meanwhile
+func (s *rowSet) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers--
+	if s.readers == 0 && s.closing {
+		s.removeFile()
+	}
+}
+
+// close removes the spill file, once no reader holds the set
+func (s *rowSet) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.closing = true
+	if s.readers == 0 {
+		s.removeFile()
+	}
+}
+
+// removeFile deletes the spill file. The caller holds mu.
+func (s *rowSet) removeFile() {
+	if s.file == nil {
+		return
+	}
+	s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil {
+		utils.ErrorLogger.Printf("Failed to remove spill file %s: %v", s.file.Name(), err)
+	}
+	s.file = nil
+	s.writer = nil
+}
+
+// normalizeReportData turns fetched report data into rows for export. A
+// REST envelope still held as a map becomes its result entries, a single
+// entry object included, and every row gets its attributes such as @name,
+// @location and @vsys as plain columns. Row sets from the streaming readers
+// are already in this form.
+func normalizeReportData(data interface{}) interface{} {
+	var items []interface{}
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if _, ok := v["result"]; !ok {
+			return rowSetFromSlice([]interface{}{panclient.PromoteAttributes(panclient.FlattenRow(v))})
+		}
+		for _, row := range panclient.EnvelopeRows(v) {
+			items = append(items, row)
+		}
+	case []interface{}:
+		for _, item := range v {
+			if row, ok := item.(map[string]interface{}); ok {
+				items = append(items, panclient.PromoteAttributes(panclient.FlattenRow(row)))
+			}
+		}
+	default:
+		return data
+	}
+	return rowSetFromSlice(items)
+}
+
+// reportView is what GenerateReport returns to the frontend: the rows, or
+// for a report spilled to disk a preview and the total row count
+func reportView(data interface{}) interface{} {
+	rows, ok := data.(*rowSet)
+	if !ok {
+		return data
+	}
+	if !rows.spilled() {
+		return rows.slice(0)
+	}
+	return map[string]interface{}{
+		"preview":    rows.slice(previewRows),
+		"total_rows": rows.len(),
+		"spilled":    true,
+	}
+}
+
+// eachReportRow calls fn for every row of report data, reading a spilled
+// report from disk rather than loading it. It returns false for data that
+// is not a row or list of rows.
+func eachReportRow(data interface{}, fn func(row map[string]interface{})) bool {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		fn(v)
+	case []interface{}:
+		for _, item := range v {
+			if row, ok := item.(map[string]interface{}); ok {
+				fn(row)
+			}
+		}
+	case *rowSet:
+		if err := v.each(func(row map[string]interface{}) error {
+			fn(row)
+			return nil
+		}); err != nil {
+			utils.ErrorLogger.Printf("Failed to read report rows: %v", err)
+		}
+	default:
+		return false
+	}
+	return true
+}
+
+// storeReportData keeps a report's data for export, removing the spill file
+// of the data it replaces once no export reads it. The caller holds
+// reportMu.
+func (a *App) storeReportData(key string, data interface{}) {
+	if old, ok := a.reportData[key].(*rowSet); ok && old != data {
+		old.close()
+	}
+	a.reportData[key] = data
+}
+
+// acquireReportData returns a report's stored data for reading. A row set
+// stays readable, even if replaced meanwhile, until the returned release
+// function is called.
+func (a *App) acquireReportData(key string) (interface{}, func(), bool) {
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+
+	data, ok := a.reportData[key]
+	return data, acquireData(data), ok
+}
+
+// acquireAllReportData returns a copy of every stored report's data, held
+// for reading until the returned release function is called
+func (a *App) acquireAllReportData() (map[string]interface{}, func()) {
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+
+	all := make(map[string]interface{}, len(a.reportData))
+	releases := make([]func(), 0, len(a.reportData))
+	for key, data := range a.reportData {
+		all[key] = data
+		releases = append(releases, acquireData(data))
+	}
+	return all, func() {
+		for _, release := range releases {
+			release()
+		}
+	}
+}
+
+// acquireData holds a row set for reading and returns its release function.
+// Other data needs no release.
+func acquireData(data interface{}) func() {
+	rows, ok := data.(*rowSet)
+	if !ok {
+		return func() {}
+	}
+	rows.acquire()
+	return rows.release
+}
+
+// shutdown removes the spill files of stored reports
+func (a *App) shutdown(ctx context.Context) {
+	a.reportMu.Lock()
+	defer a.reportMu.Unlock()
+
+	for _, data := range a.reportData {
+		if rows, ok := data.(*rowSet); ok {
+			rows.close()
+		}
+	}
+}
@@ -0,0 +1,197 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/utils"
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func TestMain(m *testing.M) {
+	utils.InfoLogger = log.New(io.Discard, "", 0)
+	utils.ErrorLogger = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+// spilledRowSet returns a row set of n rows, all but two of them on disk
+func spilledRowSet(t *testing.T, n int) *rowSet {
+	t.Helper()
+	rows := (&App{spillRows: 2}).newRowSet()
+	for i := 0; i < n; i++ {
+		if err := rows.add(map[string]interface{}{"id": fmt.Sprint(i)}, ""); err != nil {
+			t.Fatalf("add failed: %v", err)
+		}
+	}
+	if !rows.spilled() {
+		t.Fatal("row set did not spill")
+	}
+	return rows
+}
+
+func TestRowSetCloseWaitsForReaders(t *testing.T) {
+	rows := spilledRowSet(t, 10)
+	name := rows.file.Name()
+
+	rows.acquire()
+	rows.close()
+	if _, err := os.Stat(name); err != nil {
+		t.Fatalf("spill file removed while a reader holds the set: %v", err)
+	}
+	if got := len(rows.slice(0)); got != 10 {
+		t.Errorf("read %d rows after close, want 10", got)
+	}
+
+	rows.release()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spill file kept after the last reader released: %v", err)
+	}
+}
+
+func TestRowSetCloseWithoutReaders(t *testing.T) {
+	rows := spilledRowSet(t, 5)
+	name := rows.file.Name()
+
+	rows.close()
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spill file kept after close: %v", err)
+	}
+}
+
+// Replacing stored report data while exports read it neither races on
+// the map nor removes a spill file still being read
+func TestReportDataConcurrentAccess(t *testing.T) {
+	a := &App{reportData: map[string]interface{}{}, spillRows: 2}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				rows := a.newRowSet()
+				for j := 0; j < 20; j++ {
+					rows.add(map[string]interface{}{"id": fmt.Sprint(j)}, "")
+				}
+				a.reportMu.Lock()
+				a.storeReportData("traffic", rows)
+				a.reportMu.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				data, release, ok := a.acquireReportData("traffic")
+				if ok {
+					if got := len(data.(*rowSet).slice(0)); got != 20 {
+						t.Errorf("read %d rows, want 20", got)
+					}
+				}
+				release()
+
+				all, releaseAll := a.acquireAllReportData()
+				for range all {
+				}
+				releaseAll()
+			}
+		}()
+	}
+	wg.Wait()
+
+	a.shutdown(context.Background())
+}
+
+func TestTagRowsStreamsSpilledRows(t *testing.T) {
+	a := &App{spillRows: 2}
+	source := spilledRowSet(t, 6)
+	name := source.file.Name()
+
+	dst := a.newRowSet()
+	count, err := tagRows(dst, source, map[string]interface{}{columnDeviceSerial: "0001"})
+	if err != nil {
+		t.Fatalf("tagRows failed: %v", err)
+	}
+	if count != 6 || dst.len() != 6 {
+		t.Errorf("copied %d rows into a set of %d, want 6", count, dst.len())
+	}
+	if !dst.spilled() {
+		t.Error("tagged rows were all kept in memory")
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("source spill file kept after tagging: %v", err)
+	}
+
+	for _, item := range dst.slice(0) {
+		if row := item.(map[string]interface{}); row[columnDeviceSerial] != "0001" || row["id"] == nil {
+			t.Errorf("row not tagged: %v", row)
+		}
+	}
+	dst.close()
+}
+
+func TestFilterReportDataSpills(t *testing.T) {
+	a := &App{reportData: map[string]interface{}{"traffic": spilledRowSet(t, 20)}, spillRows: 2}
+	defer a.shutdown(context.Background())
+
+	// ids 1 and 10 to 19
+	result, err := a.FilterReportData("traffic", map[string]string{"id": "1"})
+	if err != nil {
+		t.Fatalf("FilterReportData failed: %v", err)
+	}
+	if result["count"] != 11 || result["total"] != 20 {
+		t.Errorf("count = %v, total = %v, want 11 of 20", result["count"], result["total"])
+	}
+	view, ok := result["result"].(map[string]interface{})
+	if !ok || view["spilled"] != true || view["total_rows"] != 11 || len(view["preview"].([]interface{})) != 11 {
+		t.Errorf("result = %v, want a spilled view of 11 rows", result["result"])
+	}
+
+	stored, ok := a.reportData["traffic_filtered"].(*rowSet)
+	if !ok || !stored.spilled() || stored.len() != 11 {
+		t.Fatalf("stored filter result = %v, want a spilled row set of 11 rows", a.reportData["traffic_filtered"])
+	}
+	name := stored.file.Name()
+
+	// Filtering again replaces the stored result and its spill file
+	if _, err := a.FilterReportData("traffic", map[string]string{"id": "2"}); err != nil {
+		t.Fatalf("FilterReportData failed: %v", err)
+	}
+	if _, err := os.Stat(name); !os.IsNotExist(err) {
+		t.Errorf("spill file of the replaced filter result kept: %v", err)
+	}
+}
+
+func TestSearchAllReportsSpills(t *testing.T) {
+	a := &App{reportData: map[string]interface{}{"traffic": spilledRowSet(t, 20)}, spillRows: 2}
+	defer a.shutdown(context.Background())
+
+	before, _ := filepath.Glob(filepath.Join(os.TempDir(), "pan_engine-rows-*"))
+	result, err := a.SearchAllReports("1")
+	if err != nil {
+		t.Fatalf("SearchAllReports failed: %v", err)
+	}
+
+	found := result["results"].(map[string]interface{})["traffic"].(map[string]interface{})
+	if found["count"] != 11 {
+		t.Errorf("count = %v, want 11", found["count"])
+	}
+	view, ok := found["matches"].(map[string]interface{})
+	if !ok || view["spilled"] != true || view["total_rows"] != 11 {
+		t.Errorf("matches = %v, want a spilled view of 11 rows", found["matches"])
+	}
+
+	// The matches are not kept, so neither is their spill file
+	after, _ := filepath.Glob(filepath.Join(os.TempDir(), "pan_engine-rows-*"))
+	if len(after) != len(before) {
+		t.Errorf("spill files %v after the search, want %v", after, before)
+	}
+}
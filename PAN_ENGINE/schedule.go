@@ -0,0 +1,148 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// schedulesFile is stored in the same directory as the settings file
+const schedulesFile = "schedules.json"
+
+// ScheduledReport is a report to be generated periodically
+type ScheduledReport struct {
+	ID         string   `json:"id"`
+	ReportType string   `json:"report_type"`
+	Schedule   string   `json:"schedule"`
+	Recipients []string `json:"recipients,omitempty"`
+	// Target is a profile, inventory device or "tag:"/"site:" group; empty
+	// runs against the profile active at run time
+	Target    string    `json:"target,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// schedulesPath returns the schedules file next to the settings file
+func (a *App) schedulesPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), schedulesFile)
+}
+
+// loadSchedules reads the saved schedules. A missing file means none.
+func (a *App) loadSchedules() error {
+	data, err := ioutil.ReadFile(a.schedulesPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var schedules []ScheduledReport
+	if err := json.Unmarshal(data, &schedules); err != nil {
+		return fmt.Errorf("failed to parse schedules: %v", err)
+	}
+	a.schedules = schedules
+	return nil
+}
+
+// saveSchedules writes the schedules file
+func (a *App) saveSchedules() error {
+	schedules := a.schedules
+	if schedules == nil {
+		schedules = []ScheduledReport{}
+	}
+
+	data, err := json.MarshalIndent(schedules, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal schedules: %v", err)
+	}
+	if err := secretstore.WriteFilePrivate(a.schedulesPath(), data); err != nil {
+		return fmt.Errorf("failed to write schedules file: %v", err)
+	}
+	return nil
+}
+
+// ScheduleReport saves a report to be generated periodically. Target may
+// name a profile, an inventory device or a "tag:"/"site:" inventory group;
+// empty uses the profile active when the schedule runs.
+func (a *App) ScheduleReport(reportType, schedule string, emailRecipients []string, target string) (string, error) {
+	if a.getEndpointForReportType(reportType) == "" {
+		return "", fmt.Errorf("unknown report type: %s", reportType)
+	}
+	if strings.TrimSpace(schedule) == "" {
+		return "", fmt.Errorf("schedule is required")
+	}
+
+	target = strings.TrimSpace(target)
+	if target != "" {
+		if _, err := a.resolveFleetTargets([]string{target}); err != nil {
+			return "", err
+		}
+	}
+
+	scheduled := ScheduledReport{
+		ID:         uuid.New().String(),
+		ReportType: reportType,
+		Schedule:   strings.TrimSpace(schedule),
+		Recipients: emailRecipients,
+		Target:     target,
+		CreatedAt:  time.Now(),
+	}
+
+	a.schedules = append(a.schedules, scheduled)
+	if err := a.saveSchedules(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save schedules: %v", err)
+		a.schedules = a.schedules[:len(a.schedules)-1]
+		return "", err
+	}
+
+	utils.InfoLogger.Printf("Report %s scheduled: id=%s, schedule=%s, target=%s", reportType, scheduled.ID, scheduled.Schedule, target)
+	return scheduled.ID, nil
+}
+
+// ListScheduledReports returns every saved schedule
+func (a *App) ListScheduledReports() []map[string]interface{} {
+	schedules := make([]map[string]interface{}, 0, len(a.schedules))
+	for _, s := range a.schedules {
+		recipients := s.Recipients
+		if recipients == nil {
+			recipients = []string{}
+		}
+		schedules = append(schedules, map[string]interface{}{
+			"id":          s.ID,
+			"report_type": s.ReportType,
+			"schedule":    s.Schedule,
+			"recipients":  recipients,
+			"target":      s.Target,
+			"created_at":  s.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return schedules
+}
+
+// DeleteScheduledReport removes a saved schedule by ID
+func (a *App) DeleteScheduledReport(id string) (bool, error) {
+	for i, s := range a.schedules {
+		if s.ID == id {
+			a.schedules = append(a.schedules[:i], a.schedules[i+1:]...)
+			if err := a.saveSchedules(); err != nil {
+				utils.ErrorLogger.Printf("Failed to save schedules: %v", err)
+				return false, err
+			}
+			return true, nil
+		}
+	}
+	return false, fmt.Errorf("schedule %s does not exist", id)
+}
@@ -0,0 +1,133 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"fmt"
+	"strings"
+)
+
+// scopeFromOptions builds the REST scope from GenerateReport options. The
+// option keys match the PAN-OS query parameters: location, vsys,
+// device-group, template, template-stack and name.
+func (a *App) scopeFromOptions(options map[string]string) (panclient.Scope, error) {
+	return buildScope(options, a.deviceInfo != nil && a.deviceInfo.IsPanorama())
+}
+
+// buildScope builds the REST scope from report options for a firewall or,
+// when panorama is set, a Panorama
+func buildScope(options map[string]string, panorama bool) (panclient.Scope, error) {
+	scope := panclient.Scope{
+		Location:      panclient.Location(strings.TrimSpace(options["location"])),
+		Vsys:          strings.TrimSpace(options["vsys"]),
+		DeviceGroup:   strings.TrimSpace(options["device-group"]),
+		Template:      strings.TrimSpace(options["template"]),
+		TemplateStack: strings.TrimSpace(options["template-stack"]),
+		Name:          strings.TrimSpace(options["name"]),
+	}
+
+	// Firewalls default to vsys1, Panorama to shared
+	if scope.Location == "" {
+		scope.Location = panclient.LocationVsys
+		if panorama {
+			scope.Location = panclient.LocationShared
+		}
+	}
+
+	if err := scope.Validate(); err != nil {
+		return panclient.Scope{}, err
+	}
+
+	return scope, nil
+}
+
+// GetAvailableScopes returns the REST locations the connected device has,
+// along with its vsys, device groups, templates and template stacks
+func (a *App) GetAvailableScopes() (map[string]interface{}, error) {
+	if a.apiURL == "" || a.apiKey == "" {
+		return nil, fmt.Errorf("API URL and Key must be configured first")
+	}
+
+	client, err := a.apiClient()
+	if err != nil {
+		return nil, err
+	}
+	ctx := a.requestContext()
+
+	info, err := client.SystemInfo(ctx)
+	if err != nil {
+		a.handleAuthFailure(err)
+		return nil, operatorError(err)
+	}
+	if err := a.setDeviceInfo(info); err != nil {
+		utils.ErrorLogger.Printf("Could not read device version: %v", err)
+		a.deviceInfo = info
+	}
+
+	result := map[string]interface{}{
+		"device_type":     "firewall",
+		"hostname":        info.Hostname,
+		"locations":       []string{},
+		"vsys":            []string{},
+		"device_groups":   []string{},
+		"templates":       []string{},
+		"template_stacks": []string{},
+	}
+
+	// listNames logs and skips a list the device refuses rather than failing the whole lookup
+	listNames := func(xpath string) []string {
+		names, err := client.ListNames(ctx, xpath)
+		if err != nil {
+			utils.ErrorLogger.Printf("Could not list %s: %v", xpath, err)
+			return []string{}
+		}
+		return names
+	}
+
+	locations := []string{string(panclient.LocationShared)}
+
+	if info.IsPanorama() {
+		result["device_type"] = "panorama"
+
+		deviceGroups := listNames(panclient.DeviceXPath + "/device-group")
+		templates := listNames(panclient.DeviceXPath + "/template")
+		stacks := listNames(panclient.DeviceXPath + "/template-stack")
+
+		if len(deviceGroups) > 0 {
+			locations = append(locations, string(panclient.LocationDeviceGroup))
+		}
+		if len(templates) > 0 {
+			locations = append(locations, string(panclient.LocationTemplate))
+		}
+		if len(stacks) > 0 {
+			locations = append(locations, string(panclient.LocationTemplateStack))
+		}
+
+		result["device_groups"] = deviceGroups
+		result["templates"] = templates
+		result["template_stacks"] = stacks
+	} else {
+		vsys := listNames(panclient.DeviceXPath + "/vsys")
+		if len(vsys) == 0 {
+			vsys = []string{panclient.DefaultVsys}
+		}
+		locations = append([]string{string(panclient.LocationVsys)}, locations...)
+
+		// Panorama-pushed objects only exist on a managed firewall
+		if resp, err := client.Op(ctx, "<show><panorama-status></panorama-status></show>"); err == nil {
+			if status, ok := resp.Result.(string); ok && strings.Contains(status, "Connected") {
+				locations = append(locations, string(panclient.LocationPanoramaPushed))
+			}
+		}
+
+		result["vsys"] = vsys
+	}
+
+	result["locations"] = locations
+	return result, nil
+}
@@ -0,0 +1,409 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/secretstore"
+	"PAN_ENGINE/utils"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/google/uuid"
+	"github.com/wailsapp/wails/v2/pkg/runtime"
+)
+
+// secretService is the OS keyring service secrets are filed under
+const secretService = "PAN_ENGINE"
+
+// vaultFile is stored in the same directory as the settings file
+const vaultFile = "secrets.vault"
+
+// EventVaultLocked is emitted when saved keys cannot be read until the
+// vault passphrase is entered
+const EventVaultLocked = "secrets:vault-locked"
+
+// legacyKeySeed is the constant older releases derived their AES key from.
+// It is only used to read keys from settings files written by them.
+const legacyKeySeed = "PAN_ENGINE_SECRET_KEY"
+
+// vaultPath returns the vault file next to the settings file
+func (a *App) vaultPath() string {
+	return filepath.Join(filepath.Dir(a.settingsPath), vaultFile)
+}
+
+// initSecretStore selects the secret backend named in the settings. With
+// no backend configured the OS keyring is used where it works, and the
+// file vault otherwise.
+func (a *App) initSecretStore(backend string) {
+	a.vault = secretstore.NewVault(a.vaultPath())
+
+	if backend == secretstore.BackendVault {
+		a.secrets = a.vault
+		return
+	}
+
+	keyring := secretstore.NewKeyring(secretService)
+	if err := keyring.Available(); err != nil {
+		utils.ErrorLogger.Printf("%v; using the encrypted file vault", err)
+		a.secrets = a.vault
+		return
+	}
+	a.secrets = keyring
+}
+
+// secretStore returns the active secret backend
+func (a *App) secretStore() secretstore.Store {
+	if a.secrets == nil {
+		a.initSecretStore("")
+	}
+	return a.secrets
+}
+
+// vaultLocked reports whether keys are kept in a vault that is still locked
+func (a *App) vaultLocked() bool {
+	return a.secretStore() == secretstore.Store(a.vault) && a.vault.Locked()
+}
+
+// hasKey reports whether a profile has an API key saved
+func (p ConnectionProfile) hasKey() bool {
+	return p.KeyRef != "" || p.EncryptedKey != ""
+}
+
+// profileKey reads a profile's API key from the secret store
+func (a *App) profileKey(p *ConnectionProfile) (string, error) {
+	switch {
+	case p.KeyRef != "":
+		key, err := a.secretStore().Get(p.KeyRef)
+		if errors.Is(err, secretstore.ErrNotFound) {
+			return "", fmt.Errorf("the API key of profile %s is missing from the %s", p.Name, a.secrets.Name())
+		}
+		return key, err
+	case p.EncryptedKey != "":
+		// Not migrated yet, e.g. while the vault is locked
+		return legacyDecryptAPIKey(p.EncryptedKey)
+	}
+	return "", nil
+}
+
+// setProfileKey stores a profile's API key in the secret store, or removes
+// it when key is empty. The settings file only keeps the reference.
+func (a *App) setProfileKey(p *ConnectionProfile, key string) error {
+	if err := a.storeSecret(&p.KeyRef, key); err != nil {
+		if key == "" {
+			return fmt.Errorf("failed to remove API key: %v", err)
+		}
+		return fmt.Errorf("failed to store API key in the %s: %v", a.secretStore().Name(), err)
+	}
+
+	a.profilesMu.Lock()
+	p.EncryptedKey = ""
+	p.noteKeySet(key)
+	a.profilesMu.Unlock()
+	return nil
+}
+
+// storeSecret saves a secret under *ref, creating the reference on first
+// use, or removes it and clears the reference when value is empty
+func (a *App) storeSecret(ref *string, value string) error {
+	store := a.secretStore()
+
+	if value == "" {
+		if *ref != "" {
+			if err := store.Delete(*ref); err != nil {
+				return err
+			}
+		}
+		*ref = ""
+		return nil
+	}
+
+	id := *ref
+	if id == "" {
+		id = "profile/" + uuid.New().String()
+	}
+	if err := store.Set(id, value); err != nil {
+		return err
+	}
+	*ref = id
+	return nil
+}
+
+// readSecret returns the secret saved under ref, or "" when ref is empty
+func (a *App) readSecret(ref string) (string, error) {
+	if ref == "" {
+		return "", nil
+	}
+	value, err := a.secretStore().Get(ref)
+	if errors.Is(err, secretstore.ErrNotFound) {
+		return "", fmt.Errorf("secret is missing from the %s", a.secrets.Name())
+	}
+	return value, err
+}
+
+// secretRefs returns every secret store reference a profile holds
+func (p *ConnectionProfile) secretRefs() []*string {
+	var refs []*string
+	for _, ref := range []*string{&p.KeyRef, &p.Proxy.PasswordRef, &p.Proxy.JumpKeyPassphraseRef} {
+		if *ref != "" {
+			refs = append(refs, ref)
+		}
+	}
+	return refs
+}
+
+// copyProfileSecrets gives a cloned profile its own copies of the proxy
+// secrets, so deleting either profile leaves the other intact
+func (a *App) copyProfileSecrets(clone *ConnectionProfile) error {
+	for _, ref := range []*string{&clone.Proxy.PasswordRef, &clone.Proxy.JumpKeyPassphraseRef} {
+		if *ref == "" {
+			continue
+		}
+		value, err := a.readSecret(*ref)
+		if err != nil {
+			return err
+		}
+		*ref = ""
+		if err := a.storeSecret(ref, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deleteProfileSecrets removes a deleted profile's key and proxy secrets.
+// Failures are only logged since the profile itself is already gone.
+func (a *App) deleteProfileSecrets(p ConnectionProfile) {
+	for _, ref := range p.secretRefs() {
+		if err := a.secretStore().Delete(*ref); err != nil {
+			utils.ErrorLogger.Printf("Could not remove a secret of profile %s: %v", p.Name, err)
+		}
+	}
+}
+
+// migrateLegacyKeys moves keys encrypted with the old built-in key into the
+// secret store. It reports whether any profile changed; profiles are left
+// as they are while the vault is locked.
+func (a *App) migrateLegacyKeys() bool {
+	if a.vaultLocked() {
+		return false
+	}
+
+	changed := false
+	for i := range a.profiles {
+		p := &a.profiles[i]
+		if p.EncryptedKey == "" {
+			continue
+		}
+
+		key, err := legacyDecryptAPIKey(p.EncryptedKey)
+		if err != nil {
+			utils.ErrorLogger.Printf("Could not decrypt the legacy key of profile %s: %v", p.Name, err)
+			continue
+		}
+		if err := a.setProfileKey(p, key); err != nil {
+			utils.ErrorLogger.Printf("Could not migrate the key of profile %s: %v", p.Name, err)
+			continue
+		}
+
+		utils.InfoLogger.Printf("Moved the API key of profile %s to the %s", p.Name, a.secrets.Name())
+		changed = true
+	}
+	return changed
+}
+
+// checkSettingsPermissions makes sure older settings files, written
+// world-readable, are only readable by their owner
+func (a *App) checkSettingsPermissions() {
+	info, err := os.Stat(a.settingsPath)
+	if err != nil || info.Mode().Perm()&0077 == 0 {
+		return
+	}
+	if err := os.Chmod(a.settingsPath, 0600); err != nil {
+		utils.ErrorLogger.Printf("Could not restrict permissions of %s: %v", a.settingsPath, err)
+	}
+}
+
+// notifyVaultLocked asks the frontend for the vault passphrase when saved
+// keys cannot be read without it
+func (a *App) notifyVaultLocked() {
+	if !a.vaultLocked() {
+		return
+	}
+
+	needed := false
+	for _, p := range a.profiles {
+		if p.KeyRef != "" {
+			needed = true
+			break
+		}
+	}
+	if needed && a.ctx != nil {
+		runtime.EventsEmit(a.ctx, EventVaultLocked, map[string]interface{}{
+			"message": "Enter the vault passphrase to unlock the saved API keys.",
+		})
+	}
+}
+
+// GetSecretStoreStatus describes where API keys are kept
+func (a *App) GetSecretStoreStatus() map[string]interface{} {
+	store := a.secretStore()
+	return map[string]interface{}{
+		"backend":      store.Name(),
+		"locked":       a.vaultLocked(),
+		"vault_exists": a.vault.Exists(),
+		"vault_path":   a.vault.Path(),
+	}
+}
+
+// UnlockVault opens the file vault with its passphrase, creating the vault
+// on first use, then loads the active profile's key
+func (a *App) UnlockVault(passphrase string) (bool, error) {
+	if err := a.vault.Unlock(passphrase); err != nil {
+		utils.ErrorLogger.Printf("Vault unlock failed: %v", err)
+		return false, err
+	}
+	utils.InfoLogger.Printf("Vault unlocked: %s", a.vault.Path())
+
+	if a.secretStore() != secretstore.Store(a.vault) {
+		return true, nil
+	}
+
+	migrated := a.migrateLegacyKeys()
+	a.loadProfiles(Settings{Profiles: a.profiles, ActiveProfile: a.activeProfile})
+	a.resetConnection()
+
+	if migrated {
+		if err := a.saveSettings(); err != nil {
+			utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// LockVault forgets the vault key and the key of the active connection
+func (a *App) LockVault() bool {
+	a.vault.Lock()
+	if a.secretStore() == secretstore.Store(a.vault) {
+		a.apiKey = ""
+		a.resetConnection()
+	}
+	utils.InfoLogger.Printf("Vault locked")
+	return true
+}
+
+// ChangeVaultPassphrase re-encrypts the vault under a new passphrase
+func (a *App) ChangeVaultPassphrase(oldPassphrase, newPassphrase string) (bool, error) {
+	if err := a.vault.ChangePassphrase(oldPassphrase, newPassphrase); err != nil {
+		return false, err
+	}
+	utils.InfoLogger.Printf("Vault passphrase changed")
+	return true, nil
+}
+
+// SetSecretBackend moves every saved key and proxy secret to another
+// backend, "keyring" or "vault". The passphrase unlocks (or creates) the
+// vault when it is involved and still locked.
+func (a *App) SetSecretBackend(backend, passphrase string) (bool, error) {
+	from := a.secretStore()
+	if backend == from.Name() {
+		return true, nil
+	}
+
+	var to secretstore.Store
+	switch backend {
+	case secretstore.BackendKeyring:
+		keyring := secretstore.NewKeyring(secretService)
+		if err := keyring.Available(); err != nil {
+			return false, err
+		}
+		to = keyring
+	case secretstore.BackendVault:
+		to = a.vault
+	default:
+		return false, fmt.Errorf("invalid backend %q: must be 'keyring' or 'vault'", backend)
+	}
+
+	usesVault := from == secretstore.Store(a.vault) || to == secretstore.Store(a.vault)
+	if usesVault && a.vault.Locked() {
+		if err := a.vault.Unlock(passphrase); err != nil {
+			return false, err
+		}
+	}
+
+	// Copy every secret first so a failure leaves the old backend intact
+	for i := range a.profiles {
+		p := &a.profiles[i]
+		for _, ref := range p.secretRefs() {
+			secret, err := from.Get(*ref)
+			if err != nil {
+				return false, fmt.Errorf("could not read a secret of profile %s: %v", p.Name, err)
+			}
+			if err := to.Set(*ref, secret); err != nil {
+				return false, fmt.Errorf("could not store a secret of profile %s: %v", p.Name, err)
+			}
+		}
+	}
+
+	a.secrets = to
+	a.migrateLegacyKeys()
+	if err := a.saveSettings(); err != nil {
+		utils.ErrorLogger.Printf("Failed to save settings: %v", err)
+		return false, err
+	}
+
+	for i := range a.profiles {
+		p := &a.profiles[i]
+		for _, ref := range p.secretRefs() {
+			if err := from.Delete(*ref); err != nil {
+				utils.ErrorLogger.Printf("Could not remove a secret of profile %s from the %s: %v", p.Name, from.Name(), err)
+			}
+		}
+	}
+
+	utils.InfoLogger.Printf("API keys moved from the %s to the %s", from.Name(), to.Name())
+	return true, nil
+}
+
+// legacyDecryptAPIKey reads a key encrypted by older releases with a key
+// derived from a constant, which is why those keys are migrated
+func legacyDecryptAPIKey(encryptedKey string) (string, error) {
+	if encryptedKey == "" {
+		return "", nil
+	}
+
+	data, err := base64.StdEncoding.DecodeString(encryptedKey)
+	if err != nil {
+		return "", err
+	}
+
+	encKey := sha256.Sum256([]byte(legacyKeySeed))
+	block, err := aes.NewCipher(encKey[:])
+	if err != nil {
+		return "", err
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return "", err
+	}
+
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
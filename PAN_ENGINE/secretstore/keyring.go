@@ -0,0 +1,66 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package secretstore
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/zalando/go-keyring"
+)
+
+// probeID is written and removed to check that the keyring works
+const probeID = "pan-engine-probe"
+
+// Keyring stores secrets in the OS keyring: the Windows Credential
+// Manager, the macOS Keychain or the Secret Service on Linux
+type Keyring struct {
+	service string
+}
+
+// NewKeyring returns a keyring store that files secrets under service
+func NewKeyring(service string) *Keyring {
+	return &Keyring{service: service}
+}
+
+// Available checks that the OS keyring can store and read a secret. A
+// Linux desktop without a Secret Service provider fails here.
+func (k *Keyring) Available() error {
+	if err := keyring.Set(k.service, probeID, "probe"); err != nil {
+		return fmt.Errorf("OS keyring unavailable: %v", err)
+	}
+	if _, err := keyring.Get(k.service, probeID); err != nil {
+		return fmt.Errorf("OS keyring unavailable: %v", err)
+	}
+	return keyring.Delete(k.service, probeID)
+}
+
+// Name implements Store
+func (k *Keyring) Name() string {
+	return BackendKeyring
+}
+
+// Get implements Store
+func (k *Keyring) Get(id string) (string, error) {
+	secret, err := keyring.Get(k.service, id)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	return secret, err
+}
+
+// Set implements Store
+func (k *Keyring) Set(id, secret string) error {
+	return keyring.Set(k.service, id, secret)
+}
+
+// Delete implements Store
+func (k *Keyring) Delete(id string) error {
+	if err := keyring.Delete(k.service, id); err != nil && !errors.Is(err, keyring.ErrNotFound) {
+		return err
+	}
+	return nil
+}
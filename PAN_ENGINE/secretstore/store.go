@@ -0,0 +1,42 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+// Package secretstore keeps API keys and other secrets out of the settings
+// file. Secrets are stored under an opaque ID in the OS keyring or in a
+// file vault encrypted with a key derived from a master passphrase.
+package secretstore
+
+import "errors"
+
+var (
+	// ErrNotFound is returned when no secret is stored under an ID
+	ErrNotFound = errors.New("secret not found")
+
+	// ErrLocked is returned while a vault has not been unlocked
+	ErrLocked = errors.New("secret vault is locked")
+
+	// ErrBadPassphrase is returned when a vault passphrase is wrong
+	ErrBadPassphrase = errors.New("incorrect vault passphrase")
+)
+
+// Backend names, as stored in the settings file
+const (
+	BackendKeyring = "keyring"
+	BackendVault   = "vault"
+)
+
+// Store is a place secrets can be kept. Implementations are safe for
+// concurrent use.
+type Store interface {
+	// Name returns the backend name
+	Name() string
+	// Get returns the secret stored under id, or ErrNotFound
+	Get(id string) (string, error)
+	// Set stores a secret under id, replacing any previous value
+	Set(id, secret string) error
+	// Delete removes the secret stored under id. Deleting a missing
+	// secret is not an error.
+	Delete(id string) error
+}
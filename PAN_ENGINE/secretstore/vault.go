@@ -0,0 +1,400 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package secretstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/crypto/scrypt"
+)
+
+// scrypt cost parameters for new vaults. They are stored in the vault file
+// so they can be raised later without breaking existing vaults.
+const (
+	scryptN = 1 << 15
+	scryptR = 8
+	scryptP = 1
+
+	saltSize = 16
+	keySize  = 32
+)
+
+// vaultVersion is the file format version
+const vaultVersion = 1
+
+// checkPlaintext is encrypted with the vault key to detect a wrong passphrase
+const checkPlaintext = "PAN_ENGINE vault"
+
+// vaultFile is the on-disk form of a vault
+type vaultFile struct {
+	Version int    `json:"version"`
+	KDF     string `json:"kdf"`
+	Salt    string `json:"salt"`
+	N       int    `json:"n"`
+	R       int    `json:"r"`
+	P       int    `json:"p"`
+	// Check is checkPlaintext sealed with the vault key
+	Check   string            `json:"check"`
+	Entries map[string]string `json:"entries"`
+}
+
+// Vault stores secrets in a file, each sealed with AES-256-GCM under a key
+// derived from a master passphrase with scrypt. The file is only readable
+// by its owner. A vault must be unlocked before use.
+type Vault struct {
+	path string
+
+	mu   sync.Mutex
+	key  []byte
+	file *vaultFile
+}
+
+// NewVault returns a locked vault backed by the file at path
+func NewVault(path string) *Vault {
+	return &Vault{path: path}
+}
+
+// Name implements Store
+func (v *Vault) Name() string {
+	return BackendVault
+}
+
+// Path returns the vault file path
+func (v *Vault) Path() string {
+	return v.path
+}
+
+// Exists reports whether the vault file has been created
+func (v *Vault) Exists() bool {
+	_, err := os.Stat(v.path)
+	return err == nil
+}
+
+// Locked reports whether the vault still needs its passphrase
+func (v *Vault) Locked() bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	return v.key == nil
+}
+
+// Unlock derives the vault key from the passphrase. The first unlock
+// creates the vault with that passphrase.
+func (v *Vault) Unlock(passphrase string) error {
+	if passphrase == "" {
+		return errors.New("vault passphrase is required")
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	file, err := v.read()
+	if os.IsNotExist(err) {
+		return v.create(passphrase)
+	}
+	if err != nil {
+		return err
+	}
+
+	key, err := deriveKey(passphrase, file)
+	if err != nil {
+		return err
+	}
+	check, err := open(key, file.Check, "check")
+	if err != nil || subtle.ConstantTimeCompare([]byte(check), []byte(checkPlaintext)) != 1 {
+		return ErrBadPassphrase
+	}
+
+	v.key = key
+	v.file = file
+	return nil
+}
+
+// Lock forgets the vault key
+func (v *Vault) Lock() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for i := range v.key {
+		v.key[i] = 0
+	}
+	v.key = nil
+	v.file = nil
+}
+
+// ChangePassphrase re-seals every secret under a key derived from a new
+// passphrase with a fresh salt
+func (v *Vault) ChangePassphrase(oldPassphrase, newPassphrase string) error {
+	if newPassphrase == "" {
+		return errors.New("new vault passphrase is required")
+	}
+	if err := v.Unlock(oldPassphrase); err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	secrets := make(map[string]string, len(v.file.Entries))
+	for id, sealed := range v.file.Entries {
+		secret, err := open(v.key, sealed, id)
+		if err != nil {
+			return fmt.Errorf("could not read secret %s: %v", id, err)
+		}
+		secrets[id] = secret
+	}
+
+	file, key, err := newVaultFile(newPassphrase)
+	if err != nil {
+		return err
+	}
+	for id, secret := range secrets {
+		if file.Entries[id], err = seal(key, secret, id); err != nil {
+			return err
+		}
+	}
+
+	if err := v.write(file); err != nil {
+		return err
+	}
+	v.key = key
+	v.file = file
+	return nil
+}
+
+// Get implements Store
+func (v *Vault) Get(id string) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.key == nil {
+		return "", ErrLocked
+	}
+	sealed, ok := v.file.Entries[id]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return open(v.key, sealed, id)
+}
+
+// Set implements Store
+func (v *Vault) Set(id, secret string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.key == nil {
+		return ErrLocked
+	}
+	sealed, err := seal(v.key, secret, id)
+	if err != nil {
+		return err
+	}
+
+	file := v.copyFile()
+	file.Entries[id] = sealed
+	if err := v.write(file); err != nil {
+		return err
+	}
+	v.file = file
+	return nil
+}
+
+// Delete implements Store
+func (v *Vault) Delete(id string) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.key == nil {
+		return ErrLocked
+	}
+	if _, ok := v.file.Entries[id]; !ok {
+		return nil
+	}
+
+	file := v.copyFile()
+	delete(file.Entries, id)
+	if err := v.write(file); err != nil {
+		return err
+	}
+	v.file = file
+	return nil
+}
+
+// create writes a new, empty vault. The caller holds v.mu.
+func (v *Vault) create(passphrase string) error {
+	file, key, err := newVaultFile(passphrase)
+	if err != nil {
+		return err
+	}
+	if err := v.write(file); err != nil {
+		return err
+	}
+	v.key = key
+	v.file = file
+	return nil
+}
+
+// copyFile returns a copy of the vault file whose entries can be changed
+// without touching the loaded state until the write succeeds
+func (v *Vault) copyFile() *vaultFile {
+	file := *v.file
+	file.Entries = make(map[string]string, len(v.file.Entries)+1)
+	for id, sealed := range v.file.Entries {
+		file.Entries[id] = sealed
+	}
+	return &file
+}
+
+// read loads the vault file
+func (v *Vault) read() (*vaultFile, error) {
+	data, err := ioutil.ReadFile(v.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse vault %s: %v", v.path, err)
+	}
+	if file.Version != vaultVersion || file.KDF != "scrypt" {
+		return nil, fmt.Errorf("unsupported vault format in %s", v.path)
+	}
+	if file.Entries == nil {
+		file.Entries = make(map[string]string)
+	}
+	return &file, nil
+}
+
+// write replaces the vault file atomically, readable only by its owner
+func (v *Vault) write(file *vaultFile) error {
+	data, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal vault: %v", err)
+	}
+	return WriteFilePrivate(v.path, data)
+}
+
+// newVaultFile creates an empty vault file and its key for a passphrase
+func newVaultFile(passphrase string) (*vaultFile, []byte, error) {
+	salt := make([]byte, saltSize)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, nil, err
+	}
+
+	file := &vaultFile{
+		Version: vaultVersion,
+		KDF:     "scrypt",
+		Salt:    base64.StdEncoding.EncodeToString(salt),
+		N:       scryptN,
+		R:       scryptR,
+		P:       scryptP,
+		Entries: make(map[string]string),
+	}
+
+	key, err := deriveKey(passphrase, file)
+	if err != nil {
+		return nil, nil, err
+	}
+	if file.Check, err = seal(key, checkPlaintext, "check"); err != nil {
+		return nil, nil, err
+	}
+	return file, key, nil
+}
+
+// deriveKey runs scrypt with the vault's salt and cost parameters
+func deriveKey(passphrase string, file *vaultFile) ([]byte, error) {
+	salt, err := base64.StdEncoding.DecodeString(file.Salt)
+	if err != nil {
+		return nil, fmt.Errorf("invalid vault salt: %v", err)
+	}
+	return scrypt.Key([]byte(passphrase), salt, file.N, file.R, file.P, keySize)
+}
+
+// seal encrypts a secret, binding it to its ID so entries cannot be swapped
+func seal(key []byte, secret, id string) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(secret), []byte(id))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a secret sealed under id
+func open(key []byte, sealed, id string) (string, error) {
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", errors.New("ciphertext too short")
+	}
+
+	nonce, ciphertext := data[:gcm.NonceSize()], data[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, []byte(id))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// WriteFilePrivate writes a file readable only by its owner, replacing it
+// through a temporary file so a crash never leaves a half-written file.
+// Permissions are tightened even when the file already existed.
+func WriteFilePrivate(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return os.Chmod(path, 0600)
+}
@@ -0,0 +1,205 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package secretstore
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// unlockedVault returns a new vault in a temporary directory, unlocked
+// with passphrase
+func unlockedVault(t *testing.T, passphrase string) *Vault {
+	t.Helper()
+	v := NewVault(filepath.Join(t.TempDir(), "vault.json"))
+	if err := v.Unlock(passphrase); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	return v
+}
+
+func TestVaultStore(t *testing.T) {
+	v := unlockedVault(t, "correct horse")
+
+	if err := v.Set("profile/fw1", "LUFRPT1=="); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, err := v.Get("profile/fw1"); err != nil || got != "LUFRPT1==" {
+		t.Errorf("Get = %q, %v; want LUFRPT1==", got, err)
+	}
+	if err := v.Set("profile/fw1", "replaced"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if got, _ := v.Get("profile/fw1"); got != "replaced" {
+		t.Errorf("Get after replace = %q, want replaced", got)
+	}
+
+	if _, err := v.Get("profile/missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing secret = %v, want ErrNotFound", err)
+	}
+	if err := v.Delete("profile/missing"); err != nil {
+		t.Errorf("Delete of a missing secret = %v, want nil", err)
+	}
+	if err := v.Delete("profile/fw1"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := v.Get("profile/fw1"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+}
+
+func TestVaultLocked(t *testing.T) {
+	v := unlockedVault(t, "correct horse")
+	if err := v.Set("id", "secret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	v.Lock()
+
+	if !v.Locked() {
+		t.Fatal("vault not locked after Lock")
+	}
+	if _, err := v.Get("id"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Get = %v, want ErrLocked", err)
+	}
+	if err := v.Set("id", "other"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Set = %v, want ErrLocked", err)
+	}
+	if err := v.Delete("id"); !errors.Is(err, ErrLocked) {
+		t.Errorf("Delete = %v, want ErrLocked", err)
+	}
+}
+
+func TestVaultReopen(t *testing.T) {
+	v := unlockedVault(t, "correct horse")
+	if err := v.Set("id", "secret"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	reopened := NewVault(v.Path())
+	if !reopened.Locked() {
+		t.Fatal("reopened vault is not locked")
+	}
+	if err := reopened.Unlock(""); err == nil {
+		t.Error("Unlock accepted an empty passphrase")
+	}
+	if err := reopened.Unlock("wrong"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("Unlock with a wrong passphrase = %v, want ErrBadPassphrase", err)
+	}
+	if err := reopened.Unlock("correct horse"); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if got, err := reopened.Get("id"); err != nil || got != "secret" {
+		t.Errorf("Get after reopening = %q, %v; want secret", got, err)
+	}
+}
+
+func TestVaultFile(t *testing.T) {
+	v := unlockedVault(t, "correct horse")
+	if err := v.Set("profile/fw1", "LUFRPT1=="); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+
+	info, err := os.Stat(v.Path())
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("vault file mode = %o, want 600", mode)
+	}
+
+	data, err := os.ReadFile(v.Path())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if strings.Contains(string(data), "LUFRPT1==") {
+		t.Error("vault file holds the secret in plain text")
+	}
+
+	// A sealed secret is bound to its ID, so it cannot be moved to another
+	var file vaultFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	file.Entries["profile/fw2"] = file.Entries["profile/fw1"]
+	if err := v.write(&file); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	reopened := NewVault(v.Path())
+	if err := reopened.Unlock("correct horse"); err != nil {
+		t.Fatalf("Unlock failed: %v", err)
+	}
+	if got, err := reopened.Get("profile/fw2"); err == nil {
+		t.Errorf("secret moved to another ID read back as %q", got)
+	}
+}
+
+func TestVaultChangePassphrase(t *testing.T) {
+	v := unlockedVault(t, "old passphrase")
+	for id, secret := range map[string]string{"a": "one", "b": "two"} {
+		if err := v.Set(id, secret); err != nil {
+			t.Fatalf("Set failed: %v", err)
+		}
+	}
+
+	if err := v.ChangePassphrase("wrong", "new passphrase"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("ChangePassphrase with a wrong passphrase = %v, want ErrBadPassphrase", err)
+	}
+	if err := v.ChangePassphrase("old passphrase", ""); err == nil {
+		t.Error("ChangePassphrase accepted an empty passphrase")
+	}
+	if err := v.ChangePassphrase("old passphrase", "new passphrase"); err != nil {
+		t.Fatalf("ChangePassphrase failed: %v", err)
+	}
+
+	reopened := NewVault(v.Path())
+	if err := reopened.Unlock("old passphrase"); !errors.Is(err, ErrBadPassphrase) {
+		t.Errorf("old passphrase still unlocks the vault: %v", err)
+	}
+	if err := reopened.Unlock("new passphrase"); err != nil {
+		t.Fatalf("Unlock with the new passphrase failed: %v", err)
+	}
+	for id, want := range map[string]string{"a": "one", "b": "two"} {
+		if got, err := reopened.Get(id); err != nil || got != want {
+			t.Errorf("Get(%s) = %q, %v; want %s", id, got, err, want)
+		}
+	}
+}
+
+func TestWriteFilePrivate(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "settings.json")
+	if err := os.WriteFile(path, []byte("old"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	if err := WriteFilePrivate(path, []byte("new")); err != nil {
+		t.Fatalf("WriteFilePrivate failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || string(data) != "new" {
+		t.Errorf("file holds %q, %v; want new", data, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if mode := info.Mode().Perm(); mode != 0600 {
+		t.Errorf("file mode = %o, want 600", mode)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("ReadDir failed: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("directory holds %d files, want only the written one", len(entries))
+	}
+}
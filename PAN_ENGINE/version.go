@@ -0,0 +1,69 @@
+/*
+Copyright © 2024 Aaron Stovall
+All rights reserved.
+*/
+
+package main
+
+import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/utils"
+	"fmt"
+)
+
+// setDeviceInfo records the connected device and selects the REST API version
+func (a *App) setDeviceInfo(info *panclient.SystemInfo) error {
+	version, err := panclient.ParseVersion(info.SWVersion)
+	if err != nil {
+		return err
+	}
+
+	restVersion, err := panclient.RESTVersionFor(version)
+	if err != nil {
+		// XML API reports still work on pre-REST releases
+		utils.ErrorLogger.Printf("%v", err)
+	}
+
+	a.deviceInfo = info
+	a.deviceVersion = &version
+	a.restAPIVersion = restVersion
+
+	utils.InfoLogger.Printf("Connected to %s (%s) running PAN-OS %s, REST API %s",
+		info.Hostname, info.Model, info.SWVersion, restVersion)
+	return nil
+}
+
+// restVersion returns the REST API version used in endpoint paths
+func (a *App) restVersion() string {
+	if a.restAPIVersion == "" {
+		return panclient.DefaultRESTVersion
+	}
+	return a.restAPIVersion
+}
+
+// reportSupportedOn reports whether a device running version, with the
+// given REST API version ("" for none), can run a report, and why not.
+// Before the device version is known (nil) everything is allowed.
+func reportSupportedOn(report catalog.Report, version *panclient.Version, restVersion string) (bool, string) {
+	if version == nil {
+		return true, ""
+	}
+
+	if report.MinVersion != "" {
+		minVersion, err := panclient.ParseVersion(report.MinVersion)
+		if err != nil {
+			return false, fmt.Sprintf("invalid minimum version %q in the report catalog", report.MinVersion)
+		}
+		if !version.AtLeast(minVersion) {
+			return false, fmt.Sprintf("requires PAN-OS %s or later (device runs %s)", report.MinVersion, version.Raw)
+		}
+	}
+
+	// REST reports need a device that has the REST API at all
+	if restVersion == "" && report.Flavor == catalog.FlavorREST {
+		return false, fmt.Sprintf("the REST API requires PAN-OS 9.0 or later (device runs %s)", version.Raw)
+	}
+
+	return true, ""
+}
@@ -1,5 +1,17 @@
 module paloalto-reports
 
-go 1.21
+go 1.22.0
 
-require github.com/go-pdf/fpdf v0.9.0
+require (
+	PAN_ENGINE v0.0.0
+	github.com/go-pdf/fpdf v0.9.0
+)
+
+require (
+	github.com/godbus/dbus/v5 v5.1.0 // indirect
+	github.com/zalando/go-keyring v0.2.6 // indirect
+	golang.org/x/crypto v0.33.0 // indirect
+	golang.org/x/net v0.35.0 // indirect
+)
+
+replace PAN_ENGINE => ../PAN_ENGINE
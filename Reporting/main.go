@@ -1,11 +1,18 @@
 package main
 
 import (
+	"PAN_ENGINE/catalog"
+	"PAN_ENGINE/panclient"
+	"PAN_ENGINE/secretstore"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io/fs"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"sort"
@@ -16,9 +23,18 @@ import (
 type Config struct {
 	APIURL string `json:"api_url"`
 	APIKey string `json:"api_key"`
+	// RESTVersion pins the REST API version (for example "v10.1"); empty
+	// detects it from the device's software version
+	RESTVersion string `json:"rest_version,omitempty"`
+	// Location, Vsys and DeviceGroup are the default scope of reports on
+	// location-scoped REST resources
+	Location    string `json:"location,omitempty"`
+	Vsys        string `json:"vsys,omitempty"`
+	DeviceGroup string `json:"device_group,omitempty"`
 }
 
 type APIEndpoint struct {
+	Key         string `json:"key"`
 	Name        string `json:"name"`
 	Endpoint    string `json:"endpoint"`
 	Description string `json:"description"`
@@ -31,57 +47,122 @@ type ReportFile struct {
 	DownloadPath string `json:"download_path"`
 }
 
-var apiEndpoints = []APIEndpoint{
-	{
-		Name:        "System Info",
-		Endpoint:    "/api/?type=op&cmd=<show><system><info></info></system></show>",
-		Description: "Get system information",
-	},
-	{
-		Name:        "Interface Info",
-		Endpoint:    "/api/?type=op&cmd=<show><interface>all</interface></show>",
-		Description: "Get interface information",
-	},
-	{
-		Name:        "Security Rules",
-		Endpoint:    "/api/?type=config&action=get&xpath=/config/devices/entry/vsys/entry/rulebase/security/rules",
-		Description: "Get security rules configuration",
-	},
-	{
-		Name:        "System Resources",
-		Endpoint:    "/api/?type=op&cmd=<show><system><resources></resources></system></show>",
-		Description: "Get system resource utilization",
-	},
-	{
-		Name:        "Traffic Logs",
-		Endpoint:    "/api/?type=log&log-type=traffic",
-		Description: "Get traffic logs",
-	},
-	{
-		Name:        "Threat Logs",
-		Endpoint:    "/api/?type=log&log-type=threat",
-		Description: "Get threat logs",
-	},
-	{
-		Name:        "URL Filtering Logs",
-		Endpoint:    "/api/?type=log&log-type=url",
-		Description: "Get URL filtering logs",
-	},
-	{
-		Name:        "GlobalProtect Users",
-		Endpoint:    "/api/?type=op&cmd=<show><global-protect-gateway><current-user></current-user></global-protect-gateway></show>",
-		Description: "Get current GlobalProtect users",
-	},
-	{
-		Name:        "Active Sessions",
-		Endpoint:    "/api/?type=op&cmd=<show><session><all></all></session></show>",
-		Description: "Get all active sessions",
-	},
-	{
-		Name:        "System Software Version",
-		Endpoint:    "/api/?type=op&cmd=<show><system><software></software></system></show>",
-		Description: "Get system software version information",
-	},
+// deviceTimeout bounds the request that detects the device's REST version
+const deviceTimeout = 30 * time.Second
+
+// catalogEndpoints turns report catalog entries into selectable endpoints,
+// with REST resources placed under restVersion
+func catalogEndpoints(c *catalog.Catalog, restVersion string) []APIEndpoint {
+	endpoints := make([]APIEndpoint, 0, len(c.Reports))
+	for _, report := range c.Reports {
+		description := report.Description
+		if description == "" {
+			description = fmt.Sprintf("Get %s (%s)", report.Label, report.Category)
+		}
+		endpoints = append(endpoints, APIEndpoint{
+			Key:         report.Key,
+			Name:        report.Label,
+			Endpoint:    report.EndpointFor(restVersion),
+			Description: description,
+		})
+	}
+	return endpoints
+}
+
+// endpointForReport returns the endpoint of a catalog report on the
+// configured device: REST resources use the device's REST API version and,
+// when the resource is location-scoped, the requested or configured scope
+func endpointForReport(ctx context.Context, report catalog.Report, config Config, form url.Values) (string, error) {
+	if report.Flavor != catalog.FlavorREST {
+		// XML API endpoints do not depend on the REST API version
+		return report.EndpointFor(""), nil
+	}
+
+	restVersion, panorama, err := deviceRESTVersion(ctx, config)
+	if err != nil {
+		return "", err
+	}
+	endpoint := report.EndpointFor(restVersion)
+	if !report.Scoped() {
+		return endpoint, nil
+	}
+
+	scope, err := reportScope(config, form, panorama)
+	if err != nil {
+		return "", err
+	}
+	return endpoint + "?" + scope.Query().Encode(), nil
+}
+
+// deviceRESTVersion returns the REST API version to use with the configured
+// device and whether it is a Panorama. A pinned version is used as is;
+// otherwise the version is derived from "show system info".
+func deviceRESTVersion(ctx context.Context, config Config) (string, bool, error) {
+	if config.RESTVersion != "" {
+		return config.RESTVersion, false, nil
+	}
+
+	client, err := panclient.New(config.APIURL, config.APIKey)
+	if err != nil {
+		return "", false, err
+	}
+	ctx, cancel := context.WithTimeout(ctx, deviceTimeout)
+	defer cancel()
+
+	info, err := client.SystemInfo(ctx)
+	if err != nil {
+		return "", false, fmt.Errorf("error detecting the device version: %v", err)
+	}
+	version, err := panclient.ParseVersion(info.SWVersion)
+	if err != nil {
+		return "", false, fmt.Errorf("error detecting the device version: %v", err)
+	}
+	restVersion, err := panclient.RESTVersionFor(version)
+	if err != nil {
+		return "", false, err
+	}
+	return restVersion, info.IsPanorama(), nil
+}
+
+// reportScope builds the scope of a location-scoped report from the request,
+// falling back to the configured scope. Firewalls default to vsys1,
+// Panorama to shared.
+func reportScope(config Config, form url.Values, panorama bool) (panclient.Scope, error) {
+	value := func(field, fallback string) string {
+		if v := strings.TrimSpace(form.Get(field)); v != "" {
+			return v
+		}
+		return fallback
+	}
+
+	scope := panclient.Scope{
+		Location:      panclient.Location(value("location", config.Location)),
+		Vsys:          value("vsys", config.Vsys),
+		DeviceGroup:   value("device_group", config.DeviceGroup),
+		Template:      value("template", ""),
+		TemplateStack: value("template_stack", ""),
+	}
+	if scope.Location == "" {
+		scope.Location = panclient.LocationVsys
+		if panorama {
+			scope.Location = panclient.LocationShared
+		}
+	}
+
+	if err := scope.Validate(); err != nil {
+		return panclient.Scope{}, err
+	}
+	return scope, nil
+}
+
+// validRESTVersion reports whether v is a REST API version the engine knows
+func validRESTVersion(v string) bool {
+	for _, known := range panclient.RESTAPIVersions {
+		if v == known {
+			return true
+		}
+	}
+	return false
 }
 
 func main() {
@@ -96,10 +177,21 @@ func main() {
 		log.Fatal(err)
 	}
 
+	// The report catalog is the built-in one with the user's overrides,
+	// read the same way as by PAN_ENGINE
+	reports, err := catalog.Load(filepath.Join(configDir, catalog.OverrideFile))
+	if err != nil {
+		log.Printf("Using the built-in report catalog: %v", err)
+		reports = catalog.Default()
+	}
+	log.Printf("Loaded %d report types", len(reports.Reports))
+
 	// Set up routes
 	http.HandleFunc("/", handleHome)
+	http.HandleFunc("/config", handleGetConfig)
 	http.HandleFunc("/save-config", handleSaveConfig)
-	http.HandleFunc("/generate-report", handleGenerateReport)
+	http.HandleFunc("/report-types", handleReportTypes(reports))
+	http.HandleFunc("/generate-report", handleGenerateReport(reports))
 	http.HandleFunc("/list-reports", handleListReports)
 	http.HandleFunc("/reports/", handleDownloadReport)
 
@@ -115,15 +207,37 @@ func handleHome(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// handleSaveConfig stores the API settings. The key is write-only: it is
+// never sent back, and an empty api_key keeps the saved one.
 func handleSaveConfig(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	config := Config{
-		APIURL: r.FormValue("api_url"),
-		APIKey: r.FormValue("api_key"),
+	config, err := loadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+
+	config.APIURL = r.FormValue("api_url")
+	if key := r.FormValue("api_key"); key != "" {
+		config.APIKey = key
+	}
+	config.RESTVersion = strings.TrimSpace(r.FormValue("rest_version"))
+	if config.RESTVersion != "" && !validRESTVersion(config.RESTVersion) {
+		http.Error(w, fmt.Sprintf("Unknown REST API version: %s", config.RESTVersion), http.StatusBadRequest)
+		return
+	}
+	config.Location = strings.TrimSpace(r.FormValue("location"))
+	config.Vsys = strings.TrimSpace(r.FormValue("vsys"))
+	config.DeviceGroup = strings.TrimSpace(r.FormValue("device_group"))
+	if config.Location != "" {
+		if _, err := reportScope(config, nil, false); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid scope: %v", err), http.StatusBadRequest)
+			return
+		}
 	}
 
 	configFile := filepath.Join("config", "config.json")
@@ -133,12 +247,49 @@ func handleSaveConfig(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := os.WriteFile(configFile, data, 0644); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// The file holds the key, so only the owner may read it
+	if err := secretstore.WriteFilePrivate(configFile, data); err != nil {
+		http.Error(w, "Failed to save configuration", http.StatusInternalServerError)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configStatus(config))
+}
+
+// handleGetConfig reports the API settings without the key
+func handleGetConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(configStatus(config))
+}
+
+// configStatus describes a configuration without revealing the API key:
+// only whether one is set and a short SHA-256 fingerprint of it
+func configStatus(config Config) map[string]interface{} {
+	status := map[string]interface{}{
+		"api_url":      config.APIURL,
+		"key_set":      config.APIKey != "",
+		"rest_version": config.RESTVersion,
+		"location":     config.Location,
+		"vsys":         config.Vsys,
+		"device_group": config.DeviceGroup,
+	}
+	if config.APIKey != "" {
+		sum := sha256.Sum256([]byte(config.APIKey))
+		status["key_fingerprint"] = "SHA256:" + hex.EncodeToString(sum[:4])
+	}
+	return status
 }
 
 func loadConfig() (Config, error) {
@@ -157,36 +308,76 @@ func loadConfig() (Config, error) {
 	return config, err
 }
 
-func handleGenerateReport(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
-	}
+// handleGenerateReport generates a report of the catalog, or of any API
+// endpoint, as CSV and PDF files
+func handleGenerateReport(reports *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
 
-	endpoint := r.FormValue("endpoint")
-	if endpoint == "" {
-		http.Error(w, "No endpoint selected", http.StatusBadRequest)
-		return
-	}
+		config, err := loadConfig()
+		if err != nil {
+			http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
+			return
+		}
 
-	config, err := loadConfig()
-	if err != nil {
-		http.Error(w, "Failed to load configuration", http.StatusInternalServerError)
-		return
-	}
+		if config.APIURL == "" || config.APIKey == "" {
+			http.Error(w, "API configuration not set", http.StatusBadRequest)
+			return
+		}
 
-	if config.APIURL == "" || config.APIKey == "" {
-		http.Error(w, "API configuration not set", http.StatusBadRequest)
-		return
-	}
+		// A catalog report key selects its endpoint
+		endpoint := r.FormValue("endpoint")
+		if key := r.FormValue("report"); key != "" {
+			report, ok := reports.Get(key)
+			if !ok {
+				http.Error(w, fmt.Sprintf("Unknown report type: %s", key), http.StatusBadRequest)
+				return
+			}
+			if endpoint, err = endpointForReport(r.Context(), report, config, r.Form); err != nil {
+				http.Error(w, fmt.Sprintf("Failed to resolve report endpoint: %v", err), http.StatusBadRequest)
+				return
+			}
+		}
+		if endpoint == "" {
+			http.Error(w, "No endpoint selected", http.StatusBadRequest)
+			return
+		}
 
-	err = generateReport(config.APIURL, config.APIKey, endpoint)
-	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to generate report: %v", err), http.StatusInternalServerError)
-		return
+		err = generateReport(config.APIURL, config.APIKey, endpoint)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Failed to generate report: %v", err), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
 	}
+}
 
-	w.WriteHeader(http.StatusOK)
+// handleReportTypes lists the report types of the catalog
+func handleReportTypes(reports *catalog.Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		// REST endpoints are shown for the pinned or detected version of the
+		// configured device, and for the default one until it can be reached
+		restVersion := panclient.DefaultRESTVersion
+		if config, err := loadConfig(); err == nil {
+			if detected, _, err := deviceRESTVersion(r.Context(), config); err == nil {
+				restVersion = detected
+			} else {
+				log.Printf("Listing REST endpoints for %s: %v", restVersion, err)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(catalogEndpoints(reports, restVersion))
+	}
 }
 
 func handleListReports(w http.ResponseWriter, r *http.Request) {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"PAN_ENGINE/panclient"
+	"bytes"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
@@ -8,15 +10,12 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"time"
 
 	"github.com/go-pdf/fpdf"
 )
 
-type ReportData struct {
-	Data interface{} `json:"data"`
-}
-
 func generateReport(apiURL, apiKey, endpoint string) error {
 	// Create unique filename based on timestamp
 	timestamp := time.Now().Format("20060102_150405")
@@ -47,27 +46,93 @@ func generateReport(apiURL, apiKey, endpoint string) error {
 	if err != nil {
 		return fmt.Errorf("error reading response: %v", err)
 	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("API returned HTTP %d", resp.StatusCode)
+	}
 
-	// Parse JSON response
-	var reportData ReportData
-	if err := json.Unmarshal(body, &reportData); err != nil {
-		return fmt.Errorf("error parsing JSON: %v", err)
+	rows, err := responseRows(body)
+	if err != nil {
+		return err
 	}
 
 	// Generate CSV report
-	if err := generateCSVReport(reportData.Data, baseFilename); err != nil {
+	if err := generateCSVReport(rows, baseFilename); err != nil {
 		return fmt.Errorf("error generating CSV: %v", err)
 	}
 
 	// Generate PDF report
-	if err := generatePDFReport(reportData.Data, baseFilename); err != nil {
+	if err := generatePDFReport(rows, baseFilename); err != nil {
 		return fmt.Errorf("error generating PDF: %v", err)
 	}
 
 	return nil
 }
 
-func generateCSVReport(data interface{}, baseFilename string) error {
+// responseRows normalizes an API response into table rows: the entries of a
+// REST envelope, with attributes such as @name as plain columns, or the
+// entries of an XML API <result>
+func responseRows(body []byte) ([]map[string]interface{}, error) {
+	if trimmed := bytes.TrimSpace(body); len(trimmed) > 0 && trimmed[0] == '<' {
+		xmlResp, err := panclient.ParseXMLResponse(trimmed)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing XML: %v", err)
+		}
+		if xmlResp.Status == "error" {
+			return nil, fmt.Errorf("API returned an error: %s", bytes.TrimSpace(body))
+		}
+		var rows []map[string]interface{}
+		for _, item := range xmlResp.Rows() {
+			if row, ok := item.(map[string]interface{}); ok {
+				rows = append(rows, row)
+			}
+		}
+		return rows, nil
+	}
+
+	var envelope map[string]interface{}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return nil, fmt.Errorf("error parsing JSON: %v", err)
+	}
+	if envelope["@status"] == "error" {
+		return nil, fmt.Errorf("API returned an error: %s", bytes.TrimSpace(body))
+	}
+	return panclient.EnvelopeRows(envelope), nil
+}
+
+// reportHeaders returns every column of the rows, sorted
+func reportHeaders(rows []map[string]interface{}) []string {
+	seen := map[string]bool{}
+	var headers []string
+	for _, row := range rows {
+		for key := range row {
+			if !seen[key] {
+				seen[key] = true
+				headers = append(headers, key)
+			}
+		}
+	}
+	sort.Strings(headers)
+	return headers
+}
+
+// cellValue formats a row value for a report cell
+func cellValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case map[string]interface{}, []interface{}:
+		data, err := json.Marshal(val)
+		if err != nil {
+			return fmt.Sprintf("%v", val)
+		}
+		return string(data)
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+func generateCSVReport(rows []map[string]interface{}, baseFilename string) error {
 	filename := filepath.Join("reports", baseFilename+".csv")
 	file, err := os.Create(filename)
 	if err != nil {
@@ -78,34 +143,27 @@ func generateCSVReport(data interface{}, baseFilename string) error {
 	writer := csv.NewWriter(file)
 	defer writer.Flush()
 
-	// Convert data to map for CSV writing
-	dataMap, ok := data.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid data format")
-	}
-
 	// Write headers
-	var headers []string
-	for key := range dataMap {
-		headers = append(headers, key)
-	}
+	headers := reportHeaders(rows)
 	if err := writer.Write(headers); err != nil {
 		return err
 	}
 
-	// Write values
-	var values []string
-	for _, header := range headers {
-		values = append(values, fmt.Sprintf("%v", dataMap[header]))
-	}
-	if err := writer.Write(values); err != nil {
-		return err
+	// Write one line per row
+	for _, row := range rows {
+		values := make([]string, 0, len(headers))
+		for _, header := range headers {
+			values = append(values, cellValue(row[header]))
+		}
+		if err := writer.Write(values); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-func generatePDFReport(data interface{}, baseFilename string) error {
+func generatePDFReport(rows []map[string]interface{}, baseFilename string) error {
 	filename := filepath.Join("reports", baseFilename+".pdf")
 
 	pdf := fpdf.New("P", "mm", "A4", "")
@@ -121,16 +179,18 @@ func generatePDFReport(data interface{}, baseFilename string) error {
 	// Set font for content
 	pdf.SetFont("Arial", "", 12)
 
-	// Convert data to map for PDF writing
-	dataMap, ok := data.(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid data format")
-	}
-
-	// Write data
-	for key, value := range dataMap {
-		pdf.Cell(40, 10, fmt.Sprintf("%s: %v", key, value))
-		pdf.Ln(10)
+	// Write each row as a block of fields, separated by a rule
+	pageWidth, _ := pdf.GetPageSize()
+	headers := reportHeaders(rows)
+	for _, row := range rows {
+		for _, key := range headers {
+			if value, ok := row[key]; ok {
+				pdf.Cell(40, 10, fmt.Sprintf("%s: %s", key, cellValue(value)))
+				pdf.Ln(10)
+			}
+		}
+		pdf.Line(10, pdf.GetY()+1, pageWidth-10, pdf.GetY()+1)
+		pdf.Ln(3)
 	}
 
 	return pdf.OutputFileAndClose(filename)